@@ -1,33 +1,35 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"os"
-	
+
 	"github.com/suparena/entitystore"
 	"github.com/suparena/entitystore/processor"
 )
 
-var (
-	versionFlag = flag.Bool("version", false, "Show version information")
-	vFlag       = flag.Bool("v", false, "Show version information (short)")
-)
-
 func main() {
-	// Parse flags early to catch version flag
-	flag.Parse()
-	
-	// Handle version flag
-	if *versionFlag || *vFlag {
-		info := entitystore.GetVersionInfo()
-		fmt.Printf("EntityStore indexmap-pps version %s\n", info.Version)
-		fmt.Printf("Git commit: %s\n", info.GitCommit)
-		fmt.Printf("Build date: %s\n", info.BuildDate)
-		fmt.Printf("Go version: %s\n", info.GoVersion)
-		os.Exit(0)
+	args := os.Args[1:]
+
+	// Subcommand: generate registrations from struct tags
+	if len(args) > 0 && args[0] == "tags" {
+		processor.TagsMain(args[1:])
+		return
 	}
-	
+
+	// Handle version flag before the processor parses its own flags
+	for _, arg := range args {
+		switch arg {
+		case "-version", "--version", "-v", "--v":
+			info := entitystore.GetVersionInfo()
+			fmt.Printf("EntityStore indexmap-pps version %s\n", info.Version)
+			fmt.Printf("Git commit: %s\n", info.GitCommit)
+			fmt.Printf("Build date: %s\n", info.BuildDate)
+			fmt.Printf("Go version: %s\n", info.GoVersion)
+			os.Exit(0)
+		}
+	}
+
 	// Run the processor
 	processor.Main()
-}
\ No newline at end of file
+}
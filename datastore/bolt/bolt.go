@@ -0,0 +1,481 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/items"
+	"github.com/suparena/entitystore/datastore/keys"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// Bucket layout. Each table is a top-level bucket holding the items, nested by
+// partition key and ordered by sort key, and one bucket per GSI whose entries are
+// ordered by the GSI sort key, then the table key:
+//
+//	items/<PK>/<SK>                     -> item as DynamoDB JSON
+//	indexes/<GSI>                       -> key attributes of the GSI as JSON
+//	index:<GSI>/<PK1>/<SK1>\x00<PK>\x00<SK> -> <PK>\x00<SK>
+//
+// Key values must not contain NUL bytes; writes of such items fail with a
+// ValidationError.
+var (
+	bucketItems   = []byte("items")
+	bucketIndexes = []byte("indexes")
+)
+
+const (
+	indexBucketPrefix = "index:"
+	keySeparator      = "\x00"
+)
+
+// BoltDataStore implements datastore.DataStore[T] on a bbolt database laid out like the
+// single DynamoDB table of the ddb package. Stores of different entity types can share
+// a table.
+type BoltDataStore[T any] struct {
+	db        *bbolt.DB
+	tableName string
+	codec     items.Codec[T]
+
+	mu      sync.Mutex
+	indexed map[string]bool // GSIs with an up-to-date index bucket
+}
+
+// StoreOption configures a BoltDataStore
+type StoreOption func(*storeOptions)
+
+type storeOptions struct {
+	registry *registry.Registry
+	fields   *keys.Resolver
+}
+
+// WithRegistry makes the datastore resolve index maps, entity types, hooks and GSIs
+// in 'r' instead of registry.Default()
+func WithRegistry(r *registry.Registry) StoreOption {
+	return func(o *storeOptions) {
+		o.registry = r
+	}
+}
+
+// WithFieldResolver sets how macro, update and lifecycle field names are matched to
+// struct fields, e.g. keys.NewResolver(keys.WithJSONTags())
+func WithFieldResolver(r *keys.Resolver) StoreOption {
+	return func(o *storeOptions) {
+		o.fields = r
+	}
+}
+
+// Open opens the bbolt database file at 'path', creating it if needed. It waits up to
+// a second for another process to release the file lock.
+func Open(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bbolt database: %w", err)
+	}
+	return db, nil
+}
+
+// NewBoltDataStore constructs a BoltDataStore for type T on table 'tableName' of 'db',
+// creating the table and building the GSIs used by the index map of T if needed
+func NewBoltDataStore[T any](db *bbolt.DB, tableName string, opts ...StoreOption) (*BoltDataStore[T], error) {
+	var options storeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	s := &BoltDataStore[T]{
+		db:        db,
+		tableName: tableName,
+		codec:     items.Codec[T]{Registry: options.registry, Fields: options.fields},
+		indexed:   make(map[string]bool),
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		table, err := tx.CreateBucketIfNotExists([]byte(tableName))
+		if err != nil {
+			return err
+		}
+		if _, err := table.CreateBucketIfNotExists(bucketItems); err != nil {
+			return err
+		}
+		if _, err := table.CreateBucketIfNotExists(bucketIndexes); err != nil {
+			return err
+		}
+		for _, index := range s.codec.Indexes() {
+			if err := s.buildIndex(tx, index); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create table %s: %w", tableName, err)
+	}
+	for _, index := range s.codec.Indexes() {
+		s.indexed[index.Name] = true
+	}
+	return s, nil
+}
+
+// Registry returns the registry the datastore resolves its registrations in,
+// registry.Default() unless set with WithRegistry
+func (s *BoltDataStore[T]) Registry() *registry.Registry {
+	return registry.OrDefault(s.codec.Registry)
+}
+
+func (s *BoltDataStore[T]) table(tx *bbolt.Tx) *bbolt.Bucket {
+	return tx.Bucket([]byte(s.tableName))
+}
+
+func indexBucketName(name string) []byte {
+	return []byte(indexBucketPrefix + name)
+}
+
+// ensureIndex builds the index bucket of a GSI unless it is up to date
+func (s *BoltDataStore[T]) ensureIndex(index items.Index) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexed[index.Name] {
+		return nil
+	}
+	if err := s.db.Update(func(tx *bbolt.Tx) error { return s.buildIndex(tx, index) }); err != nil {
+		return err
+	}
+	s.indexed[index.Name] = true
+	return nil
+}
+
+// buildIndex fills the index bucket of a GSI from the stored items, unless it exists
+// with the same key attributes
+func (s *BoltDataStore[T]) buildIndex(tx *bbolt.Tx, index items.Index) error {
+	table := s.table(tx)
+	def, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(table.Bucket(bucketIndexes).Get([]byte(index.Name)), def) {
+		return nil
+	}
+
+	name := indexBucketName(index.Name)
+	if table.Bucket(name) != nil {
+		if err := table.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	if _, err := table.CreateBucket(name); err != nil {
+		return fmt.Errorf("failed to create index %s: %w", index.Name, err)
+	}
+	err = table.Bucket(bucketItems).ForEachBucket(func(pk []byte) error {
+		return table.Bucket(bucketItems).Bucket(pk).ForEach(func(_, data []byte) error {
+			item, err := items.UnmarshalJSON(data)
+			if err != nil {
+				return err
+			}
+			return addIndexEntry(table, index, item)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build index %s: %w", index.Name, err)
+	}
+	return table.Bucket(bucketIndexes).Put([]byte(index.Name), def)
+}
+
+// indexes returns the GSIs with an index bucket in the table
+func (s *BoltDataStore[T]) indexes(tx *bbolt.Tx) ([]items.Index, error) {
+	var indexes []items.Index
+	err := s.table(tx).Bucket(bucketIndexes).ForEach(func(_, def []byte) error {
+		var index items.Index
+		if err := json.Unmarshal(def, &index); err != nil {
+			return err
+		}
+		indexes = append(indexes, index)
+		return nil
+	})
+	return indexes, err
+}
+
+// tableKey encodes the table key of an item as stored in index entries
+func tableKey(k items.Key) string {
+	return k.PK + keySeparator + k.SK
+}
+
+// parseTableKey decodes a table key encoded by tableKey
+func parseTableKey(b []byte) items.Key {
+	pk, sk, _ := strings.Cut(string(b), keySeparator)
+	return items.Key{PK: pk, SK: sk}
+}
+
+// positionKey encodes a position in the order of 'index' as a key of its buckets
+func positionKey(index items.Index, p items.Position) []byte {
+	switch {
+	case index.Name == "":
+		return []byte(p.Key.SK)
+	case index.SortKey == "":
+		return []byte(tableKey(p.Key))
+	default:
+		return []byte(p.SortKey + keySeparator + tableKey(p.Key))
+	}
+}
+
+// indexEntry returns the partition and entry key of 'item' in a GSI, reporting false
+// when the item lacks one of the key attributes and is not indexed
+func indexEntry(index items.Index, item map[string]types.AttributeValue) (string, []byte, bool) {
+	pk, ok := item[index.PartitionKey].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", nil, false
+	}
+	p := items.Position{Key: items.KeyOf(item)}
+	if index.SortKey != "" {
+		sk, ok := item[index.SortKey].(*types.AttributeValueMemberS)
+		if !ok {
+			return "", nil, false
+		}
+		p.SortKey = sk.Value
+	}
+	return pk.Value, positionKey(index, p), true
+}
+
+// checkKeys rejects an item whose table or GSI key values contain NUL bytes, which
+// separate the parts of index entries
+func checkKeys(item map[string]types.AttributeValue, indexes []items.Index) error {
+	for _, index := range append([]items.Index{items.TableIndex}, indexes...) {
+		for _, attr := range []string{index.PartitionKey, index.SortKey} {
+			if attr != "" && strings.Contains(items.StringAttr(item, attr), keySeparator) {
+				return eserrors.NewValidationError(attr, "key values must not contain NUL bytes")
+			}
+		}
+	}
+	return nil
+}
+
+func addIndexEntry(table *bbolt.Bucket, index items.Index, item map[string]types.AttributeValue) error {
+	pk, entry, ok := indexEntry(index, item)
+	if !ok {
+		return nil
+	}
+	partition, err := table.Bucket(indexBucketName(index.Name)).CreateBucketIfNotExists([]byte(pk))
+	if err != nil {
+		return err
+	}
+	return partition.Put(entry, []byte(tableKey(items.KeyOf(item))))
+}
+
+func removeIndexEntry(table *bbolt.Bucket, index items.Index, item map[string]types.AttributeValue) error {
+	pk, entry, ok := indexEntry(index, item)
+	if !ok {
+		return nil
+	}
+	return deleteKey(table.Bucket(indexBucketName(index.Name)), []byte(pk), entry)
+}
+
+// deleteKey deletes 'key' from the nested bucket 'partition' of 'parent', and the
+// nested bucket once it is empty
+func deleteKey(parent *bbolt.Bucket, partition, key []byte) error {
+	b := parent.Bucket(partition)
+	if b == nil {
+		return nil
+	}
+	if err := b.Delete(key); err != nil {
+		return err
+	}
+	if k, _ := b.Cursor().First(); k == nil {
+		return parent.DeleteBucket(partition)
+	}
+	return nil
+}
+
+// GetOne retrieves the entity whose key templates expand to 'key'
+func (s *BoltDataStore[T]) GetOne(ctx context.Context, key string) (*T, error) {
+	k, err := s.codec.StringKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand string key: %w", err)
+	}
+	item, err := s.read(k)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, s.codec.NotFound(key)
+	}
+	return s.codec.DecodeT(ctx, item)
+}
+
+// GetByKey retrieves an entity by its exact PK and SK values
+func (s *BoltDataStore[T]) GetByKey(ctx context.Context, pk, sk string) (*T, error) {
+	k := items.Key{PK: pk, SK: sk}
+	item, err := s.read(k)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, s.codec.NotFound(k.String())
+	}
+	return s.codec.DecodeT(ctx, item)
+}
+
+// read reads the raw item stored under 'k' in a read transaction
+func (s *BoltDataStore[T]) read(k items.Key) (map[string]types.AttributeValue, error) {
+	var item map[string]types.AttributeValue
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		item, err = s.get(tx, k)
+		return err
+	})
+	return item, err
+}
+
+// get reads the raw item stored under 'k', nil when there is none
+func (s *BoltDataStore[T]) get(tx *bbolt.Tx, k items.Key) (map[string]types.AttributeValue, error) {
+	partition := s.table(tx).Bucket(bucketItems).Bucket([]byte(k.PK))
+	if partition == nil {
+		return nil, nil
+	}
+	data := partition.Get([]byte(k.SK))
+	if data == nil {
+		return nil, nil
+	}
+	item, err := items.UnmarshalJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read item %s: %w", k, err)
+	}
+	return item, nil
+}
+
+// put stores 'item' under its table key in place of 'existing', the item currently
+// stored under that key or nil, and updates the GSI entries
+func (s *BoltDataStore[T]) put(tx *bbolt.Tx, existing, item map[string]types.AttributeValue) error {
+	indexes, err := s.indexes(tx)
+	if err != nil {
+		return err
+	}
+	if err := checkKeys(item, indexes); err != nil {
+		return err
+	}
+	data, err := items.MarshalJSON(item)
+	if err != nil {
+		return fmt.Errorf("failed to encode item: %w", err)
+	}
+	k := items.KeyOf(item)
+	table := s.table(tx)
+	partition, err := table.Bucket(bucketItems).CreateBucketIfNotExists([]byte(k.PK))
+	if err != nil {
+		return fmt.Errorf("failed to write item %s: %w", k, err)
+	}
+	if err := partition.Put([]byte(k.SK), data); err != nil {
+		return fmt.Errorf("failed to write item %s: %w", k, err)
+	}
+
+	for _, index := range indexes {
+		if existing != nil {
+			if err := removeIndexEntry(table, index, existing); err != nil {
+				return fmt.Errorf("failed to update index %s: %w", index.Name, err)
+			}
+		}
+		if err := addIndexEntry(table, index, item); err != nil {
+			return fmt.Errorf("failed to update index %s: %w", index.Name, err)
+		}
+	}
+	return nil
+}
+
+// remove deletes the stored 'item' and its GSI entries
+func (s *BoltDataStore[T]) remove(tx *bbolt.Tx, item map[string]types.AttributeValue) error {
+	k := items.KeyOf(item)
+	table := s.table(tx)
+	if err := deleteKey(table.Bucket(bucketItems), []byte(k.PK), []byte(k.SK)); err != nil {
+		return fmt.Errorf("failed to delete item %s: %w", k, err)
+	}
+	indexes, err := s.indexes(tx)
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := removeIndexEntry(table, index, item); err != nil {
+			return fmt.Errorf("failed to update index %s: %w", index.Name, err)
+		}
+	}
+	return nil
+}
+
+// Put stores 'entity' under the keys expanded from its index map, replacing any item
+// with the same key. With a @Version directive the stored version must match.
+func (s *BoltDataStore[T]) Put(ctx context.Context, entity T) error {
+	return s.write(ctx, entity, false)
+}
+
+// Create stores 'entity' only if no item with the same key exists yet.
+// It returns an AlreadyExistsError otherwise.
+func (s *BoltDataStore[T]) Create(ctx context.Context, entity T) error {
+	return s.write(ctx, entity, true)
+}
+
+func (s *BoltDataStore[T]) write(ctx context.Context, entity T, create bool) error {
+	w, err := s.codec.PrepareWrite(ctx, entity, create)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		existing, err := s.get(tx, w.Key)
+		if err != nil {
+			return err
+		}
+		if err := w.Check(existing); err != nil {
+			return err
+		}
+		return s.put(tx, existing, w.Item)
+	})
+}
+
+// UpdateWithCondition applies 'updates' to the item identified by 'keyInput' if
+// 'condition', a DynamoDB condition expression, holds for the stored item. The
+// @UpdatedAt and @Version index map directives are maintained automatically.
+func (s *BoltDataStore[T]) UpdateWithCondition(ctx context.Context, keyInput any, updates map[string]interface{}, condition string) error {
+	u, err := s.codec.PrepareUpdate(keyInput, updates, condition)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		existing, err := s.get(tx, u.Key)
+		if err != nil {
+			return err
+		}
+		item, err := u.Apply(existing)
+		if err != nil {
+			return err
+		}
+		return s.put(tx, existing, item)
+	})
+}
+
+// Delete removes the entity whose key templates expand to 'key'. Deleting a missing
+// entity is not an error.
+func (s *BoltDataStore[T]) Delete(ctx context.Context, key string) error {
+	k, err := s.codec.StringKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to expand string key: %w", err)
+	}
+	if err := s.codec.BeforeDelete(ctx, key, func() (map[string]types.AttributeValue, error) {
+		return s.read(k)
+	}); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		existing, err := s.get(tx, k)
+		if err != nil || existing == nil {
+			return err
+		}
+		return s.remove(tx, existing)
+	})
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// BoltTestTeam is stored in organization partitions and indexed by name on GSI1
+type BoltTestTeam struct {
+	Org  string
+	ID   string
+	Name string
+}
+
+func testRegistry() *registry.Registry {
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(BoltTestTeam{}), map[string]string{
+		"PK":     "ORG#{Org}",
+		"SK":     "TEAM#{ID}",
+		"GSI1PK": "NAME#{Name}",
+		"GSI1SK": "TEAM#{ID}",
+	})
+	reg.RegisterType("BoltTestTeam", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &BoltTestTeam{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	return reg
+}
+
+func newTestStore(t *testing.T, path string, reg *registry.Registry) (*bbolt.DB, *BoltDataStore[BoltTestTeam]) {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	teams, err := NewBoltDataStore[BoltTestTeam](db, "entities", WithRegistry(reg))
+	if err != nil {
+		t.Fatalf("NewBoltDataStore failed: %v", err)
+	}
+	return db, teams
+}
+
+// bucketKeys returns the keys and values of the bucket at 'path' in the entities
+// table, nil when it does not exist
+func bucketKeys(t *testing.T, db *bbolt.DB, path ...string) map[string]string {
+	t.Helper()
+	var res map[string]string
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("entities"))
+		for _, name := range path {
+			if b = b.Bucket([]byte(name)); b == nil {
+				return nil
+			}
+		}
+		res = make(map[string]string)
+		return b.ForEach(func(k, v []byte) error {
+			res[string(k)] = string(v)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+	return res
+}
+
+func TestBucketLayout(t *testing.T) {
+	ctx := context.Background()
+	db, teams := newTestStore(t, filepath.Join(t.TempDir(), "entities.db"), testRegistry())
+
+	if err := teams.Put(ctx, BoltTestTeam{Org: "1", ID: "1", Name: "Core"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got := bucketKeys(t, db, "items", "ORG#1"); len(got) != 1 || got["TEAM#1"] == "" {
+		t.Errorf("items/ORG#1 = %v, want the item under its sort key", got)
+	}
+	if got := bucketKeys(t, db, "indexes"); got["GSI1"] == "" {
+		t.Errorf("indexes = %v, want the definition of GSI1", got)
+	}
+	want := map[string]string{"TEAM#1\x00ORG#1\x00TEAM#1": "ORG#1\x00TEAM#1"}
+	if got := bucketKeys(t, db, "index:GSI1", "NAME#Core"); !reflect.DeepEqual(got, want) {
+		t.Errorf("index:GSI1/NAME#Core = %q, want %q", got, want)
+	}
+
+	// Renaming the team moves its index entry and drops the emptied partition
+	if err := teams.Put(ctx, BoltTestTeam{Org: "1", ID: "1", Name: "Tools"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got := bucketKeys(t, db, "index:GSI1", "NAME#Core"); got != nil {
+		t.Errorf("index:GSI1/NAME#Core = %q after the rename, want no bucket", got)
+	}
+	if got := bucketKeys(t, db, "index:GSI1", "NAME#Tools"); len(got) != 1 {
+		t.Errorf("index:GSI1/NAME#Tools = %q, want one entry", got)
+	}
+
+	if err := teams.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got := bucketKeys(t, db, "items", "ORG#1"); got != nil {
+		t.Errorf("items/ORG#1 = %v after Delete, want no bucket", got)
+	}
+	if got := bucketKeys(t, db, "index:GSI1", "NAME#Tools"); got != nil {
+		t.Errorf("index:GSI1/NAME#Tools = %q after Delete, want no bucket", got)
+	}
+}
+
+func TestNULInKeysRejected(t *testing.T) {
+	ctx := context.Background()
+	db, teams := newTestStore(t, filepath.Join(t.TempDir(), "entities.db"), testRegistry())
+
+	for _, team := range []BoltTestTeam{
+		{Org: "1", ID: "t\x001", Name: "Core"},
+		{Org: "1", ID: "t1", Name: "Co\x00re"},
+	} {
+		if err := teams.Put(ctx, team); !eserrors.IsValidationError(err) {
+			t.Errorf("Put(%+q) = %v, want a ValidationError", team, err)
+		}
+	}
+	if got := bucketKeys(t, db, "items", "ORG#1"); got != nil {
+		t.Errorf("items/ORG#1 = %v, want nothing written", got)
+	}
+}
+
+func TestIndexBuiltFromExistingItems(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "entities.db")
+
+	reg := testRegistry()
+	reg.RegisterIndexMap(reflect.TypeOf(BoltTestTeam{}), map[string]string{
+		"PK":         "ORG#{Org}",
+		"SK":         "TEAM#{ID}",
+		"OrgIndexPK": "TEAMS#{Org}",
+		"OrgIndexSK": "{Name}",
+	})
+	db, teams := newTestStore(t, path, reg)
+	for _, team := range []BoltTestTeam{{Org: "1", ID: "t1", Name: "Platform"}, {Org: "1", ID: "t2", Name: "Core"}} {
+		if err := teams.Put(ctx, team); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	db.Close()
+
+	// A GSI registered later is built from the stored items
+	reg.RegisterGSI("GSI2", "OrgIndexPK", "OrgIndexSK")
+	_, teams = newTestStore(t, path, reg)
+
+	query := func() []string {
+		results, err := teams.Query(ctx, &storagemodels.QueryParams{
+			KeyConditionExpression: "OrgIndexPK = :pk",
+			IndexName:              aws.String("GSI2"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: "TEAMS#1"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		var names []string
+		for _, r := range results {
+			names = append(names, r.(*BoltTestTeam).Name)
+		}
+		return names
+	}
+	if got, want := query(), []string{"Core", "Platform"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GSI2 Query = %v, want %v", got, want)
+	}
+
+	// Later writes maintain the index
+	if err := teams.Put(ctx, BoltTestTeam{Org: "1", ID: "t2", Name: "Tools"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got, want := query(), []string{"Platform", "Tools"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GSI2 Query after update = %v, want %v", got, want)
+	}
+}
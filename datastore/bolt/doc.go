@@ -0,0 +1,34 @@
+/*
+Package bolt provides an embedded bbolt implementation of the DataStore interface for
+CLI tools, desktop utilities and single-node deployments, without cgo.
+
+Items are kept in one bucket per partition key, ordered by sort key, and every GSI used
+by an index map gets index buckets maintained in the write transaction.
+
+	db, err := bolt.Open("entities.db")
+	if err != nil {
+	    return err
+	}
+	defer db.Close()
+	users, err := bolt.NewBoltDataStore[User](db, "entities")
+
+Queries take the same QueryParams as DynamoDB and are served by range scans. Key
+conditions support equality on the partition key and =, <, <=, >, >=, BETWEEN and
+begins_with on the sort key; filter expressions support the DynamoDB condition syntax:
+
+	results, err := users.Query(ctx, &storagemodels.QueryParams{
+	    KeyConditionExpression: "PK1 = :pk AND begins_with(SK1, :prefix)",
+	    FilterExpression:       aws.String("Status = :status"),
+	    IndexName:              aws.String("GSI1"),
+	    ExpressionAttributeValues: map[string]types.AttributeValue{
+	        ":pk":     &types.AttributeValueMemberS{Value: "ORG#1"},
+	        ":prefix": &types.AttributeValueMemberS{Value: "USER#"},
+	        ":status": &types.AttributeValueMemberS{Value: "active"},
+	    },
+	})
+
+Writes, including the checks of Create, @Version and UpdateWithCondition conditions, run
+in a single bbolt write transaction. Key values must not contain NUL bytes: writes of
+such items fail with a ValidationError.
+*/
+package bolt
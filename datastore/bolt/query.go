@@ -0,0 +1,184 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/expression"
+	"github.com/suparena/entitystore/datastore/internal/items"
+	"github.com/suparena/entitystore/storagemodels"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// Query runs the key condition of 'params' on the table or GSI and returns the matching
+// items, each unmarshaled to the type registered for its EntityType. Like a single
+// DynamoDB Query call, Limit caps the items read before the filter expression is
+// applied, and ExclusiveStartKey resumes after a previous page.
+func (s *BoltDataStore[T]) Query(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error) {
+	q, err := s.codec.PlanQuery(params)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	page, _, err := s.queryPage(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	var results []interface{}
+	for _, item := range page {
+		obj, err := s.codec.Decode(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, obj)
+	}
+	return results, nil
+}
+
+// queryPage reads one page of 'q' with a range scan of the partition bucket and
+// applies the filter. It returns the matching items and the LastEvaluatedKey, nil when
+// the page is the last one.
+func (s *BoltDataStore[T]) queryPage(ctx context.Context, q items.Query) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+	if q.Index.Name != "" {
+		if err := s.ensureIndex(q.Index); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var read []map[string]types.AttributeValue
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		partition := s.table(tx).Bucket(bucketItems)
+		if q.Index.Name != "" {
+			partition = s.table(tx).Bucket(indexBucketName(q.Index.Name))
+		}
+		partition = partition.Bucket([]byte(q.PartitionValue))
+		if partition == nil {
+			return nil
+		}
+
+		start, hasStart := q.Start()
+		inRange := false
+		c := partition.Cursor()
+		for k, v := seek(c, q.Forward, seekKey(q)); k != nil; k, v = step(c, q.Forward) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item, err := s.entryItem(tx, q, v)
+			if err != nil {
+				return err
+			}
+			if item == nil {
+				continue
+			}
+			if hasStart {
+				cmp := q.PositionOf(item).Compare(start)
+				if (q.Forward && cmp <= 0) || (!q.Forward && cmp >= 0) {
+					continue
+				}
+			}
+			// The sort key condition is a range of the scan order
+			if q.SortKey != nil && !q.SortKey.Matches(item[q.SortKey.Attribute]) {
+				if inRange {
+					break
+				}
+				continue
+			}
+			inRange = true
+			read = append(read, item)
+			if q.Limit > 0 && len(read) == q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lastKey map[string]types.AttributeValue
+	if q.Limit > 0 && len(read) == q.Limit {
+		lastKey = q.LastKey(read[len(read)-1])
+	}
+	matched := read[:0]
+	for _, item := range read {
+		ok, err := q.Matches(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+	return matched, lastKey, nil
+}
+
+// entryItem returns the item of a partition bucket entry: the item itself for the
+// table, the item under the stored table key for a GSI
+func (s *BoltDataStore[T]) entryItem(tx *bbolt.Tx, q items.Query, v []byte) (map[string]types.AttributeValue, error) {
+	if q.Index.Name == "" {
+		return items.UnmarshalJSON(v)
+	}
+	return s.get(tx, parseTableKey(v))
+}
+
+// seekKey returns where the scan of 'q' starts: the tighter of the sort key condition
+// bound and the ExclusiveStartKey in the scan direction, nil for the first or last key.
+// Bounds ending in 0xff, which never occurs in UTF-8, follow every key with the prefix.
+func seekKey(q items.Query) []byte {
+	var bound []byte
+	if q.SortKey != nil {
+		values := q.SortValues()
+		if q.Forward {
+			switch q.SortKey.Op {
+			case expression.OpEqual, expression.OpGreater, expression.OpGreaterEqual, expression.OpBetween, expression.OpBeginsWith:
+				bound = []byte(values[0])
+			}
+		} else {
+			switch q.SortKey.Op {
+			case expression.OpEqual, expression.OpLessEqual, expression.OpBeginsWith:
+				bound = []byte(values[0] + "\xff")
+			case expression.OpLess:
+				bound = []byte(values[0])
+			case expression.OpBetween:
+				bound = []byte(values[1] + "\xff")
+			}
+		}
+	}
+	if start, ok := q.Start(); ok {
+		startKey := positionKey(q.Index, start)
+		if bound == nil || (q.Forward && bytes.Compare(startKey, bound) > 0) || (!q.Forward && bytes.Compare(startKey, bound) < 0) {
+			bound = startKey
+		}
+	}
+	return bound
+}
+
+// seek positions 'c' on the first key of a scan. Forward scans start at the first key
+// at or after 'bound', backward scans at the last key before it.
+func seek(c *bbolt.Cursor, forward bool, bound []byte) ([]byte, []byte) {
+	switch {
+	case forward && bound == nil:
+		return c.First()
+	case forward:
+		return c.Seek(bound)
+	case bound == nil:
+		return c.Last()
+	}
+	if k, _ := c.Seek(bound); k == nil {
+		return c.Last()
+	}
+	return c.Prev()
+}
+
+func step(c *bbolt.Cursor, forward bool) ([]byte, []byte) {
+	if forward {
+		return c.Next()
+	}
+	return c.Prev()
+}
@@ -0,0 +1,402 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/storagemodels"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache stores the entries of a CachedDataStore. LRUCache is the in-memory
+// implementation; a shared cache, e.g. Redis, can implement it to serve several
+// processes. Implementations must be safe for concurrent use.
+type Cache[T any] interface {
+	// Get returns the entry of 'key' unless it is missing or expired
+	Get(key string) (CacheEntry[T], bool)
+	// Set stores the entry of 'key' for 'ttl'
+	Set(key string, entry CacheEntry[T], ttl time.Duration)
+	// Delete removes the entries of 'keys'
+	Delete(keys ...string)
+	// Purge removes all entries
+	Purge()
+}
+
+// CacheEntry is a cached read: an entity, or the NotFoundError of a missing one
+type CacheEntry[T any] struct {
+	Entity   *T
+	NotFound *eserrors.NotFoundError
+}
+
+// CacheKeyer is implemented by entities naming the cached reads that return them, with
+// GetOneCacheKey and GetByKeyCacheKey. Writes of such entities through a
+// CachedDataStore invalidate only these reads; writes of other entities purge the
+// cache unless WithCacheKeyFunc names their keys.
+type CacheKeyer interface {
+	CacheKeys() []string
+}
+
+// GetOneCacheKey returns the cache key of GetOne(key)
+func GetOneCacheKey(key string) string {
+	return OpGetOne + ":" + key
+}
+
+// GetByKeyCacheKey returns the cache key of GetByKey(pk, sk)
+func GetByKeyCacheKey(pk, sk string) string {
+	return OpGetByKey + ":" + pk + "\x00" + sk
+}
+
+// CacheStats are the counters of a CachedDataStore. Every read is counted once in
+// Hits, NegativeHits, Misses or Shared.
+type CacheStats struct {
+	// Hits are reads returning a cached entity
+	Hits uint64
+	// NegativeHits are reads returning a cached NotFoundError
+	NegativeHits uint64
+	// Misses are reads loaded from the datastore
+	Misses uint64
+	// Shared are missed reads that waited for a concurrent load of the same key
+	Shared uint64
+	// Invalidations are cache keys invalidated by writes
+	Invalidations uint64
+	// Purges are writes, or Purge calls, that cleared the whole cache
+	Purges uint64
+}
+
+// HitRatio returns the share of reads served from the cache, 0 before any read
+func (s CacheStats) HitRatio() float64 {
+	reads := s.Hits + s.NegativeHits + s.Misses + s.Shared
+	if reads == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.NegativeHits) / float64(reads)
+}
+
+// CacheOption configures a CachedDataStore
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+	keys        any
+}
+
+// Default cache settings
+const (
+	DefaultCacheTTL         = time.Minute
+	DefaultNegativeCacheTTL = 5 * time.Second
+	DefaultCacheSize        = 10000
+)
+
+// WithCacheTTL sets how long entities are cached, DefaultCacheTTL by default
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithNegativeCacheTTL sets how long NotFoundErrors are cached, DefaultNegativeCacheTTL
+// by default. Zero disables negative caching.
+func WithNegativeCacheTTL(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithCacheSize sets the number of entries of the LRUCache created by
+// NewCachedDataStore, DefaultCacheSize by default
+func WithCacheSize(size int) CacheOption {
+	return func(o *cacheOptions) {
+		o.size = size
+	}
+}
+
+// WithCacheKeyFunc names the cached reads returning an entity, as CacheKeyer does, so
+// that writes of entities not implementing it invalidate only these reads. It takes
+// precedence over CacheKeyer. The CachedDataStore constructors panic when T is not the
+// type they store.
+func WithCacheKeyFunc[T any](fn func(T) []string) CacheOption {
+	return func(o *cacheOptions) {
+		o.keys = fn
+	}
+}
+
+// CachedDataStore is a read-through cache of the GetOne and GetByKey results of a
+// DataStore, including NotFoundErrors. Concurrent misses of the same key share one
+// load. Put, UpdateWithCondition and Delete through the CachedDataStore invalidate the
+// reads they affect: the keys named by WithCacheKeyFunc or CacheKeyer entities, or the
+// GetOne key of a string key, falling back to purging the cache. Writes made elsewhere,
+// including by other processes sharing the Cache, are only seen once the entries expire
+// or after Invalidate or Purge. Query and Stream are not cached.
+//
+// Entities are returned as shallow copies of the cached ones: callers must not modify
+// the maps, slices or pointers they share.
+//
+//	configs := datastore.NewCachedDataStore[Config](store, datastore.WithCacheTTL(30*time.Second))
+//	cfg, err := configs.GetOne(ctx, "rating")
+//	log.Printf("hit ratio %.2f", configs.Stats().HitRatio())
+type CachedDataStore[T any] struct {
+	next  DataStore[T]
+	cache Cache[T]
+	opts  cacheOptions
+	keys  func(T) []string
+	loads singleflight.Group
+
+	// mu orders the cache updates of loads against invalidations, so that a load
+	// started before a write never caches what it read
+	mu         sync.RWMutex
+	generation uint64
+	// byKey reports whether GetByKey results were cached since the last purge; they
+	// cannot be found from the keys of GetOne, Delete and string key updates
+	byKey atomic.Bool
+
+	hits, negativeHits, misses, shared, invalidations, purges atomic.Uint64
+}
+
+// NewCachedDataStore returns a CachedDataStore of 'ds' using an LRUCache
+func NewCachedDataStore[T any](ds DataStore[T], opts ...CacheOption) *CachedDataStore[T] {
+	o := newCacheOptions(opts)
+	return &CachedDataStore[T]{next: ds, cache: NewLRUCache[T](o.size), opts: o, keys: cacheKeyFunc[T](o)}
+}
+
+// NewCachedDataStoreWithCache returns a CachedDataStore of 'ds' using 'cache'
+func NewCachedDataStoreWithCache[T any](ds DataStore[T], cache Cache[T], opts ...CacheOption) *CachedDataStore[T] {
+	o := newCacheOptions(opts)
+	return &CachedDataStore[T]{next: ds, cache: cache, opts: o, keys: cacheKeyFunc[T](o)}
+}
+
+func newCacheOptions(opts []CacheOption) cacheOptions {
+	o := cacheOptions{ttl: DefaultCacheTTL, negativeTTL: DefaultNegativeCacheTTL, size: DefaultCacheSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func cacheKeyFunc[T any](o cacheOptions) func(T) []string {
+	if o.keys == nil {
+		return nil
+	}
+	fn, ok := o.keys.(func(T) []string)
+	if !ok {
+		panic(fmt.Sprintf("datastore: WithCacheKeyFunc of %T used for a CachedDataStore of %s", o.keys, reflect.TypeOf((*T)(nil)).Elem()))
+	}
+	return fn
+}
+
+// Unwrap returns the cached DataStore
+func (c *CachedDataStore[T]) Unwrap() DataStore[T] {
+	return c.next
+}
+
+// Stats returns the counters of the cache
+func (c *CachedDataStore[T]) Stats() CacheStats {
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		NegativeHits:  c.negativeHits.Load(),
+		Misses:        c.misses.Load(),
+		Shared:        c.shared.Load(),
+		Invalidations: c.invalidations.Load(),
+		Purges:        c.purges.Load(),
+	}
+}
+
+// Invalidate removes the entries of 'keys', e.g. after writes made elsewhere
+func (c *CachedDataStore[T]) Invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.cache.Delete(keys...)
+	c.invalidations.Add(uint64(len(keys)))
+}
+
+// Purge removes all entries
+func (c *CachedDataStore[T]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.cache.Purge()
+	c.byKey.Store(false)
+	c.purges.Add(1)
+}
+
+func (c *CachedDataStore[T]) GetOne(ctx context.Context, key string) (*T, error) {
+	return c.get(ctx, GetOneCacheKey(key), key, false, func(ctx context.Context) (*T, error) {
+		return c.next.GetOne(ctx, key)
+	})
+}
+
+func (c *CachedDataStore[T]) GetByKey(ctx context.Context, pk, sk string) (*T, error) {
+	return c.get(ctx, GetByKeyCacheKey(pk, sk), pk+"/"+sk, true, func(ctx context.Context) (*T, error) {
+		return c.next.GetByKey(ctx, pk, sk)
+	})
+}
+
+func (c *CachedDataStore[T]) Put(ctx context.Context, entity T) error {
+	err := c.next.Put(ctx, entity)
+	c.invalidateEntity(&entity)
+	return err
+}
+
+func (c *CachedDataStore[T]) UpdateWithCondition(ctx context.Context, keyInput any, updates map[string]interface{}, condition string) error {
+	err := c.next.UpdateWithCondition(ctx, keyInput, updates, condition)
+	switch k := keyInput.(type) {
+	case string:
+		c.invalidateKey(k)
+	case T:
+		c.invalidateEntity(&k)
+	case *T:
+		c.invalidateEntity(k)
+	default:
+		c.Purge()
+	}
+	return err
+}
+
+func (c *CachedDataStore[T]) Query(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error) {
+	return c.next.Query(ctx, params)
+}
+
+func (c *CachedDataStore[T]) Stream(ctx context.Context, params *storagemodels.QueryParams, opts ...storagemodels.StreamOption) <-chan storagemodels.StreamResult[T] {
+	return c.next.Stream(ctx, params, opts...)
+}
+
+func (c *CachedDataStore[T]) Delete(ctx context.Context, key string) error {
+	err := c.next.Delete(ctx, key)
+	c.invalidateKey(key)
+	return err
+}
+
+// get returns the cached read of 'cacheKey', or loads it once for all concurrent
+// callers. The load is not canceled with the context of the caller that started it,
+// as other callers may wait for it.
+func (c *CachedDataStore[T]) get(ctx context.Context, cacheKey, key string, byKey bool, load func(context.Context) (*T, error)) (*T, error) {
+	if e, ok := c.cache.Get(cacheKey); ok {
+		switch {
+		case e.NotFound != nil:
+			c.negativeHits.Add(1)
+			return nil, e.NotFound
+		case e.Entity != nil:
+			c.hits.Add(1)
+			return copyEntity(e.Entity), nil
+		}
+	}
+
+	c.mu.RLock()
+	generation := c.generation
+	c.mu.RUnlock()
+
+	// Loads started before a write are not shared with reads started after it
+	var loaded bool
+	ch := c.loads.DoChan(strconv.FormatUint(generation, 10)+"/"+cacheKey, func() (interface{}, error) {
+		loaded = true
+		entity, err := load(context.WithoutCancel(ctx))
+		c.store(generation, cacheKey, key, byKey, entity, err)
+		return entity, err
+	})
+	select {
+	case <-ctx.Done():
+		c.misses.Add(1)
+		return nil, ctx.Err()
+	case res := <-ch:
+		if loaded {
+			c.misses.Add(1)
+		} else {
+			c.shared.Add(1)
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return copyEntity(res.Val.(*T)), nil
+	}
+}
+
+// store caches the result of a load unless a write happened since 'generation'
+func (c *CachedDataStore[T]) store(generation uint64, cacheKey, key string, byKey bool, entity *T, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.generation != generation {
+		return
+	}
+	switch {
+	case err == nil && entity != nil:
+		c.cache.Set(cacheKey, CacheEntry[T]{Entity: entity}, c.opts.ttl)
+	case err != nil && c.opts.negativeTTL > 0 && eserrors.IsNotFound(err):
+		var notFound *eserrors.NotFoundError
+		if !errors.As(err, &notFound) {
+			notFound = &eserrors.NotFoundError{Type: reflect.TypeOf((*T)(nil)).Elem().Name(), Key: key}
+		}
+		c.cache.Set(cacheKey, CacheEntry[T]{NotFound: notFound}, c.opts.negativeTTL)
+	default:
+		return
+	}
+	if byKey {
+		c.byKey.Store(true)
+	}
+}
+
+// invalidateEntity invalidates the reads of a written entity
+func (c *CachedDataStore[T]) invalidateEntity(entity *T) {
+	if entity == nil {
+		c.Purge()
+		return
+	}
+	if keys, ok := c.cacheKeys(entity); ok {
+		c.Invalidate(keys...)
+		return
+	}
+	c.Purge()
+}
+
+// invalidateKey invalidates the reads of the entity written by string key: its GetOne
+// read, and the reads named by the cached entity if their keys are known
+func (c *CachedDataStore[T]) invalidateKey(key string) {
+	cacheKey := GetOneCacheKey(key)
+	if e, ok := c.cache.Get(cacheKey); ok && e.Entity != nil {
+		if keys, ok := c.cacheKeys(e.Entity); ok {
+			if !slices.Contains(keys, cacheKey) {
+				keys = append(keys, cacheKey)
+			}
+			c.Invalidate(keys...)
+			return
+		}
+	}
+	if c.byKey.Load() {
+		c.Purge()
+		return
+	}
+	c.Invalidate(cacheKey)
+}
+
+// cacheKeys returns the keys of the reads of 'entity', named by WithCacheKeyFunc or
+// CacheKeyer
+func (c *CachedDataStore[T]) cacheKeys(entity *T) ([]string, bool) {
+	if c.keys != nil {
+		return c.keys(*entity), true
+	}
+	if k, ok := any(entity).(CacheKeyer); ok {
+		return k.CacheKeys(), true
+	}
+	return nil, false
+}
+
+func copyEntity[T any](entity *T) *T {
+	if entity == nil {
+		return nil
+	}
+	res := *entity
+	return &res
+}
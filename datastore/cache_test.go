@@ -0,0 +1,306 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/suparena/entitystore/datastore"
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/datastore/mock"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+)
+
+// profile names the reads returning it, being stored under "PK|SK"
+type profile struct {
+	PK, SK string
+	Name   string
+}
+
+func (p profile) CacheKeys() []string {
+	return []string{datastore.GetOneCacheKey(p.PK + "|" + p.SK), datastore.GetByKeyCacheKey(p.PK, p.SK)}
+}
+
+func newProfiles() *mock.DataStore[profile] {
+	return mock.New[profile]().WithGetKeyFunc(func(p profile) string { return p.PK + "|" + p.SK })
+}
+
+func TestCachedDataStoreConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, reg *registry.Registry) conformance.Stores {
+		table := mock.NewTable()
+		items := mock.New[conformance.Item]().WithRegistry(reg).WithTable(table)
+		cached := datastore.NewCachedDataStore[conformance.Item](items)
+		return conformance.Stores{
+			Items: cached,
+			Notes: datastore.NewCachedDataStore[conformance.Note](mock.New[conformance.Note]().WithRegistry(reg).WithTable(table)),
+			Create: func(ctx context.Context, item conformance.Item) error {
+				// Create bypasses the cache
+				defer cached.Purge()
+				return items.Create(ctx, item)
+			},
+		}
+	})
+}
+
+func TestCachedDataStore(t *testing.T) {
+	ctx := context.Background()
+	inner := newWidgets()
+	store := datastore.NewCachedDataStore[widget](inner)
+
+	if err := store.Put(ctx, widget{ID: "a", Name: "first"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		w, err := store.GetOne(ctx, "a")
+		if err != nil || w.Name != "first" {
+			t.Fatalf("GetOne = %v, %v", w, err)
+		}
+		// Callers get copies
+		w.Name = "changed"
+	}
+	inner.AssertNumberOfCalls(t, "GetOne", 1)
+
+	// Missing entities are cached as NotFoundErrors
+	for i := 0; i < 2; i++ {
+		if _, err := store.GetOne(ctx, "missing"); !eserrors.IsNotFound(err) {
+			t.Fatalf("GetOne of a missing entity returned %v", err)
+		}
+	}
+	inner.AssertNumberOfCalls(t, "GetOne", 2)
+
+	// Writes through the cache invalidate it
+	if err := store.Put(ctx, widget{ID: "missing", Name: "created"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if w, err := store.GetOne(ctx, "missing"); err != nil || w.Name != "created" {
+		t.Fatalf("GetOne after Put = %v, %v", w, err)
+	}
+	if err := store.UpdateWithCondition(ctx, "a", map[string]interface{}{"Name": "ignored"}, ""); err != nil {
+		t.Fatalf("UpdateWithCondition failed: %v", err)
+	}
+	// The mock does not apply updates without an index map, but the entity is reloaded
+	if _, err := store.GetOne(ctx, "a"); err != nil {
+		t.Fatalf("GetOne after UpdateWithCondition failed: %v", err)
+	}
+	inner.AssertNumberOfCalls(t, "GetOne", 4)
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.GetOne(ctx, "a"); !eserrors.IsNotFound(err) {
+		t.Fatalf("GetOne after Delete returned %v", err)
+	}
+
+	stats := store.Stats()
+	if stats.Hits != 2 || stats.NegativeHits != 1 || stats.Misses != 5 || stats.Shared != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if stats.Purges != 2 || stats.Invalidations != 2 {
+		t.Errorf("stats = %+v, want a purge per Put of a widget and 2 invalidated keys", stats)
+	}
+	if ratio := stats.HitRatio(); ratio != 3.0/8 {
+		t.Errorf("hit ratio = %v, want 3/8", ratio)
+	}
+}
+
+func TestCachedDataStoreOptions(t *testing.T) {
+	ctx := context.Background()
+	inner := newWidgets()
+	inner.SetData(map[string]widget{"a": {ID: "a"}, "b": {ID: "b"}})
+	store := datastore.NewCachedDataStore[widget](inner, datastore.WithCacheSize(1), datastore.WithNegativeCacheTTL(0))
+
+	for _, key := range []string{"a", "b", "a", "missing", "missing"} {
+		_, _ = store.GetOne(ctx, key)
+	}
+	// "b" evicted "a", and NotFoundErrors are not cached
+	inner.AssertNumberOfCalls(t, "GetOne", 5)
+
+	expiring := datastore.NewCachedDataStore[widget](inner, datastore.WithCacheTTL(time.Millisecond))
+	_, _ = expiring.GetOne(ctx, "a")
+	time.Sleep(5 * time.Millisecond)
+	_, _ = expiring.GetOne(ctx, "a")
+	if stats := expiring.Stats(); stats.Misses != 2 || stats.Hits != 0 {
+		t.Errorf("stats after expiry = %+v, want 2 misses", stats)
+	}
+}
+
+func TestCachedDataStoreSingleflight(t *testing.T) {
+	ctx := context.Background()
+	inner := newWidgets().WithFault(mock.Fault{Method: "GetOne", Latency: 50 * time.Millisecond})
+	inner.SetData(map[string]widget{"a": {ID: "a", Name: "first"}})
+	store := datastore.NewCachedDataStore[widget](inner)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w, err := store.GetOne(ctx, "a"); err != nil || w.Name != "first" {
+				t.Errorf("GetOne = %v, %v", w, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	inner.AssertNumberOfCalls(t, "GetOne", 1)
+	if stats := store.Stats(); stats.Misses != 1 || stats.Shared != 9 {
+		t.Errorf("stats = %+v, want 1 miss and 9 shared", stats)
+	}
+}
+
+func TestCachedDataStoreWriteDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	// The first GetOne signals its start and waits for the Put before reading
+	started, release := make(chan struct{}), make(chan struct{})
+	inner := newWidgets().WithFault(mock.Fault{Method: "GetOne", Nth: 1, Hook: func() {
+		close(started)
+		<-release
+	}})
+	inner.SetData(map[string]widget{"a": {ID: "a", Name: "first"}})
+	store := datastore.NewCachedDataStore[widget](inner)
+
+	loaded := make(chan struct{})
+	go func() {
+		defer close(loaded)
+		_, _ = store.GetOne(ctx, "a")
+	}()
+	<-started
+	if err := store.Put(ctx, widget{ID: "a", Name: "second"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	close(release)
+	<-loaded
+
+	// The load started before the Put must not have cached what it read
+	if w, err := store.GetOne(ctx, "a"); err != nil || w.Name != "second" {
+		t.Fatalf("GetOne = %v, %v; want the written entity", w, err)
+	}
+	inner.AssertNumberOfCalls(t, "GetOne", 2)
+}
+
+func TestCachedDataStoreCacheKeyer(t *testing.T) {
+	ctx := context.Background()
+	inner := newProfiles()
+	inner.SetData(map[string]profile{
+		"USER#1|PROFILE": {PK: "USER#1", SK: "PROFILE", Name: "one"},
+		"USER#2|PROFILE": {PK: "USER#2", SK: "PROFILE", Name: "two"},
+	})
+	store := datastore.NewCachedDataStore[profile](inner)
+
+	for _, pk := range []string{"USER#1", "USER#2"} {
+		if _, err := store.GetByKey(ctx, pk, "PROFILE"); err != nil {
+			t.Fatalf("GetByKey failed: %v", err)
+		}
+		if _, err := store.GetOne(ctx, pk+"|PROFILE"); err != nil {
+			t.Fatalf("GetOne failed: %v", err)
+		}
+	}
+
+	// Writes invalidate the keys named by the entity only
+	if err := store.Put(ctx, profile{PK: "USER#1", SK: "PROFILE", Name: "renamed"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if p, err := store.GetByKey(ctx, "USER#1", "PROFILE"); err != nil || p.Name != "renamed" {
+		t.Fatalf("GetByKey after Put = %v, %v", p, err)
+	}
+	if _, err := store.GetOne(ctx, "USER#1|PROFILE"); err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+	// Deleting by key invalidates the keys named by the cached entity
+	if err := store.Delete(ctx, "USER#1|PROFILE"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.GetByKey(ctx, "USER#1", "PROFILE"); !eserrors.IsNotFound(err) {
+		t.Fatalf("GetByKey after Delete returned %v", err)
+	}
+	if _, err := store.GetByKey(ctx, "USER#2", "PROFILE"); err != nil {
+		t.Fatalf("GetByKey failed: %v", err)
+	}
+
+	stats := store.Stats()
+	if stats.Purges != 0 || stats.Invalidations != 4 {
+		t.Errorf("stats = %+v, want 4 invalidated keys and no purge", stats)
+	}
+	if stats.Hits != 1 {
+		t.Errorf("hits = %d, want the unchanged profile read from the cache", stats.Hits)
+	}
+}
+
+func TestCachedDataStoreCacheKeyFunc(t *testing.T) {
+	ctx := context.Background()
+	inner := newWidgets()
+	inner.SetData(map[string]widget{"a": {ID: "a", Name: "first"}, "b": {ID: "b", Name: "other"}})
+	store := datastore.NewCachedDataStore[widget](inner, datastore.WithCacheKeyFunc(func(w widget) []string {
+		return []string{datastore.GetOneCacheKey(w.ID)}
+	}))
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := store.GetOne(ctx, key); err != nil {
+			t.Fatalf("GetOne failed: %v", err)
+		}
+	}
+	if err := store.Put(ctx, widget{ID: "a", Name: "second"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if w, err := store.GetOne(ctx, "a"); err != nil || w.Name != "second" {
+		t.Fatalf("GetOne after Put = %v, %v", w, err)
+	}
+	if _, err := store.GetOne(ctx, "b"); err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+
+	stats := store.Stats()
+	if stats.Purges != 0 || stats.Invalidations != 1 {
+		t.Errorf("stats = %+v, want 1 invalidated key and no purge", stats)
+	}
+	if stats.Hits != 1 {
+		t.Errorf("hits = %d, want the unchanged widget read from the cache", stats.Hits)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewCachedDataStore with a key function of another type did not panic")
+		}
+	}()
+	datastore.NewCachedDataStore[widget](inner, datastore.WithCacheKeyFunc(func(p profile) []string { return nil }))
+}
+
+func TestLRUCache(t *testing.T) {
+	cache := datastore.NewLRUCache[widget](2)
+	entry := func(id string) datastore.CacheEntry[widget] {
+		return datastore.CacheEntry[widget]{Entity: &widget{ID: id}}
+	}
+
+	cache.Set("a", entry("a"), time.Minute)
+	cache.Set("b", entry("b"), time.Minute)
+	cache.Get("a")
+	cache.Set("c", entry("c"), time.Minute)
+	if _, ok := cache.Get("b"); ok {
+		t.Error("the least recently used entry was not evicted")
+	}
+	if e, ok := cache.Get("a"); !ok || e.Entity.ID != "a" {
+		t.Errorf("Get(a) = %v, %v", e, ok)
+	}
+	if cache.Len() != 2 || cache.Evictions() != 1 {
+		t.Errorf("len = %d, evictions = %d; want 2 and 1", cache.Len(), cache.Evictions())
+	}
+
+	cache.Set("expired", entry("expired"), 0)
+	if _, ok := cache.Get("expired"); ok {
+		t.Error("an expired entry was returned")
+	}
+
+	cache.Delete("a")
+	if _, ok := cache.Get("a"); ok {
+		t.Error("a deleted entry was returned")
+	}
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("len after Purge = %d", cache.Len())
+	}
+}
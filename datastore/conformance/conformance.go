@@ -0,0 +1,214 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore"
+	"github.com/suparena/entitystore/registry"
+)
+
+// Item is the main entity of the suite. Its table key is derived from ID alone, so that
+// GetOne and Delete can address it, and GSI1 groups it with Notes by Group.
+type Item struct {
+	ID        string
+	Group     string
+	Color     string
+	Version   int64
+	UpdatedAt time.Time
+}
+
+// Note is a second entity type sharing the GSI1 partitions of Item
+type Note struct {
+	ID    string
+	Group string
+	Text  string
+}
+
+// invalidColor is rejected by the Validate hook registered for Item
+const invalidColor = "invalid"
+
+// Stores are the stores under test. Both must share one table and resolve index maps,
+// entity types and hooks in the registry passed to the Factory.
+type Stores struct {
+	Items datastore.DataStore[Item]
+	Notes datastore.DataStore[Note]
+
+	// Create inserts an Item only if no item with its key exists, for stores with such
+	// an operation. The Create checks are skipped when it is nil.
+	Create func(ctx context.Context, item Item) error
+}
+
+// Factory creates empty stores using 'reg', which holds the registrations of Item and
+// Note. It is called for every check; cleanup is registered on 't'.
+type Factory func(t *testing.T, reg *registry.Registry) Stores
+
+// Option configures Run
+type Option func(*config)
+
+type config struct {
+	skip []string
+}
+
+// Skip skips the named checks, e.g. "Query" or "Delete/Missing", for stores that
+// deliberately deviate from the DataStore contract
+func Skip(names ...string) Option {
+	return func(c *config) {
+		c.skip = append(c.skip, names...)
+	}
+}
+
+func (c *config) skipped(name string) bool {
+	for _, s := range c.skip {
+		if name == s || strings.HasPrefix(name, s+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRegistry returns a registry with the index maps, unmarshal functions and hooks of
+// Item and Note, as passed to the Factory
+func NewRegistry() *registry.Registry {
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(Item{}), map[string]string{
+		"PK":         "ITEM#{ID}",
+		"SK":         "ITEM#{ID}",
+		"GSI1PK":     "GROUP#{Group}",
+		"GSI1SK":     "ITEM#{ID}",
+		"@Version":   "Version",
+		"@UpdatedAt": "UpdatedAt",
+	})
+	reg.RegisterIndexMap(reflect.TypeOf(Note{}), map[string]string{
+		"PK":     "NOTE#{ID}",
+		"SK":     "NOTE#{ID}",
+		"GSI1PK": "GROUP#{Group}",
+		"GSI1SK": "NOTE#{ID}",
+	})
+	_ = reg.RegisterType(reg.EntityTypeName(reflect.TypeOf(Item{})), func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &Item{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	_ = reg.RegisterType(reg.EntityTypeName(reflect.TypeOf(Note{})), func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &Note{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	reg.RegisterHooks(reflect.TypeOf(Item{}), registry.NewEntityHooks(registry.Hooks[Item]{
+		Validate: func(item *Item) error {
+			if item.Color == invalidColor {
+				return errors.New("color is invalid")
+			}
+			return nil
+		},
+	}))
+	return reg
+}
+
+// Run checks that the stores created by 'factory' behave like the DynamoDB store:
+// NotFound and condition errors, optimistic versioning, EntityType polymorphism, query
+// ordering, and stream pagination and cancellation. Each check runs as a subtest on
+// new stores.
+func Run(t *testing.T, factory Factory, opts ...Option) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	s := &suite{factory: factory, cfg: cfg}
+
+	for _, group := range []struct {
+		name   string
+		checks []check
+	}{
+		{"GetOne", s.getOneChecks()},
+		{"GetByKey", s.getByKeyChecks()},
+		{"Put", s.putChecks()},
+		{"Create", s.createChecks()},
+		{"UpdateWithCondition", s.updateChecks()},
+		{"Query", s.queryChecks()},
+		{"Stream", s.streamChecks()},
+		{"Delete", s.deleteChecks()},
+	} {
+		t.Run(group.name, func(t *testing.T) {
+			for _, c := range group.checks {
+				name := group.name + "/" + c.name
+				t.Run(c.name, func(t *testing.T) {
+					if cfg.skipped(name) {
+						t.Skip("skipped for this store")
+					}
+					c.run(t, s.stores(t))
+				})
+			}
+		})
+	}
+}
+
+type check struct {
+	name string
+	run  func(t *testing.T, st Stores)
+}
+
+type suite struct {
+	factory Factory
+	cfg     *config
+}
+
+func (s *suite) stores(t *testing.T) Stores {
+	t.Helper()
+	st := s.factory(t, NewRegistry())
+	if st.Items == nil || st.Notes == nil {
+		t.Fatal("factory returned nil stores")
+	}
+	return st
+}
+
+// put stores items, failing the test on error
+func put(t *testing.T, st Stores, items ...Item) {
+	t.Helper()
+	for _, item := range items {
+		if err := st.Items.Put(context.Background(), item); err != nil {
+			t.Fatalf("Put(%s) failed: %v", item.ID, err)
+		}
+	}
+}
+
+// mustGet reads the item with 'id', failing the test on error
+func mustGet(t *testing.T, st Stores, id string) *Item {
+	t.Helper()
+	got, err := st.Items.GetOne(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetOne(%s) failed: %v", id, err)
+	}
+	if got == nil {
+		t.Fatalf("GetOne(%s) returned nil without an error", id)
+	}
+	return got
+}
+
+// describe formats query results for failure messages and comparisons
+func describe(results []interface{}) []string {
+	out := make([]string, 0, len(results))
+	for _, r := range results {
+		switch v := r.(type) {
+		case *Item:
+			out = append(out, "item:"+v.ID)
+		case *Note:
+			out = append(out, "note:"+v.ID)
+		default:
+			out = append(out, fmt.Sprintf("%T", r))
+		}
+	}
+	return out
+}
@@ -0,0 +1,31 @@
+/*
+Package conformance is a test suite checking that a DataStore implementation behaves
+like the DynamoDB store, so that backends, mocks and decorators can be swapped without
+changing the code using them.
+
+The suite covers every DataStore method and the error types of the errors package:
+NotFoundError from GetOne and GetByKey, ValidationError from hooks, ConditionFailedError
+from optimistic versioning and UpdateWithCondition, and AlreadyExistsError from Create.
+It stores two entity types, Item and Note, in one table to check EntityType
+polymorphism, and checks key conditions, ordering, filters and Limit of queries, and
+the pagination and cancellation of streams.
+
+A backend runs the suite from its tests with a Factory creating empty stores on the
+registry it is given:
+
+	func TestConformance(t *testing.T) {
+	    conformance.Run(t, func(t *testing.T, reg *registry.Registry) conformance.Stores {
+	        db, err := sqlite.Open(":memory:")
+	        if err != nil {
+	            t.Fatal(err)
+	        }
+	        t.Cleanup(func() { db.Close() })
+	        items, _ := sqlite.NewSQLiteDataStore[conformance.Item](db, "entities", sqlite.WithRegistry(reg))
+	        notes, _ := sqlite.NewSQLiteDataStore[conformance.Note](db, "entities", sqlite.WithRegistry(reg))
+	        return conformance.Stores{Items: items, Notes: notes, Create: items.Create}
+	    })
+	}
+
+Stores that deliberately deviate from the contract skip the affected checks with Skip.
+*/
+package conformance
@@ -0,0 +1,373 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package conformance
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// groupQuery returns the parameters of a GSI1 query of 'group', with 'keyCondition'
+// appended to the partition key condition and 'values' as further string values
+func groupQuery(group, keyCondition string, values ...string) *storagemodels.QueryParams {
+	params := &storagemodels.QueryParams{
+		KeyConditionExpression: "PK1 = :pk",
+		IndexName:              aws.String("GSI1"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "GROUP#" + group},
+		},
+	}
+	if keyCondition != "" {
+		params.KeyConditionExpression += " AND " + keyCondition
+	}
+	for i := 0; i+1 < len(values); i += 2 {
+		params.ExpressionAttributeValues[values[i]] = &types.AttributeValueMemberS{Value: values[i+1]}
+	}
+	return params
+}
+
+func (s *suite) getOneChecks() []check {
+	return []check{
+		{"Found", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "a", Group: "g", Color: "red"})
+			got := mustGet(t, st, "a")
+			if got.ID != "a" || got.Group != "g" || got.Color != "red" {
+				t.Errorf("GetOne = %+v, want the item stored", *got)
+			}
+		}},
+		{"NotFound", func(t *testing.T, st Stores) {
+			got, err := st.Items.GetOne(context.Background(), "missing")
+			var nf *eserrors.NotFoundError
+			if !errors.As(err, &nf) || !eserrors.IsNotFound(err) {
+				t.Fatalf("GetOne of a missing item returned %v, want a NotFoundError", err)
+			}
+			if got != nil {
+				t.Errorf("GetOne of a missing item returned %+v with the error", *got)
+			}
+		}},
+	}
+}
+
+func (s *suite) getByKeyChecks() []check {
+	return []check{
+		{"Found", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "a", Group: "g", Color: "red"})
+			got, err := st.Items.GetByKey(context.Background(), "ITEM#a", "ITEM#a")
+			if err != nil {
+				t.Fatalf("GetByKey failed: %v", err)
+			}
+			if got == nil || got.ID != "a" || got.Color != "red" {
+				t.Errorf("GetByKey = %+v, want the item stored", got)
+			}
+		}},
+		{"NotFound", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "a", Group: "g"})
+			_, err := st.Items.GetByKey(context.Background(), "ITEM#a", "ITEM#b")
+			var nf *eserrors.NotFoundError
+			if !errors.As(err, &nf) || !eserrors.IsNotFound(err) {
+				t.Fatalf("GetByKey of a missing item returned %v, want a NotFoundError", err)
+			}
+		}},
+	}
+}
+
+func (s *suite) putChecks() []check {
+	return []check{
+		{"RoundTrip", func(t *testing.T, st Stores) {
+			before := time.Now().Add(-time.Minute)
+			put(t, st, Item{ID: "a", Group: "g", Color: "red"})
+			got := mustGet(t, st, "a")
+			if got.Version != 1 {
+				t.Errorf("Version = %d after the first Put, want 1", got.Version)
+			}
+			if got.UpdatedAt.Before(before) {
+				t.Errorf("UpdatedAt = %v, want it set by Put", got.UpdatedAt)
+			}
+		}},
+		{"Overwrite", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "a", Group: "g", Color: "red"})
+			got := mustGet(t, st, "a")
+			got.Color = "blue"
+			put(t, st, *got)
+			got = mustGet(t, st, "a")
+			if got.Color != "blue" || got.Version != 2 {
+				t.Errorf("after overwriting, Color = %q and Version = %d, want blue and 2", got.Color, got.Version)
+			}
+		}},
+		{"VersionConflict", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "a", Group: "g", Color: "red"})
+			stale := mustGet(t, st, "a")
+			fresh := *stale
+			fresh.Color = "blue"
+			put(t, st, fresh)
+
+			stale.Color = "green"
+			err := st.Items.Put(context.Background(), *stale)
+			var cf *eserrors.ConditionFailedError
+			if !errors.As(err, &cf) || !eserrors.IsConditionFailed(err) {
+				t.Fatalf("Put of a stale version returned %v, want a ConditionFailedError", err)
+			}
+			if got := mustGet(t, st, "a"); got.Color != "blue" {
+				t.Errorf("Color = %q after the conflict, want blue", got.Color)
+			}
+		}},
+		{"Validation", func(t *testing.T, st Stores) {
+			err := st.Items.Put(context.Background(), Item{ID: "a", Group: "g", Color: invalidColor})
+			var ve *eserrors.ValidationError
+			if !errors.As(err, &ve) || !eserrors.IsValidationError(err) {
+				t.Fatalf("Put of an invalid item returned %v, want a ValidationError", err)
+			}
+			if _, err := st.Items.GetOne(context.Background(), "a"); !eserrors.IsNotFound(err) {
+				t.Errorf("GetOne of the invalid item returned %v, want it not stored", err)
+			}
+		}},
+	}
+}
+
+func (s *suite) createChecks() []check {
+	return []check{
+		{"New", func(t *testing.T, st Stores) {
+			if st.Create == nil {
+				t.Skip("the store has no Create")
+			}
+			if err := st.Create(context.Background(), Item{ID: "a", Group: "g", Color: "red"}); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			if got := mustGet(t, st, "a"); got.Color != "red" || got.Version != 1 {
+				t.Errorf("Create stored %+v", *got)
+			}
+		}},
+		{"AlreadyExists", func(t *testing.T, st Stores) {
+			if st.Create == nil {
+				t.Skip("the store has no Create")
+			}
+			put(t, st, Item{ID: "a", Group: "g", Color: "red"})
+			err := st.Create(context.Background(), Item{ID: "a", Group: "g", Color: "blue"})
+			var ae *eserrors.AlreadyExistsError
+			if !errors.As(err, &ae) || !eserrors.IsAlreadyExists(err) {
+				t.Fatalf("Create of an existing item returned %v, want an AlreadyExistsError", err)
+			}
+			if got := mustGet(t, st, "a"); got.Color != "red" {
+				t.Errorf("Color = %q after the failed Create, want red", got.Color)
+			}
+		}},
+	}
+}
+
+func (s *suite) updateChecks() []check {
+	return []check{
+		{"Applied", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "a", Group: "g", Color: "red"})
+			err := st.Items.UpdateWithCondition(context.Background(), Item{ID: "a"},
+				map[string]interface{}{"Color": "blue"}, "attribute_exists(PK)")
+			if err != nil {
+				t.Fatalf("UpdateWithCondition failed: %v", err)
+			}
+			got := mustGet(t, st, "a")
+			if got.Color != "blue" || got.Group != "g" {
+				t.Errorf("after the update, Color = %q and Group = %q, want blue and g", got.Color, got.Group)
+			}
+			if got.Version != 2 {
+				t.Errorf("Version = %d after the update, want 2", got.Version)
+			}
+		}},
+		{"ConditionFailed", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "a", Group: "g", Color: "red"})
+			err := st.Items.UpdateWithCondition(context.Background(), Item{ID: "a"},
+				map[string]interface{}{"Color": "blue"}, "attribute_not_exists(PK)")
+			var cf *eserrors.ConditionFailedError
+			if !errors.As(err, &cf) || !eserrors.IsConditionFailed(err) {
+				t.Fatalf("UpdateWithCondition returned %v, want a ConditionFailedError", err)
+			}
+			if got := mustGet(t, st, "a"); got.Color != "red" || got.Version != 1 {
+				t.Errorf("the failed update changed the item to %+v", *got)
+			}
+		}},
+		{"MissingItem", func(t *testing.T, st Stores) {
+			err := st.Items.UpdateWithCondition(context.Background(), Item{ID: "a"},
+				map[string]interface{}{"Color": "blue"}, "attribute_exists(PK)")
+			if !eserrors.IsConditionFailed(err) {
+				t.Fatalf("UpdateWithCondition of a missing item returned %v, want a ConditionFailedError", err)
+			}
+			if _, err := st.Items.GetOne(context.Background(), "a"); !eserrors.IsNotFound(err) {
+				t.Errorf("GetOne returned %v, want the failed update to create nothing", err)
+			}
+		}},
+	}
+}
+
+func (s *suite) queryChecks() []check {
+	query := func(t *testing.T, st Stores, params *storagemodels.QueryParams, want ...string) {
+		t.Helper()
+		results, err := st.Items.Query(context.Background(), params)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if got := describe(results); !reflect.DeepEqual(got, want) && (len(got) != 0 || len(want) != 0) {
+			t.Errorf("Query = %v, want %v", got, want)
+		}
+	}
+	seed := func(t *testing.T, st Stores) {
+		t.Helper()
+		put(t, st,
+			Item{ID: "c", Group: "g", Color: "red"},
+			Item{ID: "a", Group: "g", Color: "blue"},
+			Item{ID: "b", Group: "g", Color: "red"},
+			Item{ID: "d", Group: "other", Color: "red"},
+		)
+	}
+
+	return []check{
+		{"SortOrder", func(t *testing.T, st Stores) {
+			seed(t, st)
+			query(t, st, groupQuery("g", ""), "item:a", "item:b", "item:c")
+		}},
+		{"Reverse", func(t *testing.T, st Stores) {
+			seed(t, st)
+			params := groupQuery("g", "")
+			params.ScanIndexForward = aws.Bool(false)
+			query(t, st, params, "item:c", "item:b", "item:a")
+		}},
+		{"Between", func(t *testing.T, st Stores) {
+			seed(t, st)
+			query(t, st, groupQuery("g", "SK1 BETWEEN :lo AND :hi", ":lo", "ITEM#b", ":hi", "ITEM#c"), "item:b", "item:c")
+		}},
+		{"BeginsWith", func(t *testing.T, st Stores) {
+			seed(t, st)
+			if err := st.Notes.Put(context.Background(), Note{ID: "a", Group: "g"}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			query(t, st, groupQuery("g", "begins_with(SK1, :prefix)", ":prefix", "ITEM#"), "item:a", "item:b", "item:c")
+		}},
+		{"Filter", func(t *testing.T, st Stores) {
+			seed(t, st)
+			params := groupQuery("g", "", ":color", "red")
+			params.FilterExpression = aws.String("Color = :color")
+			query(t, st, params, "item:b", "item:c")
+		}},
+		{"Limit", func(t *testing.T, st Stores) {
+			seed(t, st)
+			params := groupQuery("g", "")
+			params.Limit = aws.Int32(2)
+			query(t, st, params, "item:a", "item:b")
+		}},
+		{"NoMatch", func(t *testing.T, st Stores) {
+			seed(t, st)
+			query(t, st, groupQuery("none", ""))
+		}},
+		{"EntityTypes", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "b", Group: "g"}, Item{ID: "a", Group: "g"})
+			if err := st.Notes.Put(context.Background(), Note{ID: "a", Group: "g", Text: "hello"}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			query(t, st, groupQuery("g", ""), "item:a", "item:b", "note:a")
+
+			results, err := st.Notes.Query(context.Background(), groupQuery("g", "begins_with(SK1, :prefix)", ":prefix", "NOTE#"))
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Query returned %v, want the note", describe(results))
+			}
+			if note, ok := results[0].(*Note); !ok || note.Text != "hello" {
+				t.Errorf("Query returned %#v, want the note stored", results[0])
+			}
+		}},
+	}
+}
+
+func (s *suite) streamChecks() []check {
+	seed := func(t *testing.T, st Stores) {
+		t.Helper()
+		for _, id := range []string{"e", "c", "a", "d", "b"} {
+			put(t, st, Item{ID: id, Group: "g"})
+		}
+	}
+
+	return []check{
+		{"Pages", func(t *testing.T, st Stores) {
+			seed(t, st)
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			var ids []string
+			var pages []int
+			for r := range st.Items.Stream(ctx, groupQuery("g", ""), storagemodels.WithPageSize(2)) {
+				if r.Error != nil {
+					t.Fatalf("Stream failed: %v", r.Error)
+				}
+				if r.Meta.Index != int64(len(ids)) {
+					t.Errorf("Meta.Index = %d for item %d", r.Meta.Index, len(ids))
+				}
+				ids = append(ids, r.Item.ID)
+				pages = append(pages, r.Meta.PageNumber)
+			}
+			if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(ids, want) {
+				t.Errorf("Stream = %v, want %v", ids, want)
+			}
+			if want := []int{1, 1, 2, 2, 3}; !reflect.DeepEqual(pages, want) {
+				t.Errorf("page numbers = %v, want %v", pages, want)
+			}
+		}},
+		{"Cancel", func(t *testing.T, st Stores) {
+			seed(t, st)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			results := st.Items.Stream(ctx, groupQuery("g", ""), storagemodels.WithPageSize(1), storagemodels.WithBufferSize(1))
+			if r, ok := <-results; !ok || r.Error != nil {
+				t.Fatalf("Stream returned %+v, want the first item", r)
+			}
+			cancel()
+
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case _, ok := <-results:
+					if !ok {
+						return
+					}
+				case <-timeout:
+					t.Fatal("the stream was not closed after the context was canceled")
+				}
+			}
+		}},
+	}
+}
+
+func (s *suite) deleteChecks() []check {
+	return []check{
+		{"Existing", func(t *testing.T, st Stores) {
+			put(t, st, Item{ID: "a", Group: "g"}, Item{ID: "b", Group: "g"})
+			if err := st.Items.Delete(context.Background(), "a"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if _, err := st.Items.GetOne(context.Background(), "a"); !eserrors.IsNotFound(err) {
+				t.Errorf("GetOne of the deleted item returned %v, want a NotFoundError", err)
+			}
+			mustGet(t, st, "b")
+			results, err := st.Items.Query(context.Background(), groupQuery("g", ""))
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if got := describe(results); !reflect.DeepEqual(got, []string{"item:b"}) {
+				t.Errorf("Query = %v after the delete, want [item:b]", got)
+			}
+		}},
+		{"Missing", func(t *testing.T, st Stores) {
+			if err := st.Items.Delete(context.Background(), "missing"); err != nil {
+				t.Errorf("Delete of a missing item returned %v, want nil", err)
+			}
+		}},
+	}
+}
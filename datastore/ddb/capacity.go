@@ -0,0 +1,159 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// WithReturnConsumedCapacity makes every request of the datastore ask DynamoDB for the
+// capacity it consumed: types.ReturnConsumedCapacityTotal for the total, or
+// types.ReturnConsumedCapacityIndexes for the table and each index. The capacity is
+// reported to the CapacityCollector of the context and on the operation spans. No
+// capacity is requested by default.
+func WithReturnConsumedCapacity(level types.ReturnConsumedCapacity) StoreOption {
+	return func(o *storeOptions) {
+		o.returnCapacity = level
+	}
+}
+
+// Capacity is an amount of consumed capacity units. ReadCapacityUnits and
+// WriteCapacityUnits are only known at the types.ReturnConsumedCapacityIndexes level.
+type Capacity struct {
+	CapacityUnits      float64
+	ReadCapacityUnits  float64
+	WriteCapacityUnits float64
+}
+
+func (c *Capacity) add(units, read, write *float64) {
+	c.CapacityUnits += aws.ToFloat64(units)
+	c.ReadCapacityUnits += aws.ToFloat64(read)
+	c.WriteCapacityUnits += aws.ToFloat64(write)
+}
+
+// CapacityReport is the capacity aggregated by a CapacityCollector
+type CapacityReport struct {
+	// Total is the capacity consumed by all requests
+	Total Capacity
+	// Tables and Indexes are the capacity consumed per table and per secondary index,
+	// at the types.ReturnConsumedCapacityIndexes level
+	Tables  map[string]Capacity
+	Indexes map[string]Capacity
+	// Operations is the capacity consumed per datastore operation, e.g. "GetOne" or
+	// "Stream"
+	Operations map[string]Capacity
+	// Requests is the number of capacity reports: one per request, e.g. per stream
+	// page, and per table for transactions
+	Requests int
+	// Retries is the number of requests retried by the datastore
+	Retries int
+	// RequestIDs are the AWS request IDs of the requests, in order
+	RequestIDs []string
+}
+
+// CapacityCollector aggregates the capacity consumed by the datastore calls made with a
+// context carrying it, e.g. all the calls serving one API request. It is safe for
+// concurrent use.
+//
+//	collector := ddb.NewCapacityCollector()
+//	ctx = ddb.WithCapacityCollector(ctx, collector)
+//	// ... calls to stores created with WithReturnConsumedCapacity
+//	log.Printf("consumed %.1f capacity units", collector.Report().Total.CapacityUnits)
+type CapacityCollector struct {
+	mu     sync.Mutex
+	report CapacityReport
+}
+
+// NewCapacityCollector returns an empty collector
+func NewCapacityCollector() *CapacityCollector {
+	return &CapacityCollector{report: CapacityReport{
+		Tables:     map[string]Capacity{},
+		Indexes:    map[string]Capacity{},
+		Operations: map[string]Capacity{},
+	}}
+}
+
+type capacityCollectorKey struct{}
+
+// WithCapacityCollector returns a context making the datastore calls report their
+// consumed capacity to 'c'
+func WithCapacityCollector(ctx context.Context, c *CapacityCollector) context.Context {
+	return context.WithValue(ctx, capacityCollectorKey{}, c)
+}
+
+// CapacityCollectorFrom returns the collector of 'ctx', if any
+func CapacityCollectorFrom(ctx context.Context) (*CapacityCollector, bool) {
+	c, ok := ctx.Value(capacityCollectorKey{}).(*CapacityCollector)
+	return c, ok && c != nil
+}
+
+// Report returns a copy of the capacity aggregated so far
+func (c *CapacityCollector) Report() CapacityReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := c.report
+	res.Tables = copyCapacities(c.report.Tables)
+	res.Indexes = copyCapacities(c.report.Indexes)
+	res.Operations = copyCapacities(c.report.Operations)
+	res.RequestIDs = append([]string(nil), c.report.RequestIDs...)
+	return res
+}
+
+// Reset clears the capacity aggregated so far
+func (c *CapacityCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.report = NewCapacityCollector().report
+}
+
+func copyCapacities(m map[string]Capacity) map[string]Capacity {
+	res := make(map[string]Capacity, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+// record adds the response of a request of 'operation'; 'cc' is nil when the request
+// did not ask for capacity
+func (c *CapacityCollector) record(operation, requestID string, cc *types.ConsumedCapacity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if requestID != "" {
+		c.report.RequestIDs = append(c.report.RequestIDs, requestID)
+	}
+	if cc == nil {
+		return
+	}
+	c.report.Requests++
+	c.report.Total.add(cc.CapacityUnits, cc.ReadCapacityUnits, cc.WriteCapacityUnits)
+	op := c.report.Operations[operation]
+	op.add(cc.CapacityUnits, cc.ReadCapacityUnits, cc.WriteCapacityUnits)
+	c.report.Operations[operation] = op
+
+	if cc.Table != nil && cc.TableName != nil {
+		table := c.report.Tables[*cc.TableName]
+		table.add(cc.Table.CapacityUnits, cc.Table.ReadCapacityUnits, cc.Table.WriteCapacityUnits)
+		c.report.Tables[*cc.TableName] = table
+	}
+	for _, indexes := range []map[string]types.Capacity{cc.GlobalSecondaryIndexes, cc.LocalSecondaryIndexes} {
+		for name, capacity := range indexes {
+			index := c.report.Indexes[name]
+			index.add(capacity.CapacityUnits, capacity.ReadCapacityUnits, capacity.WriteCapacityUnits)
+			c.report.Indexes[name] = index
+		}
+	}
+}
+
+// retried counts a retried request
+func (c *CapacityCollector) retried() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.report.Retries++
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+func TestCapacityCollector(t *testing.T) {
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[conformance.Item](client, "entities",
+		WithRegistry(conformance.NewRegistry()),
+		WithReturnConsumedCapacity(types.ReturnConsumedCapacityIndexes),
+	)
+	collector := NewCapacityCollector()
+	ctx := WithCapacityCollector(context.Background(), collector)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Put(ctx, conformance.Item{ID: id, Group: "g"}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if _, err := store.GetOne(ctx, "a"); err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+	if _, err := store.QueryGSI().WithPartitionKey("g").Execute(ctx); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	// The first page request is throttled and retried
+	client.Err = &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+	params := &storagemodels.QueryParams{
+		KeyConditionExpression:    "PK1 = :pk",
+		IndexName:                 aws.String("GSI1"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": &types.AttributeValueMemberS{Value: "GROUP#g"}},
+	}
+	for r := range store.Stream(ctx, params, storagemodels.WithPageSize(2), storagemodels.WithRetryBackoff(time.Millisecond)) {
+		if r.Error != nil {
+			t.Fatalf("Stream failed: %v", r.Error)
+		}
+	}
+
+	report := collector.Report()
+	// 3 writes of 1 unit, a GetItem, a query and 2 stream pages of 0.5 units
+	if report.Total.CapacityUnits != 5 || report.Total.WriteCapacityUnits != 3 || report.Total.ReadCapacityUnits != 2 {
+		t.Errorf("total = %+v, want 5 units of which 3 written and 2 read", report.Total)
+	}
+	if report.Requests != 7 || report.Retries != 1 {
+		t.Errorf("requests = %d, retries = %d; want 7 and 1", report.Requests, report.Retries)
+	}
+	if got := report.Operations["Stream"].CapacityUnits; got != 1 {
+		t.Errorf("Stream capacity = %v, want 1", got)
+	}
+	if got := report.Operations["Put"].WriteCapacityUnits; got != 3 {
+		t.Errorf("Put capacity = %v, want 3", got)
+	}
+	if got := report.Indexes["GSI1"].ReadCapacityUnits; got != 1.5 {
+		t.Errorf("GSI1 capacity = %v, want 1.5", got)
+	}
+	if got := report.Tables["entities"].CapacityUnits; got != 3.5 {
+		t.Errorf("table capacity = %v, want 3.5", got)
+	}
+
+	// Reports are copies
+	report.Operations["Put"] = Capacity{}
+	if collector.Report().Operations["Put"].CapacityUnits != 3 {
+		t.Error("changing a report changed the collector")
+	}
+
+	collector.Reset()
+	if report := collector.Report(); report.Total.CapacityUnits != 0 || report.Requests != 0 || len(report.Operations) != 0 {
+		t.Errorf("report after Reset = %+v", report)
+	}
+}
+
+func TestCapacityNotRequested(t *testing.T) {
+	// Without WithReturnConsumedCapacity the requests report no capacity
+	store := NewDynamodbDataStoreWithClient[conformance.Item](fakeddb.New(), "entities",
+		WithRegistry(conformance.NewRegistry()))
+	collector := NewCapacityCollector()
+	ctx := WithCapacityCollector(context.Background(), collector)
+
+	if err := store.Put(ctx, conformance.Item{ID: "a"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := store.GetOne(ctx, "a"); err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+	if report := collector.Report(); report.Total.CapacityUnits != 0 || report.Requests != 0 {
+		t.Errorf("report = %+v, want no capacity", report)
+	}
+	if _, ok := CapacityCollectorFrom(context.Background()); ok {
+		t.Error("a context without collector returned one")
+	}
+}
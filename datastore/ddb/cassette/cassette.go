@@ -0,0 +1,132 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package cassette
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/suparena/entitystore/datastore/ddb"
+)
+
+// Recorder and Replayer implement the client interface of the ddb store, so either can
+// be passed to ddb.NewDynamodbDataStoreWithClient
+var (
+	_ ddb.DynamoDBAPI = (*Recorder)(nil)
+	_ ddb.DynamoDBAPI = (*Replayer)(nil)
+)
+
+// Cassette is a recording of DynamoDB interactions
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request with its response or error. Requests and responses
+// are the SDK inputs and outputs as JSON, with attribute values in the DynamoDB JSON
+// format.
+type Interaction struct {
+	Operation string          `json:"operation"`
+	Request   json.RawMessage `json:"request"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Error     *Error          `json:"error,omitempty"`
+}
+
+// Error is a recorded error
+type Error struct {
+	// Code is the API error code, e.g. "ConditionalCheckFailedException"; empty for
+	// errors that are not API errors
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	// Details holds the fields of typed SDK errors, e.g. the cancellation reasons of a
+	// TransactionCanceledException
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// apiErrorTypes are the typed DynamoDB errors replayed with their fields, by code
+var apiErrorTypes = func() map[string]reflect.Type {
+	res := map[string]reflect.Type{}
+	for _, e := range []smithy.APIError{
+		&types.ConditionalCheckFailedException{},
+		&types.TransactionCanceledException{},
+		&types.TransactionConflictException{},
+		&types.TransactionInProgressException{},
+		&types.ProvisionedThroughputExceededException{},
+		&types.RequestLimitExceeded{},
+		&types.ResourceNotFoundException{},
+		&types.ItemCollectionSizeLimitExceededException{},
+		&types.IdempotentParameterMismatchException{},
+		&types.ReplicatedWriteConflictException{},
+		&types.InternalServerError{},
+	} {
+		res[e.ErrorCode()] = reflect.TypeOf(e).Elem()
+	}
+	return res
+}()
+
+// recordError converts an error returned by a client into an Error
+func recordError(err error) (*Error, error) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return &Error{Message: err.Error()}, nil
+	}
+	e := &Error{Code: apiErr.ErrorCode(), Message: apiErr.ErrorMessage()}
+	if typ, ok := apiErrorTypes[e.Code]; ok && reflect.TypeOf(apiErr) == reflect.PointerTo(typ) {
+		details, err := marshal(apiErr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record %s: %w", e.Code, err)
+		}
+		e.Details = details
+	}
+	return e, nil
+}
+
+// Err returns the error as the client returned it: a typed SDK error for the errors
+// of the DynamoDB API, or else an API error with the recorded code
+func (e *Error) Err() error {
+	if typ, ok := apiErrorTypes[e.Code]; ok && len(e.Details) > 0 {
+		v := reflect.New(typ)
+		if err := unmarshal(e.Details, v.Interface()); err == nil {
+			return v.Interface().(error)
+		}
+	}
+	if e.Code != "" {
+		return &smithy.GenericAPIError{Code: e.Code, Message: e.Message}
+	}
+	return errors.New(e.Message)
+}
+
+// Load reads a cassette saved with Save
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette to 'path' as indented JSON, creating its directory
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
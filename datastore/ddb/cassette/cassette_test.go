@@ -0,0 +1,250 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/datastore/ddb"
+	"github.com/suparena/entitystore/datastore/ddb/cassette"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// scenario runs store operations against 'client' and describes their results
+func scenario(t *testing.T, client ddb.DynamoDBAPI) []string {
+	t.Helper()
+	ctx := context.Background()
+	store := ddb.NewDynamodbDataStoreWithClient[conformance.Item](client, "entities", ddb.WithRegistry(conformance.NewRegistry()))
+	var res []string
+	log := func(format string, args ...any) {
+		res = append(res, fmt.Sprintf(format, args...))
+	}
+
+	for _, id := range []string{"b", "a"} {
+		if err := store.Put(ctx, conformance.Item{ID: id, Group: "g", Color: "red"}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	err := store.Create(ctx, conformance.Item{ID: "a", Group: "g"})
+	log("create existing: %v", eserrors.IsAlreadyExists(err))
+
+	item, err := store.GetOne(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+	log("get: %s %s v%d", item.ID, item.Color, item.Version)
+
+	err = store.UpdateWithCondition(ctx, conformance.Item{ID: "a"}, map[string]interface{}{"Color": "blue"}, "attribute_not_exists(PK)")
+	log("failed update: %v", eserrors.IsConditionFailed(err))
+
+	results, err := store.Query(ctx, &storagemodels.QueryParams{
+		KeyConditionExpression:    "PK1 = :pk",
+		IndexName:                 aws.String("GSI1"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": &types.AttributeValueMemberS{Value: "GROUP#g"}},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for _, r := range results {
+		log("query: %s", r.(*conformance.Item).ID)
+	}
+
+	if err := store.Delete(ctx, "b"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	_, err = store.GetOne(ctx, "b")
+	log("get deleted: %v", eserrors.IsNotFound(err))
+	return res
+}
+
+func TestRecordReplay(t *testing.T) {
+	recorder := cassette.NewRecorder(fakeddb.New())
+	recorded := scenario(t, recorder)
+	path := filepath.Join(t.TempDir(), "testdata", "scenario.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	c, err := cassette.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	// The @UpdatedAt timestamps of the replayed writes differ from the recorded ones
+	time.Sleep(10 * time.Millisecond)
+	replayer := cassette.NewReplayer(c)
+	replayed := scenario(t, replayer)
+
+	if strings.Join(replayed, "\n") != strings.Join(recorded, "\n") {
+		t.Errorf("replayed results:\n%s\nrecorded results:\n%s", strings.Join(replayed, "\n"), strings.Join(recorded, "\n"))
+	}
+	for _, want := range []string{"create existing: true", "failed update: true", "query: a", "get deleted: true"} {
+		if !strings.Contains(strings.Join(recorded, "\n"), want) {
+			t.Errorf("recorded results %v lack %q", recorded, want)
+		}
+	}
+	if left := replayer.Unreplayed(); len(left) != 0 {
+		t.Errorf("%d interactions were not replayed", len(left))
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	ctx := context.Background()
+	recorder := cassette.NewRecorder(fakeddb.New())
+	_, err := recorder.GetItem(ctx, &sdk.GetItemInput{
+		TableName: aws.String("entities"),
+		Key:       map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: "ITEM#a"}},
+	})
+	if err != nil {
+		t.Fatalf("GetItem failed: %v", err)
+	}
+	c, err := recorder.Cassette()
+	if err != nil {
+		t.Fatalf("Cassette failed: %v", err)
+	}
+
+	replayer := cassette.NewReplayer(c)
+	_, err = replayer.GetItem(ctx, &sdk.GetItemInput{
+		TableName: aws.String("entities"),
+		Key:       map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: "ITEM#b"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no recorded GetItem interaction") {
+		t.Errorf("GetItem of an unrecorded key returned %v, want a mismatch error", err)
+	}
+	if _, err := replayer.PutItem(ctx, &sdk.PutItemInput{TableName: aws.String("entities")}); err == nil {
+		t.Error("PutItem without recorded interaction succeeded")
+	}
+	if left := replayer.Unreplayed(); len(left) != 1 || left[0].Operation != "GetItem" {
+		t.Errorf("Unreplayed = %v, want the GetItem interaction", left)
+	}
+}
+
+func TestReplayTypedErrors(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	recorder := cassette.NewRecorder(client)
+	client.Err = &types.TransactionCanceledException{
+		Message: aws.String("Transaction cancelled"),
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")},
+			{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed")},
+		},
+	}
+	_, _ = recorder.TransactWriteItems(ctx, &sdk.TransactWriteItemsInput{})
+	client.Err = errors.New("connection reset")
+	_, _ = recorder.Query(ctx, &sdk.QueryInput{TableName: aws.String("entities")})
+
+	path := filepath.Join(t.TempDir(), "errors.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	c, err := cassette.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	replayer := cassette.NewReplayer(c)
+
+	_, err = replayer.TransactWriteItems(ctx, &sdk.TransactWriteItemsInput{})
+	var tce *types.TransactionCanceledException
+	if !errors.As(err, &tce) {
+		t.Fatalf("TransactWriteItems returned %v, want a TransactionCanceledException", err)
+	}
+	if len(tce.CancellationReasons) != 2 || aws.ToString(tce.CancellationReasons[1].Code) != "ConditionalCheckFailed" {
+		t.Errorf("CancellationReasons = %+v", tce.CancellationReasons)
+	}
+
+	_, err = replayer.Query(ctx, &sdk.QueryInput{TableName: aws.String("entities")})
+	if err == nil || err.Error() != "connection reset" {
+		t.Errorf("Query returned %v, want the recorded error", err)
+	}
+}
+
+func TestForTest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "for_test.json")
+	input := &sdk.PutItemInput{
+		TableName: aws.String("entities"),
+		Item: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: "ITEM#a"},
+			"SK": &types.AttributeValueMemberS{Value: "ITEM#a"},
+		},
+	}
+
+	t.Run("Record", func(t *testing.T) {
+		t.Setenv(cassette.ModeEnv, "record")
+		client := cassette.ForTest(t, path, func() (ddb.DynamoDBAPI, error) {
+			return fakeddb.New(), nil
+		})
+		if _, err := client.PutItem(context.Background(), input); err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+	})
+	t.Run("Replay", func(t *testing.T) {
+		client := cassette.ForTest(t, path, func() (ddb.DynamoDBAPI, error) {
+			t.Fatal("the live client is not used when replaying")
+			return nil, nil
+		})
+		if _, err := client.PutItem(context.Background(), input); err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+	})
+}
+
+func TestReplayIgnoreValues(t *testing.T) {
+	ctx := context.Background()
+	put := func(client ddb.DynamoDBAPI) error {
+		store := ddb.NewDynamodbDataStoreWithClient[conformance.Item](client, "entities", ddb.WithRegistry(conformance.NewRegistry()))
+		return store.PutWithOptions(ctx, conformance.Item{ID: "a", Group: "g"},
+			ddb.WithOutboxEvents(ddb.OutboxEvent{AggregateID: "a", Type: "Created"}))
+	}
+	recorder := cassette.NewRecorder(fakeddb.New())
+	if err := put(recorder); err != nil {
+		t.Fatalf("PutWithOptions failed: %v", err)
+	}
+	c, err := recorder.Cassette()
+	if err != nil {
+		t.Fatalf("Cassette failed: %v", err)
+	}
+
+	// Outbox messages get a new ID on every run
+	if err := put(cassette.NewReplayer(c)); err == nil {
+		t.Error("replay matched a request with another outbox message ID")
+	}
+	if err := put(cassette.NewReplayer(c, cassette.IgnoreValues(cassette.UUIDPattern))); err != nil {
+		t.Errorf("replay with IgnoreValues(UUIDPattern) failed: %v", err)
+	}
+}
+
+func TestReplayMatchesMultiFieldUpdates(t *testing.T) {
+	ctx := context.Background()
+	update := func(client ddb.DynamoDBAPI) error {
+		store := ddb.NewDynamodbDataStoreWithClient[conformance.Item](client, "entities", ddb.WithRegistry(conformance.NewRegistry()))
+		return store.UpdateWithCondition(ctx, conformance.Item{ID: "a"},
+			map[string]interface{}{"Color": "blue", "Group": "h", "ID": "a"}, "")
+	}
+	recorder := cassette.NewRecorder(fakeddb.New())
+	if err := update(recorder); err != nil {
+		t.Fatalf("UpdateWithCondition failed: %v", err)
+	}
+	c, err := recorder.Cassette()
+	if err != nil {
+		t.Fatalf("Cassette failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := update(cassette.NewReplayer(c)); err != nil {
+			t.Fatalf("replay %d failed: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package cassette
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/items"
+)
+
+var (
+	attributeValueType = reflect.TypeOf((*types.AttributeValue)(nil)).Elem()
+	timeType           = reflect.TypeOf(time.Time{})
+)
+
+// encode converts an SDK input, output or error into a tree for encoding/json, with
+// attribute values in the DynamoDB JSON format. Zero struct fields and the response
+// metadata are left out.
+func encode(v reflect.Value) (any, error) {
+	switch {
+	case v.Type() == attributeValueType:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return items.MarshalValue(v.Interface().(types.AttributeValue))
+	case v.Type() == timeType:
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return encode(v.Elem())
+	case reflect.Struct:
+		obj := map[string]any{}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() || field.Name == "ResultMetadata" || v.Field(i).IsZero() {
+				continue
+			}
+			fv, err := encode(v.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.Name, err)
+			}
+			obj[field.Name] = fv
+		}
+		return obj, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		obj := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			ev, err := encode(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", iter.Key().String(), err)
+			}
+			obj[iter.Key().String()] = ev
+		}
+		return obj, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			ev, err := encode(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			list[i] = ev
+		}
+		return list, nil
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return v.Interface(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// marshal encodes 'v' with encode and encoding/json
+func marshal(v any) (json.RawMessage, error) {
+	tree, err := encode(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// decode sets 'v', which must be settable, from JSON written by encode
+func decode(data json.RawMessage, v reflect.Value) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	switch {
+	case v.Type() == attributeValueType:
+		av, err := items.UnmarshalValue(data)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(av))
+		return nil
+	case v.Type() == timeType:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := decode(data, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		for name, raw := range obj {
+			field, ok := v.Type().FieldByName(name)
+			if !ok || !field.IsExported() {
+				return fmt.Errorf("unknown field %s of %s", name, v.Type())
+			}
+			if err := decode(raw, v.FieldByIndex(field.Index)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(obj))
+		for key, raw := range obj {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decode(raw, elem); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return json.Unmarshal(data, v.Addr().Interface())
+		}
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, raw := range list {
+			if err := decode(raw, s.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+// unmarshal decodes JSON written by marshal into 'v', a pointer
+func unmarshal(data json.RawMessage, v any) error {
+	return decode(data, reflect.ValueOf(v).Elem())
+}
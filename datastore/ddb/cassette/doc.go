@@ -0,0 +1,31 @@
+/*
+Package cassette records DynamoDB traffic to JSON cassette files and replays it, so that
+tests written against a real table or DynamoDB Local run deterministically without one.
+
+A Recorder wraps a client and captures every request with its response or error; a
+Replayer serves the recorded responses. Both implement the DynamoDB client interface of
+the ddb store:
+
+	recorder := cassette.NewRecorder(liveClient)
+	store := ddb.NewDynamodbDataStoreWithClient[User](recorder, "entities")
+	// ... run the scenario
+	err := recorder.Save("testdata/users.json")
+
+	c, err := cassette.Load("testdata/users.json")
+	store := ddb.NewDynamodbDataStoreWithClient[User](cassette.NewReplayer(c), "entities")
+
+Requests are matched structurally, in recorded order for identical requests.
+ClientRequestToken and RFC 3339 timestamps, e.g. the @UpdatedAt attribute written by
+the store, are ignored; IgnoreFields ignores further volatile attributes and IgnoreValues
+volatile parts of values, e.g. the UUIDs in the keys of outbox messages. Typed errors
+such as ConditionalCheckFailedException and TransactionCanceledException are replayed
+with their fields, so errors.As works on them.
+
+ForTest switches between both in tests, recording when ENTITYSTORE_CASSETTE_MODE is
+"record":
+
+	client := cassette.ForTest(t, "testdata/gsi_query.json", func() (ddb.DynamoDBAPI, error) {
+	    return ddb.NewDynamoDBClient(accessKey, secretKey, region, table)
+	})
+*/
+package cassette
@@ -0,0 +1,118 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package cassette
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/suparena/entitystore/datastore/ddb"
+)
+
+// Recorder is a ddb.DynamoDBAPI client passing requests to another client, e.g. one connected to a real
+// table or DynamoDB Local, and recording them with their responses
+type Recorder struct {
+	client ddb.DynamoDBAPI
+
+	mu       sync.Mutex
+	cassette Cassette
+	errs     []error
+}
+
+// NewRecorder records the interactions with 'client'
+func NewRecorder(client ddb.DynamoDBAPI) *Recorder {
+	return &Recorder{client: client}
+}
+
+// record calls the client and records the interaction
+func record[In, Out any](r *Recorder, operation string, params *In, call func() (*Out, error)) (*Out, error) {
+	// Encode the request first, in case the client modifies it
+	request, err := marshal(params)
+	out, callErr := call()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s request: %w", operation, err))
+		return out, callErr
+	}
+	interaction := Interaction{Operation: operation, Request: request}
+	if callErr != nil {
+		interaction.Error, err = recordError(callErr)
+	} else {
+		interaction.Response, err = marshal(out)
+	}
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s response: %w", operation, err))
+		return out, callErr
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	return out, callErr
+}
+
+// Cassette returns the interactions recorded so far. It fails if an interaction could
+// not be recorded.
+func (r *Recorder) Cassette() (*Cassette, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errs) > 0 {
+		return nil, fmt.Errorf("failed to record interactions: %w", errors.Join(r.errs...))
+	}
+	return &Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}, nil
+}
+
+// Save writes the interactions recorded so far to 'path'
+func (r *Recorder) Save(path string) error {
+	c, err := r.Cassette()
+	if err != nil {
+		return err
+	}
+	return c.Save(path)
+}
+
+// GetItem records a GetItem call
+func (r *Recorder) GetItem(ctx context.Context, params *sdk.GetItemInput, optFns ...func(*sdk.Options)) (*sdk.GetItemOutput, error) {
+	return record(r, "GetItem", params, func() (*sdk.GetItemOutput, error) {
+		return r.client.GetItem(ctx, params, optFns...)
+	})
+}
+
+// PutItem records a PutItem call
+func (r *Recorder) PutItem(ctx context.Context, params *sdk.PutItemInput, optFns ...func(*sdk.Options)) (*sdk.PutItemOutput, error) {
+	return record(r, "PutItem", params, func() (*sdk.PutItemOutput, error) {
+		return r.client.PutItem(ctx, params, optFns...)
+	})
+}
+
+// DeleteItem records a DeleteItem call
+func (r *Recorder) DeleteItem(ctx context.Context, params *sdk.DeleteItemInput, optFns ...func(*sdk.Options)) (*sdk.DeleteItemOutput, error) {
+	return record(r, "DeleteItem", params, func() (*sdk.DeleteItemOutput, error) {
+		return r.client.DeleteItem(ctx, params, optFns...)
+	})
+}
+
+// UpdateItem records an UpdateItem call
+func (r *Recorder) UpdateItem(ctx context.Context, params *sdk.UpdateItemInput, optFns ...func(*sdk.Options)) (*sdk.UpdateItemOutput, error) {
+	return record(r, "UpdateItem", params, func() (*sdk.UpdateItemOutput, error) {
+		return r.client.UpdateItem(ctx, params, optFns...)
+	})
+}
+
+// Query records a Query call
+func (r *Recorder) Query(ctx context.Context, params *sdk.QueryInput, optFns ...func(*sdk.Options)) (*sdk.QueryOutput, error) {
+	return record(r, "Query", params, func() (*sdk.QueryOutput, error) {
+		return r.client.Query(ctx, params, optFns...)
+	})
+}
+
+// TransactWriteItems records a TransactWriteItems call
+func (r *Recorder) TransactWriteItems(ctx context.Context, params *sdk.TransactWriteItemsInput, optFns ...func(*sdk.Options)) (*sdk.TransactWriteItemsOutput, error) {
+	return record(r, "TransactWriteItems", params, func() (*sdk.TransactWriteItemsOutput, error) {
+		return r.client.TransactWriteItems(ctx, params, optFns...)
+	})
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Option configures a Replayer
+type Option func(*replayOptions)
+
+type replayOptions struct {
+	ignored    map[string]bool
+	values     []*regexp.Regexp
+	timestamps bool
+}
+
+// IgnoreFields ignores request fields, item attributes and expression placeholders with
+// these names when matching requests, e.g. IgnoreFields("ExpiresAt", ":now")
+func IgnoreFields(names ...string) Option {
+	return func(o *replayOptions) {
+		for _, name := range names {
+			o.ignored[name] = true
+		}
+	}
+}
+
+// UUIDPattern matches UUIDs, such as the IDs the outbox generates for its messages
+var UUIDPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// IgnoreValues ignores the parts of string values matching 'patterns' when matching
+// requests, also within key values and expressions, e.g. IgnoreValues(UUIDPattern) for
+// the keys of outbox messages
+func IgnoreValues(patterns ...*regexp.Regexp) Option {
+	return func(o *replayOptions) {
+		o.values = append(o.values, patterns...)
+	}
+}
+
+// MatchTimestamps compares RFC 3339 timestamps in requests instead of ignoring them
+func MatchTimestamps() Option {
+	return func(o *replayOptions) {
+		o.timestamps = true
+	}
+}
+
+// Replayer is a ddb.DynamoDBAPI client serving the responses of a cassette. A request is answered by the
+// first interaction not replayed yet with the same operation and a request matching it
+// structurally: volatile values, i.e. ClientRequestToken, RFC 3339 timestamps and the
+// fields and values passed to IgnoreFields and IgnoreValues, are ignored.
+type Replayer struct {
+	cassette *Cassette
+	options  replayOptions
+
+	mu       sync.Mutex
+	requests []any
+	replayed []bool
+}
+
+// NewReplayer serves the responses of 'c'
+func NewReplayer(c *Cassette, opts ...Option) *Replayer {
+	options := replayOptions{ignored: map[string]bool{"ClientRequestToken": true}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &Replayer{
+		cassette: c,
+		options:  options,
+		requests: make([]any, len(c.Interactions)),
+		replayed: make([]bool, len(c.Interactions)),
+	}
+}
+
+// timestampPattern matches RFC 3339 timestamps, also within key values
+var timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`)
+
+// normalize decodes a request and removes its volatile values
+func (p *Replayer) normalize(data json.RawMessage) (any, error) {
+	var tree any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, e := range v {
+				if p.options.ignored[k] {
+					delete(v, k)
+					continue
+				}
+				v[k] = walk(e)
+			}
+		case []any:
+			for i, e := range v {
+				v[i] = walk(e)
+			}
+		case string:
+			if !p.options.timestamps {
+				v = timestampPattern.ReplaceAllString(v, "<timestamp>")
+			}
+			for _, pattern := range p.options.values {
+				v = pattern.ReplaceAllString(v, "<ignored>")
+			}
+			return v
+		}
+		return v
+	}
+	return walk(tree), nil
+}
+
+// next returns the interaction answering a request and marks it as replayed
+func (p *Replayer) next(operation string, params any) (Interaction, error) {
+	data, err := marshal(params)
+	if err != nil {
+		return Interaction{}, fmt.Errorf("cassette: failed to encode %s request: %w", operation, err)
+	}
+	request, err := p.normalize(data)
+	if err != nil {
+		return Interaction{}, fmt.Errorf("cassette: failed to encode %s request: %w", operation, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, interaction := range p.cassette.Interactions {
+		if p.replayed[i] || interaction.Operation != operation {
+			continue
+		}
+		if p.requests[i] == nil {
+			if p.requests[i], err = p.normalize(interaction.Request); err != nil {
+				return Interaction{}, fmt.Errorf("cassette: invalid request of interaction %d: %w", i, err)
+			}
+		}
+		if reflect.DeepEqual(p.requests[i], request) {
+			p.replayed[i] = true
+			return interaction, nil
+		}
+	}
+	return Interaction{}, fmt.Errorf("cassette: no recorded %s interaction matches the request %s", operation, data)
+}
+
+// replay answers a request from the cassette
+func replay[Out any](p *Replayer, operation string, params any) (*Out, error) {
+	interaction, err := p.next(operation, params)
+	if err != nil {
+		return nil, err
+	}
+	if interaction.Error != nil {
+		return nil, interaction.Error.Err()
+	}
+	out := new(Out)
+	if err := unmarshal(interaction.Response, out); err != nil {
+		return nil, fmt.Errorf("cassette: failed to decode %s response: %w", operation, err)
+	}
+	return out, nil
+}
+
+// Unreplayed returns the interactions not replayed yet
+func (p *Replayer) Unreplayed() []Interaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var res []Interaction
+	for i, interaction := range p.cassette.Interactions {
+		if !p.replayed[i] {
+			res = append(res, interaction)
+		}
+	}
+	return res
+}
+
+// GetItem replays a GetItem call
+func (p *Replayer) GetItem(ctx context.Context, params *sdk.GetItemInput, optFns ...func(*sdk.Options)) (*sdk.GetItemOutput, error) {
+	return replay[sdk.GetItemOutput](p, "GetItem", params)
+}
+
+// PutItem replays a PutItem call
+func (p *Replayer) PutItem(ctx context.Context, params *sdk.PutItemInput, optFns ...func(*sdk.Options)) (*sdk.PutItemOutput, error) {
+	return replay[sdk.PutItemOutput](p, "PutItem", params)
+}
+
+// DeleteItem replays a DeleteItem call
+func (p *Replayer) DeleteItem(ctx context.Context, params *sdk.DeleteItemInput, optFns ...func(*sdk.Options)) (*sdk.DeleteItemOutput, error) {
+	return replay[sdk.DeleteItemOutput](p, "DeleteItem", params)
+}
+
+// UpdateItem replays an UpdateItem call
+func (p *Replayer) UpdateItem(ctx context.Context, params *sdk.UpdateItemInput, optFns ...func(*sdk.Options)) (*sdk.UpdateItemOutput, error) {
+	return replay[sdk.UpdateItemOutput](p, "UpdateItem", params)
+}
+
+// Query replays a Query call
+func (p *Replayer) Query(ctx context.Context, params *sdk.QueryInput, optFns ...func(*sdk.Options)) (*sdk.QueryOutput, error) {
+	return replay[sdk.QueryOutput](p, "Query", params)
+}
+
+// TransactWriteItems replays a TransactWriteItems call
+func (p *Replayer) TransactWriteItems(ctx context.Context, params *sdk.TransactWriteItemsInput, optFns ...func(*sdk.Options)) (*sdk.TransactWriteItemsOutput, error) {
+	return replay[sdk.TransactWriteItemsOutput](p, "TransactWriteItems", params)
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package cassette
+
+import (
+	"os"
+	"testing"
+
+	"github.com/suparena/entitystore/datastore/ddb"
+)
+
+// ModeEnv selects the mode of ForTest: "record" records cassettes against live
+// clients, anything else replays them
+const ModeEnv = "ENTITYSTORE_CASSETTE_MODE"
+
+// ForTest returns the client of a test. With ModeEnv set to "record", it records the
+// interactions with the client returned by 'live' and saves them to 'path' when the test
+// ends. Otherwise it replays the cassette at 'path' and fails the test if interactions
+// are left unreplayed.
+func ForTest(t testing.TB, path string, live func() (ddb.DynamoDBAPI, error), opts ...Option) ddb.DynamoDBAPI {
+	t.Helper()
+	if os.Getenv(ModeEnv) == "record" {
+		client, err := live()
+		if err != nil {
+			t.Fatalf("failed to create the client to record %s: %v", path, err)
+		}
+		recorder := NewRecorder(client)
+		t.Cleanup(func() {
+			if err := recorder.Save(path); err != nil {
+				t.Errorf("failed to save cassette %s: %v", path, err)
+			}
+		})
+		return recorder
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("%v; record it with %s=record", err, ModeEnv)
+	}
+	replayer := NewReplayer(c, opts...)
+	t.Cleanup(func() {
+		if left := replayer.Unreplayed(); len(left) > 0 && !t.Failed() {
+			t.Errorf("cassette %s: %d recorded interactions were not replayed, the first is %s %s",
+				path, len(left), left[0].Operation, left[0].Request)
+		}
+	})
+	return replayer
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package changefeed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/registry"
+)
+
+// EventName identifies the kind of modification captured by a stream record
+type EventName string
+
+const (
+	// EventInsert is emitted when a new item is added to the table
+	EventInsert EventName = "INSERT"
+	// EventModify is emitted when attributes of an existing item change
+	EventModify EventName = "MODIFY"
+	// EventRemove is emitted when an item is deleted (including TTL expiry)
+	EventRemove EventName = "REMOVE"
+)
+
+// entityTypeAttribute is the attribute DynamodbDataStore injects on every Put
+const entityTypeAttribute = "EntityType"
+
+// Record is a backend-neutral representation of a single stream record.
+// Images are expressed with DynamoDB attribute values regardless of whether the
+// record came from the Streams API or a Lambda event.
+type Record struct {
+	EventID                 string
+	EventName               EventName
+	ShardID                 string
+	SequenceNumber          string
+	ApproximateCreationTime time.Time
+	Keys                    map[string]types.AttributeValue
+	OldImage                map[string]types.AttributeValue
+	NewImage                map[string]types.AttributeValue
+}
+
+// EntityType returns the EntityType attribute of the record, preferring the new image
+func (r Record) EntityType() string {
+	for _, image := range []map[string]types.AttributeValue{r.NewImage, r.OldImage} {
+		if attr, ok := image[entityTypeAttribute].(*types.AttributeValueMemberS); ok {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Change is a decoded stream record for entity type T.
+// Old is nil for inserts and New is nil for removals; either may also be nil when
+// the stream view type does not include the corresponding image.
+type Change[T any] struct {
+	EventName               EventName
+	EventID                 string
+	EntityType              string
+	ShardID                 string
+	SequenceNumber          string
+	ApproximateCreationTime time.Time
+	Keys                    map[string]types.AttributeValue
+	Old                     *T
+	New                     *T
+}
+
+// Handler processes a typed change. Returning an error stops the shard (or fails the
+// Lambda batch) so that the record is delivered again.
+type Handler[T any] func(ctx context.Context, change Change[T]) error
+
+// dispatchFunc decodes a record and invokes a typed handler
+type dispatchFunc func(ctx context.Context, rec Record) error
+
+// Dispatcher routes records to the handler registered for their EntityType
+type Dispatcher struct {
+	mu       sync.RWMutex
+	handlers map[string]dispatchFunc
+	fallback func(ctx context.Context, rec Record) error
+	registry *registry.Registry
+	logger   *slog.Logger
+}
+
+// DispatcherOption configures a Dispatcher
+type DispatcherOption func(*Dispatcher)
+
+// WithRegistry makes the Dispatcher decode images with the unmarshal functions of 'r'
+// instead of registry.Default()
+func WithRegistry(r *registry.Registry) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.registry = r
+	}
+}
+
+// WithLogger sets the logger of the record failures that HandleLambdaEvent reports as
+// batch item failures, slog.Default() by default
+func WithLogger(l *slog.Logger) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.logger = l
+	}
+}
+
+// NewDispatcher creates an empty Dispatcher
+func NewDispatcher(opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		handlers: make(map[string]dispatchFunc),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.registry = registry.OrDefault(d.registry)
+	if d.logger == nil {
+		d.logger = slog.Default()
+	}
+	return d
+}
+
+// Handle registers fn for the entity type of T. The entity type name is the one
+// DynamodbDataStore writes for T on Put.
+func Handle[T any](d *Dispatcher, fn Handler[T]) {
+	HandleEntityType(d, entityTypeOf[T](d.registry), fn)
+}
+
+// HandleEntityType registers fn for an explicit EntityType value.
+// This is useful when several entity types share a Go representation.
+func HandleEntityType[T any](d *Dispatcher, entityType string, fn Handler[T]) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handlers[entityType] = func(ctx context.Context, rec Record) error {
+		change := Change[T]{
+			EventName:               rec.EventName,
+			EventID:                 rec.EventID,
+			EntityType:              entityType,
+			ShardID:                 rec.ShardID,
+			SequenceNumber:          rec.SequenceNumber,
+			ApproximateCreationTime: rec.ApproximateCreationTime,
+			Keys:                    rec.Keys,
+		}
+
+		var err error
+		if change.Old, err = decodeImage[T](d.registry, entityType, rec.OldImage); err != nil {
+			return fmt.Errorf("failed to decode old image for EntityType %q: %w", entityType, err)
+		}
+		if change.New, err = decodeImage[T](d.registry, entityType, rec.NewImage); err != nil {
+			return fmt.Errorf("failed to decode new image for EntityType %q: %w", entityType, err)
+		}
+		return fn(ctx, change)
+	}
+}
+
+// HandleUnknown registers a handler for records whose EntityType has no typed handler.
+// Without it such records are skipped.
+func (d *Dispatcher) HandleUnknown(fn func(ctx context.Context, rec Record) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fallback = fn
+}
+
+// Dispatch decodes a record and invokes the matching handler
+func (d *Dispatcher) Dispatch(ctx context.Context, rec Record) error {
+	entityType := rec.EntityType()
+
+	d.mu.RLock()
+	fn, ok := d.handlers[entityType]
+	if !ok {
+		// Items stored under a legacy alias go to the handler of the current name
+		fn, ok = d.handlers[d.registry.ResolveEntityType(entityType)]
+	}
+	fallback := d.fallback
+	d.mu.RUnlock()
+
+	if ok {
+		return fn(ctx, rec)
+	}
+	if fallback != nil {
+		return fallback(ctx, rec)
+	}
+	return nil
+}
+
+// decodeImage converts a stream image into *T using the type registry.
+// A nil or empty image yields a nil result.
+func decodeImage[T any](reg *registry.Registry, entityType string, image map[string]types.AttributeValue) (*T, error) {
+	if len(image) == 0 {
+		return nil, nil
+	}
+
+	// Upgrade images written with an older schema version, mirroring GetOne.
+	image, _, err := reg.Upcast(entityType, image)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work on a copy without the EntityType attribute, mirroring GetOne.
+	item := make(map[string]types.AttributeValue, len(image))
+	for k, v := range image {
+		if k != entityTypeAttribute {
+			item[k] = v
+		}
+	}
+
+	unmarshalFn, err := reg.GetUnmarshalFunc(entityType)
+	if err != nil {
+		// No registered function: unmarshal directly into T.
+		result := new(T)
+		if err := attributevalue.UnmarshalMap(item, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	obj, err := unmarshalFn(item)
+	if err != nil {
+		return nil, err
+	}
+	switch typed := obj.(type) {
+	case *T:
+		return typed, nil
+	case T:
+		return &typed, nil
+	default:
+		var zero T
+		return nil, fmt.Errorf("registry returned %T, expected %T", obj, zero)
+	}
+}
+
+// entityTypeOf mirrors the name DynamodbDataStore injects as EntityType for T
+func entityTypeOf[T any](reg *registry.Registry) string {
+	return reg.EntityTypeName(reflect.TypeOf((*T)(nil)).Elem())
+}
@@ -0,0 +1,483 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/suparena/entitystore/registry"
+)
+
+type ChangeFeedUser struct {
+	ID    string
+	Email string
+}
+
+func init() {
+	registry.RegisterType("ChangeFeedUser", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &ChangeFeedUser{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+}
+
+// fakeStreams is an in-memory StreamsClient. Iterators are "<shardID>:<offset>".
+type fakeStreams struct {
+	mu      sync.Mutex
+	shards  []streamtypes.Shard
+	records map[string][]streamtypes.Record
+	open    map[string]bool
+	// expire makes the next GetRecords call of a shard fail with an expired iterator
+	expire map[string]bool
+	// iteratorTypes records the types of the iterators obtained per shard
+	iteratorTypes map[string][]streamtypes.ShardIteratorType
+}
+
+func (f *fakeStreams) DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &dynamodbstreams.DescribeStreamOutput{
+		StreamDescription: &streamtypes.StreamDescription{Shards: f.shards},
+	}, nil
+}
+
+func (f *fakeStreams) GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	shardID := aws.ToString(params.ShardId)
+	if f.iteratorTypes == nil {
+		f.iteratorTypes = make(map[string][]streamtypes.ShardIteratorType)
+	}
+	f.iteratorTypes[shardID] = append(f.iteratorTypes[shardID], params.ShardIteratorType)
+	offset := 0
+	if params.ShardIteratorType == streamtypes.ShardIteratorTypeLatest {
+		offset = len(f.records[shardID])
+	}
+	if params.ShardIteratorType == streamtypes.ShardIteratorTypeAfterSequenceNumber {
+		for i, r := range f.records[shardID] {
+			if aws.ToString(r.Dynamodb.SequenceNumber) == aws.ToString(params.SequenceNumber) {
+				offset = i + 1
+			}
+		}
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{
+		ShardIterator: aws.String(fmt.Sprintf("%s:%d", shardID, offset)),
+	}, nil
+}
+
+func (f *fakeStreams) GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var shardID string
+	var offset int
+	it := aws.ToString(params.ShardIterator)
+	for i := len(it) - 1; i >= 0; i-- {
+		if it[i] == ':' {
+			shardID = it[:i]
+			offset, _ = strconv.Atoi(it[i+1:])
+			break
+		}
+	}
+
+	if f.expire[shardID] {
+		delete(f.expire, shardID)
+		return nil, &streamtypes.ExpiredIteratorException{Message: aws.String("expired")}
+	}
+	recs := f.records[shardID][offset:]
+	out := &dynamodbstreams.GetRecordsOutput{Records: recs}
+	if f.open[shardID] {
+		out.NextShardIterator = aws.String(fmt.Sprintf("%s:%d", shardID, offset+len(recs)))
+	}
+	return out, nil
+}
+
+func streamRecord(seq, event, id, email string) streamtypes.Record {
+	image := map[string]streamtypes.AttributeValue{
+		"PK":         &streamtypes.AttributeValueMemberS{Value: "USER#" + id},
+		"SK":         &streamtypes.AttributeValueMemberS{Value: "USER#" + id},
+		"EntityType": &streamtypes.AttributeValueMemberS{Value: "ChangeFeedUser"},
+		"ID":         &streamtypes.AttributeValueMemberS{Value: id},
+		"Email":      &streamtypes.AttributeValueMemberS{Value: email},
+	}
+	sr := &streamtypes.StreamRecord{
+		SequenceNumber: aws.String(seq),
+		Keys: map[string]streamtypes.AttributeValue{
+			"PK": image["PK"],
+			"SK": image["SK"],
+		},
+	}
+	if event == "REMOVE" {
+		sr.OldImage = image
+	} else {
+		sr.NewImage = image
+	}
+	return streamtypes.Record{
+		EventID:   aws.String("evt-" + seq),
+		EventName: streamtypes.OperationType(event),
+		Dynamodb:  sr,
+	}
+}
+
+func TestDispatcherDecodesTypedChanges(t *testing.T) {
+	d := NewDispatcher()
+
+	var got []Change[ChangeFeedUser]
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		got = append(got, c)
+		return nil
+	})
+
+	var unknown int
+	d.HandleUnknown(func(ctx context.Context, rec Record) error {
+		unknown++
+		return nil
+	})
+
+	rec, err := fromStreamsRecord("shard-1", streamRecord("1", "INSERT", "42", "a@example.com"))
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	if err := d.Dispatch(context.Background(), rec); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	rec.NewImage["EntityType"] = &types.AttributeValueMemberS{Value: "Other"}
+	if err := d.Dispatch(context.Background(), rec); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 typed change, got %d", len(got))
+	}
+	c := got[0]
+	if c.EventName != EventInsert || c.Old != nil || c.New == nil {
+		t.Fatalf("unexpected change: %+v", c)
+	}
+	if c.New.ID != "42" || c.New.Email != "a@example.com" {
+		t.Errorf("unexpected decoded entity: %+v", c.New)
+	}
+	if c.ShardID != "shard-1" || c.SequenceNumber != "1" {
+		t.Errorf("unexpected record metadata: shard=%s seq=%s", c.ShardID, c.SequenceNumber)
+	}
+	if unknown != 1 {
+		t.Errorf("expected unknown handler to be called once, got %d", unknown)
+	}
+}
+
+func TestConsumerProcessesParentBeforeChild(t *testing.T) {
+	client := &fakeStreams{
+		shards: []streamtypes.Shard{
+			{ShardId: aws.String("child"), ParentShardId: aws.String("parent")},
+			{ShardId: aws.String("parent")},
+		},
+		records: map[string][]streamtypes.Record{
+			"parent": {
+				streamRecord("1", "INSERT", "1", "one@example.com"),
+				streamRecord("2", "MODIFY", "1", "uno@example.com"),
+			},
+			"child": {
+				streamRecord("3", "REMOVE", "1", "uno@example.com"),
+			},
+		},
+		open: map[string]bool{"child": true},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var seqs []string
+	d := NewDispatcher()
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seqs = append(seqs, c.SequenceNumber)
+		if c.EventName == EventRemove {
+			if c.Old == nil || c.Old.Email != "uno@example.com" {
+				t.Errorf("unexpected old image on remove: %+v", c.Old)
+			}
+			cancel()
+		}
+		return nil
+	})
+
+	checkpoints := NewMemoryCheckpointer()
+	consumer := NewConsumer(client, "arn:stream", d,
+		WithCheckpointer(checkpoints),
+		WithPollInterval(time.Millisecond),
+	)
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer did not finish")
+	}
+
+	if fmt.Sprint(seqs) != "[1 2 3]" {
+		t.Errorf("expected records in order [1 2 3], got %v", seqs)
+	}
+
+	cps := checkpoints.Checkpoints()
+	if cp := cps["parent"]; !cp.Closed || cp.SequenceNumber != "2" {
+		t.Errorf("unexpected parent checkpoint: %+v", cp)
+	}
+	if cp := cps["child"]; cp.Closed || cp.SequenceNumber != "3" {
+		t.Errorf("unexpected child checkpoint: %+v", cp)
+	}
+}
+
+func TestConsumerStartsShardsOfUnknownParentsAtStartingPosition(t *testing.T) {
+	// Shards roll over every few hours: the parent of an open shard is usually trimmed
+	client := &fakeStreams{
+		shards: []streamtypes.Shard{
+			{ShardId: aws.String("s2"), ParentShardId: aws.String("s1")},
+		},
+		records: map[string][]streamtypes.Record{
+			"s2": {streamRecord("1", "INSERT", "1", "one@example.com")},
+		},
+		open: map[string]bool{"s2": true},
+	}
+
+	var seqs []string
+	d := NewDispatcher()
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		seqs = append(seqs, c.SequenceNumber)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	consumer := NewConsumer(client, "arn:stream", d,
+		WithStartingPosition(streamtypes.ShardIteratorTypeLatest),
+		WithPollInterval(time.Millisecond),
+	)
+	done := make(chan error, 1)
+	go func() { done <- consumer.Run(ctx) }()
+
+	iteratorTypes := func() []streamtypes.ShardIteratorType {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.iteratorTypes["s2"]
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(iteratorTypes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if got := iteratorTypes(); len(got) != 1 || got[0] != streamtypes.ShardIteratorTypeLatest {
+		t.Errorf("iterator types = %v, want [LATEST]", got)
+	}
+	if len(seqs) != 0 {
+		t.Errorf("expected no records before LATEST, got %v", seqs)
+	}
+}
+
+func TestConsumerResumesFromCheckpoint(t *testing.T) {
+	client := &fakeStreams{
+		shards: []streamtypes.Shard{{ShardId: aws.String("s1")}},
+		records: map[string][]streamtypes.Record{
+			"s1": {
+				streamRecord("1", "INSERT", "1", "one@example.com"),
+				streamRecord("2", "INSERT", "2", "two@example.com"),
+			},
+		},
+	}
+
+	checkpoints := NewMemoryCheckpointer()
+	_ = checkpoints.SetCheckpoint(context.Background(), "s1", Checkpoint{SequenceNumber: "1"})
+
+	var seqs []string
+	d := NewDispatcher()
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		seqs = append(seqs, c.SequenceNumber)
+		return nil
+	})
+
+	consumer := NewConsumer(client, "arn:stream", d, WithCheckpointer(checkpoints))
+	if err := consumer.processShard(context.Background(), "s1", false); err != nil {
+		t.Fatalf("processShard failed: %v", err)
+	}
+	if fmt.Sprint(seqs) != "[2]" {
+		t.Errorf("expected only record 2 to be processed, got %v", seqs)
+	}
+}
+
+func TestConsumerReopensExpiredIteratorAtTrimHorizon(t *testing.T) {
+	// The iterator opened at LATEST expires before any record was read; reopening at
+	// LATEST again would skip the records written in between
+	client := &fakeStreams{
+		shards: []streamtypes.Shard{{ShardId: aws.String("s1")}},
+		records: map[string][]streamtypes.Record{
+			"s1": {
+				streamRecord("1", "INSERT", "1", "one@example.com"),
+				streamRecord("2", "INSERT", "2", "two@example.com"),
+			},
+		},
+		expire: map[string]bool{"s1": true},
+	}
+
+	var seqs []string
+	d := NewDispatcher()
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		seqs = append(seqs, c.SequenceNumber)
+		return nil
+	})
+
+	consumer := NewConsumer(client, "arn:stream", d, WithStartingPosition(streamtypes.ShardIteratorTypeLatest))
+	if err := consumer.processShard(context.Background(), "s1", false); err != nil {
+		t.Fatalf("processShard failed: %v", err)
+	}
+	if fmt.Sprint(seqs) != "[1 2]" {
+		t.Errorf("expected records 1 and 2 after the expired iterator, got %v", seqs)
+	}
+}
+
+func TestDispatcherWithRegistry(t *testing.T) {
+	reg := registry.New()
+	reg.RegisterType("ChangeFeedUser", func(item map[string]types.AttributeValue) (interface{}, error) {
+		return &ChangeFeedUser{ID: "from-scoped-registry"}, nil
+	})
+	d := NewDispatcher(WithRegistry(reg))
+
+	var got []Change[ChangeFeedUser]
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		got = append(got, c)
+		return nil
+	})
+
+	rec, err := fromStreamsRecord("shard-1", streamRecord("1", "INSERT", "42", "a@example.com"))
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	if err := d.Dispatch(context.Background(), rec); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if len(got) != 1 || got[0].New == nil || got[0].New.ID != "from-scoped-registry" {
+		t.Errorf("expected the unmarshal function of the scoped registry to be used, got %+v", got)
+	}
+}
+
+func TestDispatcherResolvesEntityNames(t *testing.T) {
+	reg := registry.New()
+	if err := reg.RegisterEntityName(reflect.TypeOf(ChangeFeedUser{}), "FeedUser", "LegacyFeedUser"); err != nil {
+		t.Fatalf("RegisterEntityName failed: %v", err)
+	}
+	d := NewDispatcher(WithRegistry(reg))
+
+	var got []string
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		got = append(got, c.New.ID)
+		return nil
+	})
+
+	for _, entityType := range []string{"FeedUser", "LegacyFeedUser", "ChangeFeedUser"} {
+		rec, err := fromStreamsRecord("shard-1", streamRecord("1", "INSERT", entityType, "a@example.com"))
+		if err != nil {
+			t.Fatalf("conversion failed: %v", err)
+		}
+		rec.NewImage["EntityType"] = &types.AttributeValueMemberS{Value: entityType}
+		if err := d.Dispatch(context.Background(), rec); err != nil {
+			t.Fatalf("Dispatch failed: %v", err)
+		}
+	}
+	if fmt.Sprint(got) != "[FeedUser LegacyFeedUser]" {
+		t.Errorf("expected the registered name and its alias to be handled, got %v", got)
+	}
+}
+
+func TestConsumerStopsOnHandlerError(t *testing.T) {
+	client := &fakeStreams{
+		shards: []streamtypes.Shard{{ShardId: aws.String("s1")}},
+		records: map[string][]streamtypes.Record{
+			"s1": {streamRecord("1", "INSERT", "1", "one@example.com")},
+		},
+		open: map[string]bool{"s1": true},
+	}
+
+	handlerErr := errors.New("boom")
+	d := NewDispatcher()
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		return handlerErr
+	})
+
+	checkpoints := NewMemoryCheckpointer()
+	consumer := NewConsumer(client, "arn:stream", d, WithCheckpointer(checkpoints))
+	err := consumer.Run(context.Background())
+	if !errors.Is(err, handlerErr) {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	if _, ok, _ := checkpoints.GetCheckpoint(context.Background(), "s1"); ok {
+		t.Error("failed record must not be checkpointed")
+	}
+}
+
+func TestHandleLambdaEvent(t *testing.T) {
+	var logs bytes.Buffer
+	d := NewDispatcher(WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	var got []Change[ChangeFeedUser]
+	Handle(d, func(ctx context.Context, c Change[ChangeFeedUser]) error {
+		if c.New != nil && c.New.ID == "bad" {
+			return errors.New("rejected")
+		}
+		got = append(got, c)
+		return nil
+	})
+
+	image := func(id string) map[string]events.DynamoDBAttributeValue {
+		return map[string]events.DynamoDBAttributeValue{
+			"EntityType": events.NewStringAttribute("ChangeFeedUser"),
+			"ID":         events.NewStringAttribute(id),
+			"Email":      events.NewStringAttribute(id + "@example.com"),
+		}
+	}
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{
+		{EventID: "a", EventName: "INSERT", Change: events.DynamoDBStreamRecord{SequenceNumber: "10", NewImage: image("ok")}},
+		{EventID: "b", EventName: "MODIFY", Change: events.DynamoDBStreamRecord{SequenceNumber: "11", NewImage: image("bad")}},
+		{EventID: "c", EventName: "INSERT", Change: events.DynamoDBStreamRecord{SequenceNumber: "12", NewImage: image("later")}},
+	}}
+
+	resp, err := d.HandleLambdaEvent(context.Background(), event)
+	if err != nil {
+		t.Fatalf("failures must be reported per item, not as an error: %v", err)
+	}
+	if len(resp.BatchItemFailures) != 1 || resp.BatchItemFailures[0].ItemIdentifier != "11" {
+		t.Errorf("unexpected batch item failures: %+v", resp.BatchItemFailures)
+	}
+	if len(got) != 1 || got[0].New.Email != "ok@example.com" {
+		t.Errorf("expected only the first record to be handled, got %+v", got)
+	}
+	if !strings.Contains(logs.String(), "rejected") {
+		t.Errorf("the failure was not logged: %q", logs.String())
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package changefeed
+
+import (
+	"context"
+	"sync"
+)
+
+// Checkpoint records how far a shard has been processed
+type Checkpoint struct {
+	// SequenceNumber is the last record that was handled successfully
+	SequenceNumber string
+	// Closed is set once the shard has been read to its end (for example after a split)
+	Closed bool
+}
+
+// Checkpointer persists per-shard progress so a restarted Consumer resumes where it stopped
+type Checkpointer interface {
+	GetCheckpoint(ctx context.Context, shardID string) (Checkpoint, bool, error)
+	SetCheckpoint(ctx context.Context, shardID string, cp Checkpoint) error
+}
+
+// MemoryCheckpointer is an in-process Checkpointer, suitable for tests and for
+// consumers that are fine with replaying from their starting position after a restart
+type MemoryCheckpointer struct {
+	mu          sync.RWMutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewMemoryCheckpointer creates an empty MemoryCheckpointer
+func NewMemoryCheckpointer() *MemoryCheckpointer {
+	return &MemoryCheckpointer{
+		checkpoints: make(map[string]Checkpoint),
+	}
+}
+
+// GetCheckpoint returns the stored checkpoint for a shard
+func (m *MemoryCheckpointer) GetCheckpoint(ctx context.Context, shardID string) (Checkpoint, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cp, ok := m.checkpoints[shardID]
+	return cp, ok, nil
+}
+
+// SetCheckpoint stores the checkpoint for a shard
+func (m *MemoryCheckpointer) SetCheckpoint(ctx context.Context, shardID string, cp Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[shardID] = cp
+	return nil
+}
+
+// Checkpoints returns a copy of all stored checkpoints
+func (m *MemoryCheckpointer) Checkpoints() map[string]Checkpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]Checkpoint, len(m.checkpoints))
+	for k, v := range m.checkpoints {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,335 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// StreamsClient is the subset of the DynamoDB Streams API used by the Consumer.
+// *dynamodbstreams.Client satisfies it; tests can provide a local fake.
+type StreamsClient interface {
+	DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// ConsumerOptions configures a Consumer
+type ConsumerOptions struct {
+	Checkpointer         Checkpointer                  // Where shard progress is stored (default: in memory)
+	PollInterval         time.Duration                 // Wait between empty GetRecords calls (default: 1s)
+	ShardRefreshInterval time.Duration                 // How often new shards are discovered (default: 10s)
+	BatchSize            int32                         // Records per GetRecords call (default: 100)
+	StartingPosition     streamtypes.ShardIteratorType // Where shards without a checkpoint start (default: TRIM_HORIZON)
+	ErrorHandler         func(error) bool              // Return true to skip a failed record, false to stop
+}
+
+// ConsumerOption is a functional option for configuring a Consumer
+type ConsumerOption func(*ConsumerOptions)
+
+// DefaultConsumerOptions returns default consumer options
+func DefaultConsumerOptions() ConsumerOptions {
+	return ConsumerOptions{
+		PollInterval:         time.Second,
+		ShardRefreshInterval: 10 * time.Second,
+		BatchSize:            100,
+		StartingPosition:     streamtypes.ShardIteratorTypeTrimHorizon,
+	}
+}
+
+// WithCheckpointer sets the checkpoint store
+func WithCheckpointer(cp Checkpointer) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.Checkpointer = cp
+	}
+}
+
+// WithPollInterval sets the wait between polls of an idle shard
+func WithPollInterval(interval time.Duration) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.PollInterval = interval
+	}
+}
+
+// WithShardRefreshInterval sets how often DescribeStream is called to discover shards
+func WithShardRefreshInterval(interval time.Duration) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.ShardRefreshInterval = interval
+	}
+}
+
+// WithBatchSize sets the GetRecords limit
+func WithBatchSize(size int32) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.BatchSize = size
+	}
+}
+
+// WithStartingPosition sets where shards without a checkpoint start reading.
+// Only TRIM_HORIZON and LATEST are meaningful here; child shards of a parent drained
+// by the Consumer always start at TRIM_HORIZON so no records are lost.
+func WithStartingPosition(pos streamtypes.ShardIteratorType) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.StartingPosition = pos
+	}
+}
+
+// WithErrorHandler sets a handler that decides whether a failed record is skipped
+func WithErrorHandler(handler func(error) bool) ConsumerOption {
+	return func(opts *ConsumerOptions) {
+		opts.ErrorHandler = handler
+	}
+}
+
+// Consumer polls every shard of a DynamoDB stream and dispatches its records
+type Consumer struct {
+	client     StreamsClient
+	streamARN  string
+	dispatcher *Dispatcher
+	options    ConsumerOptions
+}
+
+// NewConsumer creates a Consumer for the given stream
+func NewConsumer(client StreamsClient, streamARN string, dispatcher *Dispatcher, opts ...ConsumerOption) *Consumer {
+	options := DefaultConsumerOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Checkpointer == nil {
+		options.Checkpointer = NewMemoryCheckpointer()
+	}
+
+	return &Consumer{
+		client:     client,
+		streamARN:  streamARN,
+		dispatcher: dispatcher,
+		options:    options,
+	}
+}
+
+// shardState tracks a shard known to the consumer
+type shardState struct {
+	parentID string
+	running  bool
+	done     bool
+}
+
+// shardResult is sent by a shard worker when it stops
+type shardResult struct {
+	shardID string
+	err     error
+}
+
+// Run processes the stream until ctx is cancelled or a record cannot be handled.
+// Parent shards are drained before their children are started, preserving per-item
+// ordering across shard splits. Run returns nil when ctx is cancelled.
+func (c *Consumer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	shards := make(map[string]*shardState)
+	results := make(chan shardResult)
+	running := 0
+
+	ticker := time.NewTicker(c.options.ShardRefreshInterval)
+	defer ticker.Stop()
+
+	// wait drains running shard workers before returning
+	wait := func(err error) error {
+		cancel()
+		for running > 0 {
+			<-results
+			running--
+		}
+		return err
+	}
+
+	refresh := true
+	for {
+		if refresh {
+			if err := c.refreshShards(ctx, shards); err != nil {
+				if ctx.Err() != nil {
+					return wait(nil)
+				}
+				return wait(fmt.Errorf("failed to describe stream: %w", err))
+			}
+			refresh = false
+		}
+
+		// Start every shard whose parent has been fully processed.
+		for id, s := range shards {
+			if s.running || s.done {
+				continue
+			}
+			parent, ok := shards[s.parentID]
+			if ok && !parent.done {
+				continue
+			}
+			s.running = true
+			running++
+			// Only the children of parents drained here start at their oldest record;
+			// the parents of most shards are trimmed or were never seen
+			go func(shardID string, isChild bool) {
+				results <- shardResult{shardID: shardID, err: c.processShard(ctx, shardID, isChild)}
+			}(id, ok)
+		}
+
+		select {
+		case <-ctx.Done():
+			return wait(nil)
+		case <-ticker.C:
+			refresh = true
+		case res := <-results:
+			running--
+			if res.err != nil {
+				if ctx.Err() != nil {
+					return wait(nil)
+				}
+				return wait(fmt.Errorf("shard %s: %w", res.shardID, res.err))
+			}
+			s := shards[res.shardID]
+			s.running = false
+			s.done = true
+			// A closed shard usually means a split; look for its children right away.
+			refresh = true
+		}
+	}
+}
+
+// refreshShards adds shards returned by DescribeStream to the known set
+func (c *Consumer) refreshShards(ctx context.Context, shards map[string]*shardState) error {
+	var startShardID *string
+	for {
+		out, err := c.client.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(c.streamARN),
+			ExclusiveStartShardId: startShardID,
+		})
+		if err != nil {
+			return err
+		}
+		if out.StreamDescription == nil {
+			return nil
+		}
+
+		for _, shard := range out.StreamDescription.Shards {
+			id := aws.ToString(shard.ShardId)
+			if id == "" {
+				continue
+			}
+			if _, known := shards[id]; known {
+				continue
+			}
+			shards[id] = &shardState{parentID: aws.ToString(shard.ParentShardId)}
+		}
+
+		startShardID = out.StreamDescription.LastEvaluatedShardId
+		if startShardID == nil {
+			return nil
+		}
+	}
+}
+
+// processShard reads a shard until it is closed or ctx is cancelled
+func (c *Consumer) processShard(ctx context.Context, shardID string, isChild bool) error {
+	cp, hasCheckpoint, err := c.options.Checkpointer.GetCheckpoint(ctx, shardID)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	if cp.Closed {
+		return nil
+	}
+
+	// Child shards start at their oldest record so that no change is skipped
+	iterator, err := c.shardIterator(ctx, shardID, cp, hasCheckpoint, isChild)
+	if err != nil {
+		return err
+	}
+
+	for iterator != nil {
+		out, err := c.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         aws.Int32(c.options.BatchSize),
+		})
+		if err != nil {
+			var expired *streamtypes.ExpiredIteratorException
+			if errors.As(err, &expired) {
+				// Resume after the last record processed with a fresh iterator. Without
+				// one, restart from the oldest record: reopening at LATEST would skip
+				// the records written since the first iterator was obtained.
+				iterator, err = c.shardIterator(ctx, shardID, cp, cp.SequenceNumber != "", true)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("GetRecords error: %w", err)
+		}
+
+		for _, r := range out.Records {
+			rec, err := fromStreamsRecord(shardID, r)
+			if err == nil {
+				err = c.dispatcher.Dispatch(ctx, rec)
+			}
+			if err != nil {
+				if c.options.ErrorHandler == nil || !c.options.ErrorHandler(err) {
+					return err
+				}
+			}
+			cp.SequenceNumber = rec.SequenceNumber
+		}
+
+		iterator = out.NextShardIterator
+		if iterator == nil {
+			cp.Closed = true
+		}
+		if len(out.Records) > 0 || cp.Closed {
+			if err := c.options.Checkpointer.SetCheckpoint(ctx, shardID, cp); err != nil {
+				return fmt.Errorf("failed to save checkpoint: %w", err)
+			}
+		}
+
+		if iterator != nil && len(out.Records) == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.options.PollInterval):
+			}
+		}
+	}
+
+	return nil
+}
+
+// shardIterator obtains an iterator positioned after the checkpoint, at the oldest record
+// if 'fromStart', or at the configured starting position for shards that have not been
+// read yet
+func (c *Consumer) shardIterator(ctx context.Context, shardID string, cp Checkpoint, hasCheckpoint, fromStart bool) (*string, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn: aws.String(c.streamARN),
+		ShardId:   aws.String(shardID),
+	}
+	switch {
+	case hasCheckpoint && cp.SequenceNumber != "":
+		input.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+		input.SequenceNumber = aws.String(cp.SequenceNumber)
+	case fromStart:
+		input.ShardIteratorType = streamtypes.ShardIteratorTypeTrimHorizon
+	default:
+		input.ShardIteratorType = c.options.StartingPosition
+	}
+
+	out, err := c.client.GetShardIterator(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("GetShardIterator error: %w", err)
+	}
+	return out.ShardIterator, nil
+}
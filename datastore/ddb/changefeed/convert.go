@@ -0,0 +1,179 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package changefeed
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// fromStreamsRecord converts a record returned by the Streams API
+func fromStreamsRecord(shardID string, r streamtypes.Record) (Record, error) {
+	rec := Record{
+		EventName: EventName(r.EventName),
+		ShardID:   shardID,
+	}
+	if r.EventID != nil {
+		rec.EventID = *r.EventID
+	}
+	if r.Dynamodb == nil {
+		return rec, nil
+	}
+
+	sr := r.Dynamodb
+	if sr.SequenceNumber != nil {
+		rec.SequenceNumber = *sr.SequenceNumber
+	}
+	if sr.ApproximateCreationDateTime != nil {
+		rec.ApproximateCreationTime = *sr.ApproximateCreationDateTime
+	}
+
+	var err error
+	if rec.Keys, err = fromStreamsMap(sr.Keys); err != nil {
+		return rec, fmt.Errorf("failed to convert Keys: %w", err)
+	}
+	if rec.OldImage, err = fromStreamsMap(sr.OldImage); err != nil {
+		return rec, fmt.Errorf("failed to convert OldImage: %w", err)
+	}
+	if rec.NewImage, err = fromStreamsMap(sr.NewImage); err != nil {
+		return rec, fmt.Errorf("failed to convert NewImage: %w", err)
+	}
+	return rec, nil
+}
+
+func fromStreamsMap(m map[string]streamtypes.AttributeValue) (map[string]types.AttributeValue, error) {
+	if m == nil {
+		return nil, nil
+	}
+	res := make(map[string]types.AttributeValue, len(m))
+	for k, v := range m {
+		av, err := fromStreamsValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", k, err)
+		}
+		res[k] = av
+	}
+	return res, nil
+}
+
+// fromStreamsValue converts between the structurally identical attribute value
+// types of the dynamodbstreams and dynamodb SDK packages.
+func fromStreamsValue(v streamtypes.AttributeValue) (types.AttributeValue, error) {
+	switch tv := v.(type) {
+	case *streamtypes.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: tv.Value}, nil
+	case *streamtypes.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: tv.Value}, nil
+	case *streamtypes.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: tv.Value}, nil
+	case *streamtypes.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: tv.Value}, nil
+	case *streamtypes.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: tv.Value}, nil
+	case *streamtypes.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: tv.Value}, nil
+	case *streamtypes.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: tv.Value}, nil
+	case *streamtypes.AttributeValueMemberBS:
+		return &types.AttributeValueMemberBS{Value: tv.Value}, nil
+	case *streamtypes.AttributeValueMemberL:
+		list := make([]types.AttributeValue, 0, len(tv.Value))
+		for _, elem := range tv.Value {
+			av, err := fromStreamsValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, av)
+		}
+		return &types.AttributeValueMemberL{Value: list}, nil
+	case *streamtypes.AttributeValueMemberM:
+		m, err := fromStreamsMap(tv.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	default:
+		return nil, fmt.Errorf("unsupported stream attribute value %T", v)
+	}
+}
+
+// fromLambdaRecord converts a record delivered to a Lambda function
+func fromLambdaRecord(r events.DynamoDBEventRecord) (Record, error) {
+	rec := Record{
+		EventID:                 r.EventID,
+		EventName:               EventName(r.EventName),
+		SequenceNumber:          r.Change.SequenceNumber,
+		ApproximateCreationTime: r.Change.ApproximateCreationDateTime.Time,
+	}
+
+	var err error
+	if rec.Keys, err = fromLambdaMap(r.Change.Keys); err != nil {
+		return rec, fmt.Errorf("failed to convert Keys: %w", err)
+	}
+	if rec.OldImage, err = fromLambdaMap(r.Change.OldImage); err != nil {
+		return rec, fmt.Errorf("failed to convert OldImage: %w", err)
+	}
+	if rec.NewImage, err = fromLambdaMap(r.Change.NewImage); err != nil {
+		return rec, fmt.Errorf("failed to convert NewImage: %w", err)
+	}
+	return rec, nil
+}
+
+func fromLambdaMap(m map[string]events.DynamoDBAttributeValue) (map[string]types.AttributeValue, error) {
+	if m == nil {
+		return nil, nil
+	}
+	res := make(map[string]types.AttributeValue, len(m))
+	for k, v := range m {
+		av, err := fromLambdaValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", k, err)
+		}
+		res[k] = av
+	}
+	return res, nil
+}
+
+func fromLambdaValue(v events.DynamoDBAttributeValue) (types.AttributeValue, error) {
+	switch v.DataType() {
+	case events.DataTypeString:
+		return &types.AttributeValueMemberS{Value: v.String()}, nil
+	case events.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: v.Number()}, nil
+	case events.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: v.Binary()}, nil
+	case events.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: v.Boolean()}, nil
+	case events.DataTypeNull:
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: v.StringSet()}, nil
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: v.NumberSet()}, nil
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: v.BinarySet()}, nil
+	case events.DataTypeList:
+		list := make([]types.AttributeValue, 0, len(v.List()))
+		for _, elem := range v.List() {
+			av, err := fromLambdaValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, av)
+		}
+		return &types.AttributeValueMemberL{Value: list}, nil
+	case events.DataTypeMap:
+		m, err := fromLambdaMap(v.Map())
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberM{Value: m}, nil
+	default:
+		return nil, fmt.Errorf("unsupported lambda attribute data type %d", v.DataType())
+	}
+}
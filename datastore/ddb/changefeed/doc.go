@@ -0,0 +1,34 @@
+/*
+Package changefeed consumes DynamoDB Streams and delivers typed change events.
+
+Each stream record is decoded using the EntityType attribute that DynamodbDataStore
+injects at persist time, so handlers receive values of their own entity type instead
+of raw attribute maps:
+
+	d := changefeed.NewDispatcher()
+	changefeed.Handle(d, func(ctx context.Context, c changefeed.Change[User]) error {
+	    if c.EventName == changefeed.EventInsert {
+	        log.Printf("new user %s", c.New.Email)
+	    }
+	    return nil
+	})
+
+Polling Consumer:
+The Consumer reads every shard of a stream through the small StreamsClient interface
+(satisfied by *dynamodbstreams.Client), processes parent shards before their children
+after a split, and checkpoints the last processed sequence number per shard:
+
+	consumer := changefeed.NewConsumer(streamsClient, streamARN, d,
+	    changefeed.WithCheckpointer(checkpointer),
+	    changefeed.WithPollInterval(500*time.Millisecond),
+	)
+	err := consumer.Run(ctx)
+
+Lambda:
+Functions triggered by a DynamoDB event source mapping can reuse the same dispatcher:
+
+	lambda.Start(func(ctx context.Context, e events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	    return d.HandleLambdaEvent(ctx, e)
+	})
+*/
+package changefeed
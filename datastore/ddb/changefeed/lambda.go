@@ -0,0 +1,37 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package changefeed
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandleLambdaEvent dispatches the records of a Lambda DynamoDB event in order.
+// Processing stops at the first failing record, which is reported as a batch item
+// failure so that an event source mapping with ReportBatchItemFailures retries from
+// that record onward. The failure is logged and the returned error is nil, since a
+// returned error makes Lambda retry the whole batch and ignore the response.
+func (d *Dispatcher) HandleLambdaEvent(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	var resp events.DynamoDBEventResponse
+
+	for _, r := range event.Records {
+		rec, err := fromLambdaRecord(r)
+		if err == nil {
+			err = d.Dispatch(ctx, rec)
+		}
+		if err != nil {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.DynamoDBBatchItemFailure{
+				ItemIdentifier: r.Change.SequenceNumber,
+			})
+			d.logger.ErrorContext(ctx, "changefeed record failed",
+				"event_id", r.EventID, "sequence_number", r.Change.SequenceNumber, "error", err)
+			return resp, nil
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/datastore/ddb/internal/emulator"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	"github.com/suparena/entitystore/registry"
+)
+
+// The conformance suite runs against the DynamoDB Local (or compatible emulator) at
+// ENTITYSTORE_DYNAMODB_ENDPOINT, e.g. http://localhost:8000, and against the in-memory
+// fake when it is not set
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, reg *registry.Registry) conformance.Stores {
+		var client DynamoDBAPI = fakeddb.New()
+		table := "conformance"
+		if endpoint := os.Getenv(emulator.EndpointEnv); endpoint != "" {
+			table = "conformance-" + tableNameChars.ReplaceAllString(t.Name(), "-")
+			client = emulator.Table(t, endpoint, table)
+		}
+
+		items := NewDynamodbDataStoreWithClient[conformance.Item](client, table, WithRegistry(reg))
+		notes := NewDynamodbDataStoreWithClient[conformance.Note](client, table, WithRegistry(reg))
+		return conformance.Stores{
+			Items: items,
+			Notes: notes,
+			Create: func(ctx context.Context, item conformance.Item) error {
+				return items.Create(ctx, item)
+			},
+		}
+	})
+}
+
+var tableNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
@@ -32,6 +32,27 @@ The enhanced streaming API supports configurable options:
 	    }),
 	)
 
+Telemetry:
+Operations, query builders and streams are traced with OpenTelemetry spans carrying
+db.system=dynamodb, the table, index and entity type, item counts, pages, retries and
+consumed capacity, and measured with latency, throttle, retry and streamed-item metrics.
+Both are no-ops unless providers are passed:
+
+	store := ddb.NewDynamodbDataStoreWithClient[User](client, "entities",
+	    ddb.WithTracerProvider(otel.GetTracerProvider()),
+	    ddb.WithMeterProvider(otel.GetMeterProvider()),
+	)
+
+Consumed capacity:
+WithReturnConsumedCapacity makes every request ask DynamoDB for the capacity it
+consumed. A CapacityCollector attached to the context aggregates it per table, index and
+operation along with the request IDs, e.g. to log the cost of an API request:
+
+	collector := ddb.NewCapacityCollector()
+	ctx = ddb.WithCapacityCollector(ctx, collector)
+	// ...
+	report := collector.Report()
+
 For usage examples, see the integration tests and documentation.
 */
 package ddb
\ No newline at end of file
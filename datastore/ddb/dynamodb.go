@@ -9,87 +9,169 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/suparena/entitystore/datastore"
+	"github.com/suparena/entitystore/datastore/keys"
 	"github.com/suparena/entitystore/registry"
 	eserrors "github.com/suparena/entitystore/errors"
 	"reflect"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// DynamoDBAPI is the subset of the DynamoDB client used by DynamodbDataStore.
+// *dynamodb.Client satisfies it, which allows substituting fakes or wrappers.
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, params *sdk.GetItemInput, optFns ...func(*sdk.Options)) (*sdk.GetItemOutput, error)
+	PutItem(ctx context.Context, params *sdk.PutItemInput, optFns ...func(*sdk.Options)) (*sdk.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *sdk.DeleteItemInput, optFns ...func(*sdk.Options)) (*sdk.DeleteItemOutput, error)
+	UpdateItem(ctx context.Context, params *sdk.UpdateItemInput, optFns ...func(*sdk.Options)) (*sdk.UpdateItemOutput, error)
+	Query(ctx context.Context, params *sdk.QueryInput, optFns ...func(*sdk.Options)) (*sdk.QueryOutput, error)
+	TransactWriteItems(ctx context.Context, params *sdk.TransactWriteItemsInput, optFns ...func(*sdk.Options)) (*sdk.TransactWriteItemsOutput, error)
+}
+
 // DynamodbDataStore implements storage.DataStore[T] by using AWS DynamoDB as the underlying data store.
 type DynamodbDataStore[T any] struct {
-	client    *sdk.Client
-	tableName string
+	client          DynamoDBAPI
+	tableName       string
+	registry        *registry.Registry
+	fields          *keys.Resolver
+	upcastWriteBack bool
+	returnCapacity  types.ReturnConsumedCapacity
+	outboxIndex     string
+	tel             *telemetry
 }
 
-var macroPattern = regexp.MustCompile(`{([^}]+)}`)
+// StoreOption configures a DynamodbDataStore
+type StoreOption func(*storeOptions)
+
+type storeOptions struct {
+	registry        *registry.Registry
+	fields          *keys.Resolver
+	upcastWriteBack bool
+	tracerProvider  trace.TracerProvider
+	meterProvider   metric.MeterProvider
+	returnCapacity  types.ReturnConsumedCapacity
+	outboxIndex     string
+}
 
-func expandMacros(indexMap map[string]string, keysInput any) (map[string]string, error) {
-	// Convert keysInput to a map of attribute values
-	av, err := attributevalue.MarshalMap(keysInput)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal keysInput: %w", err)
+// WithRegistry makes the datastore resolve index maps, entity types, hooks and GSIs
+// in 'r' instead of registry.Default()
+func WithRegistry(r *registry.Registry) StoreOption {
+	return func(o *storeOptions) {
+		o.registry = r
 	}
+}
 
-	res := make(map[string]string, len(indexMap))
+// WithFieldResolver sets how macro, update and lifecycle field names are matched to
+// struct fields, e.g. keys.NewResolver(keys.WithJSONTags()). The default matches Go
+// field names and dynamodbav tag names.
+func WithFieldResolver(r *keys.Resolver) StoreOption {
+	return func(o *storeOptions) {
+		o.fields = r
+	}
+}
 
-	for fieldName, template := range indexMap {
-		expanded := macroPattern.ReplaceAllStringFunc(template, func(macro string) string {
-			// macro is something like "{ID}"
-			key := strings.Trim(macro, "{}")
+var macroPattern = keys.MacroPattern
 
-			val, ok := av[key]
-			if !ok {
-				return ""
-			}
+// expandMacros expands the key templates of 'indexMap' with the fields of 'keysInput',
+// a struct or a map keyed by field name. Unknown and ambiguous fields are errors, and so
+// are empty PK and SK fields unless the resolver allows them.
+func expandMacros(resolver *keys.Resolver, indexMap map[string]string, keysInput any) (map[string]string, error) {
+	res := make(map[string]string, len(indexMap))
 
-			// Convert 'val' (types.AttributeValue) into a string.
-			switch tv := val.(type) {
-			case *types.AttributeValueMemberS:
-				// e.g. S="abc123"
-				return tv.Value
-
-			case *types.AttributeValueMemberN:
-				// e.g. N="42"
-				return tv.Value
-
-			case *types.AttributeValueMemberBOOL:
-				// e.g. BOOL=true
-				return fmt.Sprintf("%v", tv.Value)
-
-			case *types.AttributeValueMemberNULL:
-				// e.g. NULL=true
-				return ""
-
-			case *types.AttributeValueMemberB:
-				// Binary data in tv.Value
-				// You might base64-encode or return empty
-				return ""
-
-			case *types.AttributeValueMemberBS,
-				*types.AttributeValueMemberNS,
-				*types.AttributeValueMemberSS:
-				// sets of strings/numbers/binaries
-				// Typically you’d convert to CSV or something
-				return ""
-
-			default:
-				// fallback if an unknown type
-				return ""
-			}
-		})
+	for fieldName, template := range indexMap {
+		if datastore.IsDirective(fieldName) {
+			continue
+		}
+		expand := resolver.Expand
+		if fieldName == TablePartitionKey || fieldName == TableSortKey {
+			expand = resolver.ExpandKey
+		}
+		expanded, err := expand(template, keysInput)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand %s template %q: %w", fieldName, template, err)
+		}
 		res[fieldName] = expanded
 	}
 
 	return res, nil
 }
 
+// ExpandTemplate expands the {Field} macros of a key template with the given values,
+// formatted the same way as when an entity is stored. A macro without a value is an
+// error rather than a silently wrong key.
+func ExpandTemplate(template string, values map[string]any) (string, error) {
+	av, err := attributevalue.MarshalMap(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal key values: %w", err)
+	}
+	for _, macro := range macroPattern.FindAllString(template, -1) {
+		key := strings.Trim(macro, "{}")
+		if _, isNull := av[key].(*types.AttributeValueMemberNULL); av[key] == nil || isNull {
+			return "", fmt.Errorf("no value for macro %s in template %q", macro, template)
+		}
+	}
+	return expandTemplate(template, av), nil
+}
+
+// expandTemplate replaces each macro in 'template' with the matching attribute value
+func expandTemplate(template string, av map[string]types.AttributeValue) string {
+	return macroPattern.ReplaceAllStringFunc(template, func(macro string) string {
+		// macro is something like "{ID}"
+		key := strings.Trim(macro, "{}")
+
+		val, ok := av[key]
+		if !ok {
+			return ""
+		}
+
+		// Convert 'val' (types.AttributeValue) into a string.
+		switch tv := val.(type) {
+		case *types.AttributeValueMemberS:
+			// e.g. S="abc123"
+			return tv.Value
+
+		case *types.AttributeValueMemberN:
+			// e.g. N="42"
+			return tv.Value
+
+		case *types.AttributeValueMemberBOOL:
+			// e.g. BOOL=true
+			return fmt.Sprintf("%v", tv.Value)
+
+		case *types.AttributeValueMemberNULL:
+			// e.g. NULL=true
+			return ""
+
+		case *types.AttributeValueMemberB:
+			// Binary data in tv.Value
+			// You might base64-encode or return empty
+			return ""
+
+		case *types.AttributeValueMemberBS,
+			*types.AttributeValueMemberNS,
+			*types.AttributeValueMemberSS:
+			// sets of strings/numbers/binaries
+			// Typically you’d convert to CSV or something
+			return ""
+
+		default:
+			// fallback if an unknown type
+			return ""
+		}
+	})
+}
+
 // NewDynamoDBClient initializes a DynamoDB client using AWS credentials.
 func NewDynamoDBClient(awsAccessKey, awsSecretKey, awsRegion, tableName string) (*sdk.Client, error) {
 	// Load the custom AWS configuration using static credentials
@@ -111,23 +193,67 @@ func NewDynamoDBClient(awsAccessKey, awsSecretKey, awsRegion, tableName string)
 }
 
 // NewDynamodbDataStore constructs a new DynamodbDataStore for type T.
-func NewDynamodbDataStore[T any](awsAccessKey, awsSecretKey, awsRegion, awsDDBTableName string) (*DynamodbDataStore[T], error) {
+func NewDynamodbDataStore[T any](awsAccessKey, awsSecretKey, awsRegion, awsDDBTableName string, opts ...StoreOption) (*DynamodbDataStore[T], error) {
 	// Create a new DynamoDB client
 	client, err := NewDynamoDBClient(awsAccessKey, awsSecretKey, awsRegion, awsDDBTableName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create DynamoDB client: %w", err)
 	}
 
+	return NewDynamodbDataStoreWithClient[T](client, awsDDBTableName, opts...), nil
+}
+
+// NewDynamodbDataStoreWithClient constructs a DynamodbDataStore for type T on top of an existing client.
+func NewDynamodbDataStoreWithClient[T any](client DynamoDBAPI, tableName string, opts ...StoreOption) *DynamodbDataStore[T] {
+	var options storeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	return &DynamodbDataStore[T]{
-		client:    client,
-		tableName: awsDDBTableName,
-	}, nil
+		client:          client,
+		tableName:       tableName,
+		registry:        options.registry,
+		fields:          options.fields,
+		upcastWriteBack: options.upcastWriteBack,
+		returnCapacity:  options.returnCapacity,
+		outboxIndex:     options.outboxIndex,
+		tel:             newTelemetry(options.tracerProvider, options.meterProvider),
+	}
+}
+
+// Registry returns the registry the datastore resolves its registrations in,
+// registry.Default() unless set with WithRegistry
+func (d *DynamodbDataStore[T]) Registry() *registry.Registry {
+	return registry.OrDefault(d.registry)
+}
+
+// fieldResolver returns the resolver of macro, update and lifecycle field names
+func (d *DynamodbDataStore[T]) fieldResolver() *keys.Resolver {
+	return keys.OrDefault(d.fields)
+}
+
+// lifecycle returns the lifecycle directives of 'indexMap' with their fields resolved
+// to attribute names of T
+func (d *DynamodbDataStore[T]) lifecycle(indexMap map[string]string) (datastore.Lifecycle, error) {
+	lifecycle, err := datastore.ParseLifecycle(indexMap)
+	if err != nil {
+		return datastore.Lifecycle{}, err
+	}
+	return lifecycle.Resolve(reflect.TypeOf((*T)(nil)).Elem(), d.fieldResolver())
+}
+
+// indexMap returns the index map registered for T
+func (d *DynamodbDataStore[T]) indexMap() (map[string]string, bool) {
+	return d.Registry().GetIndexMap(reflect.TypeOf((*T)(nil)).Elem())
 }
 
 // GetOne retrieves a single item from DynamoDB using a string key.
 // It returns a pointer to the item of type T, or nil if no item is found.
-func (d *DynamodbDataStore[T]) GetOne(ctx context.Context, key string) (*T, error) {
-	indexMap, ok := registry.GetIndexMap[T]()
+func (d *DynamodbDataStore[T]) GetOne(ctx context.Context, key string) (_ *T, err error) {
+	ctx, op := d.startOperation(ctx, "GetOne")
+	defer op.end(ctx, &err)
+
+	indexMap, ok := d.indexMap()
 	if !ok {
 		return nil, errors.New("no index map found for entity type")
 	}
@@ -146,33 +272,46 @@ func (d *DynamodbDataStore[T]) GetOne(ctx context.Context, key string) (*T, erro
 
 	// Perform the GetItem call.
 	out, err := d.client.GetItem(ctx, &sdk.GetItemInput{
-		TableName: &d.tableName,
-		Key:       keyMap,
+		TableName:              &d.tableName,
+		Key:                    keyMap,
+		ReturnConsumedCapacity: d.returnCapacity,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("GetItem error: %w", err)
 	}
+	op.response(ctx, out.ResultMetadata, out.ConsumedCapacity)
 	if out.Item == nil {
 		// Not found: return error
-		var t T
-		typeName := reflect.TypeOf(t).Name()
-		return nil, eserrors.NewNotFoundError(typeName, key)
+		return nil, eserrors.NewNotFoundError(d.entityTypeOf(new(T)), key)
+	}
+
+	// Upgrade items written with an older schema version.
+	item, err := d.upcast(ctx, d.itemEntityType(out.Item), out.Item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upcast item: %w", err)
 	}
 
 	// Remove the EntityType attribute.
-	delete(out.Item, "EntityType")
+	delete(item, "EntityType")
 
 	// Create a new instance of T and unmarshal the item into it.
 	result := new(T)
-	if err := attributevalue.UnmarshalMap(out.Item, result); err != nil {
+	if err := attributevalue.UnmarshalMap(item, result); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal item: %w", err)
 	}
+	if err := datastore.RunAfterLoadWithRegistry(ctx, d.registry, result); err != nil {
+		return nil, err
+	}
+	op.addItems(1)
 	return result, nil
 }
 
 // GetByKey retrieves a single item from DynamoDB using explicit PK and SK values.
 // This is useful for composite keys where GetOne cannot construct the key from a single ID.
-func (d *DynamodbDataStore[T]) GetByKey(ctx context.Context, pk, sk string) (*T, error) {
+func (d *DynamodbDataStore[T]) GetByKey(ctx context.Context, pk, sk string) (_ *T, err error) {
+	ctx, op := d.startOperation(ctx, "GetByKey")
+	defer op.end(ctx, &err)
+
 	// Build the DynamoDB key directly from PK and SK
 	// Note: DynamoDB key attributes are case-sensitive - use uppercase PK/SK
 	keyMap := map[string]types.AttributeValue{
@@ -182,27 +321,37 @@ func (d *DynamodbDataStore[T]) GetByKey(ctx context.Context, pk, sk string) (*T,
 
 	// Perform the GetItem call
 	out, err := d.client.GetItem(ctx, &sdk.GetItemInput{
-		TableName: &d.tableName,
-		Key:       keyMap,
+		TableName:              &d.tableName,
+		Key:                    keyMap,
+		ReturnConsumedCapacity: d.returnCapacity,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("GetByKey error: %w", err)
 	}
+	op.response(ctx, out.ResultMetadata, out.ConsumedCapacity)
 	if out.Item == nil {
 		// Not found: return error
-		var t T
-		typeName := reflect.TypeOf(t).Name()
-		return nil, eserrors.NewNotFoundError(typeName, fmt.Sprintf("%s|%s", pk, sk))
+		return nil, eserrors.NewNotFoundError(d.entityTypeOf(new(T)), fmt.Sprintf("%s|%s", pk, sk))
+	}
+
+	// Upgrade items written with an older schema version
+	item, err := d.upcast(ctx, d.itemEntityType(out.Item), out.Item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upcast item: %w", err)
 	}
 
 	// Remove the EntityType attribute
-	delete(out.Item, "EntityType")
+	delete(item, "EntityType")
 
 	// Create a new instance of T and unmarshal the item into it
 	result := new(T)
-	if err := attributevalue.UnmarshalMap(out.Item, result); err != nil {
+	if err := attributevalue.UnmarshalMap(item, result); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal item: %w", err)
 	}
+	if err := datastore.RunAfterLoadWithRegistry(ctx, d.registry, result); err != nil {
+		return nil, err
+	}
+	op.addItems(1)
 	return result, nil
 }
 
@@ -231,6 +380,7 @@ func (d *DynamodbDataStore[T]) queryOne(ctx context.Context, expanded map[string
 		KeyConditionExpression:    &keyCond,
 		ExpressionAttributeValues: exprVals,
 		Limit:                     aws.Int32(1), // only need one item
+		ReturnConsumedCapacity:    d.returnCapacity,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("queryOne - Query error: %w", err)
@@ -238,84 +388,63 @@ func (d *DynamodbDataStore[T]) queryOne(ctx context.Context, expanded map[string
 	return out.Items, nil
 }
 
-// getEntityType uses reflection to determine the object's type name.
-// If a pointer is passed in, it returns the underlying type's name.
-func getEntityType(obj interface{}) string {
-	t := reflect.TypeOf(obj)
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
-	}
-	return t.Name()
+// entityTypeOf returns the EntityType name of the object's type: the name registered
+// with registry.RegisterEntityName, or the Go type name. If a pointer is passed in, it
+// returns the name of the underlying type.
+func (d *DynamodbDataStore[T]) entityTypeOf(obj interface{}) string {
+	return d.Registry().EntityTypeName(reflect.TypeOf(obj))
 }
 
 // Put stores the given 'entity' in the underlying data store using macros in 'indexMap'
 // to populate partition/sort keys (and possibly GSIs).
+// The entity is passed by value, so the version incremented for @Version does not reach
+// the caller: re-read the entity, or use PutVersioned, before putting it again.
 func (d *DynamodbDataStore[T]) Put(ctx context.Context, entity T) error {
-	indexMap, ok := registry.GetIndexMap[T]()
-	if !ok {
-		return errors.New("no index map found for entity type")
-	}
+	return d.PutWithOptions(ctx, entity)
+}
 
+// Create stores 'entity' only if no item with the same key exists yet.
+// It returns an AlreadyExistsError otherwise.
+func (d *DynamodbDataStore[T]) Create(ctx context.Context, entity T, opts ...PutOption) error {
+	return d.write(ctx, &entity, true, opts)
+}
+
+// buildItem marshals 'entity' and adds the EntityType and SchemaVersion attributes and
+// the expanded key attributes from 'indexMap'.
+func (d *DynamodbDataStore[T]) buildItem(entity T, indexMap map[string]string) (map[string]types.AttributeValue, error) {
 	av, err := attributevalue.MarshalMap(entity)
 	if err != nil {
-		return fmt.Errorf("failed to marshal entity: %w", err)
+		return nil, fmt.Errorf("failed to marshal entity: %w", err)
 	}
 
-	entityType := getEntityType(entity)
+	entityType := d.entityTypeOf(entity)
 	av["EntityType"] = &types.AttributeValueMemberS{Value: entityType}
+	if version, ok := d.Registry().SchemaVersion(entityType); ok {
+		av[registry.SchemaVersionAttribute] = &types.AttributeValueMemberN{Value: strconv.Itoa(version)}
+	}
 
 	// Expand macros using the entity itself (assuming the entity has ID, etc.)
-	expanded, err := expandMacros(indexMap, entity)
+	expanded, err := expandMacros(d.fieldResolver(), indexMap, entity)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Insert the expanded fields as PK, SK, etc.
 	for k, v := range expanded {
 		// Map logical GSI names to physical names
-		physicalKey := k
-		switch k {
-		case "GSI1PK":
-			if gsiConfig, ok := GetGSIConfig("GSI1"); ok {
-				physicalKey = gsiConfig.PartitionKeyName
-			}
-		case "GSI1SK":
-			if gsiConfig, ok := GetGSIConfig("GSI1"); ok {
-				physicalKey = gsiConfig.SortKeyName
-			}
-		case "GSI2PK":
-			if gsiConfig, ok := GetGSIConfig("GSI2"); ok {
-				physicalKey = gsiConfig.PartitionKeyName
-			}
-		case "GSI2SK":
-			if gsiConfig, ok := GetGSIConfig("GSI2"); ok {
-				physicalKey = gsiConfig.SortKeyName
-			}
-		case "GSI3PK":
-			if gsiConfig, ok := GetGSIConfig("GSI3"); ok {
-				physicalKey = gsiConfig.PartitionKeyName
-			}
-		case "GSI3SK":
-			if gsiConfig, ok := GetGSIConfig("GSI3"); ok {
-				physicalKey = gsiConfig.SortKeyName
-			}
-		}
+		physicalKey := d.physicalKeyName(k)
 		av[physicalKey] = &types.AttributeValueMemberS{Value: v}
 	}
 
-	_, err = d.client.PutItem(ctx, &sdk.PutItemInput{
-		TableName: &d.tableName,
-		Item:      av,
-	})
-	if err != nil {
-		return fmt.Errorf("PutItem failed: %w", err)
-	}
-	return nil
+	return av, nil
 }
 
 // Delete removes an item from DynamoDB using a string key.
-func (d *DynamodbDataStore[T]) Delete(ctx context.Context, key string) error {
-	indexMap, ok := registry.GetIndexMap[T]()
+func (d *DynamodbDataStore[T]) Delete(ctx context.Context, key string) (err error) {
+	ctx, op := d.startOperation(ctx, "Delete")
+	defer op.end(ctx, &err)
+
+	indexMap, ok := d.indexMap()
 	if !ok {
 		return errors.New("no index map found for entity type")
 	}
@@ -332,10 +461,22 @@ func (d *DynamodbDataStore[T]) Delete(ctx context.Context, key string) error {
 		return fmt.Errorf("failed to build key for Delete: %w", err)
 	}
 
+	// BeforeDelete hooks see the entity being deleted, so load it first when there are any.
+	if datastore.HasBeforeDeleteWithRegistry[T](d.registry) {
+		existing, err := d.GetByKey(ctx, expanded["PK"], expanded["SK"])
+		if err != nil && !eserrors.IsNotFound(err) {
+			return fmt.Errorf("failed to load item for BeforeDelete: %w", err)
+		}
+		if err := datastore.RunBeforeDeleteWithRegistry(ctx, d.registry, key, existing); err != nil {
+			return err
+		}
+	}
+
 	// Call DeleteItem.
-	_, err = d.client.DeleteItem(ctx, &sdk.DeleteItemInput{
-		TableName: &d.tableName,
-		Key:       keyMap,
+	out, err := d.client.DeleteItem(ctx, &sdk.DeleteItemInput{
+		TableName:              &d.tableName,
+		Key:                    keyMap,
+		ReturnConsumedCapacity: d.returnCapacity,
 	})
 	if err != nil {
 		var cfe *types.ConditionalCheckFailedException
@@ -344,11 +485,19 @@ func (d *DynamodbDataStore[T]) Delete(ctx context.Context, key string) error {
 		}
 		return fmt.Errorf("failed to delete item in DynamoDB: %w", err)
 	}
+	op.response(ctx, out.ResultMetadata, out.ConsumedCapacity)
 	return nil
 }
 
 func (d *DynamodbDataStore[T]) getKey(keyInput any, indexMap map[string]string) (map[string]types.AttributeValue, error) {
-	expanded, err := expandMacros(indexMap, keyInput)
+	// Only the table key is needed, so key inputs need not carry the GSI fields
+	tableKey := map[string]string{}
+	for _, name := range []string{"PK", "SK"} {
+		if template, ok := indexMap[name]; ok {
+			tableKey[name] = template
+		}
+	}
+	expanded, err := expandMacros(d.fieldResolver(), tableKey, keyInput)
 	if err != nil {
 		return nil, err
 	}
@@ -378,7 +527,11 @@ func (d *DynamodbDataStore[T]) getKey(keyInput any, indexMap map[string]string)
 //   - an "update expression" (e.g., "SET #f1 = :v1, #f2 = :v2")
 //   - a corresponding map of expression attribute names
 //   - a corresponding map of expression attribute values
-func buildUpdateExpression(updates map[string]interface{}) (string,
+//
+// Field names are resolved to the attribute names of struct type 'entityType' with
+// 'resolver'; values are marshaled like stored entities. Placeholders are numbered in
+// field name order, so that the same updates always give the same request.
+func buildUpdateExpression(resolver *keys.Resolver, entityType reflect.Type, updates map[string]interface{}) (string,
 	map[string]string,
 	map[string]types.AttributeValue,
 	error) {
@@ -391,29 +544,32 @@ func buildUpdateExpression(updates map[string]interface{}) (string,
 	exprAttrNames := make(map[string]string)
 	exprAttrValues := make(map[string]types.AttributeValue)
 
-	i := 0
-	for field, val := range updates {
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for i, field := range fields {
+		val := updates[field]
 		placeholderName := fmt.Sprintf("#f%d", i)
 		placeholderValue := fmt.Sprintf(":v%d", i)
 
-		setClauses = append(setClauses, fmt.Sprintf("%s = %s", placeholderName, placeholderValue))
-		exprAttrNames[placeholderName] = field
-
-		// Convert val -> AttributeValue; this is a naive approach for demonstration.
-		// In real code, handle various types (string, number, bool, etc.).
-		// We'll assume everything is string for simplicity here:
-		switch typedVal := val.(type) {
-		case string:
-			exprAttrValues[placeholderValue] = &types.AttributeValueMemberS{Value: typedVal}
-		case int, int64, float64:
-			// Convert numeric to string for AttributeValueMemberN
-			exprAttrValues[placeholderValue] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%v", typedVal)}
-		default:
-			// Could marshal to JSON or handle other data types
-			return "", nil, nil, fmt.Errorf("unhandled update value type for field '%s'", field)
+		attr := field
+		if entityType.Kind() == reflect.Struct {
+			var err error
+			if attr, err = resolver.Attribute(entityType, field); err != nil {
+				return "", nil, nil, fmt.Errorf("update field: %w", err)
+			}
 		}
+		setClauses = append(setClauses, fmt.Sprintf("%s = %s", placeholderName, placeholderValue))
+		exprAttrNames[placeholderName] = attr
 
-		i++
+		av, err := attributevalue.Marshal(val)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to marshal update value for field '%s': %w", field, err)
+		}
+		exprAttrValues[placeholderValue] = av
 	}
 
 	updateExpr := "SET " + joinClauses(setClauses)
@@ -433,8 +589,13 @@ func joinClauses(clauses []string) string {
 	return joined
 }
 
-func (d *DynamodbDataStore[T]) UpdateWithCondition(ctx context.Context, keyInput any, updates map[string]interface{}, condition string) error {
-	indexMap, ok := registry.GetIndexMap[T]()
+// UpdateWithCondition applies 'updates' to the item identified by 'keyInput' if 'condition' holds.
+// The @UpdatedAt and @Version index map directives are maintained automatically.
+func (d *DynamodbDataStore[T]) UpdateWithCondition(ctx context.Context, keyInput any, updates map[string]interface{}, condition string) (err error) {
+	ctx, op := d.startOperation(ctx, "UpdateWithCondition")
+	defer op.end(ctx, &err)
+
+	indexMap, ok := d.indexMap()
 	if !ok {
 		return errors.New("no index map found for entity type")
 	}
@@ -444,10 +605,36 @@ func (d *DynamodbDataStore[T]) UpdateWithCondition(ctx context.Context, keyInput
 		return fmt.Errorf("failed to build key: %w", err)
 	}
 
-	updateExpr, exprAttrNames, exprAttrValues, err := buildUpdateExpression(updates)
+	entityType := reflect.TypeOf((*T)(nil)).Elem()
+	updateExpr, exprAttrNames, exprAttrValues, err := buildUpdateExpression(d.fieldResolver(), entityType, updates)
 	if err != nil {
 		return fmt.Errorf("failed to build update expression: %w", err)
 	}
+	updated := make(map[string]bool, len(exprAttrNames))
+	for _, attr := range exprAttrNames {
+		updated[attr] = true
+	}
+
+	lifecycle, err := d.lifecycle(indexMap)
+	if err != nil {
+		return err
+	}
+	if lifecycle.UpdatedAt != "" && !updated[lifecycle.UpdatedAt] {
+		now, err := datastore.TimeValue(entityType, lifecycle.UpdatedAt, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if exprAttrValues[":updatedAt"], err = attributevalue.Marshal(now); err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", lifecycle.UpdatedAt, err)
+		}
+		exprAttrNames["#updatedAt"] = lifecycle.UpdatedAt
+		updateExpr += ", #updatedAt = :updatedAt"
+	}
+	if lifecycle.Version != "" && !updated[lifecycle.Version] {
+		exprAttrNames["#version"] = lifecycle.Version
+		exprAttrValues[":versionIncrement"] = &types.AttributeValueMemberN{Value: "1"}
+		updateExpr += " ADD #version :versionIncrement"
+	}
 
 	input := &sdk.UpdateItemInput{
 		TableName:                 &d.tableName,
@@ -457,9 +644,10 @@ func (d *DynamodbDataStore[T]) UpdateWithCondition(ctx context.Context, keyInput
 		ExpressionAttributeValues: exprAttrValues,
 		ConditionExpression:       &condition,
 		ReturnValues:              types.ReturnValueAllNew, // or ALL_OLD, NONE, etc.
+		ReturnConsumedCapacity:    d.returnCapacity,
 	}
 
-	_, err = d.client.UpdateItem(ctx, input)
+	out, err := d.client.UpdateItem(ctx, input)
 	if err != nil {
 		// If the condition fails, DynamoDB returns a ConditionalCheckFailedException
 		var cfe *types.ConditionalCheckFailedException
@@ -469,6 +657,8 @@ func (d *DynamodbDataStore[T]) UpdateWithCondition(ctx context.Context, keyInput
 		// Other possible errors: ProvisionedThroughputExceeded, etc.
 		return fmt.Errorf("UpdateWithCondition failed: %w", err)
 	}
+	op.response(ctx, out.ResultMetadata, out.ConsumedCapacity)
+	op.addItems(1)
 
 	return nil
 }
@@ -495,6 +685,9 @@ func buildKeyFromExpanded(expanded map[string]string) (map[string]types.Attribut
 func expandStringKey(indexMap map[string]string, key string) (map[string]string, error) {
 	expanded := make(map[string]string, len(indexMap))
 	for field, template := range indexMap {
+		if datastore.IsDirective(field) {
+			continue
+		}
 		// Replace all macro occurrences in the template with the provided key.
 		// If the template contains multiple macros or unexpected content, you might need more advanced logic.
 		expanded[field] = macroPattern.ReplaceAllString(template, key)
@@ -0,0 +1,231 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// RenamedTestMember was stored as "Member" before it was renamed
+type RenamedTestMember struct {
+	Org  string
+	ID   string
+	Name string
+}
+
+func TestEntityNameAndAliases(t *testing.T) {
+	ctx := context.Background()
+	memberType := reflect.TypeOf(RenamedTestMember{})
+
+	reg := registry.New()
+	reg.RegisterIndexMap(memberType, map[string]string{
+		"PK": "ORG#{Org}",
+		"SK": "MEMBER#{ID}",
+	})
+	if err := reg.RegisterEntityName(memberType, "OrgMember", "Member"); err != nil {
+		t.Fatalf("RegisterEntityName failed: %v", err)
+	}
+	reg.RegisterType("OrgMember", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &RenamedTestMember{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[RenamedTestMember](client, "test-table", WithRegistry(reg))
+
+	if err := store.Put(ctx, RenamedTestMember{Org: "acme", ID: "1", Name: "new"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	item, _ := client.Item("ORG#acme", "MEMBER#1")
+	if s, ok := item["EntityType"].(*types.AttributeValueMemberS); !ok || s.Value != "OrgMember" {
+		t.Errorf("EntityType = %v, want the registered name", item["EntityType"])
+	}
+
+	// An item written under the legacy name
+	_, err := client.PutItem(ctx, &sdk.PutItemInput{
+		TableName: aws.String("test-table"),
+		Item: map[string]types.AttributeValue{
+			"PK":         &types.AttributeValueMemberS{Value: "ORG#acme"},
+			"SK":         &types.AttributeValueMemberS{Value: "MEMBER#2"},
+			"EntityType": &types.AttributeValueMemberS{Value: "Member"},
+			"Org":        &types.AttributeValueMemberS{Value: "acme"},
+			"ID":         &types.AttributeValueMemberS{Value: "2"},
+			"Name":       &types.AttributeValueMemberS{Value: "legacy"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+
+	results, err := store.Query(ctx, &storagemodels.QueryParams{
+		KeyConditionExpression: "PK = :pk",
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "ORG#acme"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if _, ok := r.(*RenamedTestMember); !ok {
+			t.Errorf("Query result %#v was not decoded as RenamedTestMember", r)
+		}
+	}
+
+	members, err := store.QueryKey(ctx, KeyQuery{PartitionKey: "ORG#acme", SortKeyPrefix: "MEMBER#"})
+	if err != nil {
+		t.Fatalf("QueryKey failed: %v", err)
+	}
+	if len(members) != 2 {
+		t.Errorf("QueryKey skipped the aliased item: got %d members", len(members))
+	}
+
+	_, err = store.GetByKey(ctx, "ORG#acme", "MEMBER#3")
+	var notFound *eserrors.NotFoundError
+	if !errors.As(err, &notFound) || notFound.Type != "OrgMember" {
+		t.Errorf("expected a NotFoundError for OrgMember, got %v", err)
+	}
+}
+
+// Member is an unrelated type whose Go type name is an alias of RenamedTestMember
+type Member struct {
+	Org  string
+	ID   string
+	Name string
+}
+
+func TestEntityNameAliasKeepsOtherTypes(t *testing.T) {
+	ctx := context.Background()
+
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(RenamedTestMember{}), map[string]string{
+		"PK": "ORG#{Org}",
+		"SK": "MEMBER#{ID}",
+	})
+	reg.RegisterIndexMap(reflect.TypeOf(Member{}), map[string]string{
+		"PK": "TEAM#{Org}",
+		"SK": "MEMBER#{ID}",
+	})
+	if err := reg.RegisterEntityName(reflect.TypeOf(RenamedTestMember{}), "OrgMember", "Member"); err != nil {
+		t.Fatalf("RegisterEntityName failed: %v", err)
+	}
+
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[Member](client, "test-table", WithRegistry(reg))
+	if err := store.Put(ctx, Member{Org: "acme", ID: "1", Name: "team member"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	members, err := store.QueryKey(ctx, KeyQuery{PartitionKey: "TEAM#acme"})
+	if err != nil {
+		t.Fatalf("QueryKey failed: %v", err)
+	}
+	if len(members) != 1 || members[0].Name != "team member" {
+		t.Errorf("QueryKey = %v, want the item of Member", members)
+	}
+	got, err := store.GetByKey(ctx, "TEAM#acme", "MEMBER#1")
+	if err != nil || got.Name != "team member" {
+		t.Errorf("GetByKey = %v, %v; want the item of Member", got, err)
+	}
+}
+
+// RosterEntry shares the organization partitions of RenamedTestMember
+type RosterEntry struct {
+	Org  string
+	ID   string
+	Name string
+}
+
+func TestEntityNameAliasesResolvedAlikeByQueryAndStream(t *testing.T) {
+	ctx := context.Background()
+	memberType := reflect.TypeOf(RenamedTestMember{})
+
+	reg := registry.New()
+	reg.RegisterIndexMap(memberType, map[string]string{
+		"PK": "ORG#{Org}",
+		"SK": "MEMBER#{ID}",
+	})
+	reg.RegisterIndexMap(reflect.TypeOf(RosterEntry{}), map[string]string{
+		"PK": "ORG#{Org}",
+		"SK": "ROSTER#{ID}",
+	})
+	if err := reg.RegisterEntityName(memberType, "OrgMember", "Member"); err != nil {
+		t.Fatalf("RegisterEntityName failed: %v", err)
+	}
+	reg.RegisterType("OrgMember", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &RenamedTestMember{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	err := reg.RegisterUpcaster("OrgMember", 1, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		item["Name"] = &types.AttributeValueMemberS{Value: "upgraded"}
+		return item, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterUpcaster failed: %v", err)
+	}
+
+	// A member written under the legacy name, read through the roster store
+	client := fakeddb.New()
+	_, err = client.PutItem(ctx, &sdk.PutItemInput{
+		TableName: aws.String("test-table"),
+		Item: map[string]types.AttributeValue{
+			"PK":         &types.AttributeValueMemberS{Value: "ORG#acme"},
+			"SK":         &types.AttributeValueMemberS{Value: "MEMBER#2"},
+			"EntityType": &types.AttributeValueMemberS{Value: "Member"},
+			"Org":        &types.AttributeValueMemberS{Value: "acme"},
+			"ID":         &types.AttributeValueMemberS{Value: "2"},
+			"Name":       &types.AttributeValueMemberS{Value: "legacy"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	store := NewDynamodbDataStoreWithClient[RosterEntry](client, "test-table", WithRegistry(reg))
+	params := &storagemodels.QueryParams{
+		KeyConditionExpression: "PK = :pk",
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "ORG#acme"},
+		},
+	}
+
+	results, err := store.Query(ctx, params)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	if m, ok := results[0].(*RenamedTestMember); !ok || m.Name != "upgraded" {
+		t.Errorf("Query result = %#v, want the upcast OrgMember", results[0])
+	}
+
+	var streamed []string
+	for res := range store.Stream(ctx, params) {
+		if res.Error != nil {
+			t.Fatalf("Stream failed: %v", res.Error)
+		}
+		streamed = append(streamed, res.Item.Name)
+	}
+	if !reflect.DeepEqual(streamed, []string{"upgraded"}) {
+		t.Errorf("streamed names = %v, want the item upcast as OrgMember like Query", streamed)
+	}
+}
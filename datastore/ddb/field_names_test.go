@@ -0,0 +1,113 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/go-openapi/strfmt"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	"github.com/suparena/entitystore/datastore/keys"
+	"github.com/suparena/entitystore/datastore/testmodels"
+	"github.com/suparena/entitystore/registry"
+)
+
+// ratingSystemRegistry registers testmodels.RatingSystem with json names in its templates
+func ratingSystemRegistry() *registry.Registry {
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(testmodels.RatingSystem{}), map[string]string{
+		"PK":         "RATING#{Id}",
+		"SK":         "RATING#{Id}",
+		"GSI1PK":     "SITE#{SiteUrl}",
+		"GSI1SK":     "CREATED#{CreatedAt}",
+		"@UpdatedAt": "UpdatedAt",
+	})
+	return reg
+}
+
+func TestJSONFieldNames(t *testing.T) {
+	ctx := context.Background()
+	id, name := "r1", "Elo"
+	created := strfmt.DateTime(time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC))
+	rating := testmodels.RatingSystem{ID: &id, Name: &name, SiteURL: "example.com", CreatedAt: &created}
+
+	t.Run("DefaultResolverRejectsJSONNames", func(t *testing.T) {
+		store := NewDynamodbDataStoreWithClient[testmodels.RatingSystem](fakeddb.New(), "test-table",
+			WithRegistry(ratingSystemRegistry()))
+		if err := store.Put(ctx, rating); !errors.Is(err, keys.ErrFieldNotFound) {
+			t.Errorf("expected ErrFieldNotFound for {Id}, got %v", err)
+		}
+	})
+
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[testmodels.RatingSystem](client, "test-table",
+		WithRegistry(ratingSystemRegistry()), WithFieldResolver(keys.NewResolver(keys.WithJSONTags())))
+
+	if err := store.Put(ctx, rating); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	item, ok := client.Item("RATING#r1", "RATING#r1")
+	if !ok {
+		t.Fatal("item was not stored under the expanded key")
+	}
+	want := map[string]string{"PK1": "SITE#example.com", "SK1": "CREATED#2025-03-04T05:06:07Z"}
+	for attr, value := range want {
+		if s, ok := item[attr].(*types.AttributeValueMemberS); !ok || s.Value != value {
+			t.Errorf("attribute %s = %v, want %q", attr, item[attr], value)
+		}
+	}
+
+	renamed := "Glicko"
+	err := store.UpdateWithCondition(ctx, map[string]any{"Id": "r1"},
+		map[string]interface{}{"Name": &renamed, "SiteUrl": "example.org"}, "attribute_exists(PK)")
+	if err != nil {
+		t.Fatalf("UpdateWithCondition failed: %v", err)
+	}
+	item, _ = client.Item("RATING#r1", "RATING#r1")
+	if s, ok := item["Name"].(*types.AttributeValueMemberS); !ok || s.Value != "Glicko" {
+		t.Errorf("Name = %v, want the dereferenced update value", item["Name"])
+	}
+	if s, ok := item["SiteURL"].(*types.AttributeValueMemberS); !ok || s.Value != "example.org" {
+		t.Errorf("SiteURL = %v, want the update of json name SiteUrl", item["SiteURL"])
+	}
+	if _, ok := item["UpdatedAt"].(*types.AttributeValueMemberS); !ok {
+		t.Errorf("UpdatedAt = %v, want a timestamp maintained by the update", item["UpdatedAt"])
+	}
+
+	err = store.UpdateWithCondition(ctx, map[string]any{"Id": "r1"},
+		map[string]interface{}{"Unknown": "x"}, "attribute_exists(PK)")
+	if !errors.Is(err, keys.ErrFieldNotFound) {
+		t.Errorf("expected ErrFieldNotFound for an unknown update field, got %v", err)
+	}
+}
+
+func TestEmptyKeyFields(t *testing.T) {
+	ctx := context.Background()
+	rating := testmodels.RatingSystem{SiteURL: "example.com"}
+
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[testmodels.RatingSystem](client, "test-table",
+		WithRegistry(ratingSystemRegistry()), WithFieldResolver(keys.NewResolver(keys.WithJSONTags())))
+	if err := store.Put(ctx, rating); !errors.Is(err, keys.ErrEmptyKeyField) {
+		t.Errorf("Put with a nil {Id} = %v, want ErrEmptyKeyField", err)
+	}
+	if err := store.UpdateWithCondition(ctx, map[string]any{"Id": ""}, map[string]interface{}{"SiteUrl": "example.org"}, ""); !errors.Is(err, keys.ErrEmptyKeyField) {
+		t.Errorf("UpdateWithCondition with an empty {Id} = %v, want ErrEmptyKeyField", err)
+	}
+
+	store = NewDynamodbDataStoreWithClient[testmodels.RatingSystem](client, "test-table",
+		WithRegistry(ratingSystemRegistry()), WithFieldResolver(keys.NewResolver(keys.WithJSONTags(), keys.WithEmptyKeyFields())))
+	if err := store.Put(ctx, rating); err != nil {
+		t.Fatalf("Put allowing empty key fields failed: %v", err)
+	}
+	if _, ok := client.Item("RATING#", "RATING#"); !ok {
+		t.Error("item was not stored under the key with empty segments")
+	}
+}
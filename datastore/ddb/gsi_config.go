@@ -4,6 +4,18 @@
 
 package ddb
 
+import (
+	"regexp"
+
+	"github.com/suparena/entitystore/registry"
+)
+
+// Key attribute names of the table
+const (
+	TablePartitionKey = "PK"
+	TableSortKey      = "SK"
+)
+
 // GSIConfig holds the configuration for GSI key mappings
 type GSIConfig struct {
 	// IndexName is the actual GSI name in DynamoDB (e.g., "GSI1")
@@ -23,8 +35,51 @@ var DefaultGSIConfigs = map[string]GSIConfig{
 	},
 }
 
-// GetGSIConfig returns the GSI configuration for a given index name
+// GetGSIConfig returns the GSI configuration for a given index name. Indexes declared
+// with registry.RegisterGSI take precedence over DefaultGSIConfigs.
 func GetGSIConfig(indexName string) (GSIConfig, bool) {
+	return gsiConfigIn(registry.Default(), indexName)
+}
+
+// GetGSIConfigWithRegistry is GetGSIConfig with the indexes declared in 'reg'. A nil
+// registry means registry.Default().
+func GetGSIConfigWithRegistry(reg *registry.Registry, indexName string) (GSIConfig, bool) {
+	return gsiConfigIn(registry.OrDefault(reg), indexName)
+}
+
+func gsiConfigIn(reg *registry.Registry, indexName string) (GSIConfig, bool) {
+	if keys, ok := reg.GetGSI(indexName); ok {
+		return GSIConfig{
+			IndexName:        indexName,
+			PartitionKeyName: keys.PartitionKey,
+			SortKeyName:      keys.SortKey,
+		}, true
+	}
 	config, ok := DefaultGSIConfigs[indexName]
 	return config, ok
-}
\ No newline at end of file
+}
+
+var gsiKeyPattern = regexp.MustCompile(`^(GSI\d+)(PK|SK)$`)
+
+// gsiConfig returns the configuration of 'indexName', preferring GSIs registered in the
+// datastore's registry over DefaultGSIConfigs
+func (d *DynamodbDataStore[T]) gsiConfig(indexName string) (GSIConfig, bool) {
+	return gsiConfigIn(d.Registry(), indexName)
+}
+
+// physicalKeyName maps a logical index map key such as "GSI1PK" to the attribute
+// configured for it. Other keys are returned unchanged.
+func (d *DynamodbDataStore[T]) physicalKeyName(key string) string {
+	m := gsiKeyPattern.FindStringSubmatch(key)
+	if m == nil {
+		return key
+	}
+	gsiConfig, ok := d.gsiConfig(m[1])
+	if !ok {
+		return key
+	}
+	if m[2] == "PK" {
+		return gsiConfig.PartitionKeyName
+	}
+	return gsiConfig.SortKeyName
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	"github.com/suparena/entitystore/registry"
+)
+
+// RegisteredGSITestEntity uses an index declared with registry.RegisterGSI
+type RegisteredGSITestEntity struct {
+	ID    string
+	Owner string
+}
+
+func init() {
+	registry.RegisterGSI("GSI7", "PK7", "SK7")
+	registry.RegisterIndexMap[RegisteredGSITestEntity](map[string]string{
+		"PK":     "DOC#{ID}",
+		"SK":     "DOC#{ID}",
+		"GSI7PK": "OWNER#{Owner}",
+		"GSI7SK": "DOC#{ID}",
+		"GSI8PK": "UNDECLARED",
+	})
+}
+
+func TestRegisteredGSIConfig(t *testing.T) {
+	config, ok := GetGSIConfig("GSI7")
+	if !ok || config.IndexName != "GSI7" || config.PartitionKeyName != "PK7" || config.SortKeyName != "SK7" {
+		t.Fatalf("unexpected GSI7 config: %+v, %v", config, ok)
+	}
+
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[RegisteredGSITestEntity](client, "test-table")
+	if err := store.Put(context.Background(), RegisteredGSITestEntity{ID: "1", Owner: "alice"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	item, ok := client.Item("DOC#1", "DOC#1")
+	if !ok {
+		t.Fatal("item was not stored")
+	}
+	want := map[string]string{"PK7": "OWNER#alice", "SK7": "DOC#1", "GSI8PK": "UNDECLARED"}
+	for attr, value := range want {
+		if s, ok := item[attr].(*types.AttributeValueMemberS); !ok || s.Value != value {
+			t.Errorf("attribute %s = %v, want %q", attr, item[attr], value)
+		}
+	}
+}
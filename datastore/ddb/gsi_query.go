@@ -11,7 +11,6 @@ import (
 	
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/suparena/entitystore/registry"
 	"github.com/suparena/entitystore/storagemodels"
 )
 
@@ -105,13 +104,13 @@ func (q *GSIQueryBuilder[T]) Build() (*storagemodels.QueryParams, error) {
 	}
 	
 	// Get GSI configuration
-	gsiConfig, ok := GetGSIConfig(q.indexName)
+	gsiConfig, ok := q.store.gsiConfig(q.indexName)
 	if !ok {
 		return nil, fmt.Errorf("GSI configuration not found for index %s", q.indexName)
 	}
 	
 	// Get index map to build the actual key values
-	indexMap, ok := registry.GetIndexMap[T]()
+	indexMap, ok := q.store.indexMap()
 	if !ok {
 		return nil, fmt.Errorf("no index map found for type %T", *new(T))
 	}
@@ -202,7 +201,10 @@ func (q *GSIQueryBuilder[T]) Build() (*storagemodels.QueryParams, error) {
 }
 
 // Execute runs the query and returns results
-func (q *GSIQueryBuilder[T]) Execute(ctx context.Context) ([]T, error) {
+func (q *GSIQueryBuilder[T]) Execute(ctx context.Context) (_ []T, err error) {
+	ctx, op := q.store.startOperation(ctx, "QueryGSI", indexAttrs(&q.indexName)...)
+	defer op.end(ctx, &err)
+
 	params, err := q.Build()
 	if err != nil {
 		return nil, err
@@ -215,16 +217,9 @@ func (q *GSIQueryBuilder[T]) Execute(ctx context.Context) ([]T, error) {
 	}
 	
 	// Convert results to typed slice
-	typedResults := make([]T, 0, len(results))
-	for _, r := range results {
-		if typed, ok := r.(T); ok {
-			typedResults = append(typedResults, typed)
-		} else if typed, ok := r.(*T); ok {
-			typedResults = append(typedResults, *typed)
-		}
-	}
-	
-	return typedResults, nil
+	typed := typedResults[T](results)
+	op.addItems(len(typed))
+	return typed, nil
 }
 
 // ExecuteWithPagination runs the query and returns results with pagination token
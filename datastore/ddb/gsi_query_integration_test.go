@@ -1,22 +1,33 @@
-// +build integration
-
 /*
  * Copyright © 2025 Suparena Software Inc., All rights reserved.
  */
 
-package ddb
+package ddb_test
 
 import (
 	"context"
+	"os"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb"
+	"github.com/suparena/entitystore/datastore/ddb/cassette"
+	"github.com/suparena/entitystore/datastore/ddb/internal/emulator"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
 	"github.com/suparena/entitystore/registry"
 	"github.com/suparena/entitystore/storagemodels"
 )
 
-// TestEntity for GSI integration testing
+// The GSI integration tests replay the cassettes in testdata. With
+// ENTITYSTORE_CASSETTE_MODE=record they are recorded against the DynamoDB Local (or
+// compatible emulator) at ENTITYSTORE_DYNAMODB_ENDPOINT, or against the in-memory fake
+// when it is not set.
+const gsiIntegrationTable = "gsi-integration"
+
+// GSIIntegrationTestEntity for GSI integration testing
 type GSIIntegrationTestEntity struct {
 	ID        string    `json:"id"`
 	Email     string    `json:"email"`
@@ -26,35 +37,37 @@ type GSIIntegrationTestEntity struct {
 	CreatedAt time.Time `json:"createdAt"`
 }
 
-func init() {
-	// Register test entity
-	registry.RegisterType("GSIIntegrationTestEntity", func(item map[string]types.AttributeValue) (interface{}, error) {
+// setupTestStore creates a store on the client of the cassette at 'path'
+func setupTestStore(t *testing.T, path string) *ddb.DynamodbDataStore[GSIIntegrationTestEntity] {
+	t.Helper()
+	reg := registry.New()
+	reg.RegisterType("GSIIntegrationTestEntity", func(item map[string]types.AttributeValue) (interface{}, error) {
 		entity := &GSIIntegrationTestEntity{}
-		// In real code, you would unmarshal the item into entity
-		return entity, nil
+		err := attributevalue.UnmarshalMap(item, entity)
+		return entity, err
 	})
-
-	// Register index map with GSI patterns
-	indexMap := map[string]string{
+	reg.RegisterIndexMap(reflect.TypeOf(GSIIntegrationTestEntity{}), map[string]string{
 		"PK":     "ENTITY#{ID}",
 		"SK":     "ENTITY#{ID}",
 		"GSI1PK": "EMAIL#{Email}",
 		"GSI1SK": "STATUS#{Status}#CREATED#{CreatedAt}",
-	}
-	registry.RegisterIndexMap[GSIIntegrationTestEntity](indexMap)
+	})
+
+	client := cassette.ForTest(t, path, func() (ddb.DynamoDBAPI, error) {
+		if endpoint := os.Getenv(emulator.EndpointEnv); endpoint != "" {
+			return emulator.Table(t, endpoint, gsiIntegrationTable), nil
+		}
+		return fakeddb.New(), nil
+	})
+	return ddb.NewDynamodbDataStoreWithClient[GSIIntegrationTestEntity](client, gsiIntegrationTable, ddb.WithRegistry(reg))
 }
 
 func TestGSIQueryIntegration(t *testing.T) {
-	// Skip if not running integration tests
-	if testing.Short() {
-		t.Skip("Skipping integration test")
-	}
-
-	// Setup test store
-	store := setupTestStore[GSIIntegrationTestEntity](t)
+	store := setupTestStore(t, "testdata/gsi_query.json")
 	ctx := context.Background()
 
 	// Create test data
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
 	testEntities := []GSIIntegrationTestEntity{
 		{
 			ID:        "user1",
@@ -62,7 +75,7 @@ func TestGSIQueryIntegration(t *testing.T) {
 			Status:    "active",
 			Country:   "USA",
 			Score:     100,
-			CreatedAt: time.Now().Add(-24 * time.Hour),
+			CreatedAt: created,
 		},
 		{
 			ID:        "user2",
@@ -70,7 +83,7 @@ func TestGSIQueryIntegration(t *testing.T) {
 			Status:    "active",
 			Country:   "UK",
 			Score:     90,
-			CreatedAt: time.Now().Add(-12 * time.Hour),
+			CreatedAt: created.Add(12 * time.Hour),
 		},
 		{
 			ID:        "user3",
@@ -78,7 +91,7 @@ func TestGSIQueryIntegration(t *testing.T) {
 			Status:    "inactive",
 			Country:   "USA",
 			Score:     80,
-			CreatedAt: time.Now().Add(-6 * time.Hour),
+			CreatedAt: created.Add(18 * time.Hour),
 		},
 		{
 			ID:        "user4",
@@ -86,7 +99,7 @@ func TestGSIQueryIntegration(t *testing.T) {
 			Status:    "pending",
 			Country:   "Canada",
 			Score:     95,
-			CreatedAt: time.Now().Add(-3 * time.Hour),
+			CreatedAt: created.Add(21 * time.Hour),
 		},
 	}
 
@@ -98,9 +111,6 @@ func TestGSIQueryIntegration(t *testing.T) {
 		}
 	}
 
-	// Wait for eventual consistency
-	time.Sleep(1 * time.Second)
-
 	t.Run("QueryByGSI1PK", func(t *testing.T) {
 		// Query by email
 		results, err := store.QueryByGSI1PK(ctx, "user1@example.com")
@@ -188,7 +198,7 @@ func TestGSIQueryIntegration(t *testing.T) {
 	})
 
 	t.Run("QueryWithSortKeyRange", func(t *testing.T) {
-		// Query all emails with status between active and pending
+		// Query all statuses between active and pending
 		results, err := store.QueryGSI().
 			WithPartitionKey("user1@example.com").
 			WithSortKeyBetween("STATUS#active", "STATUS#pending").
@@ -199,15 +209,13 @@ func TestGSIQueryIntegration(t *testing.T) {
 		}
 
 		// Should find both active and inactive users
-		if len(results) < 1 {
-			t.Errorf("Expected at least 1 result, got %d", len(results))
+		if len(results) != 2 {
+			t.Errorf("Expected 2 results, got %d", len(results))
 		}
 	})
 
 	t.Run("StreamGSIQuery", func(t *testing.T) {
 		// Stream results using GSI
-		// Use stream options
-
 		resultCh := store.QueryGSI().
 			WithPartitionKey("user1@example.com").
 			Stream(ctx, storagemodels.WithBufferSize(10))
@@ -244,83 +252,40 @@ func TestGSIQueryIntegration(t *testing.T) {
 
 	// Cleanup test data
 	for _, entity := range testEntities {
-		_ = store.Delete(ctx, entity.ID)
+		if err := store.Delete(ctx, entity.ID); err != nil {
+			t.Errorf("Delete failed: %v", err)
+		}
 	}
 }
 
 func TestGSIQueryPatterns(t *testing.T) {
-	// Skip if not running integration tests
-	if testing.Short() {
-		t.Skip("Skipping integration test")
-	}
-
-	store := setupTestStore[GSIIntegrationTestEntity](t)
+	store := setupTestStore(t, "testdata/gsi_query_patterns.json")
 	ctx := context.Background()
 
-	// Test common query patterns
-	t.Run("EmailLookupPattern", func(t *testing.T) {
-		// Common pattern: Look up all records for an email
-		email := "test@example.com"
-		
-		// Create test data with same email
-		entities := []GSIIntegrationTestEntity{
-			{ID: "1", Email: email, Status: "active"},
-			{ID: "2", Email: email, Status: "inactive"},
-			{ID: "3", Email: email, Status: "pending"},
-		}
-
-		for _, e := range entities {
-			_ = store.Put(ctx, e)
-		}
-
-		// Query all records for this email
-		results, err := store.QueryByGSI1PK(ctx, email)
-		if err != nil {
-			t.Fatalf("Query failed: %v", err)
-		}
-
-		if len(results) != 3 {
-			t.Errorf("Expected 3 results, got %d", len(results))
-		}
-
-		// Cleanup
-		for _, e := range entities {
-			_ = store.Delete(ctx, e.ID)
-		}
-	})
-
-	t.Run("StatusFilterPattern", func(t *testing.T) {
-		// Common pattern: Find all active users
-		entities := []GSIIntegrationTestEntity{
-			{ID: "1", Email: "a@test.com", Status: "active"},
-			{ID: "2", Email: "b@test.com", Status: "active"},
-			{ID: "3", Email: "c@test.com", Status: "inactive"},
-		}
-
-		for _, e := range entities {
-			_ = store.Put(ctx, e)
+	// Common pattern: Look up all records for an email
+	email := "test@example.com"
+	entities := []GSIIntegrationTestEntity{
+		{ID: "1", Email: email, Status: "active"},
+		{ID: "2", Email: email, Status: "inactive"},
+		{ID: "3", Email: email, Status: "pending"},
+	}
+	for _, e := range entities {
+		if err := store.Put(ctx, e); err != nil {
+			t.Fatalf("Put failed: %v", err)
 		}
+	}
 
-		// This requires scanning or using a different access pattern
-		// With single GSI, we need to query by email first
-		// This demonstrates the limitation of single GSI
+	results, err := store.QueryByGSI1PK(ctx, email)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Expected 3 results, got %d", len(results))
+	}
 
-		// Cleanup
-		for _, e := range entities {
-			_ = store.Delete(ctx, e.ID)
+	for _, e := range entities {
+		if err := store.Delete(ctx, e.ID); err != nil {
+			t.Errorf("Delete failed: %v", err)
 		}
-	})
+	}
 }
-
-// setupTestStore creates a test DynamoDB store
-func setupTestStore[T any](t *testing.T) *DynamodbDataStore[T] {
-	// This would use the test setup from your existing integration tests
-	// For now, returning a placeholder
-	t.Helper()
-	
-	// Mock setup - in real integration tests, this would connect to DynamoDB Local
-	// or use the existing test infrastructure
-	t.Skip("Integration test setup not implemented")
-	
-	return nil
-}
\ No newline at end of file
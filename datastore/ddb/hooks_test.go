@@ -0,0 +1,205 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	oaerrors "github.com/go-openapi/errors"
+	"github.com/go-openapi/strfmt"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// HookTestAccount normalizes and validates itself before being stored
+type HookTestAccount struct {
+	ID      string
+	Email   string
+	Balance int
+	Loaded  bool `dynamodbav:"-"`
+}
+
+func (a *HookTestAccount) BeforePut(ctx context.Context) error {
+	a.Email = strings.ToLower(a.Email)
+	return nil
+}
+
+func (a *HookTestAccount) Validate() error {
+	if !strings.Contains(a.Email, "@") {
+		return eserrors.NewValidationError("Email", "must be an email address")
+	}
+	return nil
+}
+
+func (a *HookTestAccount) AfterLoad(ctx context.Context) error {
+	a.Loaded = true
+	return nil
+}
+
+func init() {
+	registry.RegisterIndexMap[HookTestAccount](map[string]string{
+		"PK": "ACCOUNT#{ID}",
+		"SK": "ACCOUNT#{ID}",
+	})
+	registry.RegisterType("HookTestAccount", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &HookTestAccount{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	registry.RegisterHooks(registry.Hooks[HookTestAccount]{
+		BeforeDelete: func(ctx context.Context, key string, a *HookTestAccount) error {
+			if key == "root" {
+				return errors.New("root account cannot be deleted")
+			}
+			if a != nil && a.Balance > 0 {
+				return errors.New("account with a balance cannot be deleted")
+			}
+			return nil
+		},
+	})
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[HookTestAccount](client, "test-table")
+
+	t.Run("BeforePutAndValidate", func(t *testing.T) {
+		if err := store.Put(ctx, HookTestAccount{ID: "1", Email: "Alice@Example.COM"}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		item, ok := client.Item("ACCOUNT#1", "ACCOUNT#1")
+		if !ok {
+			t.Fatal("item was not stored")
+		}
+		if email := item["Email"].(*types.AttributeValueMemberS).Value; email != "alice@example.com" {
+			t.Errorf("expected normalized email, got %q", email)
+		}
+
+		calls := len(client.Calls())
+		err := store.Put(ctx, HookTestAccount{ID: "2", Email: "invalid"})
+		if !eserrors.IsValidationError(err) {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+		if len(client.Calls()) != calls {
+			t.Error("invalid entity must not reach DynamoDB")
+		}
+	})
+
+	t.Run("AfterLoad", func(t *testing.T) {
+		got, err := store.GetOne(ctx, "1")
+		if err != nil {
+			t.Fatalf("GetOne failed: %v", err)
+		}
+		if !got.Loaded {
+			t.Error("expected AfterLoad to run on GetOne")
+		}
+
+		got, err = store.GetByKey(ctx, "ACCOUNT#1", "ACCOUNT#1")
+		if err != nil {
+			t.Fatalf("GetByKey failed: %v", err)
+		}
+		if !got.Loaded {
+			t.Error("expected AfterLoad to run on GetByKey")
+		}
+
+		results, err := store.Query(ctx, &storagemodels.QueryParams{
+			KeyConditionExpression: "PK = :pk",
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: "ACCOUNT#1"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if len(results) != 1 || !results[0].(*HookTestAccount).Loaded {
+			t.Errorf("expected AfterLoad to run on query results, got %+v", results)
+		}
+	})
+
+	t.Run("BeforeDelete", func(t *testing.T) {
+		if err := store.Put(ctx, HookTestAccount{ID: "root", Email: "root@example.com"}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if err := store.Delete(ctx, "root"); err == nil {
+			t.Fatal("expected BeforeDelete to veto deletion")
+		}
+		if _, ok := client.Item("ACCOUNT#root", "ACCOUNT#root"); !ok {
+			t.Error("vetoed item must not be deleted")
+		}
+		// The hook sees the stored entity, not just its key
+		if err := store.Put(ctx, HookTestAccount{ID: "rich", Email: "rich@example.com", Balance: 10}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if err := store.Delete(ctx, "rich"); err == nil {
+			t.Fatal("expected BeforeDelete to veto deleting an account with a balance")
+		}
+		if err := store.Delete(ctx, "1"); err != nil {
+			t.Errorf("Delete failed: %v", err)
+		}
+		if err := store.Delete(ctx, "missing"); err != nil {
+			t.Errorf("Delete of a missing item failed: %v", err)
+		}
+	})
+}
+
+// SchemaTestProfile mimics a go-swagger model generated with x-dynamodb-validate
+type SchemaTestProfile struct {
+	ID    *string
+	Email strfmt.Email
+}
+
+func (p *SchemaTestProfile) Validate(formats strfmt.Registry) error {
+	var res []error
+	if p.ID == nil {
+		res = append(res, oaerrors.Required("ID", "body", nil))
+	}
+	if !formats.Validates("email", p.Email.String()) {
+		res = append(res, oaerrors.InvalidType("Email", "body", "email", p.Email.String()))
+	}
+	if len(res) > 0 {
+		return oaerrors.CompositeValidationError(res...)
+	}
+	return nil
+}
+
+func TestSchemaValidationRejectsPut(t *testing.T) {
+	ctx := context.Background()
+	reg := registry.New()
+	profileType := reflect.TypeOf(SchemaTestProfile{})
+	reg.RegisterIndexMap(profileType, map[string]string{
+		"PK": "PROFILE#{ID}",
+		"SK": "PROFILE#{ID}",
+	})
+	reg.EnableSchemaValidation(profileType, nil)
+
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[SchemaTestProfile](client, "test-table", WithRegistry(reg))
+
+	id := "1"
+	err := store.Put(ctx, SchemaTestProfile{ID: &id, Email: "not-an-email"})
+	var ve *eserrors.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(ve.Fields) != 1 || ve.Fields[0].Field != "Email" {
+		t.Errorf("expected one error for Email, got %+v", ve.Fields)
+	}
+	if len(client.Calls()) != 0 {
+		t.Errorf("invalid entity must not reach DynamoDB, got calls %v", client.Calls())
+	}
+
+	if err := store.Put(ctx, SchemaTestProfile{ID: &id, Email: "alice@example.com"}); err != nil {
+		t.Fatalf("Put of a valid entity failed: %v", err)
+	}
+}
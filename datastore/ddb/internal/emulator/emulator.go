@@ -0,0 +1,68 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+// Package emulator connects tests to DynamoDB Local or a compatible emulator and creates
+// tables with the layout of the ddb package.
+package emulator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// EndpointEnv is the environment variable with the endpoint of the emulator, e.g.
+// http://localhost:8000
+const EndpointEnv = "ENTITYSTORE_DYNAMODB_ENDPOINT"
+
+// Table creates 'table' with the PK/SK key and GSI1 on PK1/SK1 in the emulator at
+// 'endpoint', replacing an existing table, and deletes it when the test ends
+func Table(t testing.TB, endpoint, table string) *sdk.Client {
+	t.Helper()
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("local", "local", "")),
+	)
+	if err != nil {
+		t.Fatalf("failed to load AWS configuration: %v", err)
+	}
+	client := sdk.NewFromConfig(cfg, func(o *sdk.Options) {
+		o.BaseEndpoint = aws.String(endpoint)
+	})
+
+	attr := func(name string) types.AttributeDefinition {
+		return types.AttributeDefinition{AttributeName: aws.String(name), AttributeType: types.ScalarAttributeTypeS}
+	}
+	keySchema := func(pk, sk string) []types.KeySchemaElement {
+		return []types.KeySchemaElement{
+			{AttributeName: aws.String(pk), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String(sk), KeyType: types.KeyTypeRange},
+		}
+	}
+	_, _ = client.DeleteTable(ctx, &sdk.DeleteTableInput{TableName: aws.String(table)})
+	_, err = client.CreateTable(ctx, &sdk.CreateTableInput{
+		TableName:            aws.String(table),
+		BillingMode:          types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{attr("PK"), attr("SK"), attr("PK1"), attr("SK1")},
+		KeySchema:            keySchema("PK", "SK"),
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+			IndexName:  aws.String("GSI1"),
+			KeySchema:  keySchema("PK1", "SK1"),
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create table %s: %v", table, err)
+	}
+	t.Cleanup(func() {
+		client.DeleteTable(context.Background(), &sdk.DeleteTableInput{TableName: aws.String(table)})
+	})
+	return client
+}
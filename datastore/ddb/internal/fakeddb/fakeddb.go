@@ -0,0 +1,644 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+// Package fakeddb provides a small in-memory DynamoDB client for unit tests.
+// It understands the subset of expressions produced by the ddb package:
+// equality, comparison and begins_with key conditions, attribute_exists /
+// attribute_not_exists, comparison and BETWEEN conditions joined with AND or OR (without
+// parentheses), and SET / REMOVE /
+// ADD update expressions. Requests asking for ReturnConsumedCapacity are charged 0.5
+// read units per GetItem or Query page, 1 write unit per written item and 2 per
+// transactional item.
+package fakeddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Index describes the key attributes of a table or GSI
+type Index struct {
+	PartitionKey string
+	SortKey      string
+}
+
+// Client is an in-memory implementation of the DynamoDB operations used by the store
+type Client struct {
+	mu      sync.Mutex
+	items   map[string]map[string]types.AttributeValue
+	indexes map[string]Index
+	calls   []string
+
+	// Err, when set, is returned by the next call and then cleared
+	Err error
+}
+
+// New creates an empty fake table keyed by PK/SK with GSI1 on PK1/SK1
+func New() *Client {
+	return &Client{
+		items: make(map[string]map[string]types.AttributeValue),
+		indexes: map[string]Index{
+			"":     {PartitionKey: "PK", SortKey: "SK"},
+			"GSI1": {PartitionKey: "PK1", SortKey: "SK1"},
+		},
+	}
+}
+
+// WithIndex adds GSI 'name' keyed by 'partitionKey'/'sortKey'
+func (c *Client) WithIndex(name, partitionKey, sortKey string) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indexes[name] = Index{PartitionKey: partitionKey, SortKey: sortKey}
+	return c
+}
+
+// Calls returns the names of the operations invoked so far
+func (c *Client) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+// Items returns copies of all stored items ordered by PK and SK
+func (c *Client) Items() []map[string]types.AttributeValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.items))
+	for k := range c.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make([]map[string]types.AttributeValue, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, copyItem(c.items[k]))
+	}
+	return res
+}
+
+// Item returns a copy of the item stored under pk/sk
+func (c *Client) Item(pk, sk string) (map[string]types.AttributeValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[pk+"|"+sk]
+	return copyItem(item), ok
+}
+
+func (c *Client) begin(op string) error {
+	c.calls = append(c.calls, op)
+	if err := c.Err; err != nil {
+		c.Err = nil
+		return err
+	}
+	return nil
+}
+
+// GetItem implements the DynamoDB GetItem operation
+func (c *Client) GetItem(ctx context.Context, in *sdk.GetItemInput, _ ...func(*sdk.Options)) (*sdk.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.begin("GetItem"); err != nil {
+		return nil, err
+	}
+	return &sdk.GetItemOutput{
+		Item:             copyItem(c.items[storageKey(in.Key)]),
+		ConsumedCapacity: consumed(in.ReturnConsumedCapacity, in.TableName, "", readUnits, 0),
+	}, nil
+}
+
+// PutItem implements the DynamoDB PutItem operation
+func (c *Client) PutItem(ctx context.Context, in *sdk.PutItemInput, _ ...func(*sdk.Options)) (*sdk.PutItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.begin("PutItem"); err != nil {
+		return nil, err
+	}
+	key := storageKey(in.Item)
+	if err := checkCondition(c.items[key], in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	c.items[key] = copyItem(in.Item)
+	return &sdk.PutItemOutput{ConsumedCapacity: consumed(in.ReturnConsumedCapacity, in.TableName, "", 0, writeUnits)}, nil
+}
+
+// DeleteItem implements the DynamoDB DeleteItem operation
+func (c *Client) DeleteItem(ctx context.Context, in *sdk.DeleteItemInput, _ ...func(*sdk.Options)) (*sdk.DeleteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.begin("DeleteItem"); err != nil {
+		return nil, err
+	}
+	key := storageKey(in.Key)
+	if err := checkCondition(c.items[key], in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	old := c.items[key]
+	delete(c.items, key)
+	return &sdk.DeleteItemOutput{
+		Attributes:       old,
+		ConsumedCapacity: consumed(in.ReturnConsumedCapacity, in.TableName, "", 0, writeUnits),
+	}, nil
+}
+
+// UpdateItem implements the DynamoDB UpdateItem operation
+func (c *Client) UpdateItem(ctx context.Context, in *sdk.UpdateItemInput, _ ...func(*sdk.Options)) (*sdk.UpdateItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.begin("UpdateItem"); err != nil {
+		return nil, err
+	}
+	item, err := c.update(in.Key, in.UpdateExpression, in.ConditionExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	c.items[storageKey(in.Key)] = item
+	return &sdk.UpdateItemOutput{
+		Attributes:       copyItem(item),
+		ConsumedCapacity: consumed(in.ReturnConsumedCapacity, in.TableName, "", 0, writeUnits),
+	}, nil
+}
+
+// Query implements the DynamoDB Query operation
+func (c *Client) Query(ctx context.Context, in *sdk.QueryInput, _ ...func(*sdk.Options)) (*sdk.QueryOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.begin("Query"); err != nil {
+		return nil, err
+	}
+
+	indexName := ""
+	if in.IndexName != nil {
+		indexName = *in.IndexName
+	}
+	idx, ok := c.indexes[indexName]
+	if !ok {
+		return nil, fmt.Errorf("fakeddb: unknown index %q", indexName)
+	}
+
+	keyCond := ""
+	if in.KeyConditionExpression != nil {
+		keyCond = *in.KeyConditionExpression
+	}
+
+	var matched []map[string]types.AttributeValue
+	for _, item := range c.items {
+		if _, ok := item[idx.PartitionKey]; !ok {
+			continue
+		}
+		ok, err := evaluate(item, keyCond, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		if ok && in.FilterExpression != nil {
+			ok, err = evaluate(item, *in.FilterExpression, in.ExpressionAttributeNames, in.ExpressionAttributeValues)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ok {
+			matched = append(matched, copyItem(item))
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return scalar(matched[i][idx.SortKey]) < scalar(matched[j][idx.SortKey])
+	})
+	if in.ScanIndexForward != nil && !*in.ScanIndexForward {
+		for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+			matched[i], matched[j] = matched[j], matched[i]
+		}
+	}
+
+	if in.ExclusiveStartKey != nil {
+		start := storageKey(in.ExclusiveStartKey)
+		for i, item := range matched {
+			if storageKey(item) == start {
+				matched = matched[i+1:]
+				break
+			}
+		}
+	}
+
+	out := &sdk.QueryOutput{ConsumedCapacity: consumed(in.ReturnConsumedCapacity, in.TableName, indexName, readUnits, 0)}
+	if in.Limit != nil && int(*in.Limit) < len(matched) {
+		matched = matched[:*in.Limit]
+		last := matched[len(matched)-1]
+		out.LastEvaluatedKey = map[string]types.AttributeValue{"PK": last["PK"], "SK": last["SK"]}
+	}
+	out.Items = matched
+	out.Count = int32(len(matched))
+	return out, nil
+}
+
+// TransactWriteItems implements the DynamoDB TransactWriteItems operation.
+// All conditions are checked before any write is applied.
+func (c *Client) TransactWriteItems(ctx context.Context, in *sdk.TransactWriteItemsInput, _ ...func(*sdk.Options)) (*sdk.TransactWriteItemsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.begin("TransactWriteItems"); err != nil {
+		return nil, err
+	}
+
+	staged := make(map[string]map[string]types.AttributeValue)
+	for i, ti := range in.TransactItems {
+		switch {
+		case ti.Put != nil:
+			key := storageKey(ti.Put.Item)
+			if err := checkCondition(c.items[key], ti.Put.ConditionExpression, ti.Put.ExpressionAttributeNames, ti.Put.ExpressionAttributeValues); err != nil {
+				return nil, transactionCanceled(err, i, len(in.TransactItems))
+			}
+			staged[key] = copyItem(ti.Put.Item)
+		case ti.Delete != nil:
+			key := storageKey(ti.Delete.Key)
+			if err := checkCondition(c.items[key], ti.Delete.ConditionExpression, ti.Delete.ExpressionAttributeNames, ti.Delete.ExpressionAttributeValues); err != nil {
+				return nil, transactionCanceled(err, i, len(in.TransactItems))
+			}
+			staged[key] = nil
+		case ti.Update != nil:
+			item, err := c.update(ti.Update.Key, ti.Update.UpdateExpression, ti.Update.ConditionExpression, ti.Update.ExpressionAttributeNames, ti.Update.ExpressionAttributeValues)
+			if err != nil {
+				return nil, transactionCanceled(err, i, len(in.TransactItems))
+			}
+			staged[storageKey(ti.Update.Key)] = item
+		case ti.ConditionCheck != nil:
+			key := storageKey(ti.ConditionCheck.Key)
+			if err := checkCondition(c.items[key], ti.ConditionCheck.ConditionExpression, ti.ConditionCheck.ExpressionAttributeNames, ti.ConditionCheck.ExpressionAttributeValues); err != nil {
+				return nil, transactionCanceled(err, i, len(in.TransactItems))
+			}
+		}
+	}
+
+	for key, item := range staged {
+		if item == nil {
+			delete(c.items, key)
+			continue
+		}
+		c.items[key] = item
+	}
+	out := &sdk.TransactWriteItemsOutput{}
+	if cc := consumed(in.ReturnConsumedCapacity, transactTable(in.TransactItems), "", 0, 2*float64(len(in.TransactItems))); cc != nil {
+		out.ConsumedCapacity = []types.ConsumedCapacity{*cc}
+	}
+	return out, nil
+}
+
+// Capacity units charged per request
+const (
+	readUnits  = 0.5
+	writeUnits = 1
+)
+
+// consumed returns the capacity reported for 'level', nil when none is requested;
+// 'index' is the GSI read by a query, "" for the table
+func consumed(level types.ReturnConsumedCapacity, table *string, index string, read, write float64) *types.ConsumedCapacity {
+	if level == "" || level == types.ReturnConsumedCapacityNone {
+		return nil
+	}
+	cc := &types.ConsumedCapacity{TableName: table, CapacityUnits: aws.Float64(read + write)}
+	if level != types.ReturnConsumedCapacityIndexes {
+		return cc
+	}
+	cc.ReadCapacityUnits = aws.Float64(read)
+	cc.WriteCapacityUnits = aws.Float64(write)
+	capacity := types.Capacity{CapacityUnits: aws.Float64(read + write), ReadCapacityUnits: aws.Float64(read), WriteCapacityUnits: aws.Float64(write)}
+	if index == "" {
+		cc.Table = &capacity
+	} else {
+		cc.GlobalSecondaryIndexes = map[string]types.Capacity{index: capacity}
+	}
+	return cc
+}
+
+// transactTable returns the table written by a transaction, the fake having one table
+func transactTable(items []types.TransactWriteItem) *string {
+	for _, ti := range items {
+		switch {
+		case ti.Put != nil:
+			return ti.Put.TableName
+		case ti.Delete != nil:
+			return ti.Delete.TableName
+		case ti.Update != nil:
+			return ti.Update.TableName
+		case ti.ConditionCheck != nil:
+			return ti.ConditionCheck.TableName
+		}
+	}
+	return nil
+}
+
+// transactionCanceled reports 'err' as the cancellation reason of item 'failed'
+func transactionCanceled(err error, failed, total int) error {
+	msg := err.Error()
+	reasons := make([]types.CancellationReason, total)
+	for i := range reasons {
+		code := "None"
+		if i == failed {
+			code = "ValidationError"
+			var cfe *types.ConditionalCheckFailedException
+			if errors.As(err, &cfe) {
+				code = "ConditionalCheckFailed"
+			}
+		}
+		reasons[i] = types.CancellationReason{Code: aws.String(code)}
+	}
+	return &types.TransactionCanceledException{Message: &msg, CancellationReasons: reasons}
+}
+
+// update applies an update expression to a copy of the stored item
+func (c *Client) update(key map[string]types.AttributeValue, updateExpr, condition *string, names map[string]string, values map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	current := c.items[storageKey(key)]
+	if err := checkCondition(current, condition, names, values); err != nil {
+		return nil, err
+	}
+
+	item := copyItem(current)
+	if item == nil {
+		item = copyItem(key)
+	}
+	if updateExpr == nil {
+		return item, nil
+	}
+
+	for action, clauses := range splitUpdate(*updateExpr) {
+		for _, clause := range clauses {
+			switch action {
+			case "SET":
+				parts := strings.SplitN(clause, "=", 2)
+				if len(parts) != 2 {
+					return nil, fmt.Errorf("fakeddb: unsupported SET clause %q", clause)
+				}
+				item[resolveName(parts[0], names)] = resolveOperand(item, parts[1], names, values)
+			case "REMOVE":
+				delete(item, resolveName(clause, names))
+			case "ADD":
+				fields := strings.Fields(clause)
+				if len(fields) != 2 {
+					return nil, fmt.Errorf("fakeddb: unsupported ADD clause %q", clause)
+				}
+				name := resolveName(fields[0], names)
+				item[name] = addNumbers(item[name], values[fields[1]])
+			}
+		}
+	}
+	return item, nil
+}
+
+// splitUpdate splits "SET a = :a, b = :b REMOVE c" into its clauses per action
+func splitUpdate(expr string) map[string][]string {
+	res := make(map[string][]string)
+	action := ""
+	var current strings.Builder
+	flush := func() {
+		for _, clause := range strings.Split(current.String(), ",") {
+			if clause = strings.TrimSpace(clause); clause != "" && action != "" {
+				res[action] = append(res[action], clause)
+			}
+		}
+		current.Reset()
+	}
+	for _, tok := range strings.Fields(expr) {
+		switch strings.ToUpper(tok) {
+		case "SET", "REMOVE", "ADD", "DELETE":
+			flush()
+			action = strings.ToUpper(tok)
+			continue
+		}
+		current.WriteString(tok)
+		current.WriteString(" ")
+	}
+	flush()
+	return res
+}
+
+// resolveOperand evaluates the right-hand side of a SET clause
+func resolveOperand(item map[string]types.AttributeValue, operand string, names map[string]string, values map[string]types.AttributeValue) types.AttributeValue {
+	operand = strings.TrimSpace(operand)
+	if strings.HasPrefix(operand, "if_not_exists(") {
+		args := strings.Split(strings.TrimSuffix(strings.TrimPrefix(operand, "if_not_exists("), ")"), ",")
+		if existing, ok := item[resolveName(args[0], names)]; ok {
+			return existing
+		}
+		return values[strings.TrimSpace(args[1])]
+	}
+	if strings.Contains(operand, "+") {
+		parts := strings.SplitN(operand, "+", 2)
+		return addNumbers(resolveOperand(item, parts[0], names, values), resolveOperand(item, parts[1], names, values))
+	}
+	if strings.HasPrefix(operand, ":") {
+		return values[operand]
+	}
+	return item[resolveName(operand, names)]
+}
+
+func addNumbers(a, b types.AttributeValue) types.AttributeValue {
+	var x, y int64
+	if n, ok := a.(*types.AttributeValueMemberN); ok {
+		fmt.Sscan(n.Value, &x)
+	}
+	if n, ok := b.(*types.AttributeValueMemberN); ok {
+		fmt.Sscan(n.Value, &y)
+	}
+	return &types.AttributeValueMemberN{Value: fmt.Sprint(x + y)}
+}
+
+func checkCondition(item map[string]types.AttributeValue, condition *string, names map[string]string, values map[string]types.AttributeValue) error {
+	if condition == nil || *condition == "" {
+		return nil
+	}
+	ok, err := evaluate(item, *condition, names, values)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		msg := "The conditional request failed"
+		return &types.ConditionalCheckFailedException{Message: &msg}
+	}
+	return nil
+}
+
+// evaluate supports OR-joined groups of AND-joined equality, comparison, begins_with and
+// attribute existence checks
+func evaluate(item map[string]types.AttributeValue, expr string, names map[string]string, values map[string]types.AttributeValue) (bool, error) {
+	for _, group := range splitOr(expr) {
+		ok, err := evaluateAnd(item, group, names, values)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func evaluateAnd(item map[string]types.AttributeValue, expr string, names map[string]string, values map[string]types.AttributeValue) (bool, error) {
+	for _, clause := range splitAnd(expr) {
+		clause = strings.TrimSpace(clause)
+		switch {
+		case strings.HasPrefix(clause, "attribute_not_exists("):
+			name := resolveName(strings.TrimSuffix(strings.TrimPrefix(clause, "attribute_not_exists("), ")"), names)
+			if _, ok := item[name]; ok {
+				return false, nil
+			}
+		case strings.HasPrefix(clause, "attribute_exists("):
+			name := resolveName(strings.TrimSuffix(strings.TrimPrefix(clause, "attribute_exists("), ")"), names)
+			if _, ok := item[name]; !ok {
+				return false, nil
+			}
+		case strings.HasPrefix(clause, "begins_with("):
+			args := strings.Split(strings.TrimSuffix(strings.TrimPrefix(clause, "begins_with("), ")"), ",")
+			if len(args) != 2 {
+				return false, fmt.Errorf("fakeddb: unsupported clause %q", clause)
+			}
+			attr, ok := item[resolveName(args[0], names)]
+			if !ok || !strings.HasPrefix(scalar(attr), scalar(values[strings.TrimSpace(args[1])])) {
+				return false, nil
+			}
+		case strings.Contains(clause, " BETWEEN "):
+			parts := strings.Fields(clause)
+			if len(parts) != 5 {
+				return false, fmt.Errorf("fakeddb: unsupported clause %q", clause)
+			}
+			v := item[resolveName(parts[0], names)]
+			if order(v, values[parts[2]]) < 0 || order(v, values[parts[4]]) > 0 {
+				return false, nil
+			}
+		default:
+			parts := strings.Fields(clause)
+			if len(parts) != 3 {
+				return false, fmt.Errorf("fakeddb: unsupported clause %q", clause)
+			}
+			attr, ok := item[resolveName(parts[0], names)]
+			if !ok {
+				return false, nil
+			}
+			if !compare(order(attr, values[parts[2]]), parts[1]) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// splitOr splits on OR
+func splitOr(expr string) []string {
+	var res []string
+	var current []string
+	for _, token := range strings.Fields(expr) {
+		if strings.EqualFold(token, "OR") {
+			res = append(res, strings.Join(current, " "))
+			current = nil
+			continue
+		}
+		current = append(current, token)
+	}
+	return append(res, strings.Join(current, " "))
+}
+
+// splitAnd splits on AND while keeping BETWEEN x AND y together
+func splitAnd(expr string) []string {
+	var res []string
+	tokens := strings.Fields(expr)
+	var current []string
+	for i := 0; i < len(tokens); i++ {
+		if strings.EqualFold(tokens[i], "AND") {
+			if len(current) >= 2 && strings.EqualFold(current[len(current)-2], "BETWEEN") {
+				current = append(current, "AND")
+				continue
+			}
+			res = append(res, strings.Join(current, " "))
+			current = nil
+			continue
+		}
+		current = append(current, tokens[i])
+	}
+	if len(current) > 0 {
+		res = append(res, strings.Join(current, " "))
+	}
+	return res
+}
+
+// compare applies the comparison operator 'op' to the result of order
+func compare(c int, op string) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// order compares two scalar values like DynamoDB: numbers numerically, other values
+// by their string form
+func order(a, b types.AttributeValue) int {
+	an, aok := a.(*types.AttributeValueMemberN)
+	bn, bok := b.(*types.AttributeValueMemberN)
+	if aok && bok {
+		x, errX := strconv.ParseFloat(an.Value, 64)
+		y, errY := strconv.ParseFloat(bn.Value, 64)
+		if errX == nil && errY == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(scalar(a), scalar(b))
+}
+
+func resolveName(name string, names map[string]string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "#") {
+		if resolved, ok := names[name]; ok {
+			return resolved
+		}
+	}
+	return name
+}
+
+func scalar(av types.AttributeValue) string {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return v.Value
+	case *types.AttributeValueMemberBOOL:
+		return fmt.Sprint(v.Value)
+	}
+	return ""
+}
+
+func storageKey(item map[string]types.AttributeValue) string {
+	return scalar(item["PK"]) + "|" + scalar(item["SK"])
+}
+
+func copyItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	res := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore"
+)
+
+// KeyQuery selects items by fully expanded key values. Unlike QueryGSI, the values are
+// used verbatim, which suits callers that expand key templates themselves, such as
+// generated repositories.
+type KeyQuery struct {
+	// IndexName is the logical index (e.g. "GSI1"), or empty to query the table
+	IndexName string
+	// PartitionKey is the exact partition key value
+	PartitionKey string
+	// SortKey, when set, must equal the sort key
+	SortKey string
+	// SortKeyPrefix, when set and SortKey is empty, must be a prefix of the sort key
+	SortKeyPrefix string
+	// Limit caps the number of items of type T returned, 0 means no limit
+	Limit int32
+}
+
+// QueryKey runs a KeyQuery and returns the matching items of type T, reading every page
+// of the result up to Limit items
+func (d *DynamodbDataStore[T]) QueryKey(ctx context.Context, q KeyQuery) (_ []T, err error) {
+	ctx, op := d.startOperation(ctx, "QueryKey", indexAttrs(&q.IndexName)...)
+	defer op.end(ctx, &err)
+
+	if q.PartitionKey == "" {
+		return nil, fmt.Errorf("partition key value is required")
+	}
+
+	pkName, skName := "PK", "SK"
+	input := &sdk.QueryInput{
+		TableName:                 &d.tableName,
+		ExpressionAttributeValues: map[string]types.AttributeValue{},
+		ReturnConsumedCapacity:    d.returnCapacity,
+	}
+	if q.IndexName != "" {
+		gsiConfig, ok := d.gsiConfig(q.IndexName)
+		if !ok {
+			return nil, fmt.Errorf("GSI configuration not found for index %s", q.IndexName)
+		}
+		pkName, skName = gsiConfig.PartitionKeyName, gsiConfig.SortKeyName
+		input.IndexName = aws.String(gsiConfig.IndexName)
+	}
+
+	keyCond := pkName + " = :pk"
+	input.ExpressionAttributeValues[":pk"] = &types.AttributeValueMemberS{Value: q.PartitionKey}
+	switch {
+	case q.SortKey != "":
+		keyCond += " AND " + skName + " = :sk"
+		input.ExpressionAttributeValues[":sk"] = &types.AttributeValueMemberS{Value: q.SortKey}
+	case q.SortKeyPrefix != "":
+		keyCond += " AND begins_with(" + skName + ", :sk)"
+		input.ExpressionAttributeValues[":sk"] = &types.AttributeValueMemberS{Value: q.SortKeyPrefix}
+	}
+	input.KeyConditionExpression = &keyCond
+
+	// Items of other entity types sharing the partition are skipped, so pages are read
+	// until Limit items of T were found or the partition is exhausted
+	entityType := d.entityTypeOf(new(T))
+	results := make([]T, 0)
+	for {
+		if q.Limit > 0 {
+			input.Limit = aws.Int32(q.Limit - int32(len(results)))
+		}
+		out, err := d.client.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("query error: %w", err)
+		}
+		op.response(ctx, out.ResultMetadata, out.ConsumedCapacity)
+		op.page(len(out.Items), len(out.LastEvaluatedKey) > 0)
+
+		for _, item := range out.Items {
+			if d.itemEntityType(item) != entityType {
+				continue
+			}
+			item, err := d.upcast(ctx, entityType, item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to upcast item: %w", err)
+			}
+			delete(item, "EntityType")
+
+			var result T
+			if err := attributevalue.UnmarshalMap(item, &result); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal item: %w", err)
+			}
+			if err := datastore.RunAfterLoadWithRegistry(ctx, d.registry, &result); err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+
+		if len(out.LastEvaluatedKey) == 0 || (q.Limit > 0 && int32(len(results)) >= q.Limit) {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	op.addItems(len(results))
+	return results, nil
+}
+
+// typedResults keeps the query results of type T or *T
+func typedResults[T any](results []interface{}) []T {
+	typed := make([]T, 0, len(results))
+	for _, r := range results {
+		if t, ok := r.(T); ok {
+			typed = append(typed, t)
+		} else if t, ok := r.(*T); ok {
+			typed = append(typed, *t)
+		}
+	}
+	return typed
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	"github.com/suparena/entitystore/registry"
+)
+
+// KeyQueryTestMember is stored in its organization's partition
+type KeyQueryTestMember struct {
+	OrgID string
+	ID    string
+	Email string
+	Level int
+}
+
+func init() {
+	registry.RegisterIndexMap[KeyQueryTestMember](map[string]string{
+		"PK":     "ORG#{OrgID}",
+		"SK":     "MEMBER#{ID}",
+		"GSI1PK": "EMAIL#{Email}",
+		"GSI1SK": "LEVEL#{Level}",
+	})
+}
+
+func TestExpandTemplate(t *testing.T) {
+	values := map[string]any{
+		"OrgID": "acme",
+		"Level": 3,
+	}
+	got, err := ExpandTemplate("ORG#{OrgID}#LEVEL#{Level}", values)
+	if err != nil {
+		t.Fatalf("ExpandTemplate failed: %v", err)
+	}
+	if got != "ORG#acme#LEVEL#3" {
+		t.Errorf("unexpected expansion %q", got)
+	}
+
+	if got, err := ExpandTemplate("ORG#{OrgID}#{Missing}", values); err == nil {
+		t.Errorf("expected error for a missing macro, got %q", got)
+	}
+	if got, err := ExpandTemplate("ORG#{OrgID}", map[string]any{"OrgID": nil}); err == nil {
+		t.Errorf("expected error for a nil value, got %q", got)
+	}
+}
+
+func TestQueryKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewDynamodbDataStoreWithClient[KeyQueryTestMember](fakeddb.New(), "test-table")
+
+	members := []KeyQueryTestMember{
+		{OrgID: "acme", ID: "1", Email: "a@acme.test", Level: 1},
+		{OrgID: "acme", ID: "2", Email: "b@acme.test", Level: 2},
+		{OrgID: "other", ID: "3", Email: "a@acme.test", Level: 2},
+	}
+	for _, m := range members {
+		if err := store.Put(ctx, m); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	got, err := store.QueryKey(ctx, KeyQuery{PartitionKey: "ORG#acme", SortKeyPrefix: "MEMBER#"})
+	if err != nil {
+		t.Fatalf("QueryKey failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("expected 2 members of acme, got %+v", got)
+	}
+
+	got, err = store.QueryKey(ctx, KeyQuery{IndexName: "GSI1", PartitionKey: "EMAIL#a@acme.test", SortKey: "LEVEL#2"})
+	if err != nil {
+		t.Fatalf("QueryKey failed: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != "3" {
+		t.Errorf("expected member 3, got %+v", got)
+	}
+
+	if _, err := store.QueryKey(ctx, KeyQuery{}); err == nil {
+		t.Error("expected error without partition key")
+	}
+}
+
+func TestQueryKeyPagesPastOtherEntityTypes(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[KeyQueryTestMember](client, "test-table")
+
+	// Items of another entity type sort before the members of the partition
+	for i := 0; i < 3; i++ {
+		_, err := client.PutItem(ctx, &sdk.PutItemInput{
+			TableName: aws.String("test-table"),
+			Item: map[string]types.AttributeValue{
+				"PK":         &types.AttributeValueMemberS{Value: "ORG#acme"},
+				"SK":         &types.AttributeValueMemberS{Value: fmt.Sprintf("INVITE#%d", i)},
+				"EntityType": &types.AttributeValueMemberS{Value: "Invite"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := store.Put(ctx, KeyQueryTestMember{OrgID: "acme", ID: fmt.Sprint(i), Email: "m@acme.test"}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	got, err := store.QueryKey(ctx, KeyQuery{PartitionKey: "ORG#acme", Limit: 2})
+	if err != nil {
+		t.Fatalf("QueryKey failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("expected 2 members with Limit 2, got %+v", got)
+	}
+
+	// A limit above the size of the partition reads it in one page
+	calls := len(client.Calls())
+	got, err = store.QueryKey(ctx, KeyQuery{PartitionKey: "ORG#acme", Limit: 10})
+	if err != nil {
+		t.Fatalf("QueryKey failed: %v", err)
+	}
+	if len(got) != 3 {
+		t.Errorf("expected all 3 members, got %+v", got)
+	}
+	if queries := len(client.Calls()) - calls; queries != 1 {
+		t.Errorf("expected a single page for 6 items with Limit 10, got %d queries", queries)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+)
+
+// LifecycleTestSession has managed timestamps, a version and a TTL
+type LifecycleTestSession struct {
+	ID        string
+	User      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Version   int64
+}
+
+func init() {
+	registry.RegisterIndexMap[LifecycleTestSession](map[string]string{
+		"PK":         "SESSION#{ID}",
+		"SK":         "SESSION#{ID}",
+		"@CreatedAt": "CreatedAt",
+		"@UpdatedAt": "UpdatedAt",
+		"@Version":   "Version",
+		"@TTL":       "ExpiresAt",
+		"@TTLAfter":  "1h",
+	})
+}
+
+func TestLifecycleDirectives(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[LifecycleTestSession](client, "test-table")
+
+	t.Run("CreateStampsItem", func(t *testing.T) {
+		before := time.Now().UTC().Add(-time.Second)
+		if err := store.Create(ctx, LifecycleTestSession{ID: "1", User: "alice"}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		item, ok := client.Item("SESSION#1", "SESSION#1")
+		if !ok {
+			t.Fatal("item was not stored")
+		}
+		if _, ok := item["@CreatedAt"]; ok {
+			t.Error("directives must not be written as attributes")
+		}
+		ttl, err := strconv.ParseInt(item["ExpiresAt"].(*types.AttributeValueMemberN).Value, 10, 64)
+		if err != nil || time.Unix(ttl, 0).Before(before.Add(time.Hour)) {
+			t.Errorf("expected TTL about one hour ahead, got %v (%v)", ttl, err)
+		}
+
+		got, err := store.GetOne(ctx, "1")
+		if err != nil {
+			t.Fatalf("GetOne failed: %v", err)
+		}
+		if got.Version != 1 || got.CreatedAt.Before(before) || !got.UpdatedAt.Equal(got.CreatedAt) {
+			t.Errorf("unexpected stored session: %+v", got)
+		}
+
+		err = store.Create(ctx, LifecycleTestSession{ID: "1", User: "bob"})
+		if !eserrors.IsAlreadyExists(err) {
+			t.Errorf("expected AlreadyExistsError, got %v", err)
+		}
+	})
+
+	t.Run("PutChecksVersion", func(t *testing.T) {
+		current, err := store.GetOne(ctx, "1")
+		if err != nil {
+			t.Fatalf("GetOne failed: %v", err)
+		}
+
+		stale := *current
+		current.User = "alice2"
+		if err := store.Put(ctx, *current); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+
+		stale.User = "mallory"
+		if err := store.Put(ctx, stale); !eserrors.IsConditionFailed(err) {
+			t.Fatalf("expected ConditionFailedError for stale version, got %v", err)
+		}
+
+		got, _ := store.GetOne(ctx, "1")
+		if got.Version != 2 || got.User != "alice2" || !got.CreatedAt.Equal(current.CreatedAt) {
+			t.Errorf("unexpected stored session: %+v", got)
+		}
+	})
+
+	t.Run("PutVersionedKeepsVersion", func(t *testing.T) {
+		session := LifecycleTestSession{ID: "2", User: "dave"}
+		for i := 1; i <= 2; i++ {
+			if err := store.PutVersioned(ctx, &session); err != nil {
+				t.Fatalf("PutVersioned #%d failed: %v", i, err)
+			}
+			if session.Version != int64(i) {
+				t.Errorf("Version = %d after PutVersioned #%d, want %d", session.Version, i, i)
+			}
+		}
+	})
+
+	t.Run("PutReplacesUnversionedItem", func(t *testing.T) {
+		// An item written before @Version was added has no version attribute
+		_, err := client.PutItem(ctx, &sdk.PutItemInput{
+			TableName: aws.String("test-table"),
+			Item: map[string]types.AttributeValue{
+				"PK":   &types.AttributeValueMemberS{Value: "SESSION#3"},
+				"SK":   &types.AttributeValueMemberS{Value: "SESSION#3"},
+				"ID":   &types.AttributeValueMemberS{Value: "3"},
+				"User": &types.AttributeValueMemberS{Value: "erin"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+		if err := store.Put(ctx, LifecycleTestSession{ID: "3", User: "erin2"}); err != nil {
+			t.Fatalf("Put over an unversioned item failed: %v", err)
+		}
+		if got, _ := store.GetOne(ctx, "3"); got == nil || got.Version != 1 {
+			t.Errorf("unexpected session after Put: %+v", got)
+		}
+		if err := store.Put(ctx, LifecycleTestSession{ID: "3", User: "mallory"}); !eserrors.IsConditionFailed(err) {
+			t.Errorf("expected ConditionFailedError once the item is versioned, got %v", err)
+		}
+	})
+
+	t.Run("TransactionalPutChecksVersion", func(t *testing.T) {
+		err := store.PutWithOptions(ctx, LifecycleTestSession{ID: "1", Version: 1},
+			WithOutboxEvents(OutboxEvent{AggregateID: "1", Type: "SessionChanged"}))
+		if !eserrors.IsConditionFailed(err) {
+			t.Errorf("expected ConditionFailedError, got %v", err)
+		}
+	})
+
+	t.Run("UpdateMaintainsFields", func(t *testing.T) {
+		before, _ := store.GetOne(ctx, "1")
+		err := store.UpdateWithCondition(ctx, LifecycleTestSession{ID: "1"},
+			map[string]interface{}{"User": "carol"}, "attribute_exists(PK)")
+		if err != nil {
+			t.Fatalf("UpdateWithCondition failed: %v", err)
+		}
+
+		got, _ := store.GetOne(ctx, "1")
+		if got.User != "carol" || got.Version != before.Version+1 || got.UpdatedAt.Before(before.UpdatedAt) {
+			t.Errorf("unexpected session after update: %+v", got)
+		}
+	})
+}
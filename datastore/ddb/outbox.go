@@ -0,0 +1,347 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/suparena/entitystore/datastore"
+	eserrors "github.com/suparena/entitystore/errors"
+)
+
+// Outbox item layout. Outbox messages live in the same table as the entities they
+// belong to, partitioned by aggregate so that they are ordered per aggregate:
+//
+//	PK  = OUTBOX#<AggregateID>
+//	SK  = EVENT#<CreatedAt>#<Sequence>#<ID>
+//	PK1 = OUTBOX#PENDING                      (outbox GSI, removed once the message is sent)
+//	SK1 = <CreatedAt>#<AggregateID>#<Sequence>#<ID>
+const (
+	// OutboxEntityType is the EntityType attribute written on outbox items
+	OutboxEntityType = "OutboxMessage"
+	// OutboxPendingPartition is the GSI partition key value of messages awaiting delivery
+	OutboxPendingPartition = "OUTBOX#PENDING"
+	// OutboxFailedPartition is the GSI partition key value of messages that exhausted their retries
+	OutboxFailedPartition = "OUTBOX#FAILED"
+
+	// OutboxStatusPending marks a message that has not been published yet
+	OutboxStatusPending = "PENDING"
+	// OutboxStatusSent marks a message that was handed to the publisher successfully
+	OutboxStatusSent = "SENT"
+	// OutboxStatusFailed marks a message that exhausted its retries
+	OutboxStatusFailed = "FAILED"
+
+	// outboxTimeFormat is fixed-width so that lexical order equals chronological order
+	outboxTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+	// DefaultOutboxIndex is the GSI holding pending outbox messages
+	DefaultOutboxIndex = "GSI1"
+
+	// maxTransactItems is the DynamoDB limit for TransactWriteItems
+	maxTransactItems = 100
+)
+
+// WithOutboxIndex sets the GSI holding pending outbox messages, DefaultOutboxIndex by
+// default. Relays created with outbox.WithStore read the same index.
+func WithOutboxIndex(name string) StoreOption {
+	return func(o *storeOptions) {
+		o.outboxIndex = name
+	}
+}
+
+// OutboxIndex returns the configuration of the GSI holding pending outbox messages,
+// resolved in the registry of the datastore. When the GSI is not configured, only its
+// IndexName is set.
+func (d *DynamodbDataStore[T]) OutboxIndex() (GSIConfig, bool) {
+	name := d.outboxIndexName()
+	config, ok := d.gsiConfig(name)
+	if !ok {
+		return GSIConfig{IndexName: name}, false
+	}
+	return config, true
+}
+
+func (d *DynamodbDataStore[T]) outboxIndexName() string {
+	if d.outboxIndex == "" {
+		return DefaultOutboxIndex
+	}
+	return d.outboxIndex
+}
+
+// OutboxEvent is a domain event to be written atomically with an entity
+type OutboxEvent struct {
+	// ID uniquely identifies the event; a UUID is generated when empty
+	ID string
+	// AggregateID groups events that must be published in order (for example the entity ID)
+	AggregateID string
+	// Type is the event type, e.g. "UserRegistered"
+	Type string
+	// Payload is the serialized event body
+	Payload []byte
+}
+
+// OutboxMessage is the stored form of an OutboxEvent as read by the relay
+type OutboxMessage struct {
+	PK            string    `dynamodbav:"PK"`
+	SK            string    `dynamodbav:"SK"`
+	ID            string    `dynamodbav:"ID"`
+	AggregateID   string    `dynamodbav:"AggregateID"`
+	Type          string    `dynamodbav:"Type"`
+	Payload       []byte    `dynamodbav:"Payload"`
+	Sequence      int       `dynamodbav:"Sequence"`
+	Status        string    `dynamodbav:"Status"`
+	Attempts      int       `dynamodbav:"Attempts"`
+	LastError     string    `dynamodbav:"LastError,omitempty"`
+	CreatedAt     time.Time `dynamodbav:"CreatedAt"`
+	NextAttemptAt time.Time `dynamodbav:"NextAttemptAt"`
+}
+
+// PutOptions configures a single PutWithOptions call
+type PutOptions struct {
+	// OutboxEvents are written in the same transaction as the entity
+	OutboxEvents []OutboxEvent
+}
+
+// PutOption is a functional option for PutWithOptions
+type PutOption func(*PutOptions)
+
+// WithOutboxEvents writes the given events to the transactional outbox together with the entity.
+// Either the entity and all events are stored, or none of them.
+func WithOutboxEvents(events ...OutboxEvent) PutOption {
+	return func(opts *PutOptions) {
+		opts.OutboxEvents = append(opts.OutboxEvents, events...)
+	}
+}
+
+// PutWithOptions stores 'entity' like Put and applies the given options.
+// When outbox events are supplied the entity and the events are written with
+// TransactWriteItems so that an event is recorded if and only if the entity is.
+func (d *DynamodbDataStore[T]) PutWithOptions(ctx context.Context, entity T, opts ...PutOption) error {
+	return d.write(ctx, &entity, false, opts)
+}
+
+// PutVersioned stores 'entity' like PutWithOptions and, once the write succeeded, leaves
+// it with the stamped lifecycle fields, so that the next PutVersioned of the same struct
+// expects the version just written. Put takes the entity by value: after a Put of a type
+// with @Version the caller must re-read the entity before putting it again.
+func (d *DynamodbDataStore[T]) PutVersioned(ctx context.Context, entity *T, opts ...PutOption) error {
+	stamped := *entity
+	if err := d.write(ctx, &stamped, false, opts); err != nil {
+		return err
+	}
+	*entity = stamped
+	return nil
+}
+
+// write implements Put, PutWithOptions, PutVersioned and Create, stamping the lifecycle
+// fields of 'entity'. With 'create' set the write fails with an AlreadyExistsError if
+// the item exists.
+func (d *DynamodbDataStore[T]) write(ctx context.Context, entity *T, create bool, opts []PutOption) (err error) {
+	name := "Put"
+	if create {
+		name = "Create"
+	}
+	ctx, op := d.startOperation(ctx, name)
+	defer op.end(ctx, &err)
+
+	var options PutOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	indexMap, ok := d.indexMap()
+	if !ok {
+		return errors.New("no index map found for entity type")
+	}
+
+	lifecycle, err := d.lifecycle(indexMap)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	previousVersion, err := lifecycle.Stamp(entity, now, create)
+	if err != nil {
+		return err
+	}
+
+	if err := datastore.RunBeforePutWithRegistry(ctx, d.registry, entity); err != nil {
+		return err
+	}
+
+	av, err := d.buildItem(*entity, indexMap)
+	if err != nil {
+		return err
+	}
+	if expiresAt, ok, err := lifecycle.ExpiresAt(entity, now); err != nil {
+		return err
+	} else if ok {
+		av[lifecycle.TTLAttribute] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)}
+	}
+
+	condition, names, values, err := writeCondition(lifecycle, create, previousVersion)
+	if err != nil {
+		return err
+	}
+
+	if len(options.OutboxEvents) == 0 {
+		out, err := d.client.PutItem(ctx, &sdk.PutItemInput{
+			TableName:                 &d.tableName,
+			Item:                      av,
+			ConditionExpression:       condition,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			ReturnConsumedCapacity:    d.returnCapacity,
+		})
+		if err != nil {
+			var cfe *types.ConditionalCheckFailedException
+			if errors.As(err, &cfe) {
+				return writeConflict(av, create, *condition)
+			}
+			return fmt.Errorf("PutItem failed: %w", err)
+		}
+		op.response(ctx, out.ResultMetadata, out.ConsumedCapacity)
+		op.addItems(1)
+		return nil
+	}
+
+	if len(options.OutboxEvents)+1 > maxTransactItems {
+		return eserrors.NewValidationError("OutboxEvents",
+			fmt.Sprintf("at most %d outbox events can be written with one entity", maxTransactItems-1))
+	}
+
+	transactItems := make([]types.TransactWriteItem, 0, len(options.OutboxEvents)+1)
+	transactItems = append(transactItems, types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:                 &d.tableName,
+			Item:                      av,
+			ConditionExpression:       condition,
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		},
+	})
+
+	outboxGSI, ok := d.OutboxIndex()
+	if !ok {
+		return fmt.Errorf("GSI configuration not found for outbox index %s", d.outboxIndexName())
+	}
+	for i, event := range options.OutboxEvents {
+		item, err := buildOutboxItem(event, i, now, outboxGSI)
+		if err != nil {
+			return err
+		}
+		transactItems = append(transactItems, types.TransactWriteItem{
+			Put: &types.Put{TableName: &d.tableName, Item: item},
+		})
+	}
+
+	out, err := d.client.TransactWriteItems(ctx, &sdk.TransactWriteItemsInput{
+		TransactItems:          transactItems,
+		ReturnConsumedCapacity: d.returnCapacity,
+	})
+	if err != nil {
+		var tce *types.TransactionCanceledException
+		if condition != nil && errors.As(err, &tce) && len(tce.CancellationReasons) > 0 &&
+			aws.ToString(tce.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			return writeConflict(av, create, *condition)
+		}
+		return fmt.Errorf("TransactWriteItems failed: %w", err)
+	}
+	capacities := make([]*types.ConsumedCapacity, len(out.ConsumedCapacity))
+	for i := range out.ConsumedCapacity {
+		capacities[i] = &out.ConsumedCapacity[i]
+	}
+	op.response(ctx, out.ResultMetadata, capacities...)
+	op.addItems(len(transactItems))
+	return nil
+}
+
+// writeCondition returns the condition guarding a write: the item must not exist on
+// create, and must still have the previous version when versioning is enabled. An
+// entity with version 0 may replace an item without a version, e.g. one written before
+// @Version was added.
+func writeCondition(lifecycle datastore.Lifecycle, create bool, previousVersion int64) (*string, map[string]string, map[string]types.AttributeValue, error) {
+	if create {
+		return aws.String("attribute_not_exists(" + TablePartitionKey + ")"), nil, nil, nil
+	}
+	if lifecycle.Version == "" {
+		return nil, nil, nil, nil
+	}
+	if previousVersion == 0 {
+		return aws.String("attribute_not_exists(#version) OR #version = :zero"),
+			map[string]string{"#version": lifecycle.Version},
+			map[string]types.AttributeValue{":zero": &types.AttributeValueMemberN{Value: "0"}},
+			nil
+	}
+
+	expected, err := attributevalue.Marshal(previousVersion)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to marshal version: %w", err)
+	}
+	return aws.String("#version = :expectedVersion"),
+		map[string]string{"#version": lifecycle.Version},
+		map[string]types.AttributeValue{":expectedVersion": expected},
+		nil
+}
+
+// writeConflict converts a failed write condition into the matching semantic error
+func writeConflict(item map[string]types.AttributeValue, create bool, condition string) error {
+	if create {
+		var key string
+		if pk, ok := item[TablePartitionKey].(*types.AttributeValueMemberS); ok {
+			key = pk.Value
+		}
+		var entityType string
+		if attr, ok := item["EntityType"].(*types.AttributeValueMemberS); ok {
+			entityType = attr.Value
+		}
+		return eserrors.NewAlreadyExistsError(entityType, key)
+	}
+	return eserrors.NewConditionFailedError("put", condition)
+}
+
+// buildOutboxItem converts an event into its stored representation
+func buildOutboxItem(event OutboxEvent, sequence int, now time.Time, gsiConfig GSIConfig) (map[string]types.AttributeValue, error) {
+	if event.AggregateID == "" {
+		return nil, eserrors.NewValidationError("AggregateID", "outbox events require an aggregate ID")
+	}
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+
+	ts := now.Format(outboxTimeFormat)
+	msg := OutboxMessage{
+		PK:            "OUTBOX#" + event.AggregateID,
+		SK:            fmt.Sprintf("EVENT#%s#%04d#%s", ts, sequence, event.ID),
+		ID:            event.ID,
+		AggregateID:   event.AggregateID,
+		Type:          event.Type,
+		Payload:       event.Payload,
+		Sequence:      sequence,
+		Status:        OutboxStatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+
+	item, err := attributevalue.MarshalMap(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal outbox event: %w", err)
+	}
+	item["EntityType"] = &types.AttributeValueMemberS{Value: OutboxEntityType}
+
+	item[gsiConfig.PartitionKeyName] = &types.AttributeValueMemberS{Value: OutboxPendingPartition}
+	item[gsiConfig.SortKeyName] = &types.AttributeValueMemberS{
+		Value: fmt.Sprintf("%s#%s#%04d#%s", ts, event.AggregateID, sequence, event.ID),
+	}
+	return item, nil
+}
@@ -0,0 +1,34 @@
+/*
+Package outbox relays domain events written through the transactional outbox.
+
+Events are recorded atomically with an entity using DynamodbDataStore.PutWithOptions:
+
+	err := store.PutWithOptions(ctx, order,
+	    ddb.WithOutboxEvents(ddb.OutboxEvent{
+	        AggregateID: order.ID,
+	        Type:        "OrderPlaced",
+	        Payload:     payload,
+	    }),
+	)
+
+A Relay then reads pending messages from the outbox index of the store (GSI1 unless set
+with ddb.WithOutboxIndex) in creation order, hands them to a Publisher and marks them as
+sent. Sent messages expire through the table's TTL after WithSentRetention, 7 days by
+default:
+
+	relay, err := outbox.NewRelay(client, tableName, publisher,
+	    outbox.WithStore(store),
+	    outbox.WithPollInterval(time.Second),
+	    outbox.WithMaxAttempts(5),
+	)
+	err = relay.Run(ctx)
+
+Delivery is at-least-once. Messages of the same aggregate are published in order:
+when a message fails, later messages of that aggregate wait until it succeeds or
+exhausts its retries and is moved to the failed partition. A batch reads further pages
+past blocked aggregates, so they do not delay the others.
+
+ChannelPublisher delivers messages to a Go channel and is intended for tests and
+in-process consumers.
+*/
+package outbox
@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package outbox
+
+import (
+	"context"
+
+	"github.com/suparena/entitystore/datastore/ddb"
+)
+
+// Message is an outbox message as handed to a Publisher
+type Message = ddb.OutboxMessage
+
+// Publisher delivers outbox messages to a message broker, event bus, etc.
+// Returning an error leaves the message pending so it is retried later.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+// Publish calls f(ctx, msg)
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// ChannelPublisher publishes messages to a Go channel
+type ChannelPublisher struct {
+	ch chan Message
+}
+
+// NewChannelPublisher creates a ChannelPublisher with the given channel buffer size
+func NewChannelPublisher(bufferSize int) *ChannelPublisher {
+	return &ChannelPublisher{
+		ch: make(chan Message, bufferSize),
+	}
+}
+
+// Publish sends msg on the channel, blocking until it is received or ctx is done
+func (p *ChannelPublisher) Publish(ctx context.Context, msg Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case p.ch <- msg:
+		return nil
+	}
+}
+
+// Messages returns the channel that published messages are delivered on
+func (p *ChannelPublisher) Messages() <-chan Message {
+	return p.ch
+}
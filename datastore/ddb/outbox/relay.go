@@ -0,0 +1,347 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb"
+	"github.com/suparena/entitystore/registry"
+)
+
+// RelayOptions configures a Relay
+type RelayOptions struct {
+	IndexName     string             // GSI holding pending messages (default: ddb.DefaultOutboxIndex)
+	Store         OutboxStore        // Store writing the messages; its outbox index replaces IndexName
+	Registry      *registry.Registry // Registry declaring IndexName without a Store (default: registry.Default())
+	BatchSize     int32              // Messages handled per batch, and pending messages read per page (default: 100)
+	PollInterval  time.Duration      // Wait when no message was published (default: 1s)
+	MaxAttempts   int                // Publish attempts before a message is marked failed (default: 10)
+	RetryBackoff  time.Duration      // Base delay between attempts, multiplied by the attempt count (default: 1s)
+	SentRetention time.Duration      // How long sent messages are kept before their TTL expires; zero keeps them (default: 7 days)
+	TTLAttribute  string             // TTL attribute of the table, set on sent messages (default: ExpiresAt)
+	ErrorHandler  func(error) bool   // Return true to keep running after a storage error, false to stop
+}
+
+// OutboxStore is the store writing outbox messages, e.g. a *ddb.DynamodbDataStore
+type OutboxStore interface {
+	// OutboxIndex returns the configuration of the GSI holding pending messages; when
+	// the GSI is not configured, only its IndexName is set
+	OutboxIndex() (ddb.GSIConfig, bool)
+}
+
+// RelayOption is a functional option for configuring a Relay
+type RelayOption func(*RelayOptions)
+
+// DefaultRelayOptions returns default relay options
+func DefaultRelayOptions() RelayOptions {
+	return RelayOptions{
+		IndexName:     ddb.DefaultOutboxIndex,
+		BatchSize:     100,
+		PollInterval:  time.Second,
+		MaxAttempts:   10,
+		RetryBackoff:  time.Second,
+		SentRetention: 7 * 24 * time.Hour,
+		TTLAttribute:  "ExpiresAt",
+	}
+}
+
+// WithIndexName sets the GSI used to find pending messages
+func WithIndexName(name string) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.IndexName = name
+	}
+}
+
+// WithStore makes the relay read the outbox index of 's', so that it matches the store
+// options the messages were written with
+func WithStore(s OutboxStore) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.Store = s
+	}
+}
+
+// WithRegistry resolves IndexName in 'reg', the registry of the stores writing the
+// messages, when no store is set with WithStore
+func WithRegistry(reg *registry.Registry) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.Registry = reg
+	}
+}
+
+// WithSentRetention sets how long sent messages are kept: their 'ttlAttribute' is set
+// to the expiry so that DynamoDB TTL deletes them. Zero keeps sent messages.
+func WithSentRetention(retention time.Duration, ttlAttribute string) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.SentRetention = retention
+		opts.TTLAttribute = ttlAttribute
+	}
+}
+
+// WithBatchSize sets the number of messages handled per batch
+func WithBatchSize(size int32) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.BatchSize = size
+	}
+}
+
+// WithPollInterval sets the wait between batches when nothing was published
+func WithPollInterval(interval time.Duration) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.PollInterval = interval
+	}
+}
+
+// WithMaxAttempts sets how often a message is tried before it is marked failed
+func WithMaxAttempts(attempts int) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.MaxAttempts = attempts
+	}
+}
+
+// WithRetryBackoff sets the base delay between publish attempts
+func WithRetryBackoff(backoff time.Duration) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.RetryBackoff = backoff
+	}
+}
+
+// WithErrorHandler sets a handler that decides whether Run continues after a storage error
+func WithErrorHandler(handler func(error) bool) RelayOption {
+	return func(opts *RelayOptions) {
+		opts.ErrorHandler = handler
+	}
+}
+
+// Relay moves pending outbox messages to a Publisher
+type Relay struct {
+	client    ddb.DynamoDBAPI
+	tableName string
+	publisher Publisher
+	options   RelayOptions
+	gsiConfig ddb.GSIConfig
+}
+
+// NewRelay creates a Relay reading the outbox of the given table
+func NewRelay(client ddb.DynamoDBAPI, tableName string, publisher Publisher, opts ...RelayOption) (*Relay, error) {
+	options := DefaultRelayOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var gsiConfig ddb.GSIConfig
+	var ok bool
+	indexName := options.IndexName
+	if options.Store != nil {
+		gsiConfig, ok = options.Store.OutboxIndex()
+		indexName = gsiConfig.IndexName
+	} else {
+		gsiConfig, ok = ddb.GetGSIConfigWithRegistry(options.Registry, options.IndexName)
+	}
+	if !ok {
+		return nil, fmt.Errorf("GSI configuration not found for outbox index %s", indexName)
+	}
+
+	return &Relay{
+		client:    client,
+		tableName: tableName,
+		publisher: publisher,
+		options:   options,
+		gsiConfig: gsiConfig,
+	}, nil
+}
+
+// Run publishes pending messages until ctx is cancelled. It returns nil on
+// cancellation, or the first storage error not accepted by the ErrorHandler.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		published, err := r.ProcessBatch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if r.options.ErrorHandler == nil || !r.options.ErrorHandler(err) {
+				return err
+			}
+		}
+
+		if published > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.options.PollInterval):
+		}
+	}
+}
+
+// ProcessBatch performs a single pass over the pending messages, oldest first, and
+// returns the number of messages published. Messages of aggregates blocked by a
+// waiting or failing message are skipped, and further pages are read until BatchSize
+// messages were attempted, so that blocked aggregates do not starve the others.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	blocked := make(map[string]bool)
+	published, attempted := 0, 0
+
+	var startKey map[string]types.AttributeValue
+	for {
+		messages, lastKey, err := r.pending(ctx, startKey)
+		if err != nil {
+			return published, err
+		}
+
+		for _, msg := range messages {
+			if attempted >= int(r.options.BatchSize) {
+				return published, nil
+			}
+			// Preserve per-aggregate order: nothing after a waiting or failed message is sent.
+			if blocked[msg.AggregateID] {
+				continue
+			}
+			if msg.NextAttemptAt.After(now) {
+				blocked[msg.AggregateID] = true
+				continue
+			}
+
+			attempted++
+			if pubErr := r.publisher.Publish(ctx, msg); pubErr != nil {
+				blocked[msg.AggregateID] = true
+				if err := r.recordFailure(ctx, msg, pubErr, now); err != nil {
+					return published, err
+				}
+				continue
+			}
+
+			if err := r.markSent(ctx, msg, now); err != nil {
+				return published, err
+			}
+			published++
+		}
+
+		if len(lastKey) == 0 || attempted >= int(r.options.BatchSize) {
+			return published, nil
+		}
+		startKey = lastKey
+	}
+}
+
+// pending reads a page of pending messages starting after 'startKey'
+func (r *Relay) pending(ctx context.Context, startKey map[string]types.AttributeValue) ([]Message, map[string]types.AttributeValue, error) {
+	keyCond := r.gsiConfig.PartitionKeyName + " = :pk"
+	out, err := r.client.Query(ctx, &sdk.QueryInput{
+		TableName:              &r.tableName,
+		IndexName:              aws.String(r.gsiConfig.IndexName),
+		KeyConditionExpression: &keyCond,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: ddb.OutboxPendingPartition},
+		},
+		ScanIndexForward:  aws.Bool(true),
+		Limit:             aws.Int32(r.options.BatchSize),
+		ExclusiveStartKey: startKey,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query pending outbox messages: %w", err)
+	}
+
+	messages := make([]Message, 0, len(out.Items))
+	for _, item := range out.Items {
+		var msg Message
+		if err := attributevalue.UnmarshalMap(item, &msg); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal outbox message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, out.LastEvaluatedKey, nil
+}
+
+// markSent flags a message as sent, removes it from the pending index and sets its TTL
+func (r *Relay) markSent(ctx context.Context, msg Message, now time.Time) error {
+	expr := "SET #status = :sent, #sentAt = :now"
+	names := map[string]string{
+		"#status": "Status",
+		"#sentAt": "SentAt",
+		"#gsipk":  r.gsiConfig.PartitionKeyName,
+		"#gsisk":  r.gsiConfig.SortKeyName,
+	}
+	values := map[string]types.AttributeValue{
+		":sent": &types.AttributeValueMemberS{Value: ddb.OutboxStatusSent},
+		":now":  &types.AttributeValueMemberS{Value: now.Format(time.RFC3339Nano)},
+	}
+	if r.options.SentRetention > 0 && r.options.TTLAttribute != "" {
+		expr += ", #ttl = :ttl"
+		names["#ttl"] = r.options.TTLAttribute
+		values[":ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(r.options.SentRetention).Unix(), 10)}
+	}
+	return r.update(ctx, msg, expr+" REMOVE #gsipk, #gsisk", names, values)
+}
+
+// recordFailure counts a failed attempt and either schedules a retry or, once
+// MaxAttempts is reached, moves the message to the failed partition
+func (r *Relay) recordFailure(ctx context.Context, msg Message, pubErr error, now time.Time) error {
+	attempts := msg.Attempts + 1
+	names := map[string]string{
+		"#status":   "Status",
+		"#attempts": "Attempts",
+		"#lastErr":  "LastError",
+	}
+	values := map[string]types.AttributeValue{
+		":attempts": &types.AttributeValueMemberN{Value: fmt.Sprint(attempts)},
+		":lastErr":  &types.AttributeValueMemberS{Value: pubErr.Error()},
+	}
+
+	if attempts >= r.options.MaxAttempts {
+		names["#gsipk"] = r.gsiConfig.PartitionKeyName
+		values[":failed"] = &types.AttributeValueMemberS{Value: ddb.OutboxStatusFailed}
+		values[":failedPK"] = &types.AttributeValueMemberS{Value: ddb.OutboxFailedPartition}
+		return r.update(ctx, msg,
+			"SET #status = :failed, #attempts = :attempts, #lastErr = :lastErr, #gsipk = :failedPK",
+			names, values)
+	}
+
+	names["#next"] = "NextAttemptAt"
+	next := now.Add(time.Duration(attempts) * r.options.RetryBackoff)
+	values[":next"] = &types.AttributeValueMemberS{Value: next.Format(time.RFC3339Nano)}
+	return r.update(ctx, msg,
+		"SET #attempts = :attempts, #lastErr = :lastErr, #next = :next",
+		names, values)
+}
+
+// update applies an update to a pending message. A failed condition means another
+// relay already processed the message and is not treated as an error.
+func (r *Relay) update(ctx context.Context, msg Message, expr string, names map[string]string, values map[string]types.AttributeValue) error {
+	values[":pending"] = &types.AttributeValueMemberS{Value: ddb.OutboxStatusPending}
+	condition := "#status = :pending"
+	names["#status"] = "Status"
+
+	_, err := r.client.UpdateItem(ctx, &sdk.UpdateItemInput{
+		TableName: &r.tableName,
+		Key: map[string]types.AttributeValue{
+			ddb.TablePartitionKey: &types.AttributeValueMemberS{Value: msg.PK},
+			ddb.TableSortKey:      &types.AttributeValueMemberS{Value: msg.SK},
+		},
+		UpdateExpression:          &expr,
+		ConditionExpression:       &condition,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if errors.As(err, &cfe) {
+			return nil
+		}
+		return fmt.Errorf("failed to update outbox message %s: %w", msg.ID, err)
+	}
+	return nil
+}
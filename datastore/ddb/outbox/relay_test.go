@@ -0,0 +1,318 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	"github.com/suparena/entitystore/registry"
+)
+
+type RelayTestAccount struct {
+	ID      string
+	Balance int
+}
+
+func init() {
+	registry.RegisterIndexMap[RelayTestAccount](map[string]string{
+		"PK": "ACCOUNT#{ID}",
+		"SK": "ACCOUNT#{ID}",
+	})
+}
+
+func seed(t *testing.T, client *fakeddb.Client) {
+	t.Helper()
+	store := ddb.NewDynamodbDataStoreWithClient[RelayTestAccount](client, "test-table")
+	ctx := context.Background()
+
+	writes := []struct {
+		id     string
+		events []string
+	}{
+		{"a", []string{"Opened", "Deposited"}},
+		{"b", []string{"Opened"}},
+	}
+	for _, w := range writes {
+		var events []ddb.OutboxEvent
+		for _, typ := range w.events {
+			events = append(events, ddb.OutboxEvent{AggregateID: w.id, Type: typ})
+		}
+		if err := store.PutWithOptions(ctx, RelayTestAccount{ID: w.id}, ddb.WithOutboxEvents(events...)); err != nil {
+			t.Fatalf("PutWithOptions failed: %v", err)
+		}
+	}
+}
+
+func statusOf(client *fakeddb.Client) map[string]string {
+	res := make(map[string]string)
+	for _, item := range client.Items() {
+		if item["EntityType"].(*types.AttributeValueMemberS).Value != ddb.OutboxEntityType {
+			continue
+		}
+		agg := item["AggregateID"].(*types.AttributeValueMemberS).Value
+		typ := item["Type"].(*types.AttributeValueMemberS).Value
+		res[agg+"/"+typ] = item["Status"].(*types.AttributeValueMemberS).Value
+	}
+	return res
+}
+
+func TestRelayPublishesAndMarksSent(t *testing.T) {
+	client := fakeddb.New()
+	seed(t, client)
+
+	publisher := NewChannelPublisher(10)
+	relay, err := NewRelay(client, "test-table", publisher)
+	if err != nil {
+		t.Fatalf("NewRelay failed: %v", err)
+	}
+
+	n, err := relay.ProcessBatch(context.Background())
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 published messages, got %d", n)
+	}
+
+	var order []string
+	for i := 0; i < 3; i++ {
+		msg := <-publisher.Messages()
+		if msg.AggregateID == "a" {
+			order = append(order, msg.Type)
+		}
+	}
+	if len(order) != 2 || order[0] != "Opened" || order[1] != "Deposited" {
+		t.Errorf("aggregate a published out of order: %v", order)
+	}
+
+	for k, status := range statusOf(client) {
+		if status != ddb.OutboxStatusSent {
+			t.Errorf("%s: expected SENT, got %s", k, status)
+		}
+	}
+
+	for _, item := range client.Items() {
+		if _, ok := item["Type"]; ok {
+			if _, ok := item["ExpiresAt"].(*types.AttributeValueMemberN); !ok {
+				t.Errorf("sent message %v has no TTL", item["SK"])
+			}
+		}
+	}
+
+	// Sent messages leave the pending index.
+	if n, err := relay.ProcessBatch(context.Background()); err != nil || n != 0 {
+		t.Errorf("expected nothing left to publish, got %d (%v)", n, err)
+	}
+}
+
+func TestRelayRetriesInAggregateOrder(t *testing.T) {
+	client := fakeddb.New()
+	seed(t, client)
+
+	var mu sync.Mutex
+	var published []string
+	failures := map[string]int{"a/Opened": 1}
+	publisher := PublisherFunc(func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		key := msg.AggregateID + "/" + msg.Type
+		if failures[key] > 0 {
+			failures[key]--
+			return errors.New("broker unavailable")
+		}
+		published = append(published, key)
+		return nil
+	})
+
+	relay, err := NewRelay(client, "test-table", publisher, WithRetryBackoff(0))
+	if err != nil {
+		t.Fatalf("NewRelay failed: %v", err)
+	}
+
+	if _, err := relay.ProcessBatch(context.Background()); err != nil {
+		t.Fatalf("first batch failed: %v", err)
+	}
+	status := statusOf(client)
+	if status["a/Opened"] != ddb.OutboxStatusPending || status["a/Deposited"] != ddb.OutboxStatusPending {
+		t.Fatalf("aggregate a must stay pending after a failure: %v", status)
+	}
+	if status["b/Opened"] != ddb.OutboxStatusSent {
+		t.Fatalf("other aggregates must not be blocked: %v", status)
+	}
+
+	if _, err := relay.ProcessBatch(context.Background()); err != nil {
+		t.Fatalf("second batch failed: %v", err)
+	}
+	want := []string{"b/Opened", "a/Opened", "a/Deposited"}
+	if len(published) != len(want) {
+		t.Fatalf("expected %v, got %v", want, published)
+	}
+	for i := range want {
+		if published[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, published)
+		}
+	}
+}
+
+func TestRelaySkipsBlockedAggregates(t *testing.T) {
+	client := fakeddb.New()
+	store := ddb.NewDynamodbDataStoreWithClient[RelayTestAccount](client, "test-table")
+	ctx := context.Background()
+	// The oldest messages all belong to aggregate a, which cannot be published
+	events := []ddb.OutboxEvent{{AggregateID: "a", Type: "1"}, {AggregateID: "a", Type: "2"}, {AggregateID: "a", Type: "3"}}
+	if err := store.PutWithOptions(ctx, RelayTestAccount{ID: "a"}, ddb.WithOutboxEvents(events...)); err != nil {
+		t.Fatalf("PutWithOptions failed: %v", err)
+	}
+	if err := store.PutWithOptions(ctx, RelayTestAccount{ID: "b"}, ddb.WithOutboxEvents(ddb.OutboxEvent{AggregateID: "b", Type: "1"})); err != nil {
+		t.Fatalf("PutWithOptions failed: %v", err)
+	}
+
+	publisher := PublisherFunc(func(ctx context.Context, msg Message) error {
+		if msg.AggregateID == "a" {
+			return errors.New("broker rejects a")
+		}
+		return nil
+	})
+	relay, err := NewRelay(client, "test-table", publisher, WithBatchSize(2), WithRetryBackoff(time.Hour))
+	if err != nil {
+		t.Fatalf("NewRelay failed: %v", err)
+	}
+	n, err := relay.ProcessBatch(ctx)
+	if err != nil {
+		t.Fatalf("ProcessBatch failed: %v", err)
+	}
+	if n != 1 || statusOf(client)["b/1"] != ddb.OutboxStatusSent {
+		t.Errorf("published %d, statuses %v; want aggregate b sent past the blocked page", n, statusOf(client))
+	}
+}
+
+func TestRelayUsesStoreOutboxIndex(t *testing.T) {
+	client := fakeddb.New().WithIndex("GSI2", "PK2", "SK2")
+	reg := registry.New()
+	reg.RegisterGSI("GSI2", "PK2", "SK2")
+	reg.RegisterIndexMap(reflect.TypeOf(RelayTestAccount{}), map[string]string{
+		"PK": "ACCOUNT#{ID}",
+		"SK": "ACCOUNT#{ID}",
+	})
+	store := ddb.NewDynamodbDataStoreWithClient[RelayTestAccount](client, "test-table",
+		ddb.WithRegistry(reg), ddb.WithOutboxIndex("GSI2"))
+	ctx := context.Background()
+	if err := store.PutWithOptions(ctx, RelayTestAccount{ID: "a"}, ddb.WithOutboxEvents(ddb.OutboxEvent{AggregateID: "a", Type: "Opened"})); err != nil {
+		t.Fatalf("PutWithOptions failed: %v", err)
+	}
+
+	relay, err := NewRelay(client, "test-table", NewChannelPublisher(10), WithStore(store))
+	if err != nil {
+		t.Fatalf("NewRelay failed: %v", err)
+	}
+	if n, err := relay.ProcessBatch(ctx); err != nil || n != 1 {
+		t.Fatalf("ProcessBatch = %d, %v; want the message of the store's outbox index", n, err)
+	}
+
+	// The error names the index of the store, not IndexName
+	unknown := ddb.NewDynamodbDataStoreWithClient[RelayTestAccount](client, "test-table",
+		ddb.WithRegistry(reg), ddb.WithOutboxIndex("GSI7"))
+	_, err = NewRelay(client, "test-table", NewChannelPublisher(10), WithStore(unknown))
+	if err == nil || !strings.Contains(err.Error(), "GSI7") {
+		t.Errorf("NewRelay with an unknown store index = %v, want an error naming GSI7", err)
+	}
+}
+
+func TestRelayUsesRegistryIndex(t *testing.T) {
+	client := fakeddb.New().WithIndex("GSI3", "PK3", "SK3")
+	reg := registry.New()
+	reg.RegisterGSI("GSI3", "PK3", "SK3")
+	reg.RegisterIndexMap(reflect.TypeOf(RelayTestAccount{}), map[string]string{
+		"PK": "ACCOUNT#{ID}",
+		"SK": "ACCOUNT#{ID}",
+	})
+	store := ddb.NewDynamodbDataStoreWithClient[RelayTestAccount](client, "test-table",
+		ddb.WithRegistry(reg), ddb.WithOutboxIndex("GSI3"))
+	ctx := context.Background()
+	if err := store.PutWithOptions(ctx, RelayTestAccount{ID: "a"}, ddb.WithOutboxEvents(ddb.OutboxEvent{AggregateID: "a", Type: "Opened"})); err != nil {
+		t.Fatalf("PutWithOptions failed: %v", err)
+	}
+
+	if _, err := NewRelay(client, "test-table", NewChannelPublisher(10), WithIndexName("GSI3")); err == nil {
+		t.Error("expected GSI3 to be unknown to the default registry")
+	}
+	relay, err := NewRelay(client, "test-table", NewChannelPublisher(10), WithIndexName("GSI3"), WithRegistry(reg))
+	if err != nil {
+		t.Fatalf("NewRelay failed: %v", err)
+	}
+	if n, err := relay.ProcessBatch(ctx); err != nil || n != 1 {
+		t.Fatalf("ProcessBatch = %d, %v; want the message of the registry's index", n, err)
+	}
+}
+
+func TestRelayMarksFailedAfterMaxAttempts(t *testing.T) {
+	client := fakeddb.New()
+	seed(t, client)
+
+	publisher := PublisherFunc(func(ctx context.Context, msg Message) error {
+		if msg.AggregateID == "b" {
+			return errors.New("poison message")
+		}
+		return nil
+	})
+	relay, err := NewRelay(client, "test-table", publisher, WithMaxAttempts(2), WithRetryBackoff(0))
+	if err != nil {
+		t.Fatalf("NewRelay failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := relay.ProcessBatch(context.Background()); err != nil {
+			t.Fatalf("batch %d failed: %v", i, err)
+		}
+	}
+
+	if status := statusOf(client)["b/Opened"]; status != ddb.OutboxStatusFailed {
+		t.Errorf("expected FAILED, got %s", status)
+	}
+	for _, item := range client.Items() {
+		if item["Type"] == nil || item["AggregateID"].(*types.AttributeValueMemberS).Value != "b" {
+			continue
+		}
+		if pk := item["PK1"].(*types.AttributeValueMemberS).Value; pk != ddb.OutboxFailedPartition {
+			t.Errorf("failed message should move to %s, got %s", ddb.OutboxFailedPartition, pk)
+		}
+	}
+}
+
+func TestRelayRunStopsOnCancel(t *testing.T) {
+	client := fakeddb.New()
+	seed(t, client)
+
+	publisher := NewChannelPublisher(10)
+	relay, err := NewRelay(client, "test-table", publisher, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewRelay failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- relay.Run(ctx) }()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-publisher.Messages():
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned error: %v", err)
+	}
+}
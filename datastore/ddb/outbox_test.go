@@ -0,0 +1,111 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+)
+
+// OutboxTestOrder is stored together with outbox events
+type OutboxTestOrder struct {
+	ID     string
+	Status string
+}
+
+func init() {
+	registry.RegisterIndexMap[OutboxTestOrder](map[string]string{
+		"PK": "ORDER#{ID}",
+		"SK": "ORDER#{ID}",
+	})
+}
+
+func TestPutWithOutboxEvents(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[OutboxTestOrder](client, "test-table")
+
+	t.Run("PlainPutDoesNotUseTransaction", func(t *testing.T) {
+		if err := store.Put(ctx, OutboxTestOrder{ID: "1", Status: "NEW"}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if calls := client.Calls(); calls[len(calls)-1] != "PutItem" {
+			t.Errorf("expected PutItem, got %v", calls)
+		}
+	})
+
+	t.Run("EntityAndEventsWrittenTogether", func(t *testing.T) {
+		err := store.PutWithOptions(ctx, OutboxTestOrder{ID: "2", Status: "PLACED"},
+			WithOutboxEvents(
+				OutboxEvent{AggregateID: "2", Type: "OrderPlaced", Payload: []byte(`{"id":"2"}`)},
+				OutboxEvent{ID: "evt-b", AggregateID: "2", Type: "OrderPaid"},
+			),
+		)
+		if err != nil {
+			t.Fatalf("PutWithOptions failed: %v", err)
+		}
+		if calls := client.Calls(); calls[len(calls)-1] != "TransactWriteItems" {
+			t.Errorf("expected TransactWriteItems, got %v", calls)
+		}
+
+		if _, ok := client.Item("ORDER#2", "ORDER#2"); !ok {
+			t.Fatal("entity was not written")
+		}
+
+		var outbox []map[string]types.AttributeValue
+		for _, item := range client.Items() {
+			if item["EntityType"].(*types.AttributeValueMemberS).Value == OutboxEntityType {
+				outbox = append(outbox, item)
+			}
+		}
+		if len(outbox) != 2 {
+			t.Fatalf("expected 2 outbox items, got %d", len(outbox))
+		}
+		for _, item := range outbox {
+			if pk := item["PK"].(*types.AttributeValueMemberS).Value; pk != "OUTBOX#2" {
+				t.Errorf("unexpected outbox PK %s", pk)
+			}
+			if gsi := item["PK1"].(*types.AttributeValueMemberS).Value; gsi != OutboxPendingPartition {
+				t.Errorf("unexpected outbox GSI partition %s", gsi)
+			}
+		}
+		// Items are ordered by SK, so the first event must come first.
+		if typ := outbox[0]["Type"].(*types.AttributeValueMemberS).Value; typ != "OrderPlaced" {
+			t.Errorf("expected OrderPlaced first, got %s", typ)
+		}
+		if sk := outbox[1]["SK"].(*types.AttributeValueMemberS).Value; !strings.HasSuffix(sk, "#0001#evt-b") {
+			t.Errorf("unexpected SK for second event: %s", sk)
+		}
+	})
+
+	t.Run("TransactionFailureWritesNothing", func(t *testing.T) {
+		before := len(client.Items())
+		client.Err = &types.TransactionCanceledException{}
+		err := store.PutWithOptions(ctx, OutboxTestOrder{ID: "3"},
+			WithOutboxEvents(OutboxEvent{AggregateID: "3", Type: "OrderPlaced"}))
+		var tce *types.TransactionCanceledException
+		if !errors.As(err, &tce) {
+			t.Fatalf("expected TransactionCanceledException, got %v", err)
+		}
+		if after := len(client.Items()); after != before {
+			t.Errorf("expected no writes, item count went from %d to %d", before, after)
+		}
+	})
+
+	t.Run("MissingAggregateID", func(t *testing.T) {
+		err := store.PutWithOptions(ctx, OutboxTestOrder{ID: "4"},
+			WithOutboxEvents(OutboxEvent{Type: "OrderPlaced"}))
+		if !eserrors.IsValidationError(err) {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+	})
+}
@@ -10,14 +10,17 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/datastore"
 	"github.com/suparena/entitystore/storagemodels"
 )
 
 // Query performs a query against the DynamoDB table using the provided parameters.
 // It uses the injected EntityType attribute (added at persist time) to select the correct
 // unmarshal function from the type registry so that each item is unmarshaled to its proper type.
-func (d *DynamodbDataStore[T]) Query(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error) {
+func (d *DynamodbDataStore[T]) Query(ctx context.Context, params *storagemodels.QueryParams) (_ []interface{}, err error) {
+	ctx, op := d.startOperation(ctx, "Query", indexAttrs(params.IndexName)...)
+	defer op.end(ctx, &err)
+
 	input := &dynamodb.QueryInput{
 		TableName:                 &d.tableName,
 		KeyConditionExpression:    &params.KeyConditionExpression,
@@ -26,11 +29,14 @@ func (d *DynamodbDataStore[T]) Query(ctx context.Context, params *storagemodels.
 		IndexName:                 params.IndexName,
 		Limit:                     params.Limit,
 		ScanIndexForward:          params.ScanIndexForward,
+		ReturnConsumedCapacity:    d.returnCapacity,
 	}
 	out, err := d.client.Query(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("query error: %w", err)
 	}
+	op.response(ctx, out.ResultMetadata, out.ConsumedCapacity)
+	op.page(len(out.Items), len(out.LastEvaluatedKey) > 0)
 
 	var results []interface{}
 	for _, item := range out.Items {
@@ -43,9 +49,17 @@ func (d *DynamodbDataStore[T]) Query(ctx context.Context, params *storagemodels.
 		} else {
 			return nil, fmt.Errorf("missing EntityType attribute in item")
 		}
+		// Items stored under a legacy alias are read as the current name, as Stream does.
+		entityType = d.itemEntityType(item)
+
+		// Upgrade items written with an older schema version.
+		item, err := d.upcast(ctx, entityType, item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upcast item for EntityType %q: %w", entityType, err)
+		}
 
 		// Look up the unmarshal function from the type registry.
-		unmarshalFn, err := registry.GetUnmarshalFunc(entityType)
+		unmarshalFn, err := d.Registry().GetUnmarshalFunc(entityType)
 		if err != nil {
 			// Fallback: if no function is registered, unmarshal into a generic map.
 			var generic map[string]interface{}
@@ -61,8 +75,12 @@ func (d *DynamodbDataStore[T]) Query(ctx context.Context, params *storagemodels.
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal item for EntityType %q: %w", entityType, err)
 		}
+		if err := datastore.RunAfterLoadAnyWithRegistry(ctx, d.registry, obj); err != nil {
+			return nil, err
+		}
 		results = append(results, obj)
 	}
+	op.addItems(len(results))
 
 	return results, nil
 }
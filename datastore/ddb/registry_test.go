@@ -0,0 +1,94 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// ScopedRegistryEntity is only registered in the registry of its test
+type ScopedRegistryEntity struct {
+	ID   string
+	Name string
+}
+
+func TestWithRegistry(t *testing.T) {
+	ctx := context.Background()
+	entityType := reflect.TypeOf(ScopedRegistryEntity{})
+
+	reg := registry.New()
+	reg.RegisterGSI("GSI9", "PK9", "SK9")
+	reg.RegisterIndexMap(entityType, map[string]string{
+		"PK":     "SCOPED#{ID}",
+		"SK":     "SCOPED#{ID}",
+		"GSI9PK": "NAME#{Name}",
+		"GSI9SK": "SCOPED#{ID}",
+	})
+	if err := reg.RegisterType("ScopedRegistryEntity", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &ScopedRegistryEntity{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	}); err != nil {
+		t.Fatalf("RegisterType failed: %v", err)
+	}
+	reg.RegisterHooks(entityType, registry.NewEntityHooks(registry.Hooks[ScopedRegistryEntity]{
+		BeforeDelete: func(ctx context.Context, key string, entity *ScopedRegistryEntity) error {
+			return errors.New("scoped entities cannot be deleted")
+		},
+	}))
+
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[ScopedRegistryEntity](client, "test-table", WithRegistry(reg))
+	if store.Registry() != reg {
+		t.Fatal("Registry() does not return the configured registry")
+	}
+
+	if err := store.Put(ctx, ScopedRegistryEntity{ID: "1", Name: "alpha"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	item, ok := client.Item("SCOPED#1", "SCOPED#1")
+	if !ok {
+		t.Fatal("item was not stored")
+	}
+	if s, ok := item["PK9"].(*types.AttributeValueMemberS); !ok || s.Value != "NAME#alpha" {
+		t.Errorf("PK9 = %v, want NAME#alpha", item["PK9"])
+	}
+
+	results, err := store.Query(ctx, &storagemodels.QueryParams{
+		TableName:              "test-table",
+		KeyConditionExpression: "PK = :pk",
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "SCOPED#1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	if got, ok := results[0].(*ScopedRegistryEntity); !ok || got.Name != "alpha" {
+		t.Errorf("unexpected result %#v", results[0])
+	}
+
+	if err := store.Delete(ctx, "SCOPED#1"); err == nil {
+		t.Error("expected the BeforeDelete hook of the scoped registry to reject the delete")
+	}
+
+	// The default registry knows nothing about the entity
+	defaultStore := NewDynamodbDataStoreWithClient[ScopedRegistryEntity](client, "test-table")
+	if err := defaultStore.Put(ctx, ScopedRegistryEntity{ID: "2"}); err == nil {
+		t.Error("expected Put without the scoped registry to fail")
+	}
+}
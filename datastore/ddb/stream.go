@@ -15,7 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/datastore"
 	"github.com/suparena/entitystore/storagemodels"
 )
 
@@ -30,8 +30,11 @@ func (d *DynamodbDataStore[T]) Stream(ctx context.Context, params *storagemodels
 	// Create buffered result channel
 	resultCh := make(chan storagemodels.StreamResult[T], options.BufferSize)
 
+	// The span ends with the stream
+	ctx, op := d.startOperation(ctx, "Stream", indexAttrs(params.IndexName)...)
+
 	// Start streaming in background
-	go d.streamWorker(ctx, params, options, resultCh)
+	go d.streamWorker(ctx, op, params, options, resultCh)
 
 	return resultCh
 }
@@ -39,12 +42,23 @@ func (d *DynamodbDataStore[T]) Stream(ctx context.Context, params *storagemodels
 // streamWorker handles the actual streaming logic
 func (d *DynamodbDataStore[T]) streamWorker(
 	ctx context.Context,
+	op *operation,
 	params *storagemodels.QueryParams,
 	options storagemodels.StreamOptions,
 	resultCh chan<- storagemodels.StreamResult[T],
 ) {
 	defer close(resultCh)
 
+	// A stream that stops before its last page without error was canceled
+	var streamErr error
+	completed := false
+	defer func() {
+		if !completed && streamErr == nil {
+			streamErr = ctx.Err()
+		}
+		op.end(ctx, &streamErr)
+	}()
+
 	// Initialize progress tracking
 	var itemIndex int64
 	var pageNumber int
@@ -82,6 +96,7 @@ func (d *DynamodbDataStore[T]) streamWorker(
 		IndexName:                 params.IndexName,
 		Limit:                     aws.Int32(options.PageSize),
 		ScanIndexForward:          params.ScanIndexForward,
+		ReturnConsumedCapacity:    d.returnCapacity,
 	}
 
 	var lastEvaluatedKey map[string]types.AttributeValue
@@ -99,14 +114,15 @@ func (d *DynamodbDataStore[T]) streamWorker(
 		}
 
 		// Execute query with retry logic
-		out, err := d.queryWithRetry(ctx, input, options)
+		out, err := d.queryWithRetry(ctx, op, input, options)
 		if err != nil {
 			// Handle error with error handler if provided
 			if options.ErrorHandler != nil {
 				if !options.ErrorHandler(err) {
 					// Error handler says to stop
+					streamErr = fmt.Errorf("query failed after retries: %w", err)
 					resultCh <- storagemodels.StreamResult[T]{
-						Error: fmt.Errorf("query failed after retries: %w", err),
+						Error: streamErr,
 						Meta: storagemodels.StreamMeta{
 							Index:      atomic.LoadInt64(&itemIndex),
 							PageNumber: pageNumber,
@@ -117,8 +133,9 @@ func (d *DynamodbDataStore[T]) streamWorker(
 				}
 			} else {
 				// No error handler, send error and stop
+				streamErr = fmt.Errorf("query failed: %w", err)
 				resultCh <- storagemodels.StreamResult[T]{
-					Error: fmt.Errorf("query failed: %w", err),
+					Error: streamErr,
 					Meta: storagemodels.StreamMeta{
 						Index:      atomic.LoadInt64(&itemIndex),
 						PageNumber: pageNumber,
@@ -132,10 +149,13 @@ func (d *DynamodbDataStore[T]) streamWorker(
 			mu.Lock()
 			errors = append(errors, err)
 			mu.Unlock()
+			op.retry(ctx, err)
 			continue
 		}
 
 		pageNumber++
+		op.response(ctx, out.ResultMetadata, out.ConsumedCapacity)
+		op.page(len(out.Items), len(out.LastEvaluatedKey) > 0)
 
 		// Process items in current page
 		for _, item := range out.Items {
@@ -146,7 +166,7 @@ func (d *DynamodbDataStore[T]) streamWorker(
 			default:
 			}
 
-			result := d.processItem(item, atomic.LoadInt64(&itemIndex), pageNumber)
+			result := d.processItem(ctx, item, atomic.LoadInt64(&itemIndex), pageNumber)
 			atomic.AddInt64(&itemIndex, 1)
 
 			// Send result
@@ -155,6 +175,7 @@ func (d *DynamodbDataStore[T]) streamWorker(
 				return
 			case resultCh <- result:
 			}
+			op.streamed(ctx)
 
 			// Record any item-level errors
 			if result.Error != nil {
@@ -176,11 +197,13 @@ func (d *DynamodbDataStore[T]) streamWorker(
 
 	// Final progress report
 	reportProgress(nil)
+	completed = true
 }
 
 // queryWithRetry executes a query with configurable retry logic
 func (d *DynamodbDataStore[T]) queryWithRetry(
 	ctx context.Context,
+	op *operation,
 	input *dynamodb.QueryInput,
 	options storagemodels.StreamOptions,
 ) (*dynamodb.QueryOutput, error) {
@@ -209,6 +232,7 @@ func (d *DynamodbDataStore[T]) queryWithRetry(
 
 		// Don't sleep after last attempt
 		if attempt < options.MaxRetries {
+			op.retry(ctx, err)
 			// Exponential backoff with jitter
 			backoff := time.Duration(attempt+1) * options.RetryBackoff
 			select {
@@ -224,6 +248,7 @@ func (d *DynamodbDataStore[T]) queryWithRetry(
 
 // processItem converts a DynamoDB item to a typed result
 func (d *DynamodbDataStore[T]) processItem(
+	ctx context.Context,
 	item map[string]types.AttributeValue,
 	index int64,
 	pageNumber int,
@@ -251,13 +276,33 @@ func (d *DynamodbDataStore[T]) processItem(
 				Meta:  meta,
 			}
 		}
-		// Remove EntityType from item before unmarshaling
-		delete(item, "EntityType")
+		// Items stored under a legacy alias are read as the current name, as Query does
+		entityType = d.itemEntityType(item)
+	}
+
+	// Upgrade items written with an older schema version
+	item, err := d.upcast(ctx, d.itemEntityType(item), item)
+	if err != nil {
+		return storagemodels.StreamResult[T]{
+			Error: fmt.Errorf("failed to upcast item: %w", err),
+			Raw:   rawCopy,
+			Meta:  meta,
+		}
 	}
 
+	// Remove EntityType from item before unmarshaling
+	delete(item, "EntityType")
+
 	// Try to unmarshal as type T first
 	var result T
 	if err := attributevalue.UnmarshalMap(item, &result); err == nil {
+		if err := datastore.RunAfterLoadWithRegistry(ctx, d.registry, &result); err != nil {
+			return storagemodels.StreamResult[T]{
+				Error: err,
+				Raw:   rawCopy,
+				Meta:  meta,
+			}
+		}
 		return storagemodels.StreamResult[T]{
 			Item: result,
 			Raw:  rawCopy,
@@ -267,12 +312,19 @@ func (d *DynamodbDataStore[T]) processItem(
 
 	// If direct unmarshal fails and we have EntityType, try registry
 	if entityType != "" {
-		unmarshalFn, err := registry.GetUnmarshalFunc(entityType)
+		unmarshalFn, err := d.Registry().GetUnmarshalFunc(entityType)
 		if err == nil {
 			obj, err := unmarshalFn(item)
 			if err == nil {
 				// Type assertion to T
 				if typedObj, ok := obj.(T); ok {
+					if err := datastore.RunAfterLoadAnyWithRegistry(ctx, d.registry, obj); err != nil {
+						return storagemodels.StreamResult[T]{
+							Error: err,
+							Raw:   rawCopy,
+							Meta:  meta,
+						}
+					}
 					return storagemodels.StreamResult[T]{
 						Item: typedObj,
 						Raw:  rawCopy,
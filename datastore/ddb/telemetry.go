@@ -0,0 +1,313 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	eserrors "github.com/suparena/entitystore/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentationName names the tracer and meter of the datastore
+const instrumentationName = "github.com/suparena/entitystore/datastore/ddb"
+
+// Span and metric attributes specific to entitystore
+const (
+	EntityTypeKey = attribute.Key("entitystore.entity_type")
+	ItemCountKey  = attribute.Key("entitystore.item_count")
+	RetriesKey    = attribute.Key("entitystore.retries")
+	PagesKey      = attribute.Key("entitystore.pages")
+	// ConsumedCapacityKey is the total of the capacity units consumed by an operation,
+	// when the responses report it
+	ConsumedCapacityKey = attribute.Key("entitystore.consumed_capacity")
+)
+
+// WithTracerProvider makes the datastore trace its operations, query builders and
+// streams with spans of 'tp'. Operations are not traced by default.
+func WithTracerProvider(tp trace.TracerProvider) StoreOption {
+	return func(o *storeOptions) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider makes the datastore record the latency of its operations, throttled
+// requests, retries, streamed items and consumed capacity with meters of 'mp'. No
+// metrics are recorded by default.
+func WithMeterProvider(mp metric.MeterProvider) StoreOption {
+	return func(o *storeOptions) {
+		o.meterProvider = mp
+	}
+}
+
+// telemetry holds the tracer and instruments of a datastore
+type telemetry struct {
+	tracer    trace.Tracer
+	duration  metric.Float64Histogram
+	throttles metric.Int64Counter
+	retries   metric.Int64Counter
+	streamed  metric.Int64Counter
+	capacity  metric.Float64Counter
+	// writeBacks counts upcast write-backs failing for other reasons than a concurrent write
+	writeBacks metric.Int64Counter
+}
+
+// noopTelemetry is used by datastores created without providers
+var noopTelemetry = newTelemetry(nil, nil)
+
+// newTelemetry creates the tracer and instruments, no-op for nil providers
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) *telemetry {
+	if tp == nil {
+		tp = tracenoop.NewTracerProvider()
+	}
+	if mp == nil {
+		mp = metricnoop.NewMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+	t := &telemetry{tracer: tp.Tracer(instrumentationName)}
+
+	// Instrument creation only fails for invalid names; the no-op instruments returned
+	// along with the error keep the datastore working
+	t.duration, _ = meter.Float64Histogram("entitystore.operation.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of datastore operations, streams until their last item"))
+	t.throttles, _ = meter.Int64Counter("entitystore.throttles",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("DynamoDB requests rejected for exceeding throughput or request limits"))
+	t.retries, _ = meter.Int64Counter("entitystore.retries",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("DynamoDB requests retried by the datastore"))
+	t.streamed, _ = meter.Int64Counter("entitystore.items.streamed",
+		metric.WithUnit("{item}"),
+		metric.WithDescription("Items sent by streams"))
+	t.capacity, _ = meter.Float64Counter("entitystore.consumed_capacity",
+		metric.WithUnit("{capacity_unit}"),
+		metric.WithDescription("Capacity units consumed, for stores created with WithReturnConsumedCapacity"))
+	t.writeBacks, _ = meter.Int64Counter("entitystore.upcast.write_back_failures",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("Upcast write-backs that failed, not counting items written concurrently"))
+	return t
+}
+
+// telemetry returns the telemetry of the datastore
+func (d *DynamodbDataStore[T]) telemetry() *telemetry {
+	if d.tel == nil {
+		return noopTelemetry
+	}
+	return d.tel
+}
+
+// operation is the span, metrics and capacity accounting of a datastore operation
+type operation struct {
+	tel   *telemetry
+	span  trace.Span
+	name  string
+	start time.Time
+	// attrs are the attributes of the metrics
+	attrs []attribute.KeyValue
+	// collector is the CapacityCollector of the context, if any
+	collector *CapacityCollector
+
+	items      int64
+	pages      int
+	retries    int
+	capacity   float64
+	measured   bool
+	requestIDs []string
+}
+
+// startOperation starts the span of operation 'name'; 'attrs' are added to the span
+// and the metrics
+func (d *DynamodbDataStore[T]) startOperation(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, *operation) {
+	tel := d.telemetry()
+	op := &operation{
+		tel:   tel,
+		name:  name,
+		start: time.Now(),
+		attrs: append([]attribute.KeyValue{
+			semconv.DBSystemDynamoDB,
+			semconv.DBOperationName(name),
+			semconv.DBCollectionName(d.tableName),
+		}, attrs...),
+	}
+	spanAttrs := append([]attribute.KeyValue{
+		semconv.AWSDynamoDBTableNames(d.tableName),
+		EntityTypeKey.String(d.Registry().EntityTypeName(reflect.TypeOf((*T)(nil)).Elem())),
+	}, op.attrs...)
+	ctx, op.span = tel.tracer.Start(ctx, "entitystore."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(spanAttrs...))
+	op.collector, _ = CapacityCollectorFrom(ctx)
+	return ctx, op
+}
+
+// indexAttrs returns the attributes of a query of index 'name', none for the table
+func indexAttrs(name *string) []attribute.KeyValue {
+	if name == nil || *name == "" {
+		return nil
+	}
+	return []attribute.KeyValue{semconv.AWSDynamoDBIndexName(*name)}
+}
+
+// addItems counts items read or written
+func (op *operation) addItems(n int) {
+	op.items += int64(n)
+}
+
+// response records the request ID and consumed capacity of a response; 'capacities'
+// are nil unless the store requests them
+func (op *operation) response(ctx context.Context, metadata middleware.Metadata, capacities ...*types.ConsumedCapacity) {
+	requestID, _ := awsmiddleware.GetRequestIDMetadata(metadata)
+	if requestID != "" {
+		op.requestIDs = append(op.requestIDs, requestID)
+	}
+	if len(capacities) == 0 {
+		capacities = []*types.ConsumedCapacity{nil}
+	}
+	for i, c := range capacities {
+		if op.collector != nil {
+			id := requestID
+			if i > 0 {
+				id = ""
+			}
+			op.collector.record(op.name, id, c)
+		}
+		if c != nil && c.CapacityUnits != nil {
+			op.capacity += *c.CapacityUnits
+			op.measured = true
+			op.tel.capacity.Add(ctx, *c.CapacityUnits, metric.WithAttributes(op.attrs...))
+		}
+	}
+}
+
+// page records a page read by a query or stream, after its response
+func (op *operation) page(items int, lastKey bool) {
+	op.pages++
+	attrs := []attribute.KeyValue{
+		attribute.Int("entitystore.page", op.pages),
+		ItemCountKey.Int(items),
+		attribute.Bool("entitystore.last_page", !lastKey),
+	}
+	if n := len(op.requestIDs); n > 0 {
+		attrs = append(attrs, semconv.AWSRequestID(op.requestIDs[n-1]))
+	}
+	op.span.AddEvent("page", trace.WithAttributes(attrs...))
+}
+
+// retry records a request that failed with 'err' and is retried
+func (op *operation) retry(ctx context.Context, err error) {
+	op.retries++
+	op.span.AddEvent("retry", trace.WithAttributes(attribute.String("error", err.Error())))
+	op.tel.retries.Add(ctx, 1, metric.WithAttributes(op.attrs...))
+	if op.collector != nil {
+		op.collector.retried()
+	}
+	if isThrottle(err) {
+		op.tel.throttles.Add(ctx, 1, metric.WithAttributes(op.attrs...))
+	}
+}
+
+// streamed counts an item sent by a stream
+func (op *operation) streamed(ctx context.Context) {
+	op.items++
+	op.tel.streamed.Add(ctx, 1, metric.WithAttributes(op.attrs...))
+}
+
+// end ends the span and records the metrics of the operation, failed with *errp if not
+// nil. Not found, already exists and condition failures are outcomes, not span errors.
+func (op *operation) end(ctx context.Context, errp *error) {
+	var err error
+	if errp != nil {
+		err = *errp
+	}
+	op.span.SetAttributes(ItemCountKey.Int64(op.items))
+	if op.pages > 0 {
+		op.span.SetAttributes(PagesKey.Int(op.pages))
+	}
+	if op.retries > 0 {
+		op.span.SetAttributes(RetriesKey.Int(op.retries))
+	}
+	if op.measured {
+		op.span.SetAttributes(ConsumedCapacityKey.Float64(op.capacity))
+	}
+	if len(op.requestIDs) == 1 {
+		op.span.SetAttributes(semconv.AWSRequestID(op.requestIDs[0]))
+	}
+
+	attrs := op.attrs
+	if err != nil {
+		errType := errorType(err)
+		attrs = append(attrs[:len(attrs):len(attrs)], semconv.ErrorTypeKey.String(errType))
+		op.span.SetAttributes(semconv.ErrorTypeKey.String(errType))
+		if !eserrors.IsNotFound(err) && !eserrors.IsAlreadyExists(err) && !eserrors.IsConditionFailed(err) {
+			op.span.RecordError(err)
+			op.span.SetStatus(codes.Error, err.Error())
+		}
+		if isThrottle(err) {
+			op.tel.throttles.Add(ctx, 1, metric.WithAttributes(op.attrs...))
+		}
+	}
+	op.tel.duration.Record(ctx, time.Since(op.start).Seconds(), metric.WithAttributes(attrs...))
+	op.span.End()
+}
+
+// writeBackFailed records an upcast write-back failed with 'err' on the span of the
+// read and in the write-back failure counter
+func (d *DynamodbDataStore[T]) writeBackFailed(ctx context.Context, err error) {
+	errType := semconv.ErrorTypeKey.String(errorType(err))
+	trace.SpanFromContext(ctx).AddEvent("upcast_write_back_failed", trace.WithAttributes(
+		attribute.String("error", err.Error()), errType))
+	d.telemetry().writeBacks.Add(ctx, 1, metric.WithAttributes(
+		semconv.DBSystemDynamoDB,
+		semconv.DBCollectionName(d.tableName),
+		EntityTypeKey.String(d.Registry().EntityTypeName(reflect.TypeOf((*T)(nil)).Elem())),
+		errType))
+}
+
+// isThrottle reports whether DynamoDB rejected a request for exceeding limits
+func isThrottle(err error) bool {
+	var pte *types.ProvisionedThroughputExceededException
+	var rle *types.RequestLimitExceeded
+	if errors.As(err, &pte) || errors.As(err, &rle) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ThrottlingException"
+}
+
+// errorType returns the error.type attribute of an error: the DynamoDB error code, or
+// the kind of entitystore error
+func errorType(err error) string {
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.ErrorCode()
+	case eserrors.IsNotFound(err):
+		return "NotFound"
+	case eserrors.IsAlreadyExists(err):
+		return "AlreadyExists"
+	case eserrors.IsConditionFailed(err):
+		return "ConditionFailed"
+	case eserrors.IsValidationError(err):
+		return "Validation"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "Canceled"
+	default:
+		return "_OTHER"
+	}
+}
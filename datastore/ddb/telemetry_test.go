@@ -0,0 +1,232 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/storagemodels"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// capacityClient reports the capacity consumed by GetItem
+type capacityClient struct {
+	*fakeddb.Client
+}
+
+func (c capacityClient) GetItem(ctx context.Context, in *sdk.GetItemInput, optFns ...func(*sdk.Options)) (*sdk.GetItemOutput, error) {
+	out, err := c.Client.GetItem(ctx, in, optFns...)
+	if err == nil {
+		out.ConsumedCapacity = &types.ConsumedCapacity{TableName: in.TableName, CapacityUnits: aws.Float64(0.5)}
+	}
+	return out, err
+}
+
+// telemetryStore returns a store recording spans to 'exporter' and metrics to 'reader'
+func telemetryStore(client DynamoDBAPI) (*DynamodbDataStore[conformance.Item], *tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	exporter := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+	store := NewDynamodbDataStoreWithClient[conformance.Item](client, "entities",
+		WithRegistry(conformance.NewRegistry()),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+	)
+	return store, exporter, reader
+}
+
+// spanAttrs returns the attributes of a span by key
+func spanAttrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	res := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		res[kv.Key] = kv.Value
+	}
+	return res
+}
+
+// counterValue returns the sum of counter 'name' over its attributes
+func counterValue(t *testing.T, reader *sdkmetric.ManualReader, name string) int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	var total int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == name {
+				for _, dp := range sum.DataPoints {
+					total += dp.Value
+				}
+			}
+		}
+	}
+	return total
+}
+
+func TestTelemetrySpans(t *testing.T) {
+	ctx := context.Background()
+	store, exporter, reader := telemetryStore(capacityClient{fakeddb.New()})
+
+	for _, id := range []string{"a", "b"} {
+		if err := store.Put(ctx, conformance.Item{ID: id, Group: "g"}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if _, err := store.GetOne(ctx, "a"); err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+	if _, err := store.GetOne(ctx, "missing"); !eserrors.IsNotFound(err) {
+		t.Fatalf("GetOne of a missing item returned %v", err)
+	}
+	if _, err := store.QueryGSI().WithPartitionKey("g").Execute(ctx); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	want := []string{"entitystore.Put", "entitystore.Put", "entitystore.GetOne", "entitystore.GetOne", "entitystore.Query", "entitystore.QueryGSI"}
+	if len(names) != len(want) {
+		t.Fatalf("spans = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("spans = %v, want %v", names, want)
+		}
+	}
+
+	get := spanAttrs(spans[2])
+	if get["db.system"].AsString() != "dynamodb" || get["db.operation.name"].AsString() != "GetOne" ||
+		get["aws.dynamodb.table_names"].AsStringSlice()[0] != "entities" ||
+		get[EntityTypeKey].AsString() != "Item" || get[ItemCountKey].AsInt64() != 1 {
+		t.Errorf("GetOne span attributes = %v", spans[2].Attributes)
+	}
+	if get[ConsumedCapacityKey].AsFloat64() != 0.5 {
+		t.Errorf("consumed capacity = %v, want 0.5", get[ConsumedCapacityKey])
+	}
+
+	missing := spanAttrs(spans[3])
+	if missing["error.type"].AsString() != "NotFound" || spans[3].Status.Code == codes.Error {
+		t.Errorf("NotFound span: attributes %v, status %v; want an error type but no error status", spans[3].Attributes, spans[3].Status)
+	}
+
+	query, builder := spans[4], spans[5]
+	if spanAttrs(query)["aws.dynamodb.index_name"].AsString() != "GSI1" || spanAttrs(query)[ItemCountKey].AsInt64() != 2 {
+		t.Errorf("Query span attributes = %v", query.Attributes)
+	}
+	if query.Parent.SpanID() != builder.SpanContext.SpanID() {
+		t.Error("the Query span is not a child of the QueryGSI span")
+	}
+	if len(query.Events) != 1 || query.Events[0].Name != "page" {
+		t.Errorf("Query span events = %v, want a page", query.Events)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	var observed uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if h, ok := m.Data.(metricdata.Histogram[float64]); ok && m.Name == "entitystore.operation.duration" {
+				for _, dp := range h.DataPoints {
+					observed += dp.Count
+				}
+			}
+		}
+	}
+	if observed != uint64(len(want)) {
+		t.Errorf("duration histogram observed %d operations, want %d", observed, len(want))
+	}
+}
+
+func TestTelemetryThrottles(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	store, exporter, reader := telemetryStore(client)
+
+	client.Err = &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+	if _, err := store.GetOne(ctx, "a"); err == nil {
+		t.Fatal("GetOne succeeded despite the throttle")
+	}
+	span := exporter.GetSpans()[0]
+	if span.Status.Code != codes.Error || spanAttrs(span)["error.type"].AsString() != "ProvisionedThroughputExceededException" {
+		t.Errorf("throttled span: status %v, attributes %v", span.Status, span.Attributes)
+	}
+	if n := counterValue(t, reader, "entitystore.throttles"); n != 1 {
+		t.Errorf("throttles = %d, want 1", n)
+	}
+}
+
+func TestTelemetryStream(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	store, exporter, reader := telemetryStore(client)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Put(ctx, conformance.Item{ID: id, Group: "g"}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	exporter.Reset()
+
+	// The first page request is throttled and retried
+	client.Err = &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+	params := &storagemodels.QueryParams{
+		KeyConditionExpression:    "PK1 = :pk",
+		IndexName:                 aws.String("GSI1"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": &types.AttributeValueMemberS{Value: "GROUP#g"}},
+	}
+	var n int
+	for r := range store.Stream(ctx, params, storagemodels.WithPageSize(2), storagemodels.WithRetryBackoff(time.Millisecond)) {
+		if r.Error != nil {
+			t.Fatalf("Stream failed: %v", r.Error)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("streamed %d items, want 3", n)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "entitystore.Stream" {
+		t.Fatalf("spans = %v, want the Stream span", spans)
+	}
+	attrs := spanAttrs(spans[0])
+	if attrs[ItemCountKey].AsInt64() != 3 || attrs[PagesKey].AsInt64() != 2 || attrs[RetriesKey].AsInt64() != 1 {
+		t.Errorf("Stream span attributes = %v", spans[0].Attributes)
+	}
+	if n := counterValue(t, reader, "entitystore.items.streamed"); n != 3 {
+		t.Errorf("items streamed = %d, want 3", n)
+	}
+	if n := counterValue(t, reader, "entitystore.retries"); n != 1 {
+		t.Errorf("retries = %d, want 1", n)
+	}
+}
+
+func TestTelemetryDisabled(t *testing.T) {
+	// Stores built without providers, or as struct literals, trace nothing and work
+	store := &DynamodbDataStore[conformance.Item]{client: fakeddb.New(), tableName: "entities", registry: conformance.NewRegistry()}
+	if err := store.Put(context.Background(), conformance.Item{ID: "a"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := store.GetOne(context.Background(), "a"); err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// WithUpcastWriteBack makes reads write upgraded items back to the table, so each old
+// item is upcast only once. Only the attributes changed by the upcasters are written,
+// on condition that no attribute of the item changed since it was read, and a failed
+// write-back does not fail the read. Write-backs failing for other reasons than a
+// concurrent write are recorded as "upcast_write_back_failed" span events and in the
+// entitystore.upcast.write_back_failures counter.
+func WithUpcastWriteBack() StoreOption {
+	return func(o *storeOptions) {
+		o.upcastWriteBack = true
+	}
+}
+
+// upcast upgrades a raw item of 'entityType' to the current schema version with the
+// upcasters of the registry. The returned item is a copy when it was upgraded.
+func (d *DynamodbDataStore[T]) upcast(ctx context.Context, entityType string, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	upgraded, ok, err := d.Registry().Upcast(entityType, item)
+	if err != nil || !ok {
+		return upgraded, err
+	}
+	if d.upcastWriteBack {
+		d.writeBack(ctx, item, upgraded)
+	}
+	return upgraded, nil
+}
+
+// writeBack updates 'original' to 'upgraded' unless it changed in the meantime. The
+// condition covers every attribute of 'original', including @Version and SchemaVersion
+// when present, so that a concurrent write is never replaced with stale data.
+func (d *DynamodbDataStore[T]) writeBack(ctx context.Context, original, upgraded map[string]types.AttributeValue) {
+	names := make([]string, 0, len(original)+len(upgraded))
+	for name := range original {
+		names = append(names, name)
+	}
+	for name := range upgraded {
+		if _, ok := original[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	attrNames := map[string]string{"#pk": TablePartitionKey}
+	attrValues := make(map[string]types.AttributeValue)
+	conditions := []string{"attribute_exists(#pk)"}
+	var set, remove []string
+	for i, name := range names {
+		before, existed := original[name]
+		after, kept := upgraded[name]
+		changed := !existed || !kept || !reflect.DeepEqual(before, after)
+		if changed && (name == TablePartitionKey || name == TableSortKey) {
+			// The key of an item cannot be updated
+			return
+		}
+		placeholder := fmt.Sprintf("#a%d", i)
+		attrNames[placeholder] = name
+		if existed {
+			attrValues[fmt.Sprintf(":o%d", i)] = before
+			conditions = append(conditions, fmt.Sprintf("%s = :o%d", placeholder, i))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("attribute_not_exists(%s)", placeholder))
+		}
+		switch {
+		case !changed:
+		case kept:
+			attrValues[fmt.Sprintf(":u%d", i)] = after
+			set = append(set, fmt.Sprintf("%s = :u%d", placeholder, i))
+		default:
+			remove = append(remove, placeholder)
+		}
+	}
+	if len(set) == 0 && len(remove) == 0 {
+		return
+	}
+
+	var update string
+	if len(set) > 0 {
+		update = "SET " + strings.Join(set, ", ")
+	}
+	if len(remove) > 0 {
+		update = strings.TrimSpace(update + " REMOVE " + strings.Join(remove, ", "))
+	}
+	// A failed condition means the item was written concurrently; it is upcast again
+	// on its next read if needed
+	out, err := d.client.UpdateItem(ctx, &sdk.UpdateItemInput{
+		TableName: &d.tableName,
+		Key: map[string]types.AttributeValue{
+			TablePartitionKey: original[TablePartitionKey],
+			TableSortKey:      original[TableSortKey],
+		},
+		UpdateExpression:          &update,
+		ConditionExpression:       aws.String(strings.Join(conditions, " AND ")),
+		ExpressionAttributeNames:  attrNames,
+		ExpressionAttributeValues: attrValues,
+		ReturnConsumedCapacity:    d.returnCapacity,
+	})
+	if err != nil {
+		var cfe *types.ConditionalCheckFailedException
+		if !errors.As(err, &cfe) {
+			d.writeBackFailed(ctx, err)
+		}
+		return
+	}
+	if c, ok := CapacityCollectorFrom(ctx); ok {
+		requestID, _ := awsmiddleware.GetRequestIDMetadata(out.ResultMetadata)
+		c.record("UpcastWriteBack", requestID, out.ConsumedCapacity)
+	}
+}
+
+// itemEntityType returns the EntityType attribute of a raw item with aliases resolved
+// like Query does, or the entity type name of T when it has none
+func (d *DynamodbDataStore[T]) itemEntityType(item map[string]types.AttributeValue) string {
+	if attr, ok := item["EntityType"].(*types.AttributeValueMemberS); ok {
+		return d.Registry().ResolveEntityTypeFor(reflect.TypeOf((*T)(nil)).Elem(), attr.Value)
+	}
+	return d.entityTypeOf(new(T))
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package ddb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	sdk "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/ddb/internal/fakeddb"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// UpcastTestCustomer renamed Name to FullName in schema version 2
+type UpcastTestCustomer struct {
+	ID       string
+	FullName string
+}
+
+func upcastTestRegistry(t *testing.T) *registry.Registry {
+	t.Helper()
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(UpcastTestCustomer{}), map[string]string{
+		"PK": "CUSTOMER#{ID}",
+		"SK": "CUSTOMER#{ID}",
+	})
+	reg.RegisterType("UpcastTestCustomer", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &UpcastTestCustomer{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	err := reg.RegisterUpcaster("UpcastTestCustomer", 1, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		item["FullName"] = item["Name"]
+		delete(item, "Name")
+		return item, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterUpcaster failed: %v", err)
+	}
+	return reg
+}
+
+// putVersion1Item stores an item as written before the FullName rename
+func putVersion1Item(t *testing.T, client *fakeddb.Client, id, name string) {
+	t.Helper()
+	_, err := client.PutItem(context.Background(), &sdk.PutItemInput{
+		TableName: aws.String("test-table"),
+		Item: map[string]types.AttributeValue{
+			"PK":         &types.AttributeValueMemberS{Value: "CUSTOMER#" + id},
+			"SK":         &types.AttributeValueMemberS{Value: "CUSTOMER#" + id},
+			"EntityType": &types.AttributeValueMemberS{Value: "UpcastTestCustomer"},
+			"ID":         &types.AttributeValueMemberS{Value: id},
+			"Name":       &types.AttributeValueMemberS{Value: name},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+}
+
+func TestUpcastOnRead(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[UpcastTestCustomer](client, "test-table", WithRegistry(upcastTestRegistry(t)))
+	putVersion1Item(t, client, "1", "Ada Lovelace")
+
+	got, err := store.GetOne(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+	if got.FullName != "Ada Lovelace" {
+		t.Errorf("GetOne FullName = %q, want the upcast Name", got.FullName)
+	}
+
+	got, err = store.GetByKey(ctx, "CUSTOMER#1", "CUSTOMER#1")
+	if err != nil || got.FullName != "Ada Lovelace" {
+		t.Errorf("GetByKey = %+v, %v", got, err)
+	}
+
+	results, err := store.Query(ctx, &storagemodels.QueryParams{
+		KeyConditionExpression: "PK = :pk",
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "CUSTOMER#1"},
+		},
+	})
+	if err != nil || len(results) != 1 || results[0].(*UpcastTestCustomer).FullName != "Ada Lovelace" {
+		t.Errorf("Query = %v, %v", results, err)
+	}
+
+	for res := range store.Stream(ctx, &storagemodels.QueryParams{
+		KeyConditionExpression: "PK = :pk",
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "CUSTOMER#1"},
+		},
+	}) {
+		if res.Error != nil || res.Item.FullName != "Ada Lovelace" {
+			t.Errorf("Stream result = %+v, %v", res.Item, res.Error)
+		}
+	}
+
+	// Without write-back the stored item keeps its version
+	item, _ := client.Item("CUSTOMER#1", "CUSTOMER#1")
+	if _, ok := item[registry.SchemaVersionAttribute]; ok {
+		t.Error("item was written back without WithUpcastWriteBack")
+	}
+}
+
+func TestPutWritesSchemaVersion(t *testing.T) {
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[UpcastTestCustomer](client, "test-table", WithRegistry(upcastTestRegistry(t)))
+	if err := store.Put(context.Background(), UpcastTestCustomer{ID: "2", FullName: "Grace Hopper"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	item, _ := client.Item("CUSTOMER#2", "CUSTOMER#2")
+	if n, ok := item[registry.SchemaVersionAttribute].(*types.AttributeValueMemberN); !ok || n.Value != "2" {
+		t.Errorf("SchemaVersion = %v, want 2", item[registry.SchemaVersionAttribute])
+	}
+
+	got, err := store.GetOne(context.Background(), "2")
+	if err != nil || got.FullName != "Grace Hopper" {
+		t.Errorf("GetOne = %+v, %v", got, err)
+	}
+}
+
+func TestUpcastWriteBack(t *testing.T) {
+	client := fakeddb.New()
+	store := NewDynamodbDataStoreWithClient[UpcastTestCustomer](client, "test-table",
+		WithRegistry(upcastTestRegistry(t)), WithUpcastWriteBack())
+	putVersion1Item(t, client, "3", "Alan Turing")
+
+	if _, err := store.GetOne(context.Background(), "3"); err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+	item, _ := client.Item("CUSTOMER#3", "CUSTOMER#3")
+	if n, ok := item[registry.SchemaVersionAttribute].(*types.AttributeValueMemberN); !ok || n.Value != "2" {
+		t.Errorf("SchemaVersion = %v, want 2 after write-back", item[registry.SchemaVersionAttribute])
+	}
+	if _, ok := item["Name"]; ok {
+		t.Error("written back item still has the old attribute")
+	}
+	if s, ok := item["EntityType"].(*types.AttributeValueMemberS); !ok || s.Value != "UpcastTestCustomer" {
+		t.Errorf("written back item lost its EntityType: %v", item["EntityType"])
+	}
+}
+
+func TestUpcastWriteBackKeepsConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	client := fakeddb.New()
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(UpcastTestCustomer{}), map[string]string{
+		"PK": "CUSTOMER#{ID}",
+		"SK": "CUSTOMER#{ID}",
+	})
+	err := reg.RegisterUpcaster("UpcastTestCustomer", 1, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		// An update lands between the read and the write-back
+		_, err := client.UpdateItem(ctx, &sdk.UpdateItemInput{
+			TableName:        aws.String("test-table"),
+			Key:              map[string]types.AttributeValue{"PK": item["PK"], "SK": item["SK"]},
+			UpdateExpression: aws.String("SET Name = :n"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":n": &types.AttributeValueMemberS{Value: "Alan M. Turing"},
+			},
+		})
+		item["FullName"] = item["Name"]
+		delete(item, "Name")
+		return item, err
+	})
+	if err != nil {
+		t.Fatalf("RegisterUpcaster failed: %v", err)
+	}
+	store := NewDynamodbDataStoreWithClient[UpcastTestCustomer](client, "test-table", WithRegistry(reg), WithUpcastWriteBack())
+	putVersion1Item(t, client, "4", "Alan Turing")
+
+	if _, err := store.GetOne(ctx, "4"); err != nil {
+		t.Fatalf("GetOne failed: %v", err)
+	}
+	item, _ := client.Item("CUSTOMER#4", "CUSTOMER#4")
+	if s, ok := item["Name"].(*types.AttributeValueMemberS); !ok || s.Value != "Alan M. Turing" {
+		t.Errorf("concurrent update was overwritten by the write-back: %v", item["Name"])
+	}
+	if _, ok := item[registry.SchemaVersionAttribute]; ok {
+		t.Error("write-back of a concurrently changed item must fail its condition")
+	}
+}
+
+// failingUpdateClient fails every UpdateItem call with 'err'
+type failingUpdateClient struct {
+	*fakeddb.Client
+	err error
+}
+
+func (c failingUpdateClient) UpdateItem(ctx context.Context, in *sdk.UpdateItemInput, optFns ...func(*sdk.Options)) (*sdk.UpdateItemOutput, error) {
+	return nil, c.err
+}
+
+func TestUpcastWriteBackFailureRecorded(t *testing.T) {
+	client := fakeddb.New()
+	exporter := tracetest.NewInMemoryExporter()
+	reader := sdkmetric.NewManualReader()
+	store := NewDynamodbDataStoreWithClient[UpcastTestCustomer](
+		failingUpdateClient{Client: client, err: &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}},
+		"test-table",
+		WithRegistry(upcastTestRegistry(t)), WithUpcastWriteBack(),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+	)
+	putVersion1Item(t, client, "5", "Alan Turing")
+
+	// The read still succeeds with the upgraded item
+	c, err := store.GetOne(context.Background(), "5")
+	if err != nil || c.FullName != "Alan Turing" {
+		t.Fatalf("GetOne = %+v, %v", c, err)
+	}
+	if n := counterValue(t, reader, "entitystore.upcast.write_back_failures"); n != 1 {
+		t.Errorf("write-back failures = %d, want 1", n)
+	}
+	var events []string
+	for _, e := range exporter.GetSpans()[0].Events {
+		events = append(events, e.Name)
+	}
+	if !reflect.DeepEqual(events, []string{"upcast_write_back_failed"}) {
+		t.Errorf("span events = %v, want the failed write-back", events)
+	}
+}
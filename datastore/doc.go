@@ -16,6 +16,21 @@ Implementations:
   - ddb: DynamoDB implementation with support for single-table design
   - mock: In-memory mock implementation for testing
 
+Chain wraps a DataStore[T] with middlewares for cross-cutting behavior; the result is
+still a DataStore[T]. Logging, Latency and Recover are provided:
+
+	store := datastore.Chain[User](ddbStore,
+	    datastore.Recover[User](),
+	    datastore.Logging[User](slog.Default()),
+	    datastore.Latency[User](histogram),
+	)
+
+NewCachedDataStore caches GetOne and GetByKey results, including NotFoundErrors, in a
+bounded LRU cache with a TTL. Writes through it invalidate the affected entries; a
+Cache implementation can replace the in-memory one:
+
+	configs := datastore.NewCachedDataStore[Config](ddbStore, datastore.WithCacheTTL(30*time.Second))
+
 The package uses Go generics to ensure type safety at compile time while maintaining
 flexibility for different storage backends.
 */
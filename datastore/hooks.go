@@ -0,0 +1,158 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+)
+
+// BeforePutHook is implemented by entities that prepare themselves before being stored,
+// e.g. to set UpdatedAt or normalize fields. It is called on a pointer to the entity.
+type BeforePutHook interface {
+	BeforePut(ctx context.Context) error
+}
+
+// AfterLoadHook is implemented by entities that post-process themselves after being read.
+// Polymorphic query results only run it when the unmarshal function registered for their
+// EntityType returns a pointer, or when the method has a value receiver.
+type AfterLoadHook interface {
+	AfterLoad(ctx context.Context) error
+}
+
+// BeforeDeleteHook is implemented by entities that can veto their deletion. Stores load
+// the entity before deleting it and call the hook on it, or on the zero value of the type
+// if it does not exist.
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context, key string) error
+}
+
+// Validator is implemented by entities that validate themselves before being stored.
+// Errors are reported as errors.ValidationError.
+type Validator interface {
+	Validate() error
+}
+
+// RunBeforePut runs the BeforePut hooks and validators for an entity that is about to be stored.
+// Registry hooks run before the entity's own methods, and schema validation runs last.
+// Any error aborts the write.
+func RunBeforePut[T any](ctx context.Context, entity *T) error {
+	return RunBeforePutWithRegistry(ctx, nil, entity)
+}
+
+// RunBeforePutWithRegistry is RunBeforePut with the hooks registered in 'reg'. A nil
+// registry means registry.Default().
+func RunBeforePutWithRegistry[T any](ctx context.Context, reg *registry.Registry, entity *T) error {
+	reg = registry.OrDefault(reg)
+	hooks, _ := reg.GetHooksForType(reflect.TypeOf((*T)(nil)).Elem())
+
+	if hooks.BeforePut != nil {
+		if err := hooks.BeforePut(ctx, entity); err != nil {
+			return fmt.Errorf("BeforePut hook failed: %w", err)
+		}
+	}
+	if h, ok := any(entity).(BeforePutHook); ok {
+		if err := h.BeforePut(ctx); err != nil {
+			return fmt.Errorf("BeforePut hook failed: %w", err)
+		}
+	}
+
+	if hooks.Validate != nil {
+		if err := hooks.Validate(entity); err != nil {
+			return eserrors.WrapValidationError(err)
+		}
+	}
+	if v, ok := any(entity).(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return eserrors.WrapValidationError(err)
+		}
+	}
+	return RunSchemaValidationWithRegistry(reg, entity)
+}
+
+// RunAfterLoad runs the AfterLoad hooks for an entity that has just been read
+func RunAfterLoad[T any](ctx context.Context, entity *T) error {
+	return RunAfterLoadAnyWithRegistry(ctx, nil, entity)
+}
+
+// RunAfterLoadWithRegistry is RunAfterLoad with the hooks registered in 'reg'
+func RunAfterLoadWithRegistry[T any](ctx context.Context, reg *registry.Registry, entity *T) error {
+	return RunAfterLoadAnyWithRegistry(ctx, reg, entity)
+}
+
+// RunAfterLoadAny runs the AfterLoad hooks for a value of any registered type, as
+// returned by polymorphic queries. Hooks registered in the registry only run when
+// obj is a pointer, since a hook cannot modify a value it is passed by copy; unmarshal
+// functions registered with registry.RegisterType should return pointers.
+func RunAfterLoadAny(ctx context.Context, obj any) error {
+	return RunAfterLoadAnyWithRegistry(ctx, nil, obj)
+}
+
+// RunAfterLoadAnyWithRegistry is RunAfterLoadAny with the hooks registered in 'reg'
+func RunAfterLoadAnyWithRegistry(ctx context.Context, reg *registry.Registry, obj any) error {
+	if obj == nil {
+		return nil
+	}
+
+	if t := reflect.TypeOf(obj); t.Kind() == reflect.Ptr {
+		if hooks, ok := registry.OrDefault(reg).GetHooksForType(t.Elem()); ok && hooks.AfterLoad != nil {
+			if err := hooks.AfterLoad(ctx, obj); err != nil {
+				return fmt.Errorf("AfterLoad hook failed: %w", err)
+			}
+		}
+	}
+	if h, ok := obj.(AfterLoadHook); ok {
+		if err := h.AfterLoad(ctx); err != nil {
+			return fmt.Errorf("AfterLoad hook failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// HasBeforeDelete reports whether T has BeforeDelete hooks, so that stores only load the
+// entity being deleted when a hook will see it
+func HasBeforeDelete[T any]() bool {
+	return HasBeforeDeleteWithRegistry[T](nil)
+}
+
+// HasBeforeDeleteWithRegistry is HasBeforeDelete with the hooks registered in 'reg'
+func HasBeforeDeleteWithRegistry[T any](reg *registry.Registry) bool {
+	if hooks, ok := registry.OrDefault(reg).GetHooksForType(reflect.TypeOf((*T)(nil)).Elem()); ok && hooks.BeforeDelete != nil {
+		return true
+	}
+	_, ok := any(new(T)).(BeforeDeleteHook)
+	return ok
+}
+
+// RunBeforeDelete runs the BeforeDelete hooks for type T before the entity with 'key' is
+// deleted, without the stored entity: see RunBeforeDeleteWithRegistry
+func RunBeforeDelete[T any](ctx context.Context, key string) error {
+	return RunBeforeDeleteWithRegistry[T](ctx, nil, key, nil)
+}
+
+// RunBeforeDeleteWithRegistry runs the BeforeDelete hooks registered in 'reg' and the
+// BeforeDeleteHook method of T before the entity with 'key' is deleted. 'entity' is the
+// stored entity, or nil if it does not exist, in which case the method is called on the
+// zero value.
+func RunBeforeDeleteWithRegistry[T any](ctx context.Context, reg *registry.Registry, key string, entity *T) error {
+	if hooks, ok := registry.OrDefault(reg).GetHooksForType(reflect.TypeOf((*T)(nil)).Elem()); ok && hooks.BeforeDelete != nil {
+		if err := hooks.BeforeDelete(ctx, key, entity); err != nil {
+			return fmt.Errorf("BeforeDelete hook failed: %w", err)
+		}
+	}
+	if entity == nil {
+		entity = new(T)
+	}
+	if h, ok := any(entity).(BeforeDeleteHook); ok {
+		if err := h.BeforeDelete(ctx, key); err != nil {
+			return fmt.Errorf("BeforeDelete hook failed: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+)
+
+type hookedEntity struct {
+	Name  string
+	Trace []string
+}
+
+func (e *hookedEntity) BeforePut(ctx context.Context) error {
+	e.Trace = append(e.Trace, "method")
+	e.Name = strings.TrimSpace(e.Name)
+	return nil
+}
+
+func (e *hookedEntity) Validate() error {
+	if e.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func (e *hookedEntity) AfterLoad(ctx context.Context) error {
+	e.Trace = append(e.Trace, "loaded")
+	return nil
+}
+
+func (e *hookedEntity) BeforeDelete(ctx context.Context, key string) error {
+	if key == "protected" || e.Name == "protected" {
+		return errors.New("cannot delete protected entity")
+	}
+	return nil
+}
+
+// registryEntity has no methods; its hooks come from the registry
+type registryEntity struct {
+	Count int
+}
+
+func init() {
+	registry.RegisterHooks(registry.Hooks[hookedEntity]{
+		BeforePut: func(ctx context.Context, e *hookedEntity) error {
+			e.Trace = append(e.Trace, "registry")
+			return nil
+		},
+	})
+	registry.RegisterHooks(registry.Hooks[registryEntity]{
+		AfterLoad: func(ctx context.Context, e *registryEntity) error {
+			e.Count++
+			return nil
+		},
+		Validate: func(e *registryEntity) error {
+			if e.Count < 0 {
+				return errors.New("count must not be negative")
+			}
+			return nil
+		},
+	})
+}
+
+func TestRunBeforePut(t *testing.T) {
+	ctx := context.Background()
+
+	e := &hookedEntity{Name: "  alice "}
+	if err := RunBeforePut(ctx, e); err != nil {
+		t.Fatalf("RunBeforePut failed: %v", err)
+	}
+	if e.Name != "alice" {
+		t.Errorf("expected hook to normalize name, got %q", e.Name)
+	}
+	if strings.Join(e.Trace, ",") != "registry,method" {
+		t.Errorf("expected registry hook before method hook, got %v", e.Trace)
+	}
+
+	err := RunBeforePut(ctx, &hookedEntity{Name: "   "})
+	if !eserrors.IsValidationError(err) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	err = RunBeforePut(ctx, &registryEntity{Count: -1})
+	if !eserrors.IsValidationError(err) {
+		t.Errorf("expected validation error from registry validator, got %v", err)
+	}
+}
+
+func TestRunAfterLoad(t *testing.T) {
+	ctx := context.Background()
+
+	e := &hookedEntity{}
+	if err := RunAfterLoad(ctx, e); err != nil {
+		t.Fatalf("RunAfterLoad failed: %v", err)
+	}
+	if len(e.Trace) != 1 || e.Trace[0] != "loaded" {
+		t.Errorf("expected AfterLoad to run, got %v", e.Trace)
+	}
+
+	r := &registryEntity{}
+	if err := RunAfterLoadAny(ctx, r); err != nil {
+		t.Fatalf("RunAfterLoadAny failed: %v", err)
+	}
+	if r.Count != 1 {
+		t.Errorf("expected registry AfterLoad to run once, got %d", r.Count)
+	}
+
+	// Non-pointer values and unknown types are left alone
+	if err := RunAfterLoadAny(ctx, registryEntity{}); err != nil {
+		t.Errorf("unexpected error for value: %v", err)
+	}
+	if err := RunAfterLoadAny(ctx, map[string]interface{}{}); err != nil {
+		t.Errorf("unexpected error for map: %v", err)
+	}
+}
+
+func TestRunBeforeDelete(t *testing.T) {
+	ctx := context.Background()
+
+	if err := RunBeforeDelete[hookedEntity](ctx, "regular"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := RunBeforeDelete[hookedEntity](ctx, "protected"); err == nil {
+		t.Error("expected BeforeDelete to veto deletion")
+	}
+	if err := RunBeforeDeleteWithRegistry(ctx, nil, "regular", &hookedEntity{Name: "protected"}); err == nil {
+		t.Error("expected BeforeDelete to see the stored entity")
+	}
+	if HasBeforeDelete[registryEntity]() {
+		t.Error("registryEntity has no BeforeDelete hook")
+	}
+	if err := RunBeforeDelete[registryEntity](ctx, "any"); err != nil {
+		t.Errorf("unexpected error for type without hook: %v", err)
+	}
+}
+
+func TestRunHooksWithRegistry(t *testing.T) {
+	ctx := context.Background()
+	reg := registry.New()
+	reg.RegisterHooks(reflect.TypeOf(registryEntity{}), registry.NewEntityHooks(registry.Hooks[registryEntity]{
+		BeforePut: func(ctx context.Context, e *registryEntity) error {
+			e.Count = 10
+			return nil
+		},
+	}))
+
+	e := &registryEntity{}
+	if err := RunBeforePutWithRegistry(ctx, reg, e); err != nil {
+		t.Fatalf("RunBeforePutWithRegistry failed: %v", err)
+	}
+	if e.Count != 10 {
+		t.Errorf("expected the hook of the scoped registry to run, got %d", e.Count)
+	}
+
+	// The default registry's AfterLoad hook does not apply to the scoped registry
+	if err := RunAfterLoadWithRegistry(ctx, reg, e); err != nil || e.Count != 10 {
+		t.Errorf("RunAfterLoadWithRegistry = %v with Count %d, want no default hook", err, e.Count)
+	}
+	if err := RunAfterLoad(ctx, e); err != nil || e.Count != 11 {
+		t.Errorf("RunAfterLoad = %v with Count %d, want the default hook", err, e.Count)
+	}
+}
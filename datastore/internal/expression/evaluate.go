@@ -0,0 +1,352 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package expression
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Evaluate reports whether 'item' satisfies 'c'. A nil item is an item that does not
+// exist, so that attribute_not_exists conditions hold for it.
+func Evaluate(c Condition, item map[string]types.AttributeValue) (bool, error) {
+	switch c := c.(type) {
+	case And:
+		ok, err := Evaluate(c.Left, item)
+		if err != nil || !ok {
+			return false, err
+		}
+		return Evaluate(c.Right, item)
+	case Or:
+		ok, err := Evaluate(c.Left, item)
+		if err != nil || ok {
+			return ok, err
+		}
+		return Evaluate(c.Right, item)
+	case Not:
+		ok, err := Evaluate(c.Condition, item)
+		return !ok, err
+	case Compare:
+		left, lok := Resolve(c.Left, item)
+		right, rok := Resolve(c.Right, item)
+		if !lok || !rok {
+			// Only inequality holds against a missing attribute
+			return c.Op == "<>" && lok != rok, nil
+		}
+		if c.Op == "=" {
+			return Equal(left, right), nil
+		}
+		if c.Op == "<>" {
+			return !Equal(left, right), nil
+		}
+		cmp, ok := Order(left, right)
+		if !ok {
+			return false, nil
+		}
+		switch c.Op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		}
+		return false, fmt.Errorf("unsupported comparison %q", c.Op)
+	case Between:
+		v, ok := Resolve(c.Operand, item)
+		low, lok := Resolve(c.Low, item)
+		high, hok := Resolve(c.High, item)
+		if !ok || !lok || !hok {
+			return false, nil
+		}
+		lc, lok := Order(v, low)
+		hc, hok := Order(v, high)
+		return lok && hok && lc >= 0 && hc <= 0, nil
+	case In:
+		v, ok := Resolve(c.Operand, item)
+		if !ok {
+			return false, nil
+		}
+		for _, op := range c.List {
+			if candidate, ok := Resolve(op, item); ok && Equal(v, candidate) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case Function:
+		return evaluateFunction(c, item)
+	}
+	return false, fmt.Errorf("unsupported condition %T", c)
+}
+
+func evaluateFunction(f Function, item map[string]types.AttributeValue) (bool, error) {
+	v, exists := Lookup(item, f.Path)
+	switch f.Name {
+	case "attribute_exists":
+		return exists, nil
+	case "attribute_not_exists":
+		return !exists, nil
+	}
+	arg, ok := Resolve(f.Arg, item)
+	if !exists || !ok {
+		return false, nil
+	}
+
+	switch f.Name {
+	case "attribute_type":
+		s, ok := arg.(*types.AttributeValueMemberS)
+		if !ok {
+			return false, fmt.Errorf("attribute_type requires a string type argument")
+		}
+		return TypeName(v) == s.Value, nil
+	case "begins_with":
+		switch v := v.(type) {
+		case *types.AttributeValueMemberS:
+			prefix, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.HasPrefix(v.Value, prefix.Value), nil
+		case *types.AttributeValueMemberB:
+			prefix, ok := arg.(*types.AttributeValueMemberB)
+			return ok && bytes.HasPrefix(v.Value, prefix.Value), nil
+		}
+		return false, nil
+	case "contains":
+		switch v := v.(type) {
+		case *types.AttributeValueMemberS:
+			sub, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.Contains(v.Value, sub.Value), nil
+		case *types.AttributeValueMemberB:
+			sub, ok := arg.(*types.AttributeValueMemberB)
+			return ok && bytes.Contains(v.Value, sub.Value), nil
+		case *types.AttributeValueMemberSS:
+			for _, s := range v.Value {
+				if Equal(&types.AttributeValueMemberS{Value: s}, arg) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberNS:
+			for _, n := range v.Value {
+				if Equal(&types.AttributeValueMemberN{Value: n}, arg) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberBS:
+			for _, b := range v.Value {
+				if Equal(&types.AttributeValueMemberB{Value: b}, arg) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberL:
+			for _, e := range v.Value {
+				if Equal(e, arg) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported function %s", f.Name)
+}
+
+// Resolve returns the value of an operand for 'item'. It reports false when a path
+// does not exist.
+func Resolve(op Operand, item map[string]types.AttributeValue) (types.AttributeValue, bool) {
+	switch op := op.(type) {
+	case Value:
+		return op.Value, op.Value != nil
+	case Path:
+		return Lookup(item, op)
+	case Size:
+		v, ok := Lookup(item, op.Path)
+		if !ok {
+			return nil, false
+		}
+		n, ok := size(v)
+		if !ok {
+			return nil, false
+		}
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(n)}, true
+	}
+	return nil, false
+}
+
+// Lookup returns the value at 'path' in 'item'
+func Lookup(item map[string]types.AttributeValue, path Path) (types.AttributeValue, bool) {
+	if len(path) == 0 || path[0].IsIndex {
+		return nil, false
+	}
+	v, ok := item[path[0].Name]
+	for _, e := range path[1:] {
+		if !ok {
+			return nil, false
+		}
+		switch c := v.(type) {
+		case *types.AttributeValueMemberM:
+			if e.IsIndex {
+				return nil, false
+			}
+			v, ok = c.Value[e.Name]
+		case *types.AttributeValueMemberL:
+			if !e.IsIndex || e.Index >= len(c.Value) {
+				return nil, false
+			}
+			v = c.Value[e.Index]
+		default:
+			return nil, false
+		}
+	}
+	return v, ok
+}
+
+func size(v types.AttributeValue) (int, bool) {
+	switch v := v.(type) {
+	case *types.AttributeValueMemberS:
+		return utf8.RuneCountInString(v.Value), true
+	case *types.AttributeValueMemberB:
+		return len(v.Value), true
+	case *types.AttributeValueMemberSS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberNS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberBS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberL:
+		return len(v.Value), true
+	case *types.AttributeValueMemberM:
+		return len(v.Value), true
+	}
+	return 0, false
+}
+
+// TypeName returns the DynamoDB type descriptor of 'v', such as "S" or "NS"
+func TypeName(v types.AttributeValue) string {
+	switch v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	}
+	return ""
+}
+
+// Order compares two scalar values of the same type like strings.Compare: strings and
+// binaries bytewise, numbers numerically. It reports false for other or mixed types.
+func Order(a, b types.AttributeValue) (int, bool) {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS:
+		if b, ok := b.(*types.AttributeValueMemberS); ok {
+			return strings.Compare(a.Value, b.Value), true
+		}
+	case *types.AttributeValueMemberB:
+		if b, ok := b.(*types.AttributeValueMemberB); ok {
+			return bytes.Compare(a.Value, b.Value), true
+		}
+	case *types.AttributeValueMemberN:
+		if b, ok := b.(*types.AttributeValueMemberN); ok {
+			x, xok := parseNumber(a.Value)
+			y, yok := parseNumber(b.Value)
+			if xok && yok {
+				return x.Cmp(y), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Equal reports whether two values have the same type and value. Numbers are compared
+// numerically and sets regardless of order.
+func Equal(a, b types.AttributeValue) bool {
+	switch a := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		cmp, ok := Order(a, b)
+		return ok && cmp == 0
+	case *types.AttributeValueMemberBOOL:
+		b, ok := b.(*types.AttributeValueMemberBOOL)
+		return ok && a.Value == b.Value
+	case *types.AttributeValueMemberNULL:
+		_, ok := b.(*types.AttributeValueMemberNULL)
+		return ok
+	case *types.AttributeValueMemberSS:
+		b, ok := b.(*types.AttributeValueMemberSS)
+		return ok && sameSet(len(a.Value), len(b.Value), func(i, j int) bool { return a.Value[i] == b.Value[j] })
+	case *types.AttributeValueMemberNS:
+		b, ok := b.(*types.AttributeValueMemberNS)
+		return ok && sameSet(len(a.Value), len(b.Value), func(i, j int) bool {
+			return Equal(&types.AttributeValueMemberN{Value: a.Value[i]}, &types.AttributeValueMemberN{Value: b.Value[j]})
+		})
+	case *types.AttributeValueMemberBS:
+		b, ok := b.(*types.AttributeValueMemberBS)
+		return ok && sameSet(len(a.Value), len(b.Value), func(i, j int) bool { return bytes.Equal(a.Value[i], b.Value[j]) })
+	case *types.AttributeValueMemberL:
+		b, ok := b.(*types.AttributeValueMemberL)
+		if !ok || len(a.Value) != len(b.Value) {
+			return false
+		}
+		for i := range a.Value {
+			if !Equal(a.Value[i], b.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		b, ok := b.(*types.AttributeValueMemberM)
+		if !ok || len(a.Value) != len(b.Value) {
+			return false
+		}
+		for k, v := range a.Value {
+			if w, ok := b.Value[k]; !ok || !Equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// sameSet reports whether every element of a set of size 'n' has an equal element in a
+// set of size 'm' and the sizes match
+func sameSet(n, m int, eq func(i, j int) bool) bool {
+	if n != m {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		found := false
+		for j := 0; j < m && !found; j++ {
+			found = eq(i, j)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func parseNumber(s string) (*big.Float, bool) {
+	f, ok := new(big.Float).SetPrec(256).SetString(s)
+	return f, ok
+}
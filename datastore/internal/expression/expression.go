@@ -0,0 +1,489 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+// Package expression parses and evaluates DynamoDB condition, filter and key condition
+// expressions, so that datastores not backed by DynamoDB accept the same QueryParams
+// and conditions as the ddb package. Placeholders are resolved while parsing.
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// PathElement is one step of a document path: an attribute or map key, or a list index
+type PathElement struct {
+	Name    string
+	Index   int
+	IsIndex bool
+}
+
+// Path is a document path such as Address.City or Tags[0]
+type Path []PathElement
+
+// String returns the path in expression syntax, with names not escaped
+func (p Path) String() string {
+	var b strings.Builder
+	for i, e := range p {
+		switch {
+		case e.IsIndex:
+			fmt.Fprintf(&b, "[%d]", e.Index)
+		case i > 0:
+			b.WriteString(".")
+			b.WriteString(e.Name)
+		default:
+			b.WriteString(e.Name)
+		}
+	}
+	return b.String()
+}
+
+// Attribute returns the top-level attribute name when the path has a single element
+func (p Path) Attribute() (string, bool) {
+	if len(p) != 1 || p[0].IsIndex {
+		return "", false
+	}
+	return p[0].Name, true
+}
+
+// Operand is a Path, a Value or a Size
+type Operand interface {
+	operand()
+}
+
+// Value is an expression attribute value
+type Value struct {
+	Placeholder string
+	Value       types.AttributeValue
+}
+
+// Size is the size() of the attribute at Path
+type Size struct {
+	Path Path
+}
+
+func (Path) operand()  {}
+func (Value) operand() {}
+func (Size) operand()  {}
+
+// Condition is a node of a parsed condition expression
+type Condition interface {
+	condition()
+}
+
+// Compare is a comparison; Op is one of =, <>, <, <=, >, >=
+type Compare struct {
+	Op          string
+	Left, Right Operand
+}
+
+// Between is Operand BETWEEN Low AND High
+type Between struct {
+	Operand   Operand
+	Low, High Operand
+}
+
+// In is Operand IN (List...)
+type In struct {
+	Operand Operand
+	List    []Operand
+}
+
+// Function is a function call: attribute_exists and attribute_not_exists without Arg,
+// and attribute_type, begins_with and contains with one
+type Function struct {
+	Name string
+	Path Path
+	Arg  Operand
+}
+
+// And is the conjunction of two conditions
+type And struct {
+	Left, Right Condition
+}
+
+// Or is the disjunction of two conditions
+type Or struct {
+	Left, Right Condition
+}
+
+// Not negates a condition
+type Not struct {
+	Condition Condition
+}
+
+func (Compare) condition()  {}
+func (Between) condition()  {}
+func (In) condition()       {}
+func (Function) condition() {}
+func (And) condition()      {}
+func (Or) condition()       {}
+func (Not) condition()      {}
+
+// Parse parses a condition or filter expression, resolving #name placeholders with
+// 'names' and :value placeholders with 'values'. Unknown placeholders are errors.
+func Parse(expr string, names map[string]string, values map[string]types.AttributeValue) (Condition, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{expr: expr, tokens: tokens, names: names, values: values}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return cond, nil
+}
+
+// Conjuncts returns the conditions joined by AND at the top of 'c'
+func Conjuncts(c Condition) []Condition {
+	if and, ok := c.(And); ok {
+		return append(Conjuncts(and.Left), Conjuncts(and.Right)...)
+	}
+	return []Condition{c}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenName  // #name
+	tokenValue // :value
+	tokenNumber
+	tokenOperator
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '.' || c == '[' || c == ']':
+			tokens = append(tokens, token{kind: tokenPunct, text: string(c), pos: i})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{kind: tokenOperator, text: "=", pos: i})
+			i++
+		case c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(expr) && (expr[i+1] == '=' || (c == '<' && expr[i+1] == '>')) {
+				op += string(expr[i+1])
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(expr) && isIdentChar(expr[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("expression %q: empty placeholder at %d", expr, i)
+			}
+			kind := tokenName
+			if c == ':' {
+				kind = tokenValue
+			}
+			tokens = append(tokens, token{kind: kind, text: expr[i:j], pos: i})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expr[i:j], pos: i})
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(expr) && isIdentChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expr[i:j], pos: i})
+			i = j
+		default:
+			return nil, fmt.Errorf("expression %q: unexpected character %q at %d", expr, c, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(expr)}), nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type parser struct {
+	expr   string
+	tokens []token
+	pos    int
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("expression %q: %s at %d", p.expr, fmt.Sprintf(format, args...), tok.pos)
+}
+
+// keyword reports whether the next token is the case-insensitive keyword 'kw'
+func (p *parser) keyword(kw string) bool {
+	tok := p.peek()
+	return tok.kind == tokenIdent && strings.EqualFold(tok.text, kw)
+}
+
+func (p *parser) punct(s string) bool {
+	tok := p.peek()
+	return tok.kind == tokenPunct && tok.text == s
+}
+
+func (p *parser) expectPunct(s string) error {
+	if tok := p.next(); tok.kind != tokenPunct || tok.text != s {
+		return p.errorf(tok, "expected %q", s)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (Condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Condition, error) {
+	if p.keyword("NOT") {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Condition: c}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Condition, error) {
+	if p.punct("(") {
+		p.next()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	if tok := p.peek(); tok.kind == tokenIdent && p.tokens[p.pos+1].text == "(" {
+		switch name := strings.ToLower(tok.text); name {
+		case "attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains":
+			return p.parseFunction(name)
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.keyword("BETWEEN"):
+		p.next()
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.errorf(p.peek(), "expected AND in BETWEEN")
+		}
+		p.next()
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return Between{Operand: left, Low: low, High: high}, nil
+	case p.keyword("IN"):
+		p.next()
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		in := In{Operand: left}
+		for {
+			op, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, op)
+			if !p.punct(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	}
+
+	tok := p.next()
+	if tok.kind != tokenOperator {
+		return nil, p.errorf(tok, "expected a comparison, got %q", tok.text)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return Compare{Op: tok.text, Left: left, Right: right}, nil
+}
+
+func (p *parser) parseFunction(name string) (Condition, error) {
+	p.next()
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	fn := Function{Name: name, Path: path}
+	if name != "attribute_exists" && name != "attribute_not_exists" {
+		if err := p.expectPunct(","); err != nil {
+			return nil, err
+		}
+		if fn.Arg, err = p.parseOperand(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+	return fn, nil
+}
+
+func (p *parser) parseOperand() (Operand, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokenValue:
+		p.next()
+		v, ok := p.values[tok.text]
+		if !ok {
+			return nil, p.errorf(tok, "no value for %s", tok.text)
+		}
+		return Value{Placeholder: tok.text, Value: v}, nil
+	case tok.kind == tokenIdent && strings.EqualFold(tok.text, "size") && p.tokens[p.pos+1].text == "(":
+		p.next()
+		p.next()
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return Size{Path: path}, nil
+	}
+	return p.parsePath()
+}
+
+func (p *parser) parsePath() (Path, error) {
+	var path Path
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	path = append(path, PathElement{Name: name})
+	for {
+		switch {
+		case p.punct("."):
+			p.next()
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, PathElement{Name: name})
+		case p.punct("["):
+			p.next()
+			tok := p.next()
+			if tok.kind != tokenNumber {
+				return nil, p.errorf(tok, "expected a list index")
+			}
+			index, err := strconv.Atoi(tok.text)
+			if err != nil {
+				return nil, p.errorf(tok, "invalid list index %q", tok.text)
+			}
+			if err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, PathElement{Index: index, IsIndex: true})
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *parser) parseName() (string, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenIdent:
+		return tok.text, nil
+	case tokenName:
+		name, ok := p.names[tok.text]
+		if !ok {
+			return "", p.errorf(tok, "no name for %s", tok.text)
+		}
+		return name, nil
+	default:
+		return "", p.errorf(tok, "expected an attribute name, got %q", tok.text)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package expression
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func testItem() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PK":     &types.AttributeValueMemberS{Value: "ORG#1"},
+		"Status": &types.AttributeValueMemberS{Value: "active"},
+		"Age":    &types.AttributeValueMemberN{Value: "30"},
+		"Tags":   &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"Profile": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"Emails": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+				&types.AttributeValueMemberS{Value: "a@example.com"},
+			}},
+		}},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	names := map[string]string{"#s": "Status", "#p": "Profile"}
+	values := map[string]types.AttributeValue{
+		":active": &types.AttributeValueMemberS{Value: "active"},
+		":n":      &types.AttributeValueMemberN{Value: "30.0"},
+		":low":    &types.AttributeValueMemberN{Value: "18"},
+		":high":   &types.AttributeValueMemberN{Value: "65"},
+		":tag":    &types.AttributeValueMemberS{Value: "b"},
+		":prefix": &types.AttributeValueMemberS{Value: "ORG#"},
+		":two":    &types.AttributeValueMemberN{Value: "2"},
+		":email":  &types.AttributeValueMemberS{Value: "a@example.com"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"#s = :active", true},
+		{"Age = :n", true},
+		{"Age BETWEEN :low AND :high", true},
+		{"Age > :high OR #s IN (:tag, :active)", true},
+		{"NOT (Age < :low) AND contains(Tags, :tag)", true},
+		{"begins_with(PK, :prefix) AND size(Tags) = :two", true},
+		{"#p.Emails[0] = :email", true},
+		{"attribute_exists(Missing)", false},
+		{"attribute_not_exists(Missing)", true},
+		{"Missing <> :active", true},
+		{"Missing = :active", false},
+		{"attribute_type(Tags, :tag)", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := Parse(tt.expr, names, values)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			got, err := Evaluate(c, testItem())
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	values := map[string]types.AttributeValue{":v": &types.AttributeValueMemberS{Value: "x"}}
+	for _, expr := range []string{
+		"Status = :missing",
+		"#missing = :v",
+		"Status = ",
+		"Status = :v AND",
+		"(Status = :v",
+		"unknown_function(Status)",
+	} {
+		if _, err := Parse(expr, nil, values); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestParseKeyCondition(t *testing.T) {
+	values := map[string]types.AttributeValue{
+		":pk":   &types.AttributeValueMemberS{Value: "ORG#1"},
+		":from": &types.AttributeValueMemberS{Value: "USER#a"},
+		":to":   &types.AttributeValueMemberS{Value: "USER#m"},
+	}
+
+	kc, err := ParseKeyCondition("SK BETWEEN :from AND :to AND PK = :pk", nil, values, "PK", "SK")
+	if err != nil {
+		t.Fatalf("ParseKeyCondition failed: %v", err)
+	}
+	if kc.PartitionKey != "PK" || kc.SortKey == nil || kc.SortKey.Op != OpBetween {
+		t.Fatalf("ParseKeyCondition = %+v, want a partition key and a BETWEEN sort key", kc)
+	}
+	if !kc.SortKey.Matches(&types.AttributeValueMemberS{Value: "USER#b"}) {
+		t.Error("USER#b does not match the sort key condition")
+	}
+	if kc.SortKey.Matches(&types.AttributeValueMemberS{Value: "USER#z"}) {
+		t.Error("USER#z matches the sort key condition")
+	}
+
+	for _, expr := range []string{
+		"SK = :from",
+		"PK = :pk OR SK = :from",
+		"PK = :pk AND Status = :from",
+		"PK > :pk",
+	} {
+		if _, err := ParseKeyCondition(expr, nil, values, "PK", "SK"); err == nil {
+			t.Errorf("ParseKeyCondition(%q) succeeded, want an error", expr)
+		}
+	}
+}
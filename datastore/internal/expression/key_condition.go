@@ -0,0 +1,130 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package expression
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Sort key operators of a KeyCondition
+const (
+	OpEqual        = "="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpBetween      = "BETWEEN"
+	OpBeginsWith   = "begins_with"
+)
+
+// KeyCondition is a parsed key condition expression: an equality on the partition key
+// and an optional condition on the sort key
+type KeyCondition struct {
+	PartitionKey   string
+	PartitionValue types.AttributeValue
+	SortKey        *SortKeyCondition
+}
+
+// SortKeyCondition is the sort key part of a KeyCondition. Values holds one value, or
+// the lower and upper bound for OpBetween.
+type SortKeyCondition struct {
+	Attribute string
+	Op        string
+	Values    []types.AttributeValue
+}
+
+// ParseKeyCondition parses a key condition expression on the index whose key attributes
+// are 'partitionKey' and 'sortKey', following the rules of DynamoDB: an equality on the
+// partition key, optionally AND-ed with a comparison, BETWEEN or begins_with on the
+// sort key, with the attribute on the left.
+func ParseKeyCondition(expr string, names map[string]string, values map[string]types.AttributeValue, partitionKey, sortKey string) (KeyCondition, error) {
+	cond, err := Parse(expr, names, values)
+	if err != nil {
+		return KeyCondition{}, err
+	}
+
+	var kc KeyCondition
+	terms := Conjuncts(cond)
+	if len(terms) > 2 {
+		return KeyCondition{}, fmt.Errorf("key condition %q: at most a partition and a sort key condition are allowed", expr)
+	}
+	for _, term := range terms {
+		attr, sk, err := keyTerm(term)
+		if err != nil {
+			return KeyCondition{}, fmt.Errorf("key condition %q: %w", expr, err)
+		}
+		switch {
+		case attr == partitionKey && kc.PartitionValue == nil && sk.Op == OpEqual:
+			kc.PartitionKey = attr
+			kc.PartitionValue = sk.Values[0]
+		case attr == sortKey && sortKey != "" && kc.SortKey == nil:
+			kc.SortKey = &sk
+		default:
+			return KeyCondition{}, fmt.Errorf("key condition %q: unsupported condition on %s", expr, attr)
+		}
+	}
+	if kc.PartitionValue == nil {
+		return KeyCondition{}, fmt.Errorf("key condition %q: missing equality on partition key %s", expr, partitionKey)
+	}
+	return kc, nil
+}
+
+// keyTerm converts one term of a key condition into a condition on an attribute
+func keyTerm(term Condition) (string, SortKeyCondition, error) {
+	switch t := term.(type) {
+	case Compare:
+		attr, ok := keyAttribute(t.Left)
+		right, isValue := t.Right.(Value)
+		if !ok || !isValue || t.Op == "<>" {
+			break
+		}
+		return attr, SortKeyCondition{Attribute: attr, Op: t.Op, Values: []types.AttributeValue{right.Value}}, nil
+	case Between:
+		attr, ok := keyAttribute(t.Operand)
+		low, lok := t.Low.(Value)
+		high, hok := t.High.(Value)
+		if !ok || !lok || !hok {
+			break
+		}
+		return attr, SortKeyCondition{Attribute: attr, Op: OpBetween, Values: []types.AttributeValue{low.Value, high.Value}}, nil
+	case Function:
+		attr, ok := t.Path.Attribute()
+		prefix, isValue := t.Arg.(Value)
+		if t.Name != OpBeginsWith || !ok || !isValue {
+			break
+		}
+		return attr, SortKeyCondition{Attribute: attr, Op: OpBeginsWith, Values: []types.AttributeValue{prefix.Value}}, nil
+	}
+	return "", SortKeyCondition{}, fmt.Errorf("unsupported key condition term %T", term)
+}
+
+func keyAttribute(op Operand) (string, bool) {
+	path, ok := op.(Path)
+	if !ok {
+		return "", false
+	}
+	return path.Attribute()
+}
+
+// Matches reports whether 'v' satisfies the sort key condition
+func (c SortKeyCondition) Matches(v types.AttributeValue) bool {
+	if v == nil {
+		return false
+	}
+	var cond Condition
+	path := Path{{Name: c.Attribute}}
+	switch c.Op {
+	case OpBetween:
+		cond = Between{Operand: path, Low: Value{Value: c.Values[0]}, High: Value{Value: c.Values[1]}}
+	case OpBeginsWith:
+		cond = Function{Name: OpBeginsWith, Path: path, Arg: Value{Value: c.Values[0]}}
+	default:
+		cond = Compare{Op: c.Op, Left: path, Right: Value{Value: c.Values[0]}}
+	}
+	ok, _ := Evaluate(cond, map[string]types.AttributeValue{c.Attribute: v})
+	return ok
+}
@@ -0,0 +1,426 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+// Package items implements the storage-independent parts of the datastores that are not
+// backed by DynamoDB. Entities are converted to the same raw items the ddb package
+// writes, so that index maps, EntityType polymorphism, lifecycle directives, hooks and
+// upcasters behave alike on every backend.
+package items
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore"
+	"github.com/suparena/entitystore/datastore/ddb"
+	"github.com/suparena/entitystore/datastore/keys"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// Key is the table key of an item
+type Key struct {
+	PK string
+	SK string
+}
+
+// String returns the key in the "PK|SK" form used in error messages
+func (k Key) String() string {
+	return k.PK + "|" + k.SK
+}
+
+// KeyOf returns the table key of a raw item
+func KeyOf(item map[string]types.AttributeValue) Key {
+	return Key{PK: StringAttr(item, "PK"), SK: StringAttr(item, "SK")}
+}
+
+// StringAttr returns the string attribute 'name' of 'item', or "" if it is not a string
+func StringAttr(item map[string]types.AttributeValue, name string) string {
+	if s, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
+
+// Copy returns a shallow copy of 'item'
+func Copy(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	res := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		res[k] = v
+	}
+	return res
+}
+
+// Index holds the key attributes of the table ("" name) or of a GSI
+type Index struct {
+	Name         string
+	PartitionKey string
+	SortKey      string
+}
+
+// TableIndex is the PK/SK key of the table
+var TableIndex = Index{PartitionKey: "PK", SortKey: "SK"}
+
+// Codec converts between entities of type T and raw items, resolving index maps, entity
+// names, hooks, GSIs and upcasters in Registry and field names with Fields
+type Codec[T any] struct {
+	Registry *registry.Registry
+	Fields   *keys.Resolver
+}
+
+// registry returns the registry of the codec, registry.Default() when unset
+func (c Codec[T]) registry() *registry.Registry {
+	return registry.OrDefault(c.Registry)
+}
+
+func (c Codec[T]) fields() *keys.Resolver {
+	return keys.OrDefault(c.Fields)
+}
+
+func entityGoType[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// EntityType returns the EntityType name of T
+func (c Codec[T]) EntityType() string {
+	return c.registry().EntityTypeName(entityGoType[T]())
+}
+
+// IndexMap returns the index map registered for T
+func (c Codec[T]) IndexMap() (map[string]string, error) {
+	indexMap, ok := c.registry().GetIndexMap(entityGoType[T]())
+	if !ok {
+		return nil, errors.New("no index map found for entity type")
+	}
+	return indexMap, nil
+}
+
+// lifecycle returns the lifecycle directives of 'indexMap' with resolved field names
+func (c Codec[T]) lifecycle(indexMap map[string]string) (datastore.Lifecycle, error) {
+	lifecycle, err := datastore.ParseLifecycle(indexMap)
+	if err != nil {
+		return datastore.Lifecycle{}, err
+	}
+	return lifecycle.Resolve(entityGoType[T](), c.fields())
+}
+
+// Index returns the key attributes of GSI 'name', as registered with
+// registry.RegisterGSI or declared in ddb.DefaultGSIConfigs, or of the table for ""
+func (c Codec[T]) Index(name string) (Index, bool) {
+	if name == "" {
+		return TableIndex, true
+	}
+	if gsi, ok := c.registry().GetGSI(name); ok {
+		return Index{Name: name, PartitionKey: gsi.PartitionKey, SortKey: gsi.SortKey}, true
+	}
+	if cfg, ok := ddb.DefaultGSIConfigs[name]; ok {
+		return Index{Name: name, PartitionKey: cfg.PartitionKeyName, SortKey: cfg.SortKeyName}, true
+	}
+	return Index{}, false
+}
+
+var gsiKeyPattern = regexp.MustCompile(`^(GSI\d+)(PK|SK)$`)
+
+// Indexes returns the GSIs of ddb.DefaultGSIConfigs and those used by the index map of T
+func (c Codec[T]) Indexes() []Index {
+	names := map[string]bool{}
+	for name := range ddb.DefaultGSIConfigs {
+		names[name] = true
+	}
+	if indexMap, err := c.IndexMap(); err == nil {
+		for key := range indexMap {
+			if m := gsiKeyPattern.FindStringSubmatch(key); m != nil {
+				names[m[1]] = true
+			}
+		}
+	}
+	var indexes []Index
+	for name := range names {
+		if index, ok := c.Index(name); ok {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// physicalKeyName maps a logical index map key such as "GSI1PK" to its attribute
+func (c Codec[T]) physicalKeyName(key string) string {
+	m := gsiKeyPattern.FindStringSubmatch(key)
+	if m == nil {
+		return key
+	}
+	index, ok := c.Index(m[1])
+	if !ok {
+		return key
+	}
+	if m[2] == "PK" {
+		return index.PartitionKey
+	}
+	return index.SortKey
+}
+
+// Write is an entity prepared for storage
+type Write struct {
+	Item map[string]types.AttributeValue
+	Key  Key
+	// Create requires that no item with Key exists
+	Create bool
+	// VersionAttribute, when set, requires the stored item to have ExpectedVersion, or
+	// to have no version or version 0 when ExpectedVersion is 0
+	VersionAttribute string
+	ExpectedVersion  int64
+}
+
+// PrepareWrite stamps the lifecycle fields of 'entity', runs the BeforePut hooks and
+// builds its raw item like the ddb package does. With 'create' set the write must not
+// replace an existing item.
+func (c Codec[T]) PrepareWrite(ctx context.Context, entity T, create bool) (Write, error) {
+	indexMap, err := c.IndexMap()
+	if err != nil {
+		return Write{}, err
+	}
+	lifecycle, err := c.lifecycle(indexMap)
+	if err != nil {
+		return Write{}, err
+	}
+	now := time.Now().UTC()
+	previousVersion, err := lifecycle.Stamp(&entity, now, create)
+	if err != nil {
+		return Write{}, err
+	}
+	if err := datastore.RunBeforePutWithRegistry(ctx, c.Registry, &entity); err != nil {
+		return Write{}, err
+	}
+
+	item, err := attributevalue.MarshalMap(entity)
+	if err != nil {
+		return Write{}, fmt.Errorf("failed to marshal entity: %w", err)
+	}
+	entityType := c.EntityType()
+	item["EntityType"] = &types.AttributeValueMemberS{Value: entityType}
+	if version, ok := c.registry().SchemaVersion(entityType); ok {
+		item[registry.SchemaVersionAttribute] = &types.AttributeValueMemberN{Value: strconv.Itoa(version)}
+	}
+	for name, template := range indexMap {
+		if datastore.IsDirective(name) {
+			continue
+		}
+		expand := c.fields().Expand
+		if name == "PK" || name == "SK" {
+			expand = c.fields().ExpandKey
+		}
+		expanded, err := expand(template, entity)
+		if err != nil {
+			return Write{}, fmt.Errorf("failed to expand %s template %q: %w", name, template, err)
+		}
+		item[c.physicalKeyName(name)] = &types.AttributeValueMemberS{Value: expanded}
+	}
+	if expiresAt, ok, err := lifecycle.ExpiresAt(&entity, now); err != nil {
+		return Write{}, err
+	} else if ok {
+		item[lifecycle.TTLAttribute] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)}
+	}
+
+	w := Write{Item: item, Key: KeyOf(item), Create: create, VersionAttribute: lifecycle.Version, ExpectedVersion: previousVersion}
+	if w.Key.PK == "" || w.Key.SK == "" {
+		return Write{}, errors.New("expanded index map missing valid PK or SK")
+	}
+	return w, nil
+}
+
+// Check verifies the conditions of the write against the stored item, nil when there
+// is none. It returns an AlreadyExistsError or a ConditionFailedError like the ddb store.
+func (w Write) Check(existing map[string]types.AttributeValue) error {
+	if w.Create {
+		if existing != nil {
+			return eserrors.NewAlreadyExistsError(StringAttr(w.Item, "EntityType"), w.Key.PK)
+		}
+		return nil
+	}
+	if w.VersionAttribute == "" {
+		return nil
+	}
+	if w.ExpectedVersion == 0 {
+		if n, ok := existing[w.VersionAttribute].(*types.AttributeValueMemberN); ok && n.Value != "0" {
+			return eserrors.NewConditionFailedError("put", "attribute_not_exists(#version) OR #version = :zero")
+		}
+		return nil
+	}
+	if n, ok := existing[w.VersionAttribute].(*types.AttributeValueMemberN); !ok || n.Value != strconv.FormatInt(w.ExpectedVersion, 10) {
+		return eserrors.NewConditionFailedError("put", "#version = :expectedVersion")
+	}
+	return nil
+}
+
+// StringKey expands the table key of the index map of T with 'key' substituted for
+// every macro, like ddb's GetOne and Delete
+func (c Codec[T]) StringKey(key string) (Key, error) {
+	indexMap, err := c.IndexMap()
+	if err != nil {
+		return Key{}, err
+	}
+	k := Key{
+		PK: keys.MacroPattern.ReplaceAllString(indexMap["PK"], key),
+		SK: keys.MacroPattern.ReplaceAllString(indexMap["SK"], key),
+	}
+	if k.PK == "" || k.SK == "" {
+		return Key{}, errors.New("failed to build key: expanded index map missing valid PK or SK")
+	}
+	return k, nil
+}
+
+// TableKey expands the table key of the index map of T with the fields of 'keyInput',
+// a struct or a map keyed by field name
+func (c Codec[T]) TableKey(keyInput any) (Key, error) {
+	indexMap, err := c.IndexMap()
+	if err != nil {
+		return Key{}, err
+	}
+	var k Key
+	for name, dst := range map[string]*string{"PK": &k.PK, "SK": &k.SK} {
+		if *dst, err = c.fields().ExpandKey(indexMap[name], keyInput); err != nil {
+			return Key{}, fmt.Errorf("failed to expand %s template %q: %w", name, indexMap[name], err)
+		}
+	}
+	if k.PK == "" || k.SK == "" {
+		return Key{}, errors.New("missing PK or SK in expanded indexMap")
+	}
+	return k, nil
+}
+
+// BeforeDelete runs the BeforeDelete hooks of T on the entity with 'key'. When T has
+// hooks, 'load' reads the stored item, or returns nil if it does not exist.
+func (c Codec[T]) BeforeDelete(ctx context.Context, key string, load func() (map[string]types.AttributeValue, error)) error {
+	if !datastore.HasBeforeDeleteWithRegistry[T](c.Registry) {
+		return nil
+	}
+	item, err := load()
+	if err != nil {
+		return err
+	}
+	var entity *T
+	if item != nil {
+		if entity, err = c.DecodeT(ctx, item); err != nil {
+			return err
+		}
+	}
+	return datastore.RunBeforeDeleteWithRegistry(ctx, c.Registry, key, entity)
+}
+
+// NotFound returns the NotFoundError for 'key'
+func (c Codec[T]) NotFound(key string) error {
+	return eserrors.NewNotFoundError(c.EntityType(), key)
+}
+
+// itemEntityType returns the EntityType of a raw item with aliases resolved like Decode
+// does, or the entity type name of T when it has none
+func (c Codec[T]) itemEntityType(item map[string]types.AttributeValue) string {
+	if attr, ok := item["EntityType"].(*types.AttributeValueMemberS); ok {
+		return c.registry().ResolveEntityTypeFor(reflect.TypeOf((*T)(nil)).Elem(), attr.Value)
+	}
+	return c.EntityType()
+}
+
+// DecodeT upgrades a raw item to the current schema version and unmarshals it into a
+// T, running the AfterLoad hooks
+func (c Codec[T]) DecodeT(ctx context.Context, item map[string]types.AttributeValue) (*T, error) {
+	item, _, err := c.registry().Upcast(c.itemEntityType(item), item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upcast item: %w", err)
+	}
+	item = Copy(item)
+	delete(item, "EntityType")
+
+	result := new(T)
+	if err := attributevalue.UnmarshalMap(item, result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+	if err := datastore.RunAfterLoadWithRegistry(ctx, c.Registry, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Decode converts a raw query result into the type registered for its EntityType, or
+// into a generic map when none is, like ddb's Query
+func (c Codec[T]) Decode(ctx context.Context, item map[string]types.AttributeValue) (any, error) {
+	attr, ok := item["EntityType"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, fmt.Errorf("missing EntityType attribute in item")
+	}
+	entityType := c.registry().ResolveEntityTypeFor(reflect.TypeOf((*T)(nil)).Elem(), attr.Value)
+
+	item, _, err := c.registry().Upcast(entityType, item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upcast item for EntityType %q: %w", entityType, err)
+	}
+
+	unmarshalFn, err := c.registry().GetUnmarshalFunc(entityType)
+	if err != nil {
+		var generic map[string]interface{}
+		if err := attributevalue.UnmarshalMap(item, &generic); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal generic item: %w", err)
+		}
+		return generic, nil
+	}
+	obj, err := unmarshalFn(item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal item for EntityType %q: %w", entityType, err)
+	}
+	if err := datastore.RunAfterLoadAnyWithRegistry(ctx, c.Registry, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// StreamResult converts a raw item into a stream result of type T like ddb's Stream:
+// the item is unmarshaled into a T, or else with the unmarshal function registered for
+// its EntityType when that yields a T
+func (c Codec[T]) StreamResult(ctx context.Context, item map[string]types.AttributeValue, index int64, pageNumber int) storagemodels.StreamResult[T] {
+	result := storagemodels.StreamResult[T]{
+		Raw: Copy(item),
+		Meta: storagemodels.StreamMeta{
+			Index:      index,
+			PageNumber: pageNumber,
+			Timestamp:  time.Now(),
+		},
+	}
+
+	entityType := c.itemEntityType(item)
+	item, _, err := c.registry().Upcast(entityType, item)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to upcast item: %w", err)
+		return result
+	}
+	item = Copy(item)
+	delete(item, "EntityType")
+
+	if err := attributevalue.UnmarshalMap(item, &result.Item); err == nil {
+		result.Error = datastore.RunAfterLoadWithRegistry(ctx, c.Registry, &result.Item)
+		return result
+	}
+
+	if unmarshalFn, err := c.registry().GetUnmarshalFunc(entityType); err == nil {
+		if obj, err := unmarshalFn(item); err == nil {
+			if typed, ok := obj.(T); ok {
+				result.Item = typed
+				result.Error = datastore.RunAfterLoadAnyWithRegistry(ctx, c.Registry, obj)
+				return result
+			}
+		}
+	}
+	result.Error = fmt.Errorf("failed to unmarshal item to type %T", result.Item)
+	return result
+}
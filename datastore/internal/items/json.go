@@ -0,0 +1,172 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package items
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MarshalJSON encodes a raw item in the DynamoDB JSON format, e.g.
+// {"PK":{"S":"USER#1"},"Age":{"N":"42"}}, so that it can be stored without losing
+// attribute types
+func MarshalJSON(item map[string]types.AttributeValue) ([]byte, error) {
+	doc := make(map[string]any, len(item))
+	for name, av := range item {
+		v, err := toJSON(av)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		doc[name] = v
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON decodes an item encoded with MarshalJSON
+func UnmarshalJSON(data []byte) (map[string]types.AttributeValue, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode item: %w", err)
+	}
+	item := make(map[string]types.AttributeValue, len(doc))
+	for name, raw := range doc {
+		av, err := fromJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", name, err)
+		}
+		item[name] = av
+	}
+	return item, nil
+}
+
+// MarshalValue encodes a single attribute value in the DynamoDB JSON format, e.g.
+// {"S":"USER#1"}, as a value for encoding/json
+func MarshalValue(av types.AttributeValue) (any, error) {
+	return toJSON(av)
+}
+
+// UnmarshalValue decodes a single attribute value in the DynamoDB JSON format
+func UnmarshalValue(data []byte) (types.AttributeValue, error) {
+	return fromJSON(data)
+}
+
+func toJSON(av types.AttributeValue) (map[string]any, error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]any{"S": v.Value}, nil
+	case *types.AttributeValueMemberN:
+		return map[string]any{"N": v.Value}, nil
+	case *types.AttributeValueMemberB:
+		return map[string]any{"B": v.Value}, nil
+	case *types.AttributeValueMemberBOOL:
+		return map[string]any{"BOOL": v.Value}, nil
+	case *types.AttributeValueMemberNULL:
+		return map[string]any{"NULL": true}, nil
+	case *types.AttributeValueMemberSS:
+		return map[string]any{"SS": v.Value}, nil
+	case *types.AttributeValueMemberNS:
+		return map[string]any{"NS": v.Value}, nil
+	case *types.AttributeValueMemberBS:
+		return map[string]any{"BS": v.Value}, nil
+	case *types.AttributeValueMemberL:
+		list := make([]any, len(v.Value))
+		for i, e := range v.Value {
+			ev, err := toJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = ev
+		}
+		return map[string]any{"L": list}, nil
+	case *types.AttributeValueMemberM:
+		m := make(map[string]any, len(v.Value))
+		for k, e := range v.Value {
+			ev, err := toJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = ev
+		}
+		return map[string]any{"M": m}, nil
+	}
+	return nil, fmt.Errorf("unsupported attribute value %T", av)
+}
+
+func fromJSON(raw json.RawMessage) (types.AttributeValue, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		return nil, err
+	}
+	if len(typed) != 1 {
+		return nil, fmt.Errorf("attribute value must have exactly one type, got %d", len(typed))
+	}
+	for typ, value := range typed {
+		switch typ {
+		case "S":
+			var s string
+			err := json.Unmarshal(value, &s)
+			return &types.AttributeValueMemberS{Value: s}, err
+		case "N":
+			var n string
+			err := json.Unmarshal(value, &n)
+			return &types.AttributeValueMemberN{Value: n}, err
+		case "B":
+			var b []byte
+			err := json.Unmarshal(value, &b)
+			return &types.AttributeValueMemberB{Value: b}, err
+		case "BOOL":
+			var b bool
+			err := json.Unmarshal(value, &b)
+			return &types.AttributeValueMemberBOOL{Value: b}, err
+		case "NULL":
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		case "SS":
+			var ss []string
+			err := json.Unmarshal(value, &ss)
+			return &types.AttributeValueMemberSS{Value: ss}, err
+		case "NS":
+			var ns []string
+			err := json.Unmarshal(value, &ns)
+			return &types.AttributeValueMemberNS{Value: ns}, err
+		case "BS":
+			var bs [][]byte
+			err := json.Unmarshal(value, &bs)
+			return &types.AttributeValueMemberBS{Value: bs}, err
+		case "L":
+			var raws []json.RawMessage
+			if err := json.Unmarshal(value, &raws); err != nil {
+				return nil, err
+			}
+			list := make([]types.AttributeValue, len(raws))
+			for i, r := range raws {
+				e, err := fromJSON(r)
+				if err != nil {
+					return nil, err
+				}
+				list[i] = e
+			}
+			return &types.AttributeValueMemberL{Value: list}, nil
+		case "M":
+			var raws map[string]json.RawMessage
+			if err := json.Unmarshal(value, &raws); err != nil {
+				return nil, err
+			}
+			m := make(map[string]types.AttributeValue, len(raws))
+			for k, r := range raws {
+				e, err := fromJSON(r)
+				if err != nil {
+					return nil, err
+				}
+				m[k] = e
+			}
+			return &types.AttributeValueMemberM{Value: m}, nil
+		default:
+			return nil, fmt.Errorf("unknown attribute type %q", typ)
+		}
+	}
+	return nil, nil
+}
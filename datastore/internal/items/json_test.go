@@ -0,0 +1,43 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package items
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"S":    &types.AttributeValueMemberS{Value: "text"},
+		"N":    &types.AttributeValueMemberN{Value: "12.5"},
+		"B":    &types.AttributeValueMemberB{Value: []byte{0, 1, 2}},
+		"BOOL": &types.AttributeValueMemberBOOL{Value: true},
+		"NULL": &types.AttributeValueMemberNULL{Value: true},
+		"SS":   &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"NS":   &types.AttributeValueMemberNS{Value: []string{"1", "2"}},
+		"BS":   &types.AttributeValueMemberBS{Value: [][]byte{{1}, {2}}},
+		"L": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "x"},
+			&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+				"nested": &types.AttributeValueMemberN{Value: "1"},
+			}},
+		}},
+	}
+
+	data, err := MarshalJSON(item)
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	got, err := UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, item) {
+		t.Errorf("round trip = %#v, want %#v", got, item)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package items
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/expression"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// Query is a parsed QueryParams
+type Query struct {
+	Index Index
+	// PartitionValue is the partition key value
+	PartitionValue string
+	// SortKey is the sort key condition, nil when there is none
+	SortKey *expression.SortKeyCondition
+	// Filter is applied to the items read, nil when there is none
+	Filter expression.Condition
+	// Forward is the sort key order
+	Forward bool
+	// Limit caps the number of items read, before filtering; 0 means no limit
+	Limit int
+	// StartKey is the ExclusiveStartKey: reading resumes after this item
+	StartKey map[string]types.AttributeValue
+}
+
+// PlanQuery parses the key condition and filter expressions of 'params' for the table
+// or the GSI named by params.IndexName. Key values must be strings, as the key
+// attributes written from index maps are.
+func (c Codec[T]) PlanQuery(params *storagemodels.QueryParams) (Query, error) {
+	if params == nil {
+		return Query{}, fmt.Errorf("query parameters are required")
+	}
+	index, ok := c.Index(aws.ToString(params.IndexName))
+	if !ok {
+		return Query{}, fmt.Errorf("GSI configuration not found for index %s", aws.ToString(params.IndexName))
+	}
+
+	kc, err := expression.ParseKeyCondition(params.KeyConditionExpression, nil, params.ExpressionAttributeValues, index.PartitionKey, index.SortKey)
+	if err != nil {
+		return Query{}, err
+	}
+	pk, ok := kc.PartitionValue.(*types.AttributeValueMemberS)
+	if !ok {
+		return Query{}, fmt.Errorf("partition key value of %s must be a string", index.PartitionKey)
+	}
+	if kc.SortKey != nil {
+		for _, v := range kc.SortKey.Values {
+			if _, ok := v.(*types.AttributeValueMemberS); !ok {
+				return Query{}, fmt.Errorf("sort key value of %s must be a string", index.SortKey)
+			}
+		}
+	}
+
+	q := Query{
+		Index:          index,
+		PartitionValue: pk.Value,
+		SortKey:        kc.SortKey,
+		Forward:        params.ScanIndexForward == nil || *params.ScanIndexForward,
+		StartKey:       params.ExclusiveStartKey,
+	}
+	if params.FilterExpression != nil && *params.FilterExpression != "" {
+		if q.Filter, err = expression.Parse(*params.FilterExpression, nil, params.ExpressionAttributeValues); err != nil {
+			return Query{}, fmt.Errorf("invalid filter expression: %w", err)
+		}
+	}
+	if params.Limit != nil && *params.Limit > 0 {
+		q.Limit = int(*params.Limit)
+	}
+	return q, nil
+}
+
+// SortValues returns the sort key condition values as strings
+func (q Query) SortValues() []string {
+	if q.SortKey == nil {
+		return nil
+	}
+	values := make([]string, len(q.SortKey.Values))
+	for i, v := range q.SortKey.Values {
+		values[i] = v.(*types.AttributeValueMemberS).Value
+	}
+	return values
+}
+
+// Matches reports whether a stored item satisfies the filter
+func (q Query) Matches(item map[string]types.AttributeValue) (bool, error) {
+	if q.Filter == nil {
+		return true, nil
+	}
+	return expression.Evaluate(q.Filter, item)
+}
+
+// LastKey returns the LastEvaluatedKey for 'item': its table key, and its index key
+// when querying a GSI
+func (q Query) LastKey(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{"PK": item["PK"], "SK": item["SK"]}
+	if q.Index.Name != "" {
+		for _, attr := range []string{q.Index.PartitionKey, q.Index.SortKey} {
+			if v, ok := item[attr]; ok {
+				key[attr] = v
+			}
+		}
+	}
+	return key
+}
+
+// Position is a position in the order of an index: the index sort key, then the table
+// key to order items with equal index sort keys
+type Position struct {
+	SortKey string
+	Key     Key
+}
+
+// PositionOf returns the position of 'item' in the index of the query
+func (q Query) PositionOf(item map[string]types.AttributeValue) Position {
+	return Position{SortKey: StringAttr(item, q.Index.SortKey), Key: KeyOf(item)}
+}
+
+// Start returns the position of the ExclusiveStartKey, reporting false without one
+func (q Query) Start() (Position, bool) {
+	if len(q.StartKey) == 0 {
+		return Position{}, false
+	}
+	return q.PositionOf(q.StartKey), true
+}
+
+// Compare orders two positions
+func (p Position) Compare(o Position) int {
+	switch {
+	case p.SortKey != o.SortKey:
+		return strings.Compare(p.SortKey, o.SortKey)
+	case p.Key.PK != o.Key.PK:
+		return strings.Compare(p.Key.PK, o.Key.PK)
+	default:
+		return strings.Compare(p.Key.SK, o.Key.SK)
+	}
+}
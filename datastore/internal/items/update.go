@@ -0,0 +1,140 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package items
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore"
+	"github.com/suparena/entitystore/datastore/internal/expression"
+	eserrors "github.com/suparena/entitystore/errors"
+)
+
+// Update is an UpdateWithCondition call prepared for storage
+type Update struct {
+	Key Key
+	// Set holds the new values by attribute name
+	Set map[string]types.AttributeValue
+	// VersionAttribute, when set, is incremented by one
+	VersionAttribute string
+	// Condition is nil when the update is unconditional
+	Condition     expression.Condition
+	conditionText string
+}
+
+// PrepareUpdate resolves the key, the updated attributes and the condition of an
+// UpdateWithCondition call like the ddb store: field names are resolved to attribute
+// names, @UpdatedAt is set and @Version incremented unless updated explicitly. The
+// condition may use the placeholders of the ddb update expression, #f0/:v0 for the
+// first update in field name order and so on, as well as #updatedAt and #version.
+func (c Codec[T]) PrepareUpdate(keyInput any, updates map[string]interface{}, condition string) (Update, error) {
+	if len(updates) == 0 {
+		return Update{}, fmt.Errorf("failed to build update expression: no updates provided")
+	}
+	indexMap, err := c.IndexMap()
+	if err != nil {
+		return Update{}, err
+	}
+	key, err := c.TableKey(keyInput)
+	if err != nil {
+		return Update{}, fmt.Errorf("failed to build key: %w", err)
+	}
+
+	u := Update{Key: key, Set: make(map[string]types.AttributeValue, len(updates)+1), conditionText: condition}
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	entityType := entityGoType[T]()
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for i, field := range fields {
+		val := updates[field]
+		attr := field
+		if entityType.Kind() == reflect.Struct {
+			if attr, err = c.fields().Attribute(entityType, field); err != nil {
+				return Update{}, fmt.Errorf("failed to build update expression: update field: %w", err)
+			}
+		}
+		av, err := attributevalue.Marshal(val)
+		if err != nil {
+			return Update{}, fmt.Errorf("failed to build update expression: failed to marshal update value for field '%s': %w", field, err)
+		}
+		u.Set[attr] = av
+		names[fmt.Sprintf("#f%d", i)] = attr
+		values[fmt.Sprintf(":v%d", i)] = av
+	}
+
+	lifecycle, err := c.lifecycle(indexMap)
+	if err != nil {
+		return Update{}, err
+	}
+	if _, updated := u.Set[lifecycle.UpdatedAt]; lifecycle.UpdatedAt != "" && !updated {
+		now, err := datastore.TimeValue(entityType, lifecycle.UpdatedAt, time.Now().UTC())
+		if err != nil {
+			return Update{}, err
+		}
+		if u.Set[lifecycle.UpdatedAt], err = attributevalue.Marshal(now); err != nil {
+			return Update{}, fmt.Errorf("failed to marshal %s: %w", lifecycle.UpdatedAt, err)
+		}
+		names["#updatedAt"] = lifecycle.UpdatedAt
+		values[":updatedAt"] = u.Set[lifecycle.UpdatedAt]
+	}
+	if _, updated := u.Set[lifecycle.Version]; lifecycle.Version != "" && !updated {
+		u.VersionAttribute = lifecycle.Version
+		names["#version"] = lifecycle.Version
+	}
+
+	if condition != "" {
+		if u.Condition, err = expression.Parse(condition, names, values); err != nil {
+			return Update{}, fmt.Errorf("invalid condition: %w", err)
+		}
+	}
+	return u, nil
+}
+
+// Apply checks the condition against the stored item, nil when there is none, and
+// returns the updated item. Like DynamoDB's UpdateItem, an update of a missing item
+// creates it from the key. A failed condition is a ConditionFailedError.
+func (u Update) Apply(existing map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	if u.Condition != nil {
+		ok, err := expression.Evaluate(u.Condition, existing)
+		if err != nil {
+			return nil, fmt.Errorf("UpdateWithCondition failed: %w", err)
+		}
+		if !ok {
+			return nil, eserrors.NewConditionFailedError("update", u.conditionText)
+		}
+	}
+
+	item := Copy(existing)
+	if item == nil {
+		item = map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: u.Key.PK},
+			"SK": &types.AttributeValueMemberS{Value: u.Key.SK},
+		}
+	}
+	for attr, v := range u.Set {
+		item[attr] = v
+	}
+	if u.VersionAttribute != "" {
+		var version int64
+		if n, ok := item[u.VersionAttribute].(*types.AttributeValueMemberN); ok {
+			var err error
+			if version, err = strconv.ParseInt(n.Value, 10, 64); err != nil {
+				return nil, fmt.Errorf("UpdateWithCondition failed: invalid %s %q: %w", u.VersionAttribute, n.Value, err)
+			}
+		}
+		item[u.VersionAttribute] = &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)}
+	}
+	return item, nil
+}
@@ -0,0 +1,327 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+// Package keys resolves the field names used by key template macros, update maps and
+// lifecycle directives to struct fields, so that every part of a datastore agrees on
+// which field a name refers to
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	// ErrFieldNotFound is returned when no field matches a name
+	ErrFieldNotFound = errors.New("field not found")
+	// ErrAmbiguousField is returned when several fields match a name
+	ErrAmbiguousField = errors.New("ambiguous field")
+	// ErrEmptyKeyField is returned when a macro of a table key template is nil or ""
+	ErrEmptyKeyField = errors.New("empty key field")
+)
+
+// MacroPattern matches the {Field} macros of a key template
+var MacroPattern = regexp.MustCompile(`{([^}]+)}`)
+
+// Field is an exported struct field, including fields promoted from embedded structs
+type Field struct {
+	Name      string       // Go field name
+	Attribute string       // Stored attribute name: the dynamodbav tag name, or the Go name
+	JSONName  string       // json tag name, if any
+	Index     []int        // Index sequence for reflect.Value.FieldByIndex
+	Type      reflect.Type // Field type
+}
+
+// Resolver matches names to struct fields. A name matches a field by Go field name or
+// dynamodbav tag name, and by json tag name when the resolver is created with
+// WithJSONTags. Among promoted fields the least nested matches win, like Go selectors.
+// A Resolver caches the fields of each struct type and is safe for concurrent use.
+type Resolver struct {
+	jsonTags       bool
+	emptyKeyFields bool
+	cache          sync.Map // reflect.Type -> []Field
+}
+
+// Option configures a Resolver
+type Option func(*Resolver)
+
+// WithJSONTags makes json tag names match as well, for models whose schema names differ
+// from their Go field names, such as a field ID tagged json:"Id"
+func WithJSONTags() Option {
+	return func(r *Resolver) {
+		r.jsonTags = true
+	}
+}
+
+// WithEmptyKeyFields makes ExpandKey expand nil and empty fields to empty key segments,
+// as Expand does, for models whose keys legitimately contain them
+func WithEmptyKeyFields() Option {
+	return func(r *Resolver) {
+		r.emptyKeyFields = true
+	}
+}
+
+// NewResolver creates a Resolver
+func NewResolver(opts ...Option) *Resolver {
+	r := &Resolver{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+var defaultResolver = NewResolver()
+
+// Default returns the resolver matching Go field names and dynamodbav tag names
+func Default() *Resolver {
+	return defaultResolver
+}
+
+// OrDefault returns 'r', or Default() when 'r' is nil
+func OrDefault(r *Resolver) *Resolver {
+	if r == nil {
+		return defaultResolver
+	}
+	return r
+}
+
+// Fields returns the exported fields of struct type 't', or of the struct 't' points to
+func (r *Resolver) Fields(t reflect.Type) []Field {
+	t = structType(t)
+	if t == nil {
+		return nil
+	}
+	if cached, ok := r.cache.Load(t); ok {
+		return cached.([]Field)
+	}
+	var fields []Field
+	collectFields(t, nil, map[reflect.Type]bool{t: true}, &fields)
+	r.cache.Store(t, fields)
+	return fields
+}
+
+// Resolve returns the field of 't' that 'name' refers to. It fails with ErrFieldNotFound
+// or ErrAmbiguousField.
+func (r *Resolver) Resolve(t reflect.Type, name string) (Field, error) {
+	st := structType(t)
+	if st == nil {
+		return Field{}, fmt.Errorf("cannot resolve %q: %s is not a struct", name, t)
+	}
+
+	var matches []Field
+	for _, f := range r.Fields(st) {
+		if !r.matches(f, name) {
+			continue
+		}
+		if len(matches) > 0 && len(f.Index) > len(matches[0].Index) {
+			continue
+		}
+		if len(matches) > 0 && len(f.Index) < len(matches[0].Index) {
+			matches = matches[:0]
+		}
+		matches = append(matches, f)
+	}
+
+	switch len(matches) {
+	case 0:
+		return Field{}, fmt.Errorf("%w: %q in %s", ErrFieldNotFound, name, st)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, f := range matches {
+			names[i] = f.Name
+		}
+		return Field{}, fmt.Errorf("%w: %q matches fields %s of %s", ErrAmbiguousField, name, strings.Join(names, ", "), st)
+	}
+}
+
+// Attribute returns the stored attribute name of the field of 't' that 'name' refers to
+func (r *Resolver) Attribute(t reflect.Type, name string) (string, error) {
+	f, err := r.Resolve(t, name)
+	if err != nil {
+		return "", err
+	}
+	return f.Attribute, nil
+}
+
+// Value returns the value of the field 'name' of struct 'v', which may be a pointer.
+// It reports false when the field is behind a nil embedded pointer.
+func (r *Resolver) Value(v reflect.Value, name string) (reflect.Value, bool, error) {
+	f, err := r.Resolve(v.Type(), name)
+	if err != nil {
+		return reflect.Value{}, false, err
+	}
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return reflect.Value{}, false, nil
+	}
+	fv, err := v.FieldByIndexErr(f.Index)
+	if err != nil {
+		return reflect.Value{}, false, nil
+	}
+	return fv, true, nil
+}
+
+// Expand replaces the macros of 'template' with the fields of 'input', a struct or a
+// pointer to one, or with the entries of a map keyed by name. Values are formatted as
+// they are stored; nil pointers expand to "", see ExpandKey for table keys. Unknown and
+// ambiguous names are errors.
+func (r *Resolver) Expand(template string, input any) (string, error) {
+	return r.expand(template, input, true)
+}
+
+// ExpandKey expands a PK or SK template like Expand, but fails with ErrEmptyKeyField
+// when a macro is nil or "", unless the resolver is created with WithEmptyKeyFields:
+// USER#{ID} expanded with a nil ID would give every such entity the key USER#.
+func (r *Resolver) ExpandKey(template string, input any) (string, error) {
+	return r.expand(template, input, r.emptyKeyFields)
+}
+
+func (r *Resolver) expand(template string, input any, allowEmpty bool) (string, error) {
+	v := reflect.ValueOf(input)
+	var expandErr error
+	expanded := MacroPattern.ReplaceAllStringFunc(template, func(macro string) string {
+		if expandErr != nil {
+			return ""
+		}
+		name := strings.Trim(macro, "{}")
+		fv, ok, err := r.lookup(v, name)
+		if err != nil {
+			expandErr = err
+			return ""
+		}
+		var s string
+		if ok {
+			if s, err = Format(fv); err != nil {
+				expandErr = fmt.Errorf("macro %s: %w", macro, err)
+				return ""
+			}
+		}
+		if s == "" && !allowEmpty {
+			expandErr = fmt.Errorf("%w: macro %s", ErrEmptyKeyField, macro)
+		}
+		return s
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
+
+// lookup finds 'name' in a struct or a map with string keys
+func (r *Resolver) lookup(v reflect.Value, name string) (reflect.Value, bool, error) {
+	iv := reflect.Indirect(v)
+	if iv.Kind() == reflect.Map && iv.Type().Key().Kind() == reflect.String {
+		mv := iv.MapIndex(reflect.ValueOf(name).Convert(iv.Type().Key()))
+		if !mv.IsValid() {
+			return reflect.Value{}, false, fmt.Errorf("%w: %q in key values", ErrFieldNotFound, name)
+		}
+		return mv, true, nil
+	}
+	return r.Value(v, name)
+}
+
+// Format converts a key field value into its key string, the same way the value is
+// marshaled when the entity is stored: pointers are dereferenced, strings and numbers
+// are used as is, and time types use their attribute value string form. Nil values
+// format as "". Lists, maps, sets and binary values cannot be used in keys.
+func Format(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "", nil
+	}
+	av, err := attributevalue.Marshal(v.Interface())
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s: %w", v.Type(), err)
+	}
+	switch tv := av.(type) {
+	case *types.AttributeValueMemberS:
+		return tv.Value, nil
+	case *types.AttributeValueMemberN:
+		return tv.Value, nil
+	case *types.AttributeValueMemberBOOL:
+		return fmt.Sprintf("%v", tv.Value), nil
+	case *types.AttributeValueMemberNULL:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported key type %s", v.Type())
+	}
+}
+
+func (r *Resolver) matches(f Field, name string) bool {
+	return f.Name == name || f.Attribute == name || (r.jsonTags && f.JSONName == name)
+}
+
+// collectFields appends the fields of 't' in declaration order, descending into
+// embedded structs without a dynamodbav name
+func collectFields(t reflect.Type, index []int, visiting map[reflect.Type]bool, fields *[]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		attr := tagName(sf.Tag.Get("dynamodbav"))
+		if attr == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		if sf.Anonymous && attr == "" {
+			et := sf.Type
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct && !visiting[et] {
+				visiting[et] = true
+				collectFields(et, fieldIndex, visiting, fields)
+				delete(visiting, et)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if attr == "" {
+			attr = sf.Name
+		}
+		jsonName := tagName(sf.Tag.Get("json"))
+		if jsonName == "-" {
+			jsonName = ""
+		}
+		*fields = append(*fields, Field{
+			Name:      sf.Name,
+			Attribute: attr,
+			JSONName:  jsonName,
+			Index:     fieldIndex,
+			Type:      sf.Type,
+		})
+	}
+}
+
+func tagName(tag string) string {
+	return strings.Split(tag, ",")[0]
+}
+
+func structType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package keys
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+)
+
+type Audit struct {
+	CreatedAt *strfmt.DateTime `json:"createdAt"`
+	Owner     string
+}
+
+type Document struct {
+	Audit
+	ID      *string `json:"Id"`
+	Title   string  `dynamodbav:"title" json:"name"`
+	Owner   string  `dynamodbav:"owner_id"`
+	Ignored string  `dynamodbav:"-"`
+	Tags    []string
+	count   int
+}
+
+type Ambiguous struct {
+	Name  string
+	Label string `dynamodbav:"Name"`
+}
+
+func TestResolve(t *testing.T) {
+	docType := reflect.TypeOf(Document{})
+	r := Default()
+
+	tests := []struct {
+		name, attr string
+	}{
+		{"ID", "ID"},
+		{"Title", "title"},
+		{"title", "title"},
+		{"CreatedAt", "CreatedAt"},
+		// The field of Document shadows the promoted Audit.Owner
+		{"Owner", "owner_id"},
+		{"owner_id", "owner_id"},
+	}
+	for _, tt := range tests {
+		attr, err := r.Attribute(docType, tt.name)
+		if err != nil || attr != tt.attr {
+			t.Errorf("Attribute(%q) = %q, %v, want %q", tt.name, attr, err, tt.attr)
+		}
+	}
+
+	for _, name := range []string{"Id", "name", "createdAt", "Ignored", "count", "Missing"} {
+		if _, err := r.Resolve(docType, name); !errors.Is(err, ErrFieldNotFound) {
+			t.Errorf("Resolve(%q) = %v, want ErrFieldNotFound", name, err)
+		}
+	}
+
+	jsonResolver := NewResolver(WithJSONTags())
+	for name, attr := range map[string]string{"Id": "ID", "name": "title", "createdAt": "CreatedAt", "ID": "ID"} {
+		if got, err := jsonResolver.Attribute(reflect.PointerTo(docType), name); err != nil || got != attr {
+			t.Errorf("json Attribute(%q) = %q, %v, want %q", name, got, err, attr)
+		}
+	}
+
+	if _, err := r.Resolve(reflect.TypeOf(Ambiguous{}), "Name"); !errors.Is(err, ErrAmbiguousField) {
+		t.Errorf("Resolve(Name) = %v, want ErrAmbiguousField", err)
+	}
+	if _, err := r.Resolve(reflect.TypeOf(""), "Name"); err == nil {
+		t.Error("expected an error resolving in a non-struct type")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	id := "42"
+	created := strfmt.DateTime(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	doc := Document{ID: &id, Title: "Report", Audit: Audit{CreatedAt: &created}}
+
+	got, err := Default().Expand("DOC#{ID}#{title}#{CreatedAt}", &doc)
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+	if want := "DOC#42#Report#2025-01-02T03:04:05Z"; got != want {
+		t.Errorf("Expand = %q, want %q", got, want)
+	}
+
+	got, err = Default().Expand("DOC#{ID}#{CreatedAt}", Document{})
+	if err != nil || got != "DOC##" {
+		t.Errorf("Expand with nil pointers = %q, %v", got, err)
+	}
+
+	got, err = NewResolver(WithJSONTags()).Expand("DOC#{Id}", doc)
+	if err != nil || got != "DOC#42" {
+		t.Errorf("Expand with json names = %q, %v", got, err)
+	}
+
+	got, err = Default().Expand("ORG#{Org}#{N}", map[string]any{"Org": "acme", "N": 7})
+	if err != nil || got != "ORG#acme#7" {
+		t.Errorf("Expand with a map = %q, %v", got, err)
+	}
+
+	if _, err := Default().Expand("DOC#{Id}", doc); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("Expand of an unknown field = %v, want ErrFieldNotFound", err)
+	}
+	if _, err := Default().Expand("{Missing}", map[string]any{}); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("Expand of a missing map entry = %v, want ErrFieldNotFound", err)
+	}
+	if _, err := Default().Expand("{Tags}", Document{Tags: []string{"a"}}); err == nil {
+		t.Error("expected an error expanding a list field")
+	}
+}
+
+func TestExpandKey(t *testing.T) {
+	id := "42"
+	if got, err := Default().ExpandKey("DOC#{ID}", Document{ID: &id}); err != nil || got != "DOC#42" {
+		t.Errorf("ExpandKey = %q, %v", got, err)
+	}
+	for name, input := range map[string]any{
+		"nil pointer":     Document{},
+		"empty string":    Document{ID: new(string)},
+		"nil map value":   map[string]any{"ID": nil},
+		"empty map value": map[string]any{"ID": ""},
+	} {
+		if got, err := Default().ExpandKey("DOC#{ID}", input); !errors.Is(err, ErrEmptyKeyField) {
+			t.Errorf("ExpandKey with a %s = %q, %v, want ErrEmptyKeyField", name, got, err)
+		}
+	}
+
+	got, err := NewResolver(WithEmptyKeyFields()).ExpandKey("DOC#{ID}", Document{})
+	if err != nil || got != "DOC#" {
+		t.Errorf("ExpandKey allowing empty fields = %q, %v", got, err)
+	}
+}
+
+func TestValueThroughNilEmbeddedPointer(t *testing.T) {
+	type Outer struct {
+		*Audit
+		ID string
+	}
+	_, ok, err := Default().Value(reflect.ValueOf(Outer{}), "Owner")
+	if err != nil || ok {
+		t.Errorf("Value = %v, %v, want not ok without error", ok, err)
+	}
+	if got, err := Default().Expand("{ID}#{Owner}", Outer{ID: "1"}); err != nil || got != "1#" {
+		t.Errorf("Expand = %q, %v", got, err)
+	}
+}
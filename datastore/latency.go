@@ -0,0 +1,135 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyObserver receives the duration of DataStore calls, e.g. to feed the histogram
+// of a metrics library
+type LatencyObserver interface {
+	ObserveLatency(operation string, d time.Duration, err error)
+}
+
+// LatencyObserverFunc adapts a function to a LatencyObserver
+type LatencyObserverFunc func(operation string, d time.Duration, err error)
+
+// ObserveLatency calls f
+func (f LatencyObserverFunc) ObserveLatency(operation string, d time.Duration, err error) {
+	f(operation, d, err)
+}
+
+// Latency reports the duration of every call to 'observer'. Streams are reported when
+// they end.
+func Latency[T any](observer LatencyObserver) Middleware[T] {
+	return func(next Handler[T]) Handler[T] {
+		return func(ctx context.Context, call *Call[T]) (Result[T], error) {
+			start := time.Now()
+			res, err := next(ctx, call)
+			if err == nil && res.Stream != nil {
+				res.Stream = ObserveStream(ctx, res.Stream, func(_ int64, err error) {
+					observer.ObserveLatency(call.Operation, time.Since(start), err)
+				})
+				return res, nil
+			}
+			observer.ObserveLatency(call.Operation, time.Since(start), err)
+			return res, err
+		}
+	}
+}
+
+// DefaultLatencyBuckets are the upper bounds of the buckets of NewLatencyHistogram
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// LatencyHistogram is an in-memory LatencyObserver counting call durations in buckets
+// per operation
+type LatencyHistogram struct {
+	buckets []time.Duration
+
+	mu         sync.Mutex
+	operations map[string]*HistogramSnapshot
+}
+
+// HistogramSnapshot is the state of the histogram of an operation
+type HistogramSnapshot struct {
+	// Buckets are the upper bounds of the buckets
+	Buckets []time.Duration
+	// Counts are the numbers of calls per bucket, not cumulative; the last count is
+	// the calls slower than the last bucket
+	Counts []uint64
+	Count  uint64
+	Errors uint64
+	Sum    time.Duration
+}
+
+// NewLatencyHistogram returns a histogram with buckets bounded by 'buckets', or by
+// DefaultLatencyBuckets when none are given
+func NewLatencyHistogram(buckets ...time.Duration) *LatencyHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return &LatencyHistogram{buckets: buckets, operations: map[string]*HistogramSnapshot{}}
+}
+
+// ObserveLatency counts a call
+func (h *LatencyHistogram) ObserveLatency(operation string, d time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.operations[operation]
+	if !ok {
+		s = &HistogramSnapshot{Buckets: h.buckets, Counts: make([]uint64, len(h.buckets)+1)}
+		h.operations[operation] = s
+	}
+	s.Counts[sort.Search(len(h.buckets), func(i int) bool { return d <= h.buckets[i] })]++
+	s.Count++
+	s.Sum += d
+	if err != nil {
+		s.Errors++
+	}
+}
+
+// Snapshot returns the histogram of 'operation'
+func (h *LatencyHistogram) Snapshot(operation string) HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.operations[operation]
+	if !ok {
+		return HistogramSnapshot{Buckets: h.buckets, Counts: make([]uint64, len(h.buckets)+1)}
+	}
+	res := *s
+	res.Counts = append([]uint64(nil), s.Counts...)
+	return res
+}
+
+// Operations returns the operations observed so far, sorted
+func (h *LatencyHistogram) Operations() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := make([]string, 0, len(h.operations))
+	for op := range h.operations {
+		res = append(res, op)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/suparena/entitystore/datastore/keys"
+)
+
+// Index map directives. Keys starting with "@" are not key templates; they declare
+// attributes that are maintained automatically on writes:
+//
+//	"@CreatedAt": "CreatedAt"   // set on create, or on Put when still zero
+//	"@UpdatedAt": "UpdatedAt"   // set on every Put, Create and update
+//	"@Version":   "Version"     // optimistic locking counter, incremented on every write
+//	"@TTL":       "ExpiresAt"   // attribute receiving the expiry as epoch seconds
+//	"@TTLAfter":  "720h"        // expiry relative to now, or to @TTLFrom
+//	"@TTLFrom":   "EndsAt"      // time field the expiry is computed from
+//
+// Field names are resolved with a keys.Resolver: the Go field name or the dynamodbav tag
+// name, and the json tag name when enabled. See Lifecycle.Resolve.
+const (
+	DirectiveCreatedAt = "@CreatedAt"
+	DirectiveUpdatedAt = "@UpdatedAt"
+	DirectiveVersion   = "@Version"
+	DirectiveTTL       = "@TTL"
+	DirectiveTTLAfter  = "@TTLAfter"
+	DirectiveTTLFrom   = "@TTLFrom"
+)
+
+// IsDirective reports whether an index map key is a directive rather than a key template
+func IsDirective(key string) bool {
+	return strings.HasPrefix(key, "@")
+}
+
+// Lifecycle describes the automatically maintained attributes of an entity type
+type Lifecycle struct {
+	CreatedAt    string        // Field holding the creation time
+	UpdatedAt    string        // Field holding the last modification time
+	Version      string        // Integer field used for optimistic locking
+	TTLAttribute string        // Attribute receiving the expiry in epoch seconds
+	TTLAfter     time.Duration // Lifetime added to now or to TTLFrom
+	TTLFrom      string        // Time field the expiry is based on
+}
+
+// ParseLifecycle extracts the directives from an index map
+func ParseLifecycle(indexMap map[string]string) (Lifecycle, error) {
+	var l Lifecycle
+	for key, value := range indexMap {
+		if !IsDirective(key) {
+			continue
+		}
+		switch key {
+		case DirectiveCreatedAt:
+			l.CreatedAt = value
+		case DirectiveUpdatedAt:
+			l.UpdatedAt = value
+		case DirectiveVersion:
+			l.Version = value
+		case DirectiveTTL:
+			l.TTLAttribute = value
+		case DirectiveTTLAfter:
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return Lifecycle{}, fmt.Errorf("invalid %s directive %q: %w", key, value, err)
+			}
+			l.TTLAfter = d
+		case DirectiveTTLFrom:
+			l.TTLFrom = value
+		default:
+			return Lifecycle{}, fmt.Errorf("unknown index map directive %q", key)
+		}
+	}
+
+	if l.TTLAttribute == "" && (l.TTLAfter != 0 || l.TTLFrom != "") {
+		return Lifecycle{}, fmt.Errorf("%s and %s require a %s directive", DirectiveTTLAfter, DirectiveTTLFrom, DirectiveTTL)
+	}
+	if l.TTLAttribute != "" && l.TTLAfter == 0 && l.TTLFrom == "" {
+		return Lifecycle{}, fmt.Errorf("%s requires %s or %s", DirectiveTTL, DirectiveTTLAfter, DirectiveTTLFrom)
+	}
+	return l, nil
+}
+
+// Resolve returns a copy of the lifecycle with its field names replaced by the attribute
+// names of the matching fields of struct type 'entityType', so that they can be used in
+// update and condition expressions. Missing and ambiguous fields are errors.
+func (l Lifecycle) Resolve(entityType reflect.Type, r *keys.Resolver) (Lifecycle, error) {
+	r = keys.OrDefault(r)
+	for _, field := range []*string{&l.CreatedAt, &l.UpdatedAt, &l.Version, &l.TTLFrom} {
+		if *field == "" {
+			continue
+		}
+		attr, err := r.Attribute(entityType, *field)
+		if err != nil {
+			return Lifecycle{}, fmt.Errorf("lifecycle field: %w", err)
+		}
+		*field = attr
+	}
+	return l, nil
+}
+
+// Stamp sets the timestamp fields and increments the version of 'entity', a pointer to a
+// struct that is about to be written. CreatedAt is only set when create is true or the
+// field is still zero. It returns the version the entity had before, which is the
+// version expected in storage.
+func (l Lifecycle) Stamp(entity any, now time.Time, create bool) (int64, error) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return 0, fmt.Errorf("lifecycle fields require a pointer to a struct, got %T", entity)
+	}
+	v = v.Elem()
+
+	if l.CreatedAt != "" {
+		f, err := lifecycleField(v, l.CreatedAt)
+		if err != nil {
+			return 0, err
+		}
+		if create || isZeroField(f) {
+			if err := setTime(f, now); err != nil {
+				return 0, fmt.Errorf("cannot set %s: %w", l.CreatedAt, err)
+			}
+		}
+	}
+
+	if l.UpdatedAt != "" {
+		f, err := lifecycleField(v, l.UpdatedAt)
+		if err != nil {
+			return 0, err
+		}
+		if err := setTime(f, now); err != nil {
+			return 0, fmt.Errorf("cannot set %s: %w", l.UpdatedAt, err)
+		}
+	}
+
+	var previous int64
+	if l.Version != "" {
+		f, err := lifecycleField(v, l.Version)
+		if err != nil {
+			return 0, err
+		}
+		if previous, err = getInt(f); err != nil {
+			return 0, fmt.Errorf("cannot read %s: %w", l.Version, err)
+		}
+		next := previous + 1
+		if create {
+			previous, next = 0, 1
+		}
+		if err := setInt(f, next); err != nil {
+			return 0, fmt.Errorf("cannot set %s: %w", l.Version, err)
+		}
+	}
+	return previous, nil
+}
+
+// ExpiresAt computes the TTL of 'entity', a pointer to a struct. It reports false when
+// no TTL is configured or the TTLFrom field is zero.
+func (l Lifecycle) ExpiresAt(entity any, now time.Time) (time.Time, bool, error) {
+	if l.TTLAttribute == "" {
+		return time.Time{}, false, nil
+	}
+	if l.TTLFrom == "" {
+		return now.Add(l.TTLAfter), true, nil
+	}
+
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return time.Time{}, false, fmt.Errorf("lifecycle fields require a pointer to a struct, got %T", entity)
+	}
+	f, err := lifecycleField(v.Elem(), l.TTLFrom)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	from, ok, err := getTime(f)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("cannot read %s: %w", l.TTLFrom, err)
+	}
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	return from.Add(l.TTLAfter), true, nil
+}
+
+// TimeValue returns 't' converted to the type of 'field' of struct type 'entityType',
+// with pointers dereferenced. It is used to build update expressions.
+func TimeValue(entityType reflect.Type, field string, t time.Time) (any, error) {
+	v := reflect.New(entityType).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("lifecycle fields require a struct type, got %s", entityType)
+	}
+	f, err := lifecycleField(v, field)
+	if err != nil {
+		return nil, err
+	}
+	if err := setTime(f, t); err != nil {
+		return nil, fmt.Errorf("cannot set %s: %w", field, err)
+	}
+	return reflect.Indirect(f).Interface(), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// lifecycleField finds the field 'name' refers to, by Go field name or attribute name
+func lifecycleField(v reflect.Value, name string) (reflect.Value, error) {
+	f, ok, err := keys.Default().Value(v, name)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("lifecycle field: %w", err)
+	}
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("lifecycle field %q is behind a nil embedded pointer in %s", name, v.Type())
+	}
+	return f, nil
+}
+
+func isZeroField(f reflect.Value) bool {
+	if f.Kind() == reflect.Ptr {
+		return f.IsNil() || f.Elem().IsZero()
+	}
+	return f.IsZero()
+}
+
+// setTime assigns 't' to time-like fields (time.Time and types based on it such as
+// strfmt.DateTime), RFC 3339 strings and epoch-second integers, or pointers to them
+func setTime(f reflect.Value, t time.Time) error {
+	if f.Kind() == reflect.Ptr {
+		// Always allocate so that values shared with the caller are not modified
+		f.Set(reflect.New(f.Type().Elem()))
+		f = f.Elem()
+	}
+	switch {
+	case timeType.ConvertibleTo(f.Type()) && f.Kind() == reflect.Struct:
+		f.Set(reflect.ValueOf(t).Convert(f.Type()))
+	case f.Kind() == reflect.String:
+		f.SetString(t.Format(time.RFC3339Nano))
+	case f.CanInt():
+		f.SetInt(t.Unix())
+	default:
+		return fmt.Errorf("unsupported timestamp type %s", f.Type())
+	}
+	return nil
+}
+
+func getTime(f reflect.Value) (time.Time, bool, error) {
+	if isZeroField(f) {
+		return time.Time{}, false, nil
+	}
+	f = reflect.Indirect(f)
+	switch {
+	case f.Type().ConvertibleTo(timeType) && f.Kind() == reflect.Struct:
+		return f.Convert(timeType).Interface().(time.Time), true, nil
+	case f.Kind() == reflect.String:
+		t, err := time.Parse(time.RFC3339Nano, f.String())
+		return t, err == nil, err
+	case f.CanInt():
+		return time.Unix(f.Int(), 0), true, nil
+	default:
+		return time.Time{}, false, fmt.Errorf("unsupported timestamp type %s", f.Type())
+	}
+}
+
+func getInt(f reflect.Value) (int64, error) {
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return 0, nil
+		}
+		f = f.Elem()
+	}
+	switch {
+	case f.CanInt():
+		return f.Int(), nil
+	case f.CanUint():
+		return int64(f.Uint()), nil
+	default:
+		return 0, fmt.Errorf("unsupported version type %s", f.Type())
+	}
+}
+
+func setInt(f reflect.Value, n int64) error {
+	if f.Kind() == reflect.Ptr {
+		// Always allocate so that values shared with the caller are not modified
+		f.Set(reflect.New(f.Type().Elem()))
+		f = f.Elem()
+	}
+	switch {
+	case f.CanInt():
+		f.SetInt(n)
+	case f.CanUint():
+		f.SetUint(uint64(n))
+	default:
+		return fmt.Errorf("unsupported version type %s", f.Type())
+	}
+	return nil
+}
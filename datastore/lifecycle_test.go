@@ -0,0 +1,123 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+)
+
+type lifecycleEntity struct {
+	ID        string
+	Created   *strfmt.DateTime `dynamodbav:"CreatedAt"`
+	UpdatedAt time.Time
+	Version   *int64
+	EndsAt    string
+}
+
+func TestParseLifecycle(t *testing.T) {
+	l, err := ParseLifecycle(map[string]string{
+		"PK":               "ITEM#{ID}",
+		DirectiveCreatedAt: "CreatedAt",
+		DirectiveTTL:       "ExpiresAt",
+		DirectiveTTLAfter:  "24h",
+	})
+	if err != nil {
+		t.Fatalf("ParseLifecycle failed: %v", err)
+	}
+	if l.CreatedAt != "CreatedAt" || l.TTLAttribute != "ExpiresAt" || l.TTLAfter != 24*time.Hour {
+		t.Errorf("unexpected lifecycle: %+v", l)
+	}
+
+	invalid := []map[string]string{
+		{"@Unknown": "x"},
+		{DirectiveTTL: "ExpiresAt", DirectiveTTLAfter: "soon"},
+		{DirectiveTTLAfter: "1h"},
+		{DirectiveTTL: "ExpiresAt"},
+	}
+	for _, m := range invalid {
+		if _, err := ParseLifecycle(m); err == nil {
+			t.Errorf("expected error for %v", m)
+		}
+	}
+}
+
+func TestLifecycleStamp(t *testing.T) {
+	l := Lifecycle{CreatedAt: "CreatedAt", UpdatedAt: "UpdatedAt", Version: "Version"}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	e := lifecycleEntity{ID: "1"}
+	previous, err := l.Stamp(&e, now, false)
+	if err != nil {
+		t.Fatalf("Stamp failed: %v", err)
+	}
+	if previous != 0 || *e.Version != 1 {
+		t.Errorf("expected version 0 -> 1, got %d -> %d", previous, *e.Version)
+	}
+	if e.Created == nil || !time.Time(*e.Created).Equal(now) || !e.UpdatedAt.Equal(now) {
+		t.Errorf("expected timestamps to be set, got %+v", e)
+	}
+
+	// A later Put keeps CreatedAt and does not modify the caller's values
+	shared := e.Created
+	later := now.Add(time.Hour)
+	previous, err = l.Stamp(&e, later, false)
+	if err != nil {
+		t.Fatalf("Stamp failed: %v", err)
+	}
+	if previous != 1 || *e.Version != 2 {
+		t.Errorf("expected version 1 -> 2, got %d -> %d", previous, *e.Version)
+	}
+	if !time.Time(*e.Created).Equal(now) || !e.UpdatedAt.Equal(later) {
+		t.Errorf("unexpected timestamps after update: %+v", e)
+	}
+
+	if _, err := l.Stamp(&e, later.Add(time.Hour), true); err != nil {
+		t.Fatalf("Stamp failed: %v", err)
+	}
+	if !time.Time(*shared).Equal(now) {
+		t.Error("Stamp modified a value shared with the caller")
+	}
+	if *e.Version != 1 {
+		t.Errorf("expected create to start at version 1, got %d", *e.Version)
+	}
+
+	if _, err := (Lifecycle{UpdatedAt: "Missing"}).Stamp(&e, now, false); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestLifecycleExpiresAt(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	l := Lifecycle{TTLAttribute: "ExpiresAt", TTLAfter: time.Hour}
+	exp, ok, err := l.ExpiresAt(&lifecycleEntity{}, now)
+	if err != nil || !ok || !exp.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected expiry %v %v %v", exp, ok, err)
+	}
+
+	l = Lifecycle{TTLAttribute: "ExpiresAt", TTLFrom: "EndsAt", TTLAfter: 24 * time.Hour}
+	if _, ok, _ := l.ExpiresAt(&lifecycleEntity{}, now); ok {
+		t.Error("expected no expiry while EndsAt is empty")
+	}
+	exp, ok, err = l.ExpiresAt(&lifecycleEntity{EndsAt: "2025-04-01T00:00:00Z"}, now)
+	if err != nil || !ok || !exp.Equal(time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiry %v %v %v", exp, ok, err)
+	}
+}
+
+func TestTimeValue(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	v, err := TimeValue(reflect.TypeOf(lifecycleEntity{}), "CreatedAt", now)
+	if err != nil {
+		t.Fatalf("TimeValue failed: %v", err)
+	}
+	if dt, ok := v.(strfmt.DateTime); !ok || !time.Time(dt).Equal(now) {
+		t.Errorf("expected strfmt.DateTime, got %#v", v)
+	}
+}
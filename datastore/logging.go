@@ -0,0 +1,82 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	eserrors "github.com/suparena/entitystore/errors"
+)
+
+// Logging logs every call with its operation, keys, duration and error to 'logger', or
+// slog.Default() when nil. Successful calls, and NotFound, AlreadyExists and
+// ConditionFailed errors, which are expected outcomes, are logged at debug level; other
+// errors at error level. Queries are logged with their item count, and streams when they
+// end with theirs.
+func Logging[T any](logger *slog.Logger) Middleware[T] {
+	return func(next Handler[T]) Handler[T] {
+		return func(ctx context.Context, call *Call[T]) (Result[T], error) {
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+			start := time.Now()
+			res, err := next(ctx, call)
+			if err == nil && res.Stream != nil {
+				attrs := callAttrs(call)
+				res.Stream = ObserveStream(ctx, res.Stream, func(count int64, err error) {
+					logCall(ctx, l, call.Operation, append(attrs, slog.Int64("count", count)), time.Since(start), err)
+				})
+				return res, nil
+			}
+			attrs := callAttrs(call)
+			if call.Operation == OpQuery && err == nil {
+				attrs = append(attrs, slog.Int("count", len(res.Items)))
+			}
+			logCall(ctx, l, call.Operation, attrs, time.Since(start), err)
+			return res, err
+		}
+	}
+}
+
+// logCall logs a call at the level of its outcome
+func logCall(ctx context.Context, l *slog.Logger, operation string, attrs []slog.Attr, d time.Duration, err error) {
+	attrs = append(attrs, slog.Duration("duration", d))
+	level := slog.LevelDebug
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		if !eserrors.IsNotFound(err) && !eserrors.IsAlreadyExists(err) && !eserrors.IsConditionFailed(err) {
+			level = slog.LevelError
+		}
+	}
+	l.LogAttrs(ctx, level, "datastore "+operation, attrs...)
+}
+
+// callAttrs returns the log attributes of the arguments of a call
+func callAttrs[T any](call *Call[T]) []slog.Attr {
+	attrs := []slog.Attr{slog.String("operation", call.Operation)}
+	switch call.Operation {
+	case OpGetOne, OpDelete:
+		attrs = append(attrs, slog.String("key", call.Key))
+	case OpGetByKey:
+		attrs = append(attrs, slog.String("pk", call.PK), slog.String("sk", call.SK))
+	case OpUpdateWithCondition:
+		attrs = append(attrs, slog.String("key", fmt.Sprint(call.KeyInput)))
+		if call.Condition != "" {
+			attrs = append(attrs, slog.String("condition", call.Condition))
+		}
+	case OpQuery, OpStream:
+		if call.Params != nil {
+			if call.Params.IndexName != nil {
+				attrs = append(attrs, slog.String("index", *call.Params.IndexName))
+			}
+			attrs = append(attrs, slog.String("keyCondition", call.Params.KeyConditionExpression))
+		}
+	}
+	return attrs
+}
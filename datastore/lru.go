@@ -0,0 +1,116 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRUCache is an in-memory Cache holding at most a fixed number of entries, evicting the
+// least recently used one when full. Expired entries are dropped when read or evicted.
+// It is safe for concurrent use.
+type LRUCache[T any] struct {
+	mu        sync.Mutex
+	size      int
+	ll        *list.List
+	entries   map[string]*list.Element
+	evictions uint64
+	now       func() time.Time
+}
+
+type lruEntry[T any] struct {
+	key     string
+	entry   CacheEntry[T]
+	expires time.Time
+}
+
+// NewLRUCache returns an empty cache of 'size' entries, at least 1
+func NewLRUCache[T any](size int) *LRUCache[T] {
+	if size < 1 {
+		size = 1
+	}
+	return &LRUCache[T]{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the entry of 'key' unless it is missing or expired
+func (c *LRUCache[T]) Get(key string) (CacheEntry[T], bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return CacheEntry[T]{}, false
+	}
+	e := el.Value.(*lruEntry[T])
+	if !e.expires.After(c.now()) {
+		c.remove(el)
+		return CacheEntry[T]{}, false
+	}
+	c.ll.MoveToFront(el)
+	return e.entry, true
+}
+
+// Set stores the entry of 'key' for 'ttl', evicting the least recently used entry if
+// the cache is full
+func (c *LRUCache[T]) Set(key string, entry CacheEntry[T], ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*lruEntry[T])
+		e.entry, e.expires = entry, expires
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.ll.PushFront(&lruEntry[T]{key: key, entry: entry, expires: expires})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+		c.evictions++
+	}
+}
+
+// Delete removes the entries of 'keys'
+func (c *LRUCache[T]) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// Purge removes all entries
+func (c *LRUCache[T]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// Len returns the number of entries, including expired ones not yet dropped
+func (c *LRUCache[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Evictions returns the number of entries evicted to make room for new ones
+func (c *LRUCache[T]) Evictions() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.evictions
+}
+
+func (c *LRUCache[T]) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry[T]).key)
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// Operation names of the DataStore methods, as seen by middlewares
+const (
+	OpGetOne              = "GetOne"
+	OpGetByKey            = "GetByKey"
+	OpPut                 = "Put"
+	OpUpdateWithCondition = "UpdateWithCondition"
+	OpQuery               = "Query"
+	OpStream              = "Stream"
+	OpDelete              = "Delete"
+)
+
+// Call is a DataStore method call passing through a middleware chain. Only the fields
+// of the arguments of Operation are set; middlewares may change them before calling
+// the next handler.
+type Call[T any] struct {
+	Operation string
+
+	// Key is the key of GetOne and Delete
+	Key string
+	// PK and SK are the keys of GetByKey
+	PK, SK string
+	// Entity is the entity of Put
+	Entity T
+	// KeyInput, Updates and Condition are the arguments of UpdateWithCondition
+	KeyInput  any
+	Updates   map[string]interface{}
+	Condition string
+	// Params are the parameters of Query and Stream
+	Params        *storagemodels.QueryParams
+	StreamOptions []storagemodels.StreamOption
+}
+
+// Result is the result of a DataStore method call. Only the field of the result of the
+// operation is set.
+type Result[T any] struct {
+	// Entity is the result of GetOne and GetByKey
+	Entity *T
+	// Items is the result of Query
+	Items []interface{}
+	// Stream is the result of Stream. Its errors are sent on the channel, so the
+	// handler returns a nil error; see ObserveStream to follow them.
+	Stream <-chan storagemodels.StreamResult[T]
+}
+
+// Handler handles a DataStore method call
+type Handler[T any] func(ctx context.Context, call *Call[T]) (Result[T], error)
+
+// Middleware wraps a Handler with cross-cutting behavior, e.g. logging, metrics,
+// authorization or retries
+type Middleware[T any] func(next Handler[T]) Handler[T]
+
+// Chain returns a DataStore passing every call through the middlewares before calling
+// 'ds'. The first middleware is the outermost one. An error returned for a Stream call
+// before it reaches 'ds' is sent as the only result on the channel.
+func Chain[T any](ds DataStore[T], mws ...Middleware[T]) DataStore[T] {
+	handler := func(ctx context.Context, call *Call[T]) (Result[T], error) {
+		return invoke(ctx, ds, call)
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+	return &chained[T]{next: ds, handler: handler}
+}
+
+// invoke calls the method of 'ds' described by 'call'
+func invoke[T any](ctx context.Context, ds DataStore[T], call *Call[T]) (Result[T], error) {
+	var res Result[T]
+	var err error
+	switch call.Operation {
+	case OpGetOne:
+		res.Entity, err = ds.GetOne(ctx, call.Key)
+	case OpGetByKey:
+		res.Entity, err = ds.GetByKey(ctx, call.PK, call.SK)
+	case OpPut:
+		err = ds.Put(ctx, call.Entity)
+	case OpUpdateWithCondition:
+		err = ds.UpdateWithCondition(ctx, call.KeyInput, call.Updates, call.Condition)
+	case OpQuery:
+		res.Items, err = ds.Query(ctx, call.Params)
+	case OpStream:
+		res.Stream = ds.Stream(ctx, call.Params, call.StreamOptions...)
+	case OpDelete:
+		err = ds.Delete(ctx, call.Key)
+	default:
+		err = fmt.Errorf("unknown DataStore operation %q", call.Operation)
+	}
+	return res, err
+}
+
+// chained is the DataStore returned by Chain
+type chained[T any] struct {
+	next    DataStore[T]
+	handler Handler[T]
+}
+
+// Unwrap returns the DataStore the middlewares wrap, e.g. to reach methods specific to
+// a backend
+func (c *chained[T]) Unwrap() DataStore[T] {
+	return c.next
+}
+
+func (c *chained[T]) GetOne(ctx context.Context, key string) (*T, error) {
+	res, err := c.handler(ctx, &Call[T]{Operation: OpGetOne, Key: key})
+	return res.Entity, err
+}
+
+func (c *chained[T]) GetByKey(ctx context.Context, pk, sk string) (*T, error) {
+	res, err := c.handler(ctx, &Call[T]{Operation: OpGetByKey, PK: pk, SK: sk})
+	return res.Entity, err
+}
+
+func (c *chained[T]) Put(ctx context.Context, entity T) error {
+	_, err := c.handler(ctx, &Call[T]{Operation: OpPut, Entity: entity})
+	return err
+}
+
+func (c *chained[T]) UpdateWithCondition(ctx context.Context, keyInput any, updates map[string]interface{}, condition string) error {
+	_, err := c.handler(ctx, &Call[T]{Operation: OpUpdateWithCondition, KeyInput: keyInput, Updates: updates, Condition: condition})
+	return err
+}
+
+func (c *chained[T]) Query(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error) {
+	res, err := c.handler(ctx, &Call[T]{Operation: OpQuery, Params: params})
+	return res.Items, err
+}
+
+func (c *chained[T]) Stream(ctx context.Context, params *storagemodels.QueryParams, opts ...storagemodels.StreamOption) <-chan storagemodels.StreamResult[T] {
+	res, err := c.handler(ctx, &Call[T]{Operation: OpStream, Params: params, StreamOptions: opts})
+	if err == nil && res.Stream != nil {
+		return res.Stream
+	}
+	resultCh := make(chan storagemodels.StreamResult[T], 1)
+	if err != nil {
+		resultCh <- storagemodels.StreamResult[T]{Error: err, Meta: storagemodels.StreamMeta{Timestamp: time.Now()}}
+	}
+	close(resultCh)
+	return resultCh
+}
+
+func (c *chained[T]) Delete(ctx context.Context, key string) error {
+	_, err := c.handler(ctx, &Call[T]{Operation: OpDelete, Key: key})
+	return err
+}
+
+// ObserveStream forwards the results of 'in' and calls 'done' with their count and the
+// first error once 'in' is closed, e.g. to log or time a whole stream. When 'ctx' is
+// done and the consumer stops reading, the remaining results are drained so the
+// producer does not block.
+func ObserveStream[T any](ctx context.Context, in <-chan storagemodels.StreamResult[T], done func(count int64, err error)) <-chan storagemodels.StreamResult[T] {
+	out := make(chan storagemodels.StreamResult[T], cap(in))
+	go func() {
+		defer close(out)
+		var count int64
+		var firstErr error
+		forward := true
+		for r := range in {
+			if r.Error != nil {
+				if firstErr == nil {
+					firstErr = r.Error
+				}
+			} else {
+				count++
+			}
+			if !forward {
+				continue
+			}
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				forward = false
+			}
+		}
+		if firstErr == nil && !forward {
+			firstErr = ctx.Err()
+		}
+		done(count, firstErr)
+	}()
+	return out
+}
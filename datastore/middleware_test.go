@@ -0,0 +1,250 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suparena/entitystore/datastore"
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/datastore/mock"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+type widget struct {
+	ID   string
+	Name string
+}
+
+func newWidgets() *mock.DataStore[widget] {
+	return mock.New[widget]().WithGetKeyFunc(func(w widget) string { return w.ID })
+}
+
+func TestChainConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, reg *registry.Registry) conformance.Stores {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		table := mock.NewTable()
+		items := mock.New[conformance.Item]().WithRegistry(reg).WithTable(table)
+		notes := mock.New[conformance.Note]().WithRegistry(reg).WithTable(table)
+		return conformance.Stores{
+			Items: datastore.Chain[conformance.Item](items,
+				datastore.Recover[conformance.Item](),
+				datastore.Logging[conformance.Item](logger),
+				datastore.Latency[conformance.Item](datastore.NewLatencyHistogram()),
+			),
+			Notes: datastore.Chain[conformance.Note](notes,
+				datastore.Recover[conformance.Note](),
+				datastore.Logging[conformance.Note](logger),
+				datastore.Latency[conformance.Note](datastore.NewLatencyHistogram()),
+			),
+			Create: items.Create,
+		}
+	})
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	inner := newWidgets()
+	var trace []string
+	traced := func(name string) datastore.Middleware[widget] {
+		return func(next datastore.Handler[widget]) datastore.Handler[widget] {
+			return func(ctx context.Context, call *datastore.Call[widget]) (datastore.Result[widget], error) {
+				trace = append(trace, name+">"+call.Operation)
+				res, err := next(ctx, call)
+				trace = append(trace, "<"+name)
+				return res, err
+			}
+		}
+	}
+	errReadOnly := errors.New("read only")
+	readOnly := func(next datastore.Handler[widget]) datastore.Handler[widget] {
+		return func(ctx context.Context, call *datastore.Call[widget]) (datastore.Result[widget], error) {
+			if call.Operation == datastore.OpDelete {
+				return datastore.Result[widget]{}, errReadOnly
+			}
+			if call.Operation == datastore.OpPut {
+				call.Entity.Name = strings.ToUpper(call.Entity.Name)
+			}
+			return next(ctx, call)
+		}
+	}
+	store := datastore.Chain[widget](inner, traced("a"), traced("b"), readOnly)
+
+	if err := store.Put(ctx, widget{ID: "1", Name: "gear"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got := strings.Join(trace, " "); got != "a>Put b>Put <b <a" {
+		t.Errorf("trace = %q, want the first middleware outermost", got)
+	}
+	got, err := store.GetOne(ctx, "1")
+	if err != nil || got.Name != "GEAR" {
+		t.Errorf("GetOne = %+v, %v, want the entity changed by the middleware", got, err)
+	}
+	if err := store.Delete(ctx, "1"); !errors.Is(err, errReadOnly) {
+		t.Errorf("Delete returned %v, want the middleware error", err)
+	}
+	inner.AssertNotCalled(t, "Delete", mock.Anything)
+
+	var n int
+	for r := range store.Stream(ctx, &storagemodels.QueryParams{}) {
+		if r.Error != nil {
+			t.Fatalf("Stream failed: %v", r.Error)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Stream sent %d items, want 1", n)
+	}
+
+	type unwrapper interface {
+		Unwrap() datastore.DataStore[widget]
+	}
+	if u, ok := store.(unwrapper); !ok || u.Unwrap() != datastore.DataStore[widget](inner) {
+		t.Error("Unwrap does not return the wrapped store")
+	}
+}
+
+func TestChainStreamError(t *testing.T) {
+	errDenied := errors.New("denied")
+	deny := func(next datastore.Handler[widget]) datastore.Handler[widget] {
+		return func(ctx context.Context, call *datastore.Call[widget]) (datastore.Result[widget], error) {
+			return datastore.Result[widget]{}, errDenied
+		}
+	}
+	var results []storagemodels.StreamResult[widget]
+	for r := range datastore.Chain[widget](newWidgets(), deny).Stream(context.Background(), &storagemodels.QueryParams{}) {
+		results = append(results, r)
+	}
+	if len(results) != 1 || !errors.Is(results[0].Error, errDenied) {
+		t.Errorf("Stream sent %+v, want the middleware error only", results)
+	}
+}
+
+// logRecords decodes the JSON log lines in 'buf'
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var res []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		res = append(res, record)
+	}
+	return res
+}
+
+func TestLogging(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	inner := newWidgets().WithFault(mock.Fault{Method: "Put", Key: "2", Err: errors.New("throttled")})
+	store := datastore.Chain[widget](inner, datastore.Logging[widget](logger))
+
+	_ = store.Put(ctx, widget{ID: "1"})
+	_, _ = store.GetOne(ctx, "missing")
+	_ = store.Put(ctx, widget{ID: "2"})
+	for range store.Stream(ctx, &storagemodels.QueryParams{}) {
+	}
+
+	records := logRecords(t, &buf)
+	if len(records) != 4 {
+		t.Fatalf("logged %d records, want 4: %s", len(records), buf.String())
+	}
+	want := []struct{ msg, level, key string }{
+		{"datastore Put", "DEBUG", ""},
+		{"datastore GetOne", "DEBUG", "missing"},
+		{"datastore Put", "ERROR", ""},
+		{"datastore Stream", "DEBUG", ""},
+	}
+	for i, w := range want {
+		r := records[i]
+		if r["msg"] != w.msg || r["level"] != w.level {
+			t.Errorf("record %d = %v, want %s at %s", i, r, w.msg, w.level)
+		}
+		if w.key != "" && r["key"] != w.key {
+			t.Errorf("record %d key = %v, want %s", i, r["key"], w.key)
+		}
+		if _, ok := r["duration"]; !ok {
+			t.Errorf("record %d has no duration", i)
+		}
+	}
+	if records[1]["error"] == nil || records[2]["error"] != "throttled" {
+		t.Errorf("errors not logged: %v, %v", records[1], records[2])
+	}
+	if records[3]["count"] != float64(1) {
+		t.Errorf("stream count = %v, want 1", records[3]["count"])
+	}
+}
+
+func TestLatency(t *testing.T) {
+	ctx := context.Background()
+	hist := datastore.NewLatencyHistogram(10*time.Millisecond, time.Millisecond)
+	inner := newWidgets().WithFault(mock.Fault{Method: "GetOne", Nth: 2, Latency: 20 * time.Millisecond})
+	store := datastore.Chain[widget](inner, datastore.Latency[widget](hist))
+
+	_ = store.Put(ctx, widget{ID: "1"})
+	_, _ = store.GetOne(ctx, "1")
+	_, _ = store.GetOne(ctx, "1")
+	_, _ = store.GetOne(ctx, "missing")
+	for range store.Stream(ctx, &storagemodels.QueryParams{}) {
+	}
+
+	s := hist.Snapshot(datastore.OpGetOne)
+	if s.Count != 3 || s.Errors != 1 {
+		t.Errorf("GetOne count = %d, errors = %d, want 3 and 1", s.Count, s.Errors)
+	}
+	if len(s.Buckets) != 2 || s.Buckets[0] != time.Millisecond {
+		t.Errorf("Buckets = %v, want them sorted", s.Buckets)
+	}
+	if s.Counts[2] != 1 || s.Sum < 20*time.Millisecond {
+		t.Errorf("Counts = %v, Sum = %v, want the slow call above the last bucket", s.Counts, s.Sum)
+	}
+	if got := strings.Join(hist.Operations(), ","); got != "GetOne,Put,Stream" {
+		t.Errorf("Operations = %s", got)
+	}
+	if s := hist.Snapshot(datastore.OpDelete); s.Count != 0 || len(s.Counts) != 3 {
+		t.Errorf("Snapshot of an unobserved operation = %+v", s)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+	inner := newWidgets().WithQueryFunc(func(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error) {
+		panic("index out of range")
+	})
+	store := datastore.Chain[widget](inner, datastore.Recover[widget]())
+
+	_, err := store.Query(ctx, &storagemodels.QueryParams{})
+	var pe *datastore.PanicError
+	if !errors.As(err, &pe) || pe.Operation != datastore.OpQuery || pe.Value != "index out of range" || len(pe.Stack) == 0 {
+		t.Fatalf("Query returned %v, want a PanicError", err)
+	}
+	if err := store.Put(ctx, widget{ID: "1"}); err != nil {
+		t.Errorf("Put after a recovered panic failed: %v", err)
+	}
+
+	// A panic with an error value unwraps to it
+	boom := errors.New("boom")
+	panicking := func(next datastore.Handler[widget]) datastore.Handler[widget] {
+		return func(ctx context.Context, call *datastore.Call[widget]) (datastore.Result[widget], error) {
+			panic(boom)
+		}
+	}
+	store = datastore.Chain[widget](newWidgets(), datastore.Recover[widget](), panicking)
+	if _, err := store.GetOne(ctx, "1"); !errors.Is(err, boom) || eserrors.IsNotFound(err) {
+		t.Errorf("GetOne returned %v, want the panic error", err)
+	}
+}
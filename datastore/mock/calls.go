@@ -0,0 +1,103 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package mock
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Call is a recorded call of a DataStore method
+type Call struct {
+	// Method is the name of the method, e.g. "Put"
+	Method string
+	// Key identifies the item of the call: its table key as "PK|SK" when T has an index
+	// map, else the key of GetOne, Delete and UpdateWithCondition, the key returned by the
+	// key function for Put and Create, and "PK|SK" for GetByKey. It is empty for Query and
+	// Stream.
+	Key string
+	// Args are the arguments after the context
+	Args []any
+	// Err is the error returned, or sent on the channel by Stream when injected
+	Err error
+}
+
+// Anything matches any argument in AssertCalled and AssertNotCalled
+var Anything any = anything{}
+
+type anything struct{}
+
+// Calls returns the calls made so far, in order
+func (m *DataStore[T]) Calls() []Call {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	calls := make([]Call, len(m.calls))
+	for i, c := range m.calls {
+		calls[i] = *c
+	}
+	return calls
+}
+
+// ResetCalls forgets the calls made so far
+func (m *DataStore[T]) ResetCalls() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+// matching returns the calls of 'method' whose first arguments equal 'args'
+func (m *DataStore[T]) matching(method string, args []any) []Call {
+	var res []Call
+	for _, c := range m.Calls() {
+		if c.Method == method && argsMatch(c.Args, args) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func argsMatch(actual, expected []any) bool {
+	if len(expected) > len(actual) {
+		return false
+	}
+	for i, want := range expected {
+		if want != Anything && !reflect.DeepEqual(actual[i], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertCalled fails the test unless 'method' was called with arguments starting with
+// 'args', where Anything matches any argument
+func (m *DataStore[T]) AssertCalled(t testing.TB, method string, args ...any) bool {
+	t.Helper()
+	if len(m.matching(method, args)) == 0 {
+		t.Errorf("expected a call of %s with arguments %v, got calls %v", method, args, m.Calls())
+		return false
+	}
+	return true
+}
+
+// AssertNotCalled fails the test if 'method' was called with arguments starting with
+// 'args', where Anything matches any argument
+func (m *DataStore[T]) AssertNotCalled(t testing.TB, method string, args ...any) bool {
+	t.Helper()
+	if calls := m.matching(method, args); len(calls) > 0 {
+		t.Errorf("expected no call of %s with arguments %v, got %v", method, args, calls)
+		return false
+	}
+	return true
+}
+
+// AssertNumberOfCalls fails the test unless 'method' was called 'n' times
+func (m *DataStore[T]) AssertNumberOfCalls(t testing.TB, method string, n int) bool {
+	t.Helper()
+	if got := len(m.matching(method, nil)); got != n {
+		t.Errorf("expected %d calls of %s, got %d", n, method, got)
+		return false
+	}
+	return true
+}
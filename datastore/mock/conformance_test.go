@@ -0,0 +1,21 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package mock
+
+import (
+	"testing"
+
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/registry"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, reg *registry.Registry) conformance.Stores {
+		table := NewTable()
+		items := New[conformance.Item]().WithRegistry(reg).WithTable(table)
+		notes := New[conformance.Note]().WithRegistry(reg).WithTable(table)
+		return conformance.Stores{Items: items, Notes: notes, Create: items.Create}
+	})
+}
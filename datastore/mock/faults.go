@@ -0,0 +1,100 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package mock
+
+import (
+	"context"
+	"time"
+)
+
+// Fault makes the calls it matches slow down or fail
+type Fault struct {
+	// Method is the method to match, e.g. "Put"; empty matches every method
+	Method string
+	// Key is the item key to match, as recorded in Call.Key; empty matches every key
+	Key string
+	// Nth, when positive, restricts the fault to the Nth call it matches, counting from 1
+	Nth int
+	// Latency delays the call; it fails with the context error if the context is done
+	// first
+	Latency time.Duration
+	// Err is returned by the call instead of performing it
+	Err error
+	// Hook is called before the latency, e.g. to signal that the call started or to
+	// block it until the test releases it
+	Hook func()
+}
+
+type fault struct {
+	Fault
+	seen int
+}
+
+// WithFault injects 'f' into the calls it matches. Every matching fault applies: their
+// latencies add up and the error of the first one added is returned.
+func (m *DataStore[T]) WithFault(f Fault) *DataStore[T] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = append(m.faults, &fault{Fault: f})
+	return m
+}
+
+// ClearFaults removes the faults added with WithFault
+func (m *DataStore[T]) ClearFaults() *DataStore[T] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = nil
+	return m
+}
+
+// enter records a call and applies the faults matching it, returning the injected error
+func (m *DataStore[T]) enter(ctx context.Context, method, key string, args ...any) (*Call, error) {
+	call := &Call{Method: method, Key: key, Args: args}
+
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	var latency time.Duration
+	var err error
+	var hooks []func()
+	for _, f := range m.faults {
+		if (f.Method != "" && f.Method != method) || (f.Key != "" && f.Key != key) {
+			continue
+		}
+		f.seen++
+		if f.Nth > 0 && f.seen != f.Nth {
+			continue
+		}
+		latency += f.Latency
+		if err == nil {
+			err = f.Err
+		}
+		if f.Hook != nil {
+			hooks = append(hooks, f.Hook)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return call, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return call, err
+}
+
+// exit records the error returned by a call
+func (m *DataStore[T]) exit(call *Call, err *error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	call.Err = *err
+}
@@ -8,32 +8,54 @@ package mock
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
 	"sync"
-	
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore"
+	"github.com/suparena/entitystore/datastore/internal/items"
 	"github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
 	"github.com/suparena/entitystore/storagemodels"
 )
 
-// DataStore is a mock implementation of datastore.DataStore[T] for testing
+// DataStore is a mock implementation of datastore.DataStore[T] for testing.
+//
+// When T has an index map in the registry, the mock behaves like the DynamoDB store on
+// an in-memory Table: keys are expanded from the index map, queries evaluate key
+// conditions, filters, Limit and ExclusiveStartKey on the table or a GSI and return
+// items in sort key order, and lifecycle directives and conditions are enforced.
+// Otherwise, or when a key function is set with WithGetKeyFunc, entities are kept in a
+// map under the key the function returns.
+//
+// Every call is recorded for assertions, and errors and latency can be injected per
+// method, key or Nth call with WithFault.
 type DataStore[T any] struct {
-	mu           sync.RWMutex
-	data         map[string]T
-	queryFunc    func(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error)
-	streamFunc   func(ctx context.Context, params *storagemodels.QueryParams, opts ...storagemodels.StreamOption) <-chan storagemodels.StreamResult[T]
-	getKeyFunc   func(entity T) string
-	putError     error
-	deleteError  error
-	updateError  error
+	mu          sync.RWMutex
+	data        map[string]T
+	table       *Table
+	queryFunc   func(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error)
+	streamFunc  func(ctx context.Context, params *storagemodels.QueryParams, opts ...storagemodels.StreamOption) <-chan storagemodels.StreamResult[T]
+	getKeyFunc  func(entity T) string
+	putError    error
+	deleteError error
+	updateError error
+	registry    *registry.Registry
+	calls       []*Call
+	faults      []*fault
 }
 
 // New creates a new mock DataStore
 func New[T any]() *DataStore[T] {
 	return &DataStore[T]{
-		data: make(map[string]T),
+		data:  make(map[string]T),
+		table: NewTable(),
 	}
 }
 
-// WithGetKeyFunc sets a custom function to extract keys from entities
+// WithGetKeyFunc sets a custom function to extract keys from entities. Entities are then
+// kept in a map under that key, even when T has an index map.
 func (m *DataStore[T]) WithGetKeyFunc(f func(T) string) *DataStore[T] {
 	m.getKeyFunc = f
 	return m
@@ -69,172 +91,394 @@ func (m *DataStore[T]) WithUpdateError(err error) *DataStore[T] {
 	return m
 }
 
+// WithRegistry makes index maps, entity types and hooks resolve in 'r' instead of
+// registry.Default()
+func (m *DataStore[T]) WithRegistry(r *registry.Registry) *DataStore[T] {
+	m.registry = r
+	return m
+}
+
+// WithTable stores the entities in 't', so that mocks of several entity types share a
+// table like stores on one DynamoDB table do
+func (m *DataStore[T]) WithTable(t *Table) *DataStore[T] {
+	m.table = t
+	return m
+}
+
+func (m *DataStore[T]) codec() items.Codec[T] {
+	return items.Codec[T]{Registry: m.registry}
+}
+
+// indexed reports whether entities are stored in the table under the keys expanded
+// from their index map
+func (m *DataStore[T]) indexed() bool {
+	if m.getKeyFunc != nil {
+		return false
+	}
+	_, err := m.codec().IndexMap()
+	return err == nil
+}
+
+// stringKey returns the item key of a GetOne or Delete call
+func (m *DataStore[T]) stringKey(key string) string {
+	if m.indexed() {
+		if k, err := m.codec().StringKey(key); err == nil {
+			return k.String()
+		}
+	}
+	return key
+}
+
+// inputKey returns the item key of a write or an update
+func (m *DataStore[T]) inputKey(keyInput any) string {
+	if !m.indexed() {
+		if entity, ok := keyInput.(T); ok {
+			return m.extractKey(entity)
+		}
+		key, _ := keyInput.(string)
+		return key
+	}
+	if k, err := m.codec().TableKey(keyInput); err == nil {
+		return k.String()
+	}
+	return ""
+}
+
 // GetOne retrieves an entity by key
-func (m *DataStore[T]) GetOne(ctx context.Context, key string) (*T, error) {
+func (m *DataStore[T]) GetOne(ctx context.Context, key string) (_ *T, err error) {
+	call, err := m.enter(ctx, "GetOne", m.stringKey(key), key)
+	defer m.exit(call, &err)
+	if err != nil {
+		return nil, err
+	}
+
+	if !m.indexed() {
+		return m.getData(ctx, key)
+	}
+	codec := m.codec()
+	k, err := codec.StringKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand string key: %w", err)
+	}
+	item := m.table.get(k)
+	if item == nil {
+		return nil, codec.NotFound(key)
+	}
+	return codec.DecodeT(ctx, item)
+}
+
+// getData reads an entity of the key function mode
+func (m *DataStore[T]) getData(ctx context.Context, key string) (*T, error) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-	
-	if entity, exists := m.data[key]; exists {
+	entity, exists := m.data[key]
+	m.mu.RUnlock()
+
+	if exists {
+		if err := datastore.RunAfterLoadWithRegistry(ctx, m.registry, &entity); err != nil {
+			return nil, err
+		}
 		return &entity, nil
 	}
-	
+
 	var zero T
 	return nil, errors.NewNotFoundError(fmt.Sprintf("%T", zero), key)
 }
 
 // GetByKey retrieves an entity by explicit PK and SK values
-func (m *DataStore[T]) GetByKey(ctx context.Context, pk, sk string) (*T, error) {
-	// For mock, we'll use the composite key format
-	key := fmt.Sprintf("%s|%s", pk, sk)
-	return m.GetOne(ctx, key)
+func (m *DataStore[T]) GetByKey(ctx context.Context, pk, sk string) (_ *T, err error) {
+	k := items.Key{PK: pk, SK: sk}
+	call, err := m.enter(ctx, "GetByKey", k.String(), pk, sk)
+	defer m.exit(call, &err)
+	if err != nil {
+		return nil, err
+	}
+
+	if !m.indexed() {
+		// Without an index map, entities are looked up under the composite key
+		return m.getData(ctx, k.String())
+	}
+	codec := m.codec()
+	item := m.table.get(k)
+	if item == nil {
+		return nil, codec.NotFound(k.String())
+	}
+	return codec.DecodeT(ctx, item)
 }
 
-// Put stores an entity
+// Put stores an entity, replacing any entity with the same key. With a @Version
+// directive the stored version must match.
 func (m *DataStore[T]) Put(ctx context.Context, entity T) error {
+	return m.write(ctx, "Put", entity, false)
+}
+
+// Create stores an entity only if no entity with the same key exists yet.
+// It returns an AlreadyExistsError otherwise.
+func (m *DataStore[T]) Create(ctx context.Context, entity T) error {
+	return m.write(ctx, "Create", entity, true)
+}
+
+func (m *DataStore[T]) write(ctx context.Context, method string, entity T, create bool) (err error) {
+	call, err := m.enter(ctx, method, m.inputKey(entity), entity)
+	defer m.exit(call, &err)
+	if err != nil {
+		return err
+	}
 	if m.putError != nil {
 		return m.putError
 	}
-	
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	
-	key := m.extractKey(entity)
-	if key == "" {
-		return errors.NewValidationError("key", "unable to extract key from entity")
+
+	if !m.indexed() {
+		if err := datastore.RunBeforePutWithRegistry(ctx, m.registry, &entity); err != nil {
+			return err
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		key := m.extractKey(entity)
+		if key == "" {
+			return errors.NewValidationError("key", "unable to extract key from entity")
+		}
+		if _, exists := m.data[key]; create && exists {
+			return errors.NewAlreadyExistsError(fmt.Sprintf("%T", entity), key)
+		}
+		m.data[key] = entity
+		return nil
 	}
-	
-	m.data[key] = entity
-	return nil
+
+	w, err := m.codec().PrepareWrite(ctx, entity, create)
+	if err != nil {
+		return err
+	}
+	return m.table.update(w.Key, func(existing map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		if err := w.Check(existing); err != nil {
+			return nil, err
+		}
+		return w.Item, nil
+	})
 }
 
-// UpdateWithCondition updates an entity with a condition
-func (m *DataStore[T]) UpdateWithCondition(ctx context.Context, keyInput any, updates map[string]interface{}, condition string) error {
+// UpdateWithCondition applies 'updates' to the entity identified by 'keyInput' if
+// 'condition', a DynamoDB condition expression, holds for the stored item. Without an
+// index map, 'keyInput' must be the key and the update only checks that it exists.
+func (m *DataStore[T]) UpdateWithCondition(ctx context.Context, keyInput any, updates map[string]interface{}, condition string) (err error) {
+	call, err := m.enter(ctx, "UpdateWithCondition", m.inputKey(keyInput), keyInput, updates, condition)
+	defer m.exit(call, &err)
+	if err != nil {
+		return err
+	}
 	if m.updateError != nil {
 		return m.updateError
 	}
-	
-	// Simple mock implementation - just check if key exists
-	key, ok := keyInput.(string)
-	if !ok {
-		return errors.NewValidationError("keyInput", "must be a string for mock")
-	}
-	
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	
-	if _, exists := m.data[key]; !exists {
-		return errors.NewNotFoundError("entity", key)
-	}
-	
-	// In a real implementation, we would apply the updates
-	// For mock, we just verify the entity exists
-	return nil
+
+	if !m.indexed() {
+		key, ok := keyInput.(string)
+		if !ok {
+			return errors.NewValidationError("keyInput", "must be a string for mock")
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if _, exists := m.data[key]; !exists {
+			return errors.NewNotFoundError("entity", key)
+		}
+		return nil
+	}
+
+	u, err := m.codec().PrepareUpdate(keyInput, updates, condition)
+	if err != nil {
+		return err
+	}
+	return m.table.update(u.Key, u.Apply)
 }
 
-// Query executes a query
-func (m *DataStore[T]) Query(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error) {
+// Query runs the key condition of 'params' on the table or GSI and returns the matching
+// items, each unmarshaled to the type registered for its EntityType, in sort key order.
+// Like a single DynamoDB Query call, Limit caps the items read before the filter
+// expression is applied, and ExclusiveStartKey resumes after a previous page. Without
+// an index map, every entity is returned in key order.
+func (m *DataStore[T]) Query(ctx context.Context, params *storagemodels.QueryParams) (_ []interface{}, err error) {
+	call, err := m.enter(ctx, "Query", "", params)
+	defer m.exit(call, &err)
+	if err != nil {
+		return nil, err
+	}
 	if m.queryFunc != nil {
 		return m.queryFunc(ctx, params)
 	}
-	
-	// Default implementation returns all data as interface{}
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	
-	results := make([]interface{}, 0, len(m.data))
-	for _, v := range m.data {
-		results = append(results, v)
+
+	if !m.indexed() {
+		entities := m.sortedData()
+		results := make([]interface{}, 0, len(entities))
+		for _, v := range entities {
+			results = append(results, v)
+		}
+		return results, nil
+	}
+
+	codec := m.codec()
+	q, err := codec.PlanQuery(params)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	page, _, err := m.table.queryPage(q)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	var results []interface{}
+	for _, item := range page {
+		obj, err := codec.Decode(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, obj)
 	}
-	
 	return results, nil
 }
 
-// Stream returns a channel of results
-func (m *DataStore[T]) Stream(ctx context.Context, params *storagemodels.QueryParams, opts ...storagemodels.StreamOption) <-chan storagemodels.StreamResult[T] {
-	if m.streamFunc != nil {
-		return m.streamFunc(ctx, params, opts...)
+// Delete removes an entity by key. Like the DynamoDB store, deleting a missing entity
+// is not an error when T has an index map; otherwise it is a NotFoundError.
+func (m *DataStore[T]) Delete(ctx context.Context, key string) (err error) {
+	call, err := m.enter(ctx, "Delete", m.stringKey(key), key)
+	defer m.exit(call, &err)
+	if err != nil {
+		return err
 	}
-	
-	// Default implementation streams all data
-	resultChan := make(chan storagemodels.StreamResult[T], 10)
-	
-	go func() {
-		defer close(resultChan)
-		
-		m.mu.RLock()
-		defer m.mu.RUnlock()
-		
-		index := int64(0)
-		for _, v := range m.data {
-			select {
-			case <-ctx.Done():
-				return
-			case resultChan <- storagemodels.StreamResult[T]{
-				Item: v,
-				Meta: storagemodels.StreamMeta{
-					Index:      index,
-					PageNumber: 1,
-				},
-			}:
-				index++
-			}
-		}
-	}()
-	
-	return resultChan
-}
-
-// Delete removes an entity by key
-func (m *DataStore[T]) Delete(ctx context.Context, key string) error {
 	if m.deleteError != nil {
 		return m.deleteError
 	}
-	
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	
-	if _, exists := m.data[key]; !exists {
-		var zero T
-		return errors.NewNotFoundError(fmt.Sprintf("%T", zero), key)
+
+	if !m.indexed() {
+		m.mu.Lock()
+		var existing *T
+		if entity, ok := m.data[key]; ok {
+			existing = &entity
+		}
+		m.mu.Unlock()
+		if err := datastore.RunBeforeDeleteWithRegistry(ctx, m.registry, key, existing); err != nil {
+			return err
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if _, exists := m.data[key]; !exists {
+			var zero T
+			return errors.NewNotFoundError(fmt.Sprintf("%T", zero), key)
+		}
+		delete(m.data, key)
+		return nil
+	}
+
+	codec := m.codec()
+	k, err := codec.StringKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to expand string key: %w", err)
+	}
+	if err := codec.BeforeDelete(ctx, key, func() (map[string]types.AttributeValue, error) {
+		return m.table.get(k), nil
+	}); err != nil {
+		return err
 	}
-	
-	delete(m.data, key)
+	m.table.delete(k)
 	return nil
 }
 
 // Helper methods for testing
 
-// SetData directly sets the internal data map (for testing)
+// SetData replaces the stored entities of type T. With an index map, the entities are
+// stored under the keys expanded from it, like Put stores them, and the keys of 'data'
+// are ignored; it panics if an entity cannot be stored.
 func (m *DataStore[T]) SetData(data map[string]T) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.data = data
+	if !m.indexed() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.data = data
+		return
+	}
+
+	m.Clear()
+	for _, entity := range data {
+		w, err := m.codec().PrepareWrite(context.Background(), entity, false)
+		if err != nil {
+			panic(fmt.Sprintf("mock: cannot store %+v: %v", entity, err))
+		}
+		m.table.put(w.Item)
+	}
 }
 
-// GetData returns a copy of the internal data map (for testing)
+// GetData returns a copy of the stored entities of type T, keyed by "PK|SK" when T has
+// an index map. It panics if a stored item cannot be unmarshaled.
 func (m *DataStore[T]) GetData() map[string]T {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	
-	result := make(map[string]T, len(m.data))
-	for k, v := range m.data {
-		result[k] = v
+	if !m.indexed() {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+
+		result := make(map[string]T, len(m.data))
+		for k, v := range m.data {
+			result[k] = v
+		}
+		return result
+	}
+
+	codec := m.codec()
+	result := make(map[string]T)
+	for k, item := range m.table.entries(m.isEntity) {
+		entity, err := codec.DecodeT(context.Background(), item)
+		if err != nil {
+			panic(fmt.Sprintf("mock: cannot read item %s: %v", k, err))
+		}
+		result[k.String()] = *entity
 	}
 	return result
 }
 
-// Count returns the number of stored entities
+// Count returns the number of stored entities of type T
 func (m *DataStore[T]) Count() int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return len(m.data)
+	if !m.indexed() {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		return len(m.data)
+	}
+	return len(m.table.entries(m.isEntity))
 }
 
-// Clear removes all data
+// Clear removes all entities of type T
 func (m *DataStore[T]) Clear() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.data = make(map[string]T)
+	if !m.indexed() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.data = make(map[string]T)
+		return
+	}
+	for k := range m.table.entries(m.isEntity) {
+		m.table.delete(k)
+	}
+}
+
+// isEntity reports whether a stored item is an entity of type T
+func (m *DataStore[T]) isEntity(item map[string]types.AttributeValue) bool {
+	entityType := registry.OrDefault(m.registry).ResolveEntityTypeFor(reflect.TypeOf((*T)(nil)).Elem(), items.StringAttr(item, "EntityType"))
+	return entityType == m.codec().EntityType()
+}
+
+// sortedData returns the entities of the key function mode in key order
+func (m *DataStore[T]) sortedData() []T {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.data))
+	for k := range m.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entities := make([]T, len(keys))
+	for i, k := range keys {
+		entities[i] = m.data[k]
+	}
+	return entities
 }
 
 // extractKey attempts to extract a key from an entity
@@ -242,8 +486,8 @@ func (m *DataStore[T]) extractKey(entity T) string {
 	if m.getKeyFunc != nil {
 		return m.getKeyFunc(entity)
 	}
-	
+
 	// Default: try to use ID field via reflection
 	// This is a simplified version for testing
 	return fmt.Sprintf("key_%v", entity)
-}
\ No newline at end of file
+}
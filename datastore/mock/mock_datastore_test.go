@@ -6,11 +6,16 @@ package mock_test
 
 import (
 	"context"
+	stderrors "errors"
+	"reflect"
 	"testing"
 	"time"
 	
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/suparena/entitystore/datastore/mock"
 	"github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
 	"github.com/suparena/entitystore/storagemodels"
 )
 
@@ -205,4 +210,261 @@ func TestMockDataStoreWithService(t *testing.T) {
 	if retrieved.Name != "John" {
 		t.Fatalf("Expected name John, got %s", retrieved.Name)
 	}
-}
\ No newline at end of file
+}
+
+type ValidatedEntity struct {
+	ID   string
+	Name string
+}
+
+func (e *ValidatedEntity) Validate() error {
+	if e.Name == "" {
+		return errors.NewValidationError("Name", "is required")
+	}
+	return nil
+}
+
+func TestMockDataStoreRunsHooks(t *testing.T) {
+	ctx := context.Background()
+	mockStore := mock.New[ValidatedEntity]().
+		WithGetKeyFunc(func(e ValidatedEntity) string { return e.ID })
+
+	if err := mockStore.Put(ctx, ValidatedEntity{ID: "1"}); !errors.IsValidationError(err) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if mockStore.Count() != 0 {
+		t.Error("invalid entity must not be stored")
+	}
+	if err := mockStore.Put(ctx, ValidatedEntity{ID: "1", Name: "ok"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+}
+
+func TestMockDataStoreWithRegistry(t *testing.T) {
+	ctx := context.Background()
+	reg := registry.New()
+	reg.RegisterHooks(reflect.TypeOf(TestEntity{}), registry.NewEntityHooks(registry.Hooks[TestEntity]{
+		BeforePut: func(ctx context.Context, e *TestEntity) error {
+			return stderrors.New("rejected by scoped registry")
+		},
+	}))
+
+	mockStore := mock.New[TestEntity]().
+		WithGetKeyFunc(func(e TestEntity) string { return e.ID }).
+		WithRegistry(reg)
+	if err := mockStore.Put(ctx, TestEntity{ID: "1", Name: "one"}); err == nil {
+		t.Error("expected the BeforePut hook of the scoped registry to run")
+	}
+
+	defaultStore := mock.New[TestEntity]().
+		WithGetKeyFunc(func(e TestEntity) string { return e.ID })
+	if err := defaultStore.Put(ctx, TestEntity{ID: "1", Name: "one"}); err != nil {
+		t.Errorf("Put with the default registry failed: %v", err)
+	}
+}
+
+type IndexedEntity struct {
+	Org     string
+	ID      string
+	Version int64
+}
+
+func indexedRegistry() *registry.Registry {
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(IndexedEntity{}), map[string]string{
+		"PK":       "ORG#{Org}",
+		"SK":       "USER#{ID}",
+		"@Version": "Version",
+	})
+	return reg
+}
+
+func orgQuery(org string) *storagemodels.QueryParams {
+	return &storagemodels.QueryParams{
+		KeyConditionExpression: "PK = :pk AND begins_with(SK, :prefix)",
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":     &types.AttributeValueMemberS{Value: "ORG#" + org},
+			":prefix": &types.AttributeValueMemberS{Value: "USER#"},
+		},
+	}
+}
+
+func TestMockDataStoreIndexed(t *testing.T) {
+	ctx := context.Background()
+	store := mock.New[IndexedEntity]().WithRegistry(indexedRegistry())
+	for _, id := range []string{"c", "a", "d", "b"} {
+		if err := store.Put(ctx, IndexedEntity{Org: "1", ID: id}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := store.Put(ctx, IndexedEntity{Org: "2", ID: "e"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	t.Run("GetByKey", func(t *testing.T) {
+		got, err := store.GetByKey(ctx, "ORG#1", "USER#b")
+		if err != nil || got.ID != "b" || got.Version != 1 {
+			t.Fatalf("GetByKey = %+v, %v", got, err)
+		}
+		if _, err := store.GetByKey(ctx, "ORG#2", "USER#b"); !errors.IsNotFound(err) {
+			t.Errorf("GetByKey of another partition returned %v, want NotFound", err)
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		params := orgQuery("1")
+		params.Limit = aws.Int32(3)
+		var ids []string
+		results, err := store.Query(ctx, params)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, r := range results {
+			ids = append(ids, r.(map[string]interface{})["ID"].(string))
+		}
+		params.ExclusiveStartKey = map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: "ORG#1"},
+			"SK": &types.AttributeValueMemberS{Value: "USER#c"},
+		}
+		results, err = store.Query(ctx, params)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, r := range results {
+			ids = append(ids, r.(map[string]interface{})["ID"].(string))
+		}
+		if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("pages = %v, want %v", ids, want)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		var ids []string
+		var pages []int
+		for r := range store.Stream(ctx, orgQuery("1"), storagemodels.WithPageSize(3)) {
+			if r.Error != nil {
+				t.Fatalf("Stream failed: %v", r.Error)
+			}
+			ids = append(ids, r.Item.ID)
+			pages = append(pages, r.Meta.PageNumber)
+		}
+		if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("Stream = %v, want %v", ids, want)
+		}
+		if want := []int{1, 1, 1, 2}; !reflect.DeepEqual(pages, want) {
+			t.Errorf("page numbers = %v, want %v", pages, want)
+		}
+	})
+
+	t.Run("HelperMethods", func(t *testing.T) {
+		data := store.GetData()
+		if len(data) != 5 || data["ORG#1|USER#a"].ID != "a" {
+			t.Errorf("GetData = %v", data)
+		}
+		store.SetData(map[string]IndexedEntity{"x": {Org: "3", ID: "x"}})
+		if store.Count() != 1 {
+			t.Errorf("Count = %d after SetData, want 1", store.Count())
+		}
+		if _, err := store.GetByKey(ctx, "ORG#3", "USER#x"); err != nil {
+			t.Errorf("GetByKey of the entity set failed: %v", err)
+		}
+	})
+}
+
+// recordingT records failures instead of failing the test
+type recordingT struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) { r.failed = true }
+
+func TestMockDataStoreCalls(t *testing.T) {
+	ctx := context.Background()
+	store := mock.New[TestEntity]().
+		WithGetKeyFunc(func(e TestEntity) string { return e.ID })
+
+	store.Put(ctx, TestEntity{ID: "1", Name: "One"})
+	store.GetOne(ctx, "1")
+	store.GetOne(ctx, "2")
+
+	calls := store.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("recorded %d calls, want 3", len(calls))
+	}
+	if calls[0].Method != "Put" || calls[0].Key != "1" || calls[0].Err != nil {
+		t.Errorf("first call = %+v", calls[0])
+	}
+	if !errors.IsNotFound(calls[2].Err) {
+		t.Errorf("the GetOne of a missing key recorded %v, want NotFound", calls[2].Err)
+	}
+
+	store.AssertCalled(t, "Put", TestEntity{ID: "1", Name: "One"})
+	store.AssertCalled(t, "GetOne", mock.Anything)
+	store.AssertNotCalled(t, "Delete")
+	store.AssertNumberOfCalls(t, "GetOne", 2)
+
+	rt := &recordingT{TB: t}
+	if store.AssertCalled(rt, "GetOne", "3") || !rt.failed {
+		t.Error("AssertCalled passed for a call that was not made")
+	}
+
+	store.ResetCalls()
+	if len(store.Calls()) != 0 {
+		t.Error("ResetCalls kept the calls")
+	}
+}
+
+func TestMockDataStoreFaults(t *testing.T) {
+	ctx := context.Background()
+	errUnavailable := stderrors.New("service unavailable")
+
+	t.Run("PerKey", func(t *testing.T) {
+		store := mock.New[IndexedEntity]().WithRegistry(indexedRegistry()).
+			WithFault(mock.Fault{Key: "ORG#1|USER#b", Err: errUnavailable})
+		if err := store.Put(ctx, IndexedEntity{Org: "1", ID: "a"}); err != nil {
+			t.Fatalf("Put of another key failed: %v", err)
+		}
+		if err := store.Put(ctx, IndexedEntity{Org: "1", ID: "b"}); err != errUnavailable {
+			t.Errorf("Put returned %v, want the injected error", err)
+		}
+		if _, err := store.GetByKey(ctx, "ORG#1", "USER#b"); err != errUnavailable {
+			t.Errorf("GetByKey returned %v, want the injected error", err)
+		}
+	})
+
+	t.Run("Nth", func(t *testing.T) {
+		store := mock.New[TestEntity]().
+			WithGetKeyFunc(func(e TestEntity) string { return e.ID }).
+			WithFault(mock.Fault{Method: "Put", Nth: 2, Err: errUnavailable})
+		for i, want := range []error{nil, errUnavailable, nil} {
+			if err := store.Put(ctx, TestEntity{ID: "1"}); err != want {
+				t.Errorf("Put %d returned %v, want %v", i+1, err, want)
+			}
+		}
+	})
+
+	t.Run("Latency", func(t *testing.T) {
+		store := mock.New[TestEntity]().
+			WithGetKeyFunc(func(e TestEntity) string { return e.ID }).
+			WithFault(mock.Fault{Method: "GetOne", Latency: time.Second})
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := store.GetOne(ctx, "1"); !stderrors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("GetOne returned %v, want the context deadline", err)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		store := mock.New[TestEntity]().WithFault(mock.Fault{Method: "Stream", Err: errUnavailable})
+		var errs []error
+		for r := range store.Stream(ctx, &storagemodels.QueryParams{}) {
+			errs = append(errs, r.Error)
+		}
+		if len(errs) != 1 || errs[0] != errUnavailable {
+			t.Errorf("Stream returned errors %v, want the injected error", errs)
+		}
+	})
+}
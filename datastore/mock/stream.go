@@ -0,0 +1,148 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package mock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// Stream sends the items matching 'params' as T on the returned channel, page by page
+// like Query with PageSize as Limit, and closes it when the query is exhausted, fails or
+// 'ctx' is done. Without an index map, every entity is streamed in key order. An
+// injected error is sent as the only result.
+func (m *DataStore[T]) Stream(ctx context.Context, params *storagemodels.QueryParams, opts ...storagemodels.StreamOption) <-chan storagemodels.StreamResult[T] {
+	call, err := m.enter(ctx, "Stream", "", params)
+	m.exit(call, &err)
+	if err != nil {
+		resultCh := make(chan storagemodels.StreamResult[T], 1)
+		resultCh <- storagemodels.StreamResult[T]{Error: err, Meta: storagemodels.StreamMeta{Timestamp: time.Now()}}
+		close(resultCh)
+		return resultCh
+	}
+	if m.streamFunc != nil {
+		return m.streamFunc(ctx, params, opts...)
+	}
+
+	options := storagemodels.DefaultStreamOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	resultCh := make(chan storagemodels.StreamResult[T], options.BufferSize)
+	if !m.indexed() {
+		go m.streamData(ctx, options, resultCh)
+	} else {
+		go m.streamWorker(ctx, params, options, resultCh)
+	}
+	return resultCh
+}
+
+// streamData streams the entities of the key function mode, numbering pages by PageSize
+func (m *DataStore[T]) streamData(ctx context.Context, options storagemodels.StreamOptions, resultCh chan<- storagemodels.StreamResult[T]) {
+	defer close(resultCh)
+
+	pageSize := int64(options.PageSize)
+	if pageSize <= 0 {
+		pageSize = 1
+	}
+	for i, v := range m.sortedData() {
+		index := int64(i)
+		select {
+		case <-ctx.Done():
+			return
+		case resultCh <- storagemodels.StreamResult[T]{
+			Item: v,
+			Meta: storagemodels.StreamMeta{
+				Index:      index,
+				PageNumber: int(index/pageSize) + 1,
+				Timestamp:  time.Now(),
+			},
+		}:
+		}
+	}
+}
+
+func (m *DataStore[T]) streamWorker(
+	ctx context.Context,
+	params *storagemodels.QueryParams,
+	options storagemodels.StreamOptions,
+	resultCh chan<- storagemodels.StreamResult[T],
+) {
+	defer close(resultCh)
+
+	var itemIndex int64
+	var pageNumber int
+	var errs []error
+	startTime := time.Now()
+	reportProgress := func(lastKey map[string]types.AttributeValue) {
+		if options.ProgressHandler == nil {
+			return
+		}
+		progress := storagemodels.StreamProgress{
+			ItemsProcessed: itemIndex,
+			PagesProcessed: pageNumber,
+			LastKey:        lastKey,
+			Errors:         errs,
+			StartTime:      startTime,
+		}
+		if elapsed := time.Since(startTime).Seconds(); elapsed > 0 {
+			progress.CurrentRate = float64(itemIndex) / elapsed
+		}
+		options.ProgressHandler(progress)
+	}
+	fail := func(err error) {
+		select {
+		case <-ctx.Done():
+		case resultCh <- storagemodels.StreamResult[T]{
+			Error: fmt.Errorf("query failed: %w", err),
+			Meta:  storagemodels.StreamMeta{Index: itemIndex, PageNumber: pageNumber, Timestamp: time.Now()},
+		}:
+		}
+	}
+
+	codec := m.codec()
+	q, err := codec.PlanQuery(params)
+	if err != nil {
+		fail(err)
+		return
+	}
+	q.Limit = int(options.PageSize)
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		page, lastKey, err := m.table.queryPage(q)
+		if err != nil {
+			fail(err)
+			return
+		}
+		pageNumber++
+
+		for _, item := range page {
+			result := codec.StreamResult(ctx, item, itemIndex, pageNumber)
+			itemIndex++
+			select {
+			case <-ctx.Done():
+				return
+			case resultCh <- result:
+			}
+			if result.Error != nil {
+				errs = append(errs, result.Error)
+			}
+		}
+
+		reportProgress(lastKey)
+		if lastKey == nil {
+			break
+		}
+		q.StartKey = lastKey
+	}
+	reportProgress(nil)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package mock
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/items"
+)
+
+// Table is the in-memory table of mocks whose entity types have index maps. It holds the
+// raw items the DynamoDB store would write, keyed by PK and SK.
+type Table struct {
+	mu    sync.Mutex
+	items map[items.Key]map[string]types.AttributeValue
+}
+
+// NewTable creates an empty table
+func NewTable() *Table {
+	return &Table{items: make(map[items.Key]map[string]types.AttributeValue)}
+}
+
+// get returns a copy of the item stored under 'k', nil when there is none
+func (t *Table) get(k items.Key) map[string]types.AttributeValue {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return items.Copy(t.items[k])
+}
+
+// put stores 'item' under its table key
+func (t *Table) put(item map[string]types.AttributeValue) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.items[items.KeyOf(item)] = item
+}
+
+// update replaces the item under 'k' with the one 'fn' returns for a copy of the
+// stored item, nil when there is none, unless 'fn' fails
+func (t *Table) update(k items.Key, fn func(existing map[string]types.AttributeValue) (map[string]types.AttributeValue, error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item, err := fn(items.Copy(t.items[k]))
+	if err != nil {
+		return err
+	}
+	t.items[k] = item
+	return nil
+}
+
+// delete removes the item under 'k'
+func (t *Table) delete(k items.Key) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.items, k)
+}
+
+// entries returns copies of the items 'match' accepts
+func (t *Table) entries(match func(item map[string]types.AttributeValue) bool) map[items.Key]map[string]types.AttributeValue {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := make(map[items.Key]map[string]types.AttributeValue)
+	for k, item := range t.items {
+		if match(item) {
+			res[k] = items.Copy(item)
+		}
+	}
+	return res
+}
+
+// queryPage reads one page of 'q' in index order and applies the filter. It returns the
+// matching items and the LastEvaluatedKey, nil when the page is the last one.
+func (t *Table) queryPage(q items.Query) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+	t.mu.Lock()
+	var read []map[string]types.AttributeValue
+	for _, item := range t.items {
+		if items.StringAttr(item, q.Index.PartitionKey) != q.PartitionValue {
+			continue
+		}
+		// Like a GSI, only items with both key attributes are indexed
+		if _, ok := item[q.Index.SortKey].(*types.AttributeValueMemberS); q.Index.SortKey != "" && !ok {
+			continue
+		}
+		if q.SortKey != nil && !q.SortKey.Matches(item[q.SortKey.Attribute]) {
+			continue
+		}
+		read = append(read, items.Copy(item))
+	}
+	t.mu.Unlock()
+
+	// after reports whether position 'p' comes after 'o' in the query direction
+	after := func(p, o items.Position) bool {
+		if q.Forward {
+			return p.Compare(o) > 0
+		}
+		return p.Compare(o) < 0
+	}
+	sort.Slice(read, func(i, j int) bool {
+		return after(q.PositionOf(read[j]), q.PositionOf(read[i]))
+	})
+	if start, ok := q.Start(); ok {
+		read = read[sort.Search(len(read), func(i int) bool {
+			return after(q.PositionOf(read[i]), start)
+		}):]
+	}
+
+	var lastKey map[string]types.AttributeValue
+	if q.Limit > 0 && len(read) >= q.Limit {
+		read = read[:q.Limit]
+		lastKey = q.LastKey(read[len(read)-1])
+	}
+	matched := read[:0]
+	for _, item := range read {
+		ok, err := q.Matches(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+	return matched, lastKey, nil
+}
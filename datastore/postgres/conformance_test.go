@@ -0,0 +1,29 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package postgres
+
+import (
+	"testing"
+
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/registry"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, reg *registry.Registry) conformance.Stores {
+		db := testDB(t)
+		table := testTable(t, db)
+
+		items, err := NewPostgresDataStore[conformance.Item](db, table, WithRegistry(reg))
+		if err != nil {
+			t.Fatalf("NewPostgresDataStore failed: %v", err)
+		}
+		notes, err := NewPostgresDataStore[conformance.Note](db, table, WithRegistry(reg))
+		if err != nil {
+			t.Fatalf("NewPostgresDataStore failed: %v", err)
+		}
+		return conformance.Stores{Items: items, Notes: notes, Create: items.Create}
+	})
+}
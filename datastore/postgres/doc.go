@@ -0,0 +1,38 @@
+/*
+Package postgres provides a PostgreSQL implementation of the DataStore interface for
+on-premises deployments.
+
+Items are stored as JSONB in one row per PK and SK, and every GSI used by an index map
+gets generated key columns and an index. PostgreSQL 12 or later is required.
+
+	db, err := postgres.Open("postgres://app@localhost:5432/app?sslmode=disable")
+	if err != nil {
+	    return err
+	}
+	users, err := postgres.NewPostgresDataStore[User](db, "entities")
+
+Queries take the same QueryParams as DynamoDB. Key conditions support equality on the
+partition key and =, <, <=, >, >=, BETWEEN and begins_with on the sort key, and are
+translated to SQL on the key columns. Filter expressions comparing top-level attributes
+with string or number values, with attribute_exists, attribute_not_exists, begins_with,
+AND, OR and NOT, are translated to SQL on the JSONB item; other filter expressions are
+evaluated on the items read:
+
+	results, err := users.Query(ctx, &storagemodels.QueryParams{
+	    KeyConditionExpression: "PK1 = :pk AND begins_with(SK1, :prefix)",
+	    FilterExpression:       aws.String("Status = :status"),
+	    IndexName:              aws.String("GSI1"),
+	    ExpressionAttributeValues: map[string]types.AttributeValue{
+	        ":pk":     &types.AttributeValueMemberS{Value: "ORG#1"},
+	        ":prefix": &types.AttributeValueMemberS{Value: "USER#"},
+	        ":status": &types.AttributeValueMemberS{Value: "active"},
+	    },
+	})
+
+Writes lock the stored item with SELECT ... FOR UPDATE and check Create, @Version and
+UpdateWithCondition conditions against it in the same transaction.
+
+The integration tests run against the database of ENTITYSTORE_POSTGRES_DSN or, without
+it, a temporary server started from the initdb and pg_ctl binaries on PATH.
+*/
+package postgres
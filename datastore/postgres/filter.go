@@ -0,0 +1,220 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/expression"
+)
+
+// sqlArgs collects the arguments of a statement and numbers their placeholders
+type sqlArgs struct {
+	values []any
+}
+
+// add appends an argument and returns its placeholder
+func (a *sqlArgs) add(v any) string {
+	a.values = append(a.values, v)
+	return fmt.Sprintf("$%d", len(a.values))
+}
+
+// stringAttrSQL extracts the string attribute 'name' of the Item column, NULL when it
+// is missing or not a string
+func stringAttrSQL(name string) string {
+	return fmt.Sprintf(`(%s->%s->>'S')`, quote(columnItem), literal(name))
+}
+
+// numberAttrSQL extracts the number attribute 'name' of the Item column as numeric,
+// NULL when it is missing or not a number
+func numberAttrSQL(name string) string {
+	return fmt.Sprintf(`((%s->%s->>'N')::numeric)`, quote(columnItem), literal(name))
+}
+
+// filterSQL translates a filter expression to an SQL condition on the Item column,
+// appending its arguments to 'args'. It reports false, leaving 'args' unchanged, when
+// the expression uses a construct outside the supported subset:
+//
+//   - comparisons, BETWEEN and IN of a top-level attribute with string or number values
+//   - attribute_exists, attribute_not_exists and begins_with on top-level attributes
+//   - AND, OR, NOT and parentheses
+//
+// Other expressions, e.g. on nested paths, sets, size() or contains, are evaluated on
+// the items read instead. The translation keeps the DynamoDB semantics for missing and
+// differently typed attributes: only <> holds for them.
+func filterSQL(c expression.Condition, args *sqlArgs) (string, bool) {
+	t := &sqlArgs{values: append([]any(nil), args.values...)}
+	sql, ok := conditionSQL(c, t)
+	if ok {
+		args.values = t.values
+	}
+	return sql, ok
+}
+
+func conditionSQL(c expression.Condition, args *sqlArgs) (string, bool) {
+	switch c := c.(type) {
+	case expression.And, expression.Or:
+		return binarySQL(c, args)
+	case expression.Not:
+		inner, ok := conditionSQL(c.Condition, args)
+		if !ok {
+			return "", false
+		}
+		return "NOT " + inner, true
+	case expression.Compare:
+		typ, ok := valueType(c.Left, c.Right)
+		if !ok {
+			return "", false
+		}
+		left, lok := operandSQL(c.Left, typ, args)
+		right, rok := operandSQL(c.Right, typ, args)
+		if !lok || !rok {
+			return "", false
+		}
+		if c.Op == "<>" {
+			return fmt.Sprintf("(%s IS DISTINCT FROM %s)", left, right), true
+		}
+		return predicate(fmt.Sprintf("%s %s %s", left, c.Op, right)), true
+	case expression.Between:
+		typ, ok := valueType(c.Operand, c.Low, c.High)
+		if !ok {
+			return "", false
+		}
+		operand, ok1 := operandSQL(c.Operand, typ, args)
+		low, ok2 := operandSQL(c.Low, typ, args)
+		high, ok3 := operandSQL(c.High, typ, args)
+		if !ok1 || !ok2 || !ok3 {
+			return "", false
+		}
+		return predicate(fmt.Sprintf("%s BETWEEN %s AND %s", operand, low, high)), true
+	case expression.In:
+		typ, ok := valueType(append([]expression.Operand{c.Operand}, c.List...)...)
+		if !ok {
+			return "", false
+		}
+		operand, ok := operandSQL(c.Operand, typ, args)
+		if !ok {
+			return "", false
+		}
+		list := make([]string, len(c.List))
+		for i, op := range c.List {
+			if list[i], ok = operandSQL(op, typ, args); !ok {
+				return "", false
+			}
+		}
+		return predicate(fmt.Sprintf("%s IN (%s)", operand, strings.Join(list, ", "))), true
+	case expression.Function:
+		return functionSQL(c, args)
+	}
+	return "", false
+}
+
+// binarySQL translates AND and OR
+func binarySQL(c expression.Condition, args *sqlArgs) (string, bool) {
+	var left, right expression.Condition
+	op := "AND"
+	switch c := c.(type) {
+	case expression.And:
+		left, right = c.Left, c.Right
+	case expression.Or:
+		left, right, op = c.Left, c.Right, "OR"
+	}
+	l, ok := conditionSQL(left, args)
+	if !ok {
+		return "", false
+	}
+	r, ok := conditionSQL(right, args)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("(%s %s %s)", l, op, r), true
+}
+
+func functionSQL(f expression.Function, args *sqlArgs) (string, bool) {
+	name, ok := f.Path.Attribute()
+	if !ok {
+		return "", false
+	}
+	switch f.Name {
+	case "attribute_exists":
+		return fmt.Sprintf("(%s ? %s)", quote(columnItem), args.add(name)), true
+	case "attribute_not_exists":
+		return fmt.Sprintf("(NOT (%s ? %s))", quote(columnItem), args.add(name)), true
+	case "begins_with":
+		v, ok := f.Arg.(expression.Value)
+		if !ok {
+			return "", false
+		}
+		prefix, ok := v.Value.(*types.AttributeValueMemberS)
+		if !ok {
+			return "", false
+		}
+		return predicate(fmt.Sprintf("starts_with(%s, %s::text)", stringAttrSQL(name), args.add(prefix.Value))), true
+	}
+	return "", false
+}
+
+// predicate turns the NULL of a comparison with a missing attribute into false, so
+// that NOT negates it like DynamoDB does
+func predicate(sql string) string {
+	return fmt.Sprintf("COALESCE(%s, false)", sql)
+}
+
+// valueType returns the attribute type, "S" or "N", of the values among 'operands'. It
+// reports false unless there is at least one value, all values have that type and the
+// other operands are top-level attributes.
+func valueType(operands ...expression.Operand) (string, bool) {
+	typ := ""
+	for _, op := range operands {
+		switch op := op.(type) {
+		case expression.Value:
+			var t string
+			switch op.Value.(type) {
+			case *types.AttributeValueMemberS:
+				t = "S"
+			case *types.AttributeValueMemberN:
+				t = "N"
+			default:
+				return "", false
+			}
+			if typ != "" && typ != t {
+				return "", false
+			}
+			typ = t
+		case expression.Path:
+			if _, ok := op.Attribute(); !ok {
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+	return typ, typ != ""
+}
+
+// operandSQL translates an operand compared as type 'typ'
+func operandSQL(op expression.Operand, typ string, args *sqlArgs) (string, bool) {
+	switch op := op.(type) {
+	case expression.Path:
+		name, ok := op.Attribute()
+		if !ok {
+			return "", false
+		}
+		if typ == "N" {
+			return numberAttrSQL(name), true
+		}
+		return stringAttrSQL(name) + ` COLLATE "C"`, true
+	case expression.Value:
+		switch v := op.Value.(type) {
+		case *types.AttributeValueMemberS:
+			return args.add(v.Value) + "::text", true
+		case *types.AttributeValueMemberN:
+			return args.add(v.Value) + "::numeric", true
+		}
+	}
+	return "", false
+}
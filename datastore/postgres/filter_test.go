@@ -0,0 +1,229 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package postgres
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/expression"
+	"github.com/suparena/entitystore/datastore/internal/items"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+var filterValues = map[string]types.AttributeValue{
+	":s": &types.AttributeValueMemberS{Value: "active"},
+	":t": &types.AttributeValueMemberS{Value: "blocked"},
+	":n": &types.AttributeValueMemberN{Value: "18"},
+	":m": &types.AttributeValueMemberN{Value: "65"},
+	":b": &types.AttributeValueMemberBOOL{Value: true},
+}
+
+func TestFilterSQL(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+		args []any
+	}{
+		{
+			expr: "Status = :s",
+			want: `COALESCE(("Item"->'Status'->>'S') COLLATE "C" = $2::text, false)`,
+			args: []any{"active"},
+		},
+		{
+			expr: "Status <> :s",
+			want: `(("Item"->'Status'->>'S') COLLATE "C" IS DISTINCT FROM $2::text)`,
+			args: []any{"active"},
+		},
+		{
+			expr: ":n <= Age",
+			want: `COALESCE($2::numeric <= (("Item"->'Age'->>'N')::numeric), false)`,
+			args: []any{"18"},
+		},
+		{
+			expr: "Age BETWEEN :n AND :m",
+			want: `COALESCE((("Item"->'Age'->>'N')::numeric) BETWEEN $2::numeric AND $3::numeric, false)`,
+			args: []any{"18", "65"},
+		},
+		{
+			expr: "#s IN (:s, :t)",
+			want: `COALESCE(("Item"->'Status'->>'S') COLLATE "C" IN ($2::text, $3::text), false)`,
+			args: []any{"active", "blocked"},
+		},
+		{
+			expr: "attribute_exists(Email) AND (attribute_not_exists(Deleted) OR NOT begins_with(Status, :s))",
+			want: `(("Item" ? $2) AND ((NOT ("Item" ? $3)) OR NOT COALESCE(starts_with(("Item"->'Status'->>'S'), $4::text), false)))`,
+			args: []any{"Email", "Deleted", "active"},
+		},
+		{
+			expr: "#q = :s",
+			want: `COALESCE(("Item"->'O''Brien'->>'S') COLLATE "C" = $2::text, false)`,
+			args: []any{"active"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := expression.Parse(tt.expr, map[string]string{"#s": "Status", "#q": "O'Brien"}, filterValues)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			args := &sqlArgs{values: []any{"ORG#1"}}
+			got, ok := filterSQL(c, args)
+			if !ok {
+				t.Fatal("filterSQL did not translate the expression")
+			}
+			if got != tt.want {
+				t.Errorf("filterSQL =\n%s\nwant\n%s", got, tt.want)
+			}
+			if want := append([]any{"ORG#1"}, tt.args...); !reflect.DeepEqual(args.values, want) {
+				t.Errorf("args = %v, want %v", args.values, want)
+			}
+		})
+	}
+}
+
+func TestFilterSQLUnsupported(t *testing.T) {
+	for _, expr := range []string{
+		"Profile.Name = :s",
+		"Tags[0] = :s",
+		"contains(Status, :s)",
+		"size(Status) > :n",
+		"Status = Other",
+		"Active = :b",
+		"Status IN (:s, :n)",
+		"Status = :s AND contains(Tags, :s)",
+	} {
+		c, err := expression.Parse(expr, nil, filterValues)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", expr, err)
+		}
+		args := &sqlArgs{values: []any{"ORG#1"}}
+		if sql, ok := filterSQL(c, args); ok {
+			t.Errorf("filterSQL(%q) = %s, want it evaluated on the items read", expr, sql)
+		}
+		if len(args.values) != 1 {
+			t.Errorf("filterSQL(%q) left args %v, want them unchanged", expr, args.values)
+		}
+	}
+}
+
+func TestSelectSQL(t *testing.T) {
+	store := &PostgresDataStore[PGTestUser]{
+		tableName: "entities",
+		codec:     items.Codec[PGTestUser]{Registry: registry.New()},
+	}
+	plan := func(p *storagemodels.QueryParams) items.Query {
+		q, err := store.codec.PlanQuery(p)
+		if err != nil {
+			t.Fatalf("PlanQuery failed: %v", err)
+		}
+		return q
+	}
+	values := func(kv ...string) map[string]types.AttributeValue {
+		m := map[string]types.AttributeValue{}
+		for i := 0; i < len(kv); i += 2 {
+			m[kv[i]] = &types.AttributeValueMemberS{Value: kv[i+1]}
+		}
+		return m
+	}
+
+	tests := []struct {
+		name   string
+		params *storagemodels.QueryParams
+		want   string
+		args   []any
+		mode   filterMode
+	}{
+		{
+			name: "begins_with",
+			params: &storagemodels.QueryParams{
+				KeyConditionExpression:    "PK = :pk AND begins_with(SK, :p)",
+				ExpressionAttributeValues: values(":pk", "ORG#1", ":p", "USER#"),
+			},
+			want: `SELECT "Item" FROM "entities" WHERE "PK" = $1 AND "SK" >= $2 AND "SK" < $3 ORDER BY "SK" ASC, "PK" ASC, "SK" ASC`,
+			args: []any{"ORG#1", "USER#", "USER$"},
+		},
+		{
+			name: "GSI in reverse order after a start key",
+			params: &storagemodels.QueryParams{
+				KeyConditionExpression:    "PK1 = :pk AND SK1 < :sk",
+				IndexName:                 aws.String("GSI1"),
+				ScanIndexForward:          aws.Bool(false),
+				ExpressionAttributeValues: values(":pk", "EMAIL#a", ":sk", "USER#z"),
+				ExclusiveStartKey:         values("PK", "ORG#1", "SK", "USER#b", "PK1", "EMAIL#a", "SK1", "USER#b"),
+			},
+			want: `SELECT "Item" FROM "entities" WHERE "PK1" = $1 AND "SK1" IS NOT NULL AND "SK1" < $2 AND ("SK1", "PK", "SK") < ($5, $3, $4) ORDER BY "SK1" DESC, "PK" DESC, "SK" DESC`,
+			args: []any{"EMAIL#a", "USER#z", "ORG#1", "USER#b", "USER#b"},
+		},
+		{
+			name: "filter in the WHERE clause",
+			params: &storagemodels.QueryParams{
+				KeyConditionExpression:    "PK = :pk",
+				FilterExpression:          aws.String("Status = :s"),
+				ExpressionAttributeValues: values(":pk", "ORG#1", ":s", "active"),
+			},
+			want: `SELECT "Item" FROM "entities" WHERE "PK" = $1 AND COALESCE(("Item"->'Status'->>'S') COLLATE "C" = $2::text, false) ORDER BY "SK" ASC, "PK" ASC, "SK" ASC`,
+			args: []any{"ORG#1", "active"},
+			mode: filterWhere,
+		},
+		{
+			name: "filter column with a limit",
+			params: &storagemodels.QueryParams{
+				KeyConditionExpression:    "PK = :pk",
+				FilterExpression:          aws.String("Status = :s"),
+				Limit:                     aws.Int32(10),
+				ExpressionAttributeValues: values(":pk", "ORG#1", ":s", "active"),
+			},
+			want: `SELECT "Item", COALESCE(("Item"->'Status'->>'S') COLLATE "C" = $2::text, false) FROM "entities" WHERE "PK" = $1 ORDER BY "SK" ASC, "PK" ASC, "SK" ASC LIMIT $3`,
+			args: []any{"ORG#1", "active", 10},
+			mode: filterColumn,
+		},
+		{
+			name: "filter evaluated on the items read",
+			params: &storagemodels.QueryParams{
+				KeyConditionExpression:    "PK = :pk",
+				FilterExpression:          aws.String("contains(Status, :s)"),
+				ExpressionAttributeValues: values(":pk", "ORG#1", ":s", "active"),
+			},
+			want: `SELECT "Item" FROM "entities" WHERE "PK" = $1 ORDER BY "SK" ASC, "PK" ASC, "SK" ASC`,
+			args: []any{"ORG#1"},
+			mode: filterGo,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args, mode := store.selectSQL(plan(tt.params))
+			if got != tt.want {
+				t.Errorf("selectSQL =\n%s\nwant\n%s", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+			if mode != tt.mode {
+				t.Errorf("filter mode = %d, want %d", mode, tt.mode)
+			}
+		})
+	}
+}
+
+func TestPrefixUpperBound(t *testing.T) {
+	tests := map[string]string{
+		"USER#":       "USER$",
+		"a\x7f":       "a\u0080",
+		"é":           "ê",
+		"a\U0010FFFF": "b",
+	}
+	for prefix, want := range tests {
+		if got, ok := prefixUpperBound(prefix); !ok || got != want {
+			t.Errorf("prefixUpperBound(%q) = %q, %v, want %q", prefix, got, ok, want)
+		}
+	}
+	if _, ok := prefixUpperBound("\U0010FFFF"); ok {
+		t.Error("prefixUpperBound of the greatest code point reported a bound")
+	}
+}
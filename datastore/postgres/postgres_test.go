@@ -0,0 +1,138 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package postgres
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// PGTestUser is stored in organization partitions and indexed by email on GSI1
+type PGTestUser struct {
+	Org   string
+	ID    string
+	Email string
+}
+
+// PGTestTeam shares the organization partitions with PGTestUser
+type PGTestTeam struct {
+	Org  string
+	ID   string
+	Name string
+}
+
+func testRegistry() *registry.Registry {
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(PGTestUser{}), map[string]string{
+		"PK":     "ORG#{Org}",
+		"SK":     "USER#{ID}",
+		"GSI1PK": "EMAIL#{Email}",
+		"GSI1SK": "USER#{ID}",
+	})
+	reg.RegisterIndexMap(reflect.TypeOf(PGTestTeam{}), map[string]string{
+		"PK": "ORG#{Org}",
+		"SK": "TEAM#{ID}",
+	})
+	reg.RegisterType("PGTestTeam", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &PGTestTeam{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	return reg
+}
+
+func TestIndexColumnsAddedToExistingTable(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	table := testTable(t, db)
+
+	reg := testRegistry()
+	reg.RegisterIndexMap(reflect.TypeOf(PGTestTeam{}), map[string]string{
+		"PK":         "ORG#{Org}",
+		"SK":         "TEAM#{ID}",
+		"OrgIndexPK": "TEAMS#{Org}",
+		"OrgIndexSK": "{Name}",
+	})
+	teams, err := NewPostgresDataStore[PGTestTeam](db, table, WithRegistry(reg))
+	if err != nil {
+		t.Fatalf("NewPostgresDataStore failed: %v", err)
+	}
+	for _, team := range []PGTestTeam{{Org: "1", ID: "t1", Name: "Platform"}, {Org: "1", ID: "t2", Name: "Core"}} {
+		if err := teams.Put(ctx, team); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// A GSI registered later gets key columns generated from the stored items
+	reg.RegisterGSI("GSI2", "OrgIndexPK", "OrgIndexSK")
+	results, err := teams.Query(ctx, &storagemodels.QueryParams{
+		KeyConditionExpression: "OrgIndexPK = :pk",
+		IndexName:              aws.String("GSI2"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "TEAMS#1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 2 || results[0].(*PGTestTeam).Name != "Core" {
+		t.Errorf("GSI2 Query = %v, want both teams ordered by name", results)
+	}
+
+	var def string
+	err = db.QueryRowContext(ctx, `SELECT indexdef FROM pg_indexes WHERE tablename = $1 AND indexname = $2`,
+		table, table+"_GSI2").Scan(&def)
+	if err != nil {
+		t.Fatalf("index of GSI2 not found: %v", err)
+	}
+	if want := `("OrgIndexPK", "OrgIndexSK", "PK", "SK")`; !strings.Contains(def, want) {
+		t.Errorf("index of GSI2 = %s, want the columns %s", def, want)
+	}
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	users, err := NewPostgresDataStore[PGTestUser](db, testTable(t, db), WithRegistry(testRegistry()))
+	if err != nil {
+		t.Fatalf("NewPostgresDataStore failed: %v", err)
+	}
+
+	const writers = 8
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- users.Create(ctx, PGTestUser{Org: "1", ID: "a"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !eserrors.IsAlreadyExists(err):
+			t.Errorf("Create = %v, want nil or AlreadyExists", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d concurrent Creates succeeded, want 1", created)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/expression"
+	"github.com/suparena/entitystore/datastore/internal/items"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// filterMode is where the filter expression of a query is applied
+type filterMode int
+
+const (
+	// filterNone: the query has no filter expression
+	filterNone filterMode = iota
+	// filterWhere: the filter is part of the WHERE clause
+	filterWhere
+	// filterColumn: the filter is selected as a column, so that Limit still counts the
+	// items read before filtering
+	filterColumn
+	// filterGo: the filter is outside the SQL subset and evaluated on the items read
+	filterGo
+)
+
+// Query runs the key condition of 'params' on the table or GSI and returns the matching
+// items, each unmarshaled to the type registered for its EntityType. Like a single
+// DynamoDB Query call, Limit caps the items read before the filter expression is
+// applied, and ExclusiveStartKey resumes after a previous page.
+func (s *PostgresDataStore[T]) Query(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error) {
+	q, err := s.codec.PlanQuery(params)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	page, _, err := s.queryPage(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	var results []interface{}
+	for _, item := range page {
+		obj, err := s.codec.Decode(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, obj)
+	}
+	return results, nil
+}
+
+// queryPage reads one page of 'q' and applies the filter. It returns the matching items
+// and the LastEvaluatedKey, nil when the page is the last one.
+func (s *PostgresDataStore[T]) queryPage(ctx context.Context, q items.Query) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+	if q.Index.Name != "" {
+		if err := s.ensureIndex(ctx, q.Index); err != nil {
+			return nil, nil, err
+		}
+	}
+	query, args, mode := s.selectSQL(q)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var read, matched []map[string]types.AttributeValue
+	for rows.Next() {
+		var data []byte
+		ok := true
+		dest := []any{&data}
+		if mode == filterColumn {
+			dest = append(dest, &ok)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		item, err := items.UnmarshalJSON(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		read = append(read, item)
+		if mode == filterGo {
+			if ok, err = q.Matches(item); err != nil {
+				return nil, nil, err
+			}
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var lastKey map[string]types.AttributeValue
+	if q.Limit > 0 && len(read) == q.Limit {
+		lastKey = q.LastKey(read[len(read)-1])
+	}
+	return matched, lastKey, nil
+}
+
+// selectSQL translates 'q' to SQL: the key condition, start key, order and limit, and
+// the filter when it is within the supported subset
+func (s *PostgresDataStore[T]) selectSQL(q items.Query) (string, []any, filterMode) {
+	args := &sqlArgs{}
+	pkColumn := quote(q.Index.PartitionKey)
+	// Items with equal index sort keys are ordered by their table key
+	order := []string{quote(columnPK), quote(columnSK)}
+	skColumn := ""
+	if q.Index.SortKey != "" {
+		skColumn = quote(q.Index.SortKey)
+		order = append([]string{skColumn}, order...)
+	}
+
+	where := []string{pkColumn + " = " + args.add(q.PartitionValue)}
+	if q.Index.Name != "" && skColumn != "" {
+		// Like a GSI, only items with both key attributes are indexed
+		where = append(where, skColumn+" IS NOT NULL")
+	}
+	if q.SortKey != nil {
+		values := q.SortValues()
+		switch q.SortKey.Op {
+		case expression.OpBetween:
+			where = append(where, fmt.Sprintf("%s BETWEEN %s AND %s", skColumn, args.add(values[0]), args.add(values[1])))
+		case expression.OpBeginsWith:
+			where = append(where, skColumn+" >= "+args.add(values[0]))
+			if upper, ok := prefixUpperBound(values[0]); ok {
+				where = append(where, skColumn+" < "+args.add(upper))
+			}
+		default:
+			where = append(where, skColumn+" "+q.SortKey.Op+" "+args.add(values[0]))
+		}
+	}
+
+	direction, after := "ASC", ">"
+	if !q.Forward {
+		direction, after = "DESC", "<"
+	}
+	if start, ok := q.Start(); ok {
+		startValues := []string{args.add(start.Key.PK), args.add(start.Key.SK)}
+		if skColumn != "" {
+			startValues = append([]string{args.add(start.SortKey)}, startValues...)
+		}
+		where = append(where, fmt.Sprintf("(%s) %s (%s)", strings.Join(order, ", "), after, strings.Join(startValues, ", ")))
+	}
+	for i := range order {
+		order[i] += " " + direction
+	}
+
+	columns := quote(columnItem)
+	mode := filterNone
+	if q.Filter != nil {
+		mode = filterGo
+		if filter, ok := filterSQL(q.Filter, args); ok {
+			if q.Limit > 0 {
+				mode = filterColumn
+				columns += ", " + filter
+			} else {
+				mode = filterWhere
+				where = append(where, filter)
+			}
+		}
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s`,
+		columns, quote(s.tableName), strings.Join(where, " AND "), strings.Join(order, ", "))
+	if q.Limit > 0 {
+		query += " LIMIT " + args.add(q.Limit)
+	}
+	return query, args.values, mode
+}
+
+// prefixUpperBound returns the least string greater than every string starting with
+// 'prefix', reporting false when there is none. It increments the last code point that
+// can be, so that the bound stays valid UTF-8 as PostgreSQL requires.
+func prefixUpperBound(prefix string) (string, bool) {
+	r := []rune(prefix)
+	for i := len(r) - 1; i >= 0; i-- {
+		if r[i] < utf8.MaxRune {
+			next := r[i] + 1
+			if next >= 0xD800 && next <= 0xDFFF {
+				next = 0xE000 // Skip the surrogates
+			}
+			return string(append(r[:i], next)), true
+		}
+	}
+	return "", false
+}
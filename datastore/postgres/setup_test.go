@@ -0,0 +1,115 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The integration tests run against the database of ENTITYSTORE_POSTGRES_DSN or, when
+// it is not set, a throwaway server started from the initdb and pg_ctl binaries on PATH,
+// listening on a Unix socket only. They are skipped when neither is available.
+const dsnEnv = "ENTITYSTORE_POSTGRES_DSN"
+
+var (
+	serverOnce sync.Once
+	serverDSN  string
+	serverErr  error
+	stopServer func()
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if stopServer != nil {
+		stopServer()
+	}
+	os.Exit(code)
+}
+
+// testDB connects to the test database, skipping the test without one
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		serverOnce.Do(func() {
+			serverDSN, stopServer, serverErr = startServer()
+		})
+		if serverErr != nil {
+			t.Skipf("PostgreSQL not available, set %s or put initdb and pg_ctl on PATH: %v", dsnEnv, serverErr)
+		}
+		dsn = serverDSN
+	}
+
+	db, err := Open(dsn)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatalf("failed to connect to PostgreSQL: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var nonIdentChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// testTable returns a table name unique to the test, dropping the table afterwards
+func testTable(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	table := "entitystore_" + nonIdentChars.ReplaceAllString(strings.ToLower(t.Name()), "_")
+	if len(table) > 48 {
+		// Keep room for index name suffixes within the 63 byte identifier limit
+		h := fnv.New32a()
+		h.Write([]byte(t.Name()))
+		table = fmt.Sprintf("%s_%08x", table[:39], h.Sum32())
+	}
+	if _, err := db.Exec("DROP TABLE IF EXISTS " + quote(table)); err != nil {
+		t.Fatalf("failed to drop table %s: %v", table, err)
+	}
+	t.Cleanup(func() { db.Exec("DROP TABLE IF EXISTS " + quote(table)) })
+	return table
+}
+
+// startServer initializes a database cluster in a temporary directory and starts it,
+// returning its DSN and a function stopping it and removing the directory
+func startServer() (string, func(), error) {
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		return "", nil, err
+	}
+	pgCtl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp("", "entitystore-pg")
+	if err != nil {
+		return "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+	if out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb failed: %v: %s", err, out)
+	}
+	options := fmt.Sprintf("-c listen_addresses='' -k %s -F", dir)
+	start := exec.Command(pgCtl, "-D", data, "-o", options, "-l", filepath.Join(dir, "server.log"), "-w", "start")
+	if out, err := start.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start failed: %v: %s", err, out)
+	}
+	stop := func() {
+		_ = exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}
+	return fmt.Sprintf("host=%s user=postgres dbname=postgres sslmode=disable", dir), stop, nil
+}
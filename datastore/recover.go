@@ -0,0 +1,43 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error returned for a call that panicked
+type PanicError struct {
+	Operation string
+	Value     any
+	Stack     []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in DataStore %s: %v", e.Operation, e.Value)
+}
+
+// Unwrap returns the panic value when it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Recover turns panics of the next handlers into PanicErrors. Panics of the goroutine
+// producing a stream happen after the call returns and are not recovered.
+func Recover[T any]() Middleware[T] {
+	return func(next Handler[T]) Handler[T] {
+		return func(ctx context.Context, call *Call[T]) (res Result[T], err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					res, err = Result[T]{}, &PanicError{Operation: call.Operation, Value: r, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, call)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/suparena/entitystore/datastore/conformance"
+	"github.com/suparena/entitystore/registry"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, reg *registry.Registry) conformance.Stores {
+		db, err := Open(filepath.Join(t.TempDir(), "entities.db"))
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		items, err := NewSQLiteDataStore[conformance.Item](db, "entities", WithRegistry(reg))
+		if err != nil {
+			t.Fatalf("NewSQLiteDataStore failed: %v", err)
+		}
+		notes, err := NewSQLiteDataStore[conformance.Note](db, "entities", WithRegistry(reg))
+		if err != nil {
+			t.Fatalf("NewSQLiteDataStore failed: %v", err)
+		}
+		return conformance.Stores{Items: items, Notes: notes, Create: items.Create}
+	})
+}
@@ -0,0 +1,34 @@
+/*
+Package sqlite provides a SQLite implementation of the DataStore interface for local
+development, tests and single-node deployments.
+
+The SQLiteDataStore keeps the single-table layout of the ddb package: entities are stored
+under the PK and SK expanded from their registered index map, with the EntityType and
+SchemaVersion attributes, so the same models, hooks, lifecycle directives and upcasters
+work unchanged. Every GSI used by an index map gets generated key columns and an index.
+
+	db, err := sqlite.Open("entities.db")
+	if err != nil {
+	    return err
+	}
+	users, err := sqlite.NewSQLiteDataStore[User](db, "entities")
+
+Queries take the same QueryParams as DynamoDB. Key conditions support equality on the
+partition key and =, <, <=, >, >=, BETWEEN and begins_with on the sort key; filter
+expressions support the DynamoDB condition syntax:
+
+	results, err := users.Query(ctx, &storagemodels.QueryParams{
+	    KeyConditionExpression: "PK1 = :pk AND begins_with(SK1, :prefix)",
+	    FilterExpression:       aws.String("Status = :status"),
+	    IndexName:              aws.String("GSI1"),
+	    ExpressionAttributeValues: map[string]types.AttributeValue{
+	        ":pk":     &types.AttributeValueMemberS{Value: "ORG#1"},
+	        ":prefix": &types.AttributeValueMemberS{Value: "USER#"},
+	        ":status": &types.AttributeValueMemberS{Value: "active"},
+	    },
+	})
+
+Conditions passed to UpdateWithCondition are evaluated against the stored item in the
+same transaction as the update.
+*/
+package sqlite
@@ -0,0 +1,165 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/datastore/internal/expression"
+	"github.com/suparena/entitystore/datastore/internal/items"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// Query runs the key condition of 'params' on the table or GSI and returns the matching
+// items, each unmarshaled to the type registered for its EntityType. Like a single
+// DynamoDB Query call, Limit caps the items read before the filter expression is
+// applied, and ExclusiveStartKey resumes after a previous page.
+func (s *SQLiteDataStore[T]) Query(ctx context.Context, params *storagemodels.QueryParams) ([]interface{}, error) {
+	q, err := s.codec.PlanQuery(params)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	page, _, err := s.queryPage(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	var results []interface{}
+	for _, item := range page {
+		obj, err := s.codec.Decode(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, obj)
+	}
+	return results, nil
+}
+
+// queryPage reads one page of 'q' and applies the filter. It returns the matching items
+// and the LastEvaluatedKey, nil when the page is the last one.
+func (s *SQLiteDataStore[T]) queryPage(ctx context.Context, q items.Query) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+	if q.Index.Name != "" {
+		if err := s.ensureIndex(ctx, q.Index); err != nil {
+			return nil, nil, err
+		}
+	}
+	query, args := s.selectSQL(q)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var read []map[string]types.AttributeValue
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		item, err := items.UnmarshalJSON([]byte(data))
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		read = append(read, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var lastKey map[string]types.AttributeValue
+	if q.Limit > 0 && len(read) == q.Limit {
+		lastKey = q.LastKey(read[len(read)-1])
+	}
+	matched := read[:0]
+	for _, item := range read {
+		ok, err := q.Matches(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+	return matched, lastKey, nil
+}
+
+// selectSQL translates the key condition, start key, order and limit of 'q' to SQL
+func (s *SQLiteDataStore[T]) selectSQL(q items.Query) (string, []any) {
+	pkColumn := quote(q.Index.PartitionKey)
+	// Items with equal index sort keys are ordered by their table key
+	order := []string{quote(columnPK), quote(columnSK)}
+	skColumn := ""
+	if q.Index.SortKey != "" {
+		skColumn = quote(q.Index.SortKey)
+		order = append([]string{skColumn}, order...)
+	}
+
+	where := []string{pkColumn + " = ?"}
+	args := []any{q.PartitionValue}
+	if q.Index.Name != "" && skColumn != "" {
+		// Like a GSI, only items with both key attributes are indexed
+		where = append(where, skColumn+" IS NOT NULL")
+	}
+	if q.SortKey != nil {
+		values := q.SortValues()
+		switch q.SortKey.Op {
+		case expression.OpBetween:
+			where = append(where, skColumn+" BETWEEN ? AND ?")
+			args = append(args, values[0], values[1])
+		case expression.OpBeginsWith:
+			where = append(where, skColumn+" >= ?")
+			args = append(args, values[0])
+			if upper, ok := prefixUpperBound(values[0]); ok {
+				where = append(where, skColumn+" < ?")
+				args = append(args, upper)
+			}
+		default:
+			where = append(where, skColumn+" "+q.SortKey.Op+" ?")
+			args = append(args, values[0])
+		}
+	}
+
+	direction, after := "ASC", ">"
+	if !q.Forward {
+		direction, after = "DESC", "<"
+	}
+	if start, ok := q.Start(); ok {
+		startValues := []any{start.Key.PK, start.Key.SK}
+		if skColumn != "" {
+			startValues = append([]any{start.SortKey}, startValues...)
+		}
+		where = append(where, fmt.Sprintf("(%s) %s (%s)", strings.Join(order, ", "), after,
+			strings.TrimSuffix(strings.Repeat("?, ", len(order)), ", ")))
+		args = append(args, startValues...)
+	}
+	for i := range order {
+		order[i] += " " + direction
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s`,
+		quote(columnItem), quote(s.tableName), strings.Join(where, " AND "), strings.Join(order, ", "))
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+	return query, args
+}
+
+// prefixUpperBound returns the least string greater than every string starting with
+// 'prefix', reporting false when there is none
+func prefixUpperBound(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+	return "", false
+}
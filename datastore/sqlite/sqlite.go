@@ -0,0 +1,337 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/suparena/entitystore/datastore/internal/items"
+	"github.com/suparena/entitystore/datastore/keys"
+	"github.com/suparena/entitystore/registry"
+)
+
+// Table layout. Each item is stored as its DynamoDB JSON in the Item column under its
+// table key; GSI key attributes are generated columns extracted from Item, indexed
+// together with the table key:
+//
+//	PK   TEXT NOT NULL
+//	SK   TEXT NOT NULL
+//	Item TEXT NOT NULL                                          -- {"PK":{"S":"USER#1"},...}
+//	PK1  TEXT GENERATED ALWAYS AS (json_extract(Item, '$."PK1".S'))
+//	SK1  TEXT GENERATED ALWAYS AS (json_extract(Item, '$."SK1".S'))
+const (
+	columnPK   = "PK"
+	columnSK   = "SK"
+	columnItem = "Item"
+)
+
+// SQLiteDataStore implements datastore.DataStore[T] on a SQLite table laid out like the
+// single DynamoDB table of the ddb package. Stores of different entity types can share
+// a table.
+type SQLiteDataStore[T any] struct {
+	db        *sql.DB
+	tableName string
+	codec     items.Codec[T]
+
+	mu      sync.Mutex
+	indexed map[string]bool // GSIs with key columns
+}
+
+// StoreOption configures a SQLiteDataStore
+type StoreOption func(*storeOptions)
+
+type storeOptions struct {
+	registry *registry.Registry
+	fields   *keys.Resolver
+}
+
+// WithRegistry makes the datastore resolve index maps, entity types, hooks and GSIs
+// in 'r' instead of registry.Default()
+func WithRegistry(r *registry.Registry) StoreOption {
+	return func(o *storeOptions) {
+		o.registry = r
+	}
+}
+
+// WithFieldResolver sets how macro, update and lifecycle field names are matched to
+// struct fields, e.g. keys.NewResolver(keys.WithJSONTags())
+func WithFieldResolver(r *keys.Resolver) StoreOption {
+	return func(o *storeOptions) {
+		o.fields = r
+	}
+}
+
+// Open opens the SQLite database file at 'path', creating it if needed, with settings
+// suited to the datastore: WAL journaling, a busy timeout, and write transactions that
+// take the write lock up front. ":memory:" opens a private in-memory database.
+func Open(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+	if path == ":memory:" {
+		dsn = "file::memory:?_txlock=immediate"
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	if path == ":memory:" {
+		// Every connection would see a different in-memory database
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// NewSQLiteDataStore constructs a SQLiteDataStore for type T on table 'tableName' of
+// 'db', creating the table and the GSI key columns used by the index map of T if needed
+func NewSQLiteDataStore[T any](db *sql.DB, tableName string, opts ...StoreOption) (*SQLiteDataStore[T], error) {
+	var options storeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	s := &SQLiteDataStore[T]{
+		db:        db,
+		tableName: tableName,
+		codec:     items.Codec[T]{Registry: options.registry, Fields: options.fields},
+		indexed:   make(map[string]bool),
+	}
+
+	ctx := context.Background()
+	create := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (%s TEXT NOT NULL, %s TEXT NOT NULL, %s TEXT NOT NULL, PRIMARY KEY (%s, %s)) WITHOUT ROWID`,
+		quote(tableName), quote(columnPK), quote(columnSK), quote(columnItem), quote(columnPK), quote(columnSK))
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return nil, fmt.Errorf("failed to create table %s: %w", tableName, err)
+	}
+	for _, index := range s.codec.Indexes() {
+		if err := s.ensureIndex(ctx, index); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Registry returns the registry the datastore resolves its registrations in,
+// registry.Default() unless set with WithRegistry
+func (s *SQLiteDataStore[T]) Registry() *registry.Registry {
+	return registry.OrDefault(s.codec.Registry)
+}
+
+// ensureIndex adds the key columns of a GSI and their index unless they exist
+func (s *SQLiteDataStore[T]) ensureIndex(ctx context.Context, index items.Index) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexed[index.Name] {
+		return nil
+	}
+
+	columns, err := s.columns(ctx)
+	if err != nil {
+		return err
+	}
+	indexColumns := []string{}
+	for _, attr := range []string{index.PartitionKey, index.SortKey} {
+		if attr == "" {
+			continue
+		}
+		indexColumns = append(indexColumns, quote(attr))
+		if columns[strings.ToLower(attr)] {
+			continue
+		}
+		alter := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s TEXT GENERATED ALWAYS AS (json_extract(%s, '$."%s".S')) VIRTUAL`,
+			quote(s.tableName), quote(attr), quote(columnItem), jsonPathEscaper.Replace(attr))
+		if _, err := s.db.ExecContext(ctx, alter); err != nil {
+			return fmt.Errorf("failed to add key column %s of %s: %w", attr, index.Name, err)
+		}
+	}
+	indexColumns = append(indexColumns, quote(columnPK), quote(columnSK))
+	createIndex := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (%s)`,
+		quote(s.tableName+"_"+index.Name), quote(s.tableName), strings.Join(indexColumns, ", "))
+	if _, err := s.db.ExecContext(ctx, createIndex); err != nil {
+		return fmt.Errorf("failed to create index %s: %w", index.Name, err)
+	}
+	s.indexed[index.Name] = true
+	return nil
+}
+
+// columns returns the lower-cased column names of the table
+func (s *SQLiteDataStore[T]) columns(ctx context.Context) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM pragma_table_xinfo(?)`, s.tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", s.tableName, err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = true
+	}
+	return columns, rows.Err()
+}
+
+// GetOne retrieves the entity whose key templates expand to 'key'
+func (s *SQLiteDataStore[T]) GetOne(ctx context.Context, key string) (*T, error) {
+	k, err := s.codec.StringKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand string key: %w", err)
+	}
+	item, err := s.get(ctx, s.db, k)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, s.codec.NotFound(key)
+	}
+	return s.codec.DecodeT(ctx, item)
+}
+
+// GetByKey retrieves an entity by its exact PK and SK values
+func (s *SQLiteDataStore[T]) GetByKey(ctx context.Context, pk, sk string) (*T, error) {
+	k := items.Key{PK: pk, SK: sk}
+	item, err := s.get(ctx, s.db, k)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, s.codec.NotFound(k.String())
+	}
+	return s.codec.DecodeT(ctx, item)
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// get reads the raw item stored under 'k', nil when there is none
+func (s *SQLiteDataStore[T]) get(ctx context.Context, q querier, k items.Key) (map[string]types.AttributeValue, error) {
+	var data string
+	err := q.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE %s = ? AND %s = ?`,
+		quote(columnItem), quote(s.tableName), quote(columnPK), quote(columnSK)), k.PK, k.SK).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read item %s: %w", k, err)
+	}
+	return items.UnmarshalJSON([]byte(data))
+}
+
+// put stores 'item' under its table key, replacing the existing item
+func (s *SQLiteDataStore[T]) put(ctx context.Context, tx *sql.Tx, item map[string]types.AttributeValue) error {
+	data, err := items.MarshalJSON(item)
+	if err != nil {
+		return fmt.Errorf("failed to encode item: %w", err)
+	}
+	k := items.KeyOf(item)
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (%s, %s, %s) VALUES (?, ?, ?) ON CONFLICT (%s, %s) DO UPDATE SET %s = excluded.%s`,
+		quote(s.tableName), quote(columnPK), quote(columnSK), quote(columnItem), quote(columnPK), quote(columnSK), quote(columnItem), quote(columnItem)),
+		k.PK, k.SK, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to write item %s: %w", k, err)
+	}
+	return nil
+}
+
+// inTx runs 'fn' in a transaction, committing it when 'fn' succeeds
+func (s *SQLiteDataStore[T]) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Put stores 'entity' under the keys expanded from its index map, replacing any item
+// with the same key. With a @Version directive the stored version must match.
+func (s *SQLiteDataStore[T]) Put(ctx context.Context, entity T) error {
+	return s.write(ctx, entity, false)
+}
+
+// Create stores 'entity' only if no item with the same key exists yet.
+// It returns an AlreadyExistsError otherwise.
+func (s *SQLiteDataStore[T]) Create(ctx context.Context, entity T) error {
+	return s.write(ctx, entity, true)
+}
+
+func (s *SQLiteDataStore[T]) write(ctx context.Context, entity T, create bool) error {
+	w, err := s.codec.PrepareWrite(ctx, entity, create)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		existing, err := s.get(ctx, tx, w.Key)
+		if err != nil {
+			return err
+		}
+		if err := w.Check(existing); err != nil {
+			return err
+		}
+		return s.put(ctx, tx, w.Item)
+	})
+}
+
+// UpdateWithCondition applies 'updates' to the item identified by 'keyInput' if
+// 'condition', a DynamoDB condition expression, holds for the stored item. The
+// @UpdatedAt and @Version index map directives are maintained automatically.
+func (s *SQLiteDataStore[T]) UpdateWithCondition(ctx context.Context, keyInput any, updates map[string]interface{}, condition string) error {
+	u, err := s.codec.PrepareUpdate(keyInput, updates, condition)
+	if err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		existing, err := s.get(ctx, tx, u.Key)
+		if err != nil {
+			return err
+		}
+		item, err := u.Apply(existing)
+		if err != nil {
+			return err
+		}
+		return s.put(ctx, tx, item)
+	})
+}
+
+// Delete removes the entity whose key templates expand to 'key'. Deleting a missing
+// entity is not an error.
+func (s *SQLiteDataStore[T]) Delete(ctx context.Context, key string) error {
+	k, err := s.codec.StringKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to expand string key: %w", err)
+	}
+	if err := s.codec.BeforeDelete(ctx, key, func() (map[string]types.AttributeValue, error) {
+		return s.get(ctx, s.db, k)
+	}); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s = ? AND %s = ?`,
+		quote(s.tableName), quote(columnPK), quote(columnSK)), k.PK, k.SK)
+	if err != nil {
+		return fmt.Errorf("failed to delete item %s: %w", k, err)
+	}
+	return nil
+}
+
+// jsonPathEscaper escapes an attribute name for a quoted JSON path in an SQL string
+var jsonPathEscaper = strings.NewReplacer(`"`, `\"`, `'`, `''`)
+
+// quote quotes an SQL identifier
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
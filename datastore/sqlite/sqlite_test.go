@@ -0,0 +1,448 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// SQLiteTestUser is stored in organization partitions and indexed by email on GSI1
+type SQLiteTestUser struct {
+	Org       string
+	ID        string
+	Email     string
+	Status    string
+	Age       int
+	UpdatedAt time.Time
+	Version   int64
+}
+
+// SQLiteTestTeam shares the organization partitions with SQLiteTestUser
+type SQLiteTestTeam struct {
+	Org  string
+	ID   string
+	Name string
+}
+
+func testRegistry() *registry.Registry {
+	reg := registry.New()
+	reg.RegisterIndexMap(reflect.TypeOf(SQLiteTestUser{}), map[string]string{
+		"PK":         "ORG#{Org}",
+		"SK":         "USER#{ID}",
+		"GSI1PK":     "EMAIL#{Email}",
+		"GSI1SK":     "USER#{ID}",
+		"@UpdatedAt": "UpdatedAt",
+		"@Version":   "Version",
+	})
+	reg.RegisterIndexMap(reflect.TypeOf(SQLiteTestTeam{}), map[string]string{
+		"PK": "ORG#{Org}",
+		"SK": "TEAM#{ID}",
+	})
+	reg.RegisterType("SQLiteTestUser", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &SQLiteTestUser{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	reg.RegisterType("SQLiteTestTeam", func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &SQLiteTestTeam{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+	return reg
+}
+
+func newTestStores(t *testing.T) (*SQLiteDataStore[SQLiteTestUser], *SQLiteDataStore[SQLiteTestTeam]) {
+	t.Helper()
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	reg := testRegistry()
+	users, err := NewSQLiteDataStore[SQLiteTestUser](db, "entities", WithRegistry(reg))
+	if err != nil {
+		t.Fatalf("NewSQLiteDataStore failed: %v", err)
+	}
+	teams, err := NewSQLiteDataStore[SQLiteTestTeam](db, "entities", WithRegistry(reg))
+	if err != nil {
+		t.Fatalf("NewSQLiteDataStore failed: %v", err)
+	}
+	return users, teams
+}
+
+func putUsers(t *testing.T, store *SQLiteDataStore[SQLiteTestUser], users ...SQLiteTestUser) {
+	t.Helper()
+	for _, u := range users {
+		if err := store.Put(context.Background(), u); err != nil {
+			t.Fatalf("Put(%s) failed: %v", u.ID, err)
+		}
+	}
+}
+
+func orgQuery(org string) *storagemodels.QueryParams {
+	return &storagemodels.QueryParams{
+		KeyConditionExpression: "PK = :pk",
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "ORG#" + org},
+		},
+	}
+}
+
+func TestPutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	users, _ := newTestStores(t)
+	putUsers(t, users, SQLiteTestUser{Org: "1", ID: "a", Email: "a@example.com", Age: 30})
+
+	got, err := users.GetByKey(ctx, "ORG#1", "USER#a")
+	if err != nil {
+		t.Fatalf("GetByKey failed: %v", err)
+	}
+	if got.Email != "a@example.com" || got.Age != 30 || got.Version != 1 || got.UpdatedAt.IsZero() {
+		t.Errorf("GetByKey = %+v, want the stored user with lifecycle fields set", got)
+	}
+
+	if _, err := users.GetByKey(ctx, "ORG#1", "USER#missing"); !eserrors.IsNotFound(err) {
+		t.Errorf("GetByKey of a missing item = %v, want NotFound", err)
+	}
+
+	if err := users.UpdateWithCondition(ctx, SQLiteTestUser{Org: "1", ID: "a"}, map[string]interface{}{"Status": "active"}, "attribute_exists(PK)"); err != nil {
+		t.Fatalf("UpdateWithCondition failed: %v", err)
+	}
+	got, _ = users.GetByKey(ctx, "ORG#1", "USER#a")
+	if got.Status != "active" || got.Version != 2 {
+		t.Errorf("after update got %+v, want Status active and Version 2", got)
+	}
+
+	err = users.UpdateWithCondition(ctx, SQLiteTestUser{Org: "1", ID: "b"}, map[string]interface{}{"Status": "active"}, "attribute_exists(PK)")
+	if !errors.Is(err, eserrors.ErrConditionFailed) {
+		t.Errorf("conditional update of a missing item = %v, want ErrConditionFailed", err)
+	}
+}
+
+func TestGetOneAndDelete(t *testing.T) {
+	ctx := context.Background()
+	_, teams := newTestStores(t)
+	reg := teams.Registry()
+	reg.RegisterIndexMap(reflect.TypeOf(SQLiteTestTeam{}), map[string]string{
+		"PK": "TEAM#{ID}",
+		"SK": "TEAM#{ID}",
+	})
+
+	if err := teams.Put(ctx, SQLiteTestTeam{Org: "1", ID: "t1", Name: "Core"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	got, err := teams.GetOne(ctx, "t1")
+	if err != nil || got.Name != "Core" {
+		t.Fatalf("GetOne = %+v, %v", got, err)
+	}
+	if err := teams.Delete(ctx, "t1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := teams.GetOne(ctx, "t1"); !eserrors.IsNotFound(err) {
+		t.Errorf("GetOne after Delete = %v, want NotFound", err)
+	}
+	if err := teams.Delete(ctx, "t1"); err != nil {
+		t.Errorf("Delete of a missing item = %v, want nil", err)
+	}
+}
+
+func TestCreateAndVersionConflicts(t *testing.T) {
+	ctx := context.Background()
+	users, _ := newTestStores(t)
+
+	user := SQLiteTestUser{Org: "1", ID: "a"}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := users.Create(ctx, user); !eserrors.IsAlreadyExists(err) {
+		t.Errorf("second Create = %v, want AlreadyExists", err)
+	}
+
+	stored, _ := users.GetByKey(ctx, "ORG#1", "USER#a")
+	if err := users.Put(ctx, *stored); err != nil {
+		t.Fatalf("Put of the current version failed: %v", err)
+	}
+	if err := users.Put(ctx, *stored); !errors.Is(err, eserrors.ErrConditionFailed) {
+		t.Errorf("Put of a stale version = %v, want ErrConditionFailed", err)
+	}
+}
+
+func TestQueryKeyConditions(t *testing.T) {
+	ctx := context.Background()
+	users, teams := newTestStores(t)
+	putUsers(t, users,
+		SQLiteTestUser{Org: "1", ID: "c", Status: "active"},
+		SQLiteTestUser{Org: "1", ID: "a", Status: "active"},
+		SQLiteTestUser{Org: "1", ID: "b", Status: "inactive"},
+		SQLiteTestUser{Org: "2", ID: "d", Status: "active"},
+	)
+	if err := teams.Put(ctx, SQLiteTestTeam{Org: "1", ID: "t1", Name: "Core"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	userIDs := func(results []interface{}) []string {
+		var ids []string
+		for _, r := range results {
+			switch v := r.(type) {
+			case *SQLiteTestUser:
+				ids = append(ids, v.ID)
+			case *SQLiteTestTeam:
+				ids = append(ids, "team:"+v.ID)
+			default:
+				t.Fatalf("unexpected result type %T", r)
+			}
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name   string
+		params func() *storagemodels.QueryParams
+		want   []string
+	}{
+		{
+			name:   "partition in sort key order with registry types",
+			params: func() *storagemodels.QueryParams { return orgQuery("1") },
+			want:   []string{"team:t1", "a", "b", "c"},
+		},
+		{
+			name: "begins_with",
+			params: func() *storagemodels.QueryParams {
+				p := orgQuery("1")
+				p.KeyConditionExpression = "PK = :pk AND begins_with(SK, :prefix)"
+				p.ExpressionAttributeValues[":prefix"] = &types.AttributeValueMemberS{Value: "USER#"}
+				return p
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "between",
+			params: func() *storagemodels.QueryParams {
+				p := orgQuery("1")
+				p.KeyConditionExpression = "PK = :pk AND SK BETWEEN :from AND :to"
+				p.ExpressionAttributeValues[":from"] = &types.AttributeValueMemberS{Value: "USER#b"}
+				p.ExpressionAttributeValues[":to"] = &types.AttributeValueMemberS{Value: "USER#z"}
+				return p
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "comparison in reverse order",
+			params: func() *storagemodels.QueryParams {
+				p := orgQuery("1")
+				p.KeyConditionExpression = "PK = :pk AND SK > :after"
+				p.ExpressionAttributeValues[":after"] = &types.AttributeValueMemberS{Value: "USER#a"}
+				p.ScanIndexForward = aws.Bool(false)
+				return p
+			},
+			want: []string{"c", "b"},
+		},
+		{
+			name: "filter",
+			params: func() *storagemodels.QueryParams {
+				p := orgQuery("1")
+				p.FilterExpression = aws.String("Status = :status")
+				p.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: "active"}
+				return p
+			},
+			want: []string{"a", "c"},
+		},
+		{
+			name: "limit applies before the filter",
+			params: func() *storagemodels.QueryParams {
+				p := orgQuery("1")
+				p.FilterExpression = aws.String("Status = :status")
+				p.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{Value: "inactive"}
+				p.Limit = aws.Int32(2)
+				return p
+			},
+			want: nil,
+		},
+		{
+			name: "exclusive start key",
+			params: func() *storagemodels.QueryParams {
+				p := orgQuery("1")
+				p.ExclusiveStartKey = map[string]types.AttributeValue{
+					"PK": &types.AttributeValueMemberS{Value: "ORG#1"},
+					"SK": &types.AttributeValueMemberS{Value: "USER#a"},
+				}
+				return p
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "GSI",
+			params: func() *storagemodels.QueryParams {
+				return &storagemodels.QueryParams{
+					KeyConditionExpression: "PK1 = :pk",
+					IndexName:              aws.String("GSI1"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":pk": &types.AttributeValueMemberS{Value: "EMAIL#"},
+					},
+				}
+			},
+			want: []string{"a", "b", "c", "d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := users.Query(ctx, tt.params())
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if got := userIDs(results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := users.Query(ctx, &storagemodels.QueryParams{KeyConditionExpression: "SK = :sk", ExpressionAttributeValues: map[string]types.AttributeValue{
+		":sk": &types.AttributeValueMemberS{Value: "USER#a"},
+	}}); err == nil {
+		t.Error("Query without a partition key condition succeeded, want an error")
+	}
+}
+
+func TestStreamPagination(t *testing.T) {
+	ctx := context.Background()
+	users, _ := newTestStores(t)
+	for _, id := range []string{"e", "b", "d", "a", "c"} {
+		putUsers(t, users, SQLiteTestUser{Org: "1", ID: id, Email: id + "@example.com"})
+	}
+
+	var pages []int
+	var ids []string
+	for result := range users.Stream(ctx, orgQuery("1"), storagemodels.WithPageSize(2)) {
+		if result.Error != nil {
+			t.Fatalf("Stream result error: %v", result.Error)
+		}
+		ids = append(ids, result.Item.ID)
+		pages = append(pages, result.Meta.PageNumber)
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Stream IDs = %v, want %v", ids, want)
+	}
+	if want := []int{1, 1, 2, 2, 3}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("Stream pages = %v, want %v", pages, want)
+	}
+
+	// Limit caps the items over all pages, and progress is reported once per page
+	limited := orgQuery("1")
+	limited.Limit = aws.Int32(3)
+	var progress []int64
+	ids = nil
+	for result := range users.Stream(ctx, limited, storagemodels.WithPageSize(2),
+		storagemodels.WithProgressHandler(func(p storagemodels.StreamProgress) { progress = append(progress, p.ItemsProcessed) })) {
+		if result.Error != nil {
+			t.Fatalf("Stream result error: %v", result.Error)
+		}
+		ids = append(ids, result.Item.ID)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Stream IDs with Limit = %v, want %v", ids, want)
+	}
+	if want := []int64{2, 3}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("Stream progress = %v, want %v", progress, want)
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	results := users.Stream(cancelCtx, orgQuery("1"), storagemodels.WithPageSize(1), storagemodels.WithBufferSize(0))
+	<-results
+	cancel()
+	for range results {
+	}
+}
+
+func TestIndexColumnsAddedToExistingTable(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "entities.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	reg := testRegistry()
+	users, err := NewSQLiteDataStore[SQLiteTestUser](db, "entities", WithRegistry(reg))
+	if err != nil {
+		t.Fatalf("NewSQLiteDataStore failed: %v", err)
+	}
+	putUsers(t, users, SQLiteTestUser{Org: "1", ID: "a", Email: "a@example.com"})
+
+	// A GSI registered later is materialized from the stored items
+	reg.RegisterGSI("GSI2", "OrgIndexPK", "OrgIndexSK")
+	reg.RegisterIndexMap(reflect.TypeOf(SQLiteTestTeam{}), map[string]string{
+		"PK":     "ORG#{Org}",
+		"SK":     "TEAM#{ID}",
+		"GSI2PK": "TEAMS#{Org}",
+		"GSI2SK": "{Name}",
+	})
+	teams, err := NewSQLiteDataStore[SQLiteTestTeam](db, "entities", WithRegistry(reg))
+	if err != nil {
+		t.Fatalf("NewSQLiteDataStore failed: %v", err)
+	}
+	for _, team := range []SQLiteTestTeam{{Org: "1", ID: "t1", Name: "Platform"}, {Org: "1", ID: "t2", Name: "Core"}} {
+		if err := teams.Put(ctx, team); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	results, err := teams.Query(ctx, &storagemodels.QueryParams{
+		KeyConditionExpression: "OrgIndexPK = :pk",
+		IndexName:              aws.String("GSI2"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: "TEAMS#1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 2 || results[0].(*SQLiteTestTeam).Name != "Core" {
+		t.Errorf("GSI2 Query = %v, want both teams ordered by name", results)
+	}
+}
+
+func TestUpcastOnRead(t *testing.T) {
+	ctx := context.Background()
+	users, teams := newTestStores(t)
+	if err := teams.Registry().RegisterUpcaster("SQLiteTestTeam", 1, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		item["Name"] = &types.AttributeValueMemberS{Value: "renamed"}
+		return item, nil
+	}); err != nil {
+		t.Fatalf("RegisterUpcaster failed: %v", err)
+	}
+
+	// Written as version 1 before the upcaster existed
+	w, err := teams.codec.PrepareWrite(ctx, SQLiteTestTeam{Org: "1", ID: "t1", Name: "Core"}, false)
+	if err != nil {
+		t.Fatalf("PrepareWrite failed: %v", err)
+	}
+	delete(w.Item, registry.SchemaVersionAttribute)
+	if err := users.inTx(ctx, func(tx *sql.Tx) error { return users.put(ctx, tx, w.Item) }); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	got, err := teams.GetByKey(ctx, "ORG#1", "TEAM#t1")
+	if err != nil {
+		t.Fatalf("GetByKey failed: %v", err)
+	}
+	if got.Name != "renamed" {
+		t.Errorf("GetByKey Name = %q, want the upcast value", got.Name)
+	}
+}
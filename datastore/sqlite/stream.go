@@ -0,0 +1,117 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/storagemodels"
+)
+
+// Stream reads the items matching 'params' page by page and sends them as T on the
+// returned channel, which is closed when the query is exhausted, fails or 'ctx' is done.
+// Pages hold PageSize items and params.Limit caps the items read over all pages, as it
+// does for a single Query; a failed page is reported as the last result.
+func (s *SQLiteDataStore[T]) Stream(ctx context.Context, params *storagemodels.QueryParams, opts ...storagemodels.StreamOption) <-chan storagemodels.StreamResult[T] {
+	options := storagemodels.DefaultStreamOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	resultCh := make(chan storagemodels.StreamResult[T], options.BufferSize)
+	go s.streamWorker(ctx, params, options, resultCh)
+	return resultCh
+}
+
+func (s *SQLiteDataStore[T]) streamWorker(
+	ctx context.Context,
+	params *storagemodels.QueryParams,
+	options storagemodels.StreamOptions,
+	resultCh chan<- storagemodels.StreamResult[T],
+) {
+	defer close(resultCh)
+
+	var itemIndex int64
+	var pageNumber int
+	var errs []error
+	startTime := time.Now()
+	reportProgress := func(lastKey map[string]types.AttributeValue) {
+		if options.ProgressHandler == nil {
+			return
+		}
+		progress := storagemodels.StreamProgress{
+			ItemsProcessed: itemIndex,
+			PagesProcessed: pageNumber,
+			LastKey:        lastKey,
+			Errors:         errs,
+			StartTime:      startTime,
+		}
+		if elapsed := time.Since(startTime).Seconds(); elapsed > 0 {
+			progress.CurrentRate = float64(itemIndex) / elapsed
+		}
+		options.ProgressHandler(progress)
+	}
+	fail := func(err error) {
+		select {
+		case <-ctx.Done():
+		case resultCh <- storagemodels.StreamResult[T]{
+			Error: fmt.Errorf("query failed: %w", err),
+			Meta:  storagemodels.StreamMeta{Index: itemIndex, PageNumber: pageNumber, Timestamp: time.Now()},
+		}:
+		}
+	}
+
+	q, err := s.codec.PlanQuery(params)
+	if err != nil {
+		fail(err)
+		return
+	}
+	budget := q.Limit
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		q.Limit = int(options.PageSize)
+		if budget > 0 && (q.Limit == 0 || budget < q.Limit) {
+			q.Limit = budget
+		}
+		page, lastKey, err := s.queryPage(ctx, q)
+		if err != nil {
+			if ctx.Err() == nil {
+				fail(err)
+			}
+			return
+		}
+		pageNumber++
+
+		for _, item := range page {
+			result := s.codec.StreamResult(ctx, item, itemIndex, pageNumber)
+			itemIndex++
+			select {
+			case <-ctx.Done():
+				return
+			case resultCh <- result:
+			}
+			if result.Error != nil {
+				errs = append(errs, result.Error)
+			}
+		}
+
+		reportProgress(lastKey)
+		if lastKey == nil {
+			return
+		}
+		// A page that has a last key read q.Limit items
+		if budget > 0 {
+			if budget -= q.Limit; budget == 0 {
+				return
+			}
+		}
+		q.StartKey = lastKey
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"fmt"
+	"reflect"
+
+	oaerrors "github.com/go-openapi/errors"
+	"github.com/go-openapi/strfmt"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+)
+
+// SchemaValidator is implemented by models generated by go-swagger. Schema validation
+// runs on write for types enabled with registry.EnableSchemaValidation.
+type SchemaValidator interface {
+	Validate(formats strfmt.Registry) error
+}
+
+// RunSchemaValidation validates 'entity' against its OpenAPI schema if schema validation
+// is enabled for T. Failures are returned as an errors.ValidationError listing every
+// invalid field.
+func RunSchemaValidation[T any](entity *T) error {
+	return RunSchemaValidationWithRegistry(nil, entity)
+}
+
+// RunSchemaValidationWithRegistry is RunSchemaValidation with schema validation enabled
+// in 'reg' (nil means registry.Default())
+func RunSchemaValidationWithRegistry[T any](reg *registry.Registry, entity *T) error {
+	formats, ok := registry.OrDefault(reg).GetSchemaValidation(reflect.TypeOf((*T)(nil)).Elem())
+	if !ok {
+		return nil
+	}
+
+	v, ok := any(entity).(SchemaValidator)
+	if !ok {
+		return fmt.Errorf("schema validation is enabled for %T but it has no Validate(strfmt.Registry) method", entity)
+	}
+	if err := v.Validate(formats); err != nil {
+		return schemaValidationError(err)
+	}
+	return nil
+}
+
+// schemaValidationError converts the errors returned by go-openapi validation into a
+// ValidationError with one FieldError per failed rule
+func schemaValidationError(err error) error {
+	var fields []eserrors.FieldError
+	collectFieldErrors(err, &fields)
+	return &eserrors.ValidationError{Fields: fields, Err: err}
+}
+
+func collectFieldErrors(err error, fields *[]eserrors.FieldError) {
+	switch e := err.(type) {
+	case *oaerrors.CompositeError:
+		for _, inner := range e.Errors {
+			collectFieldErrors(inner, fields)
+		}
+	case *oaerrors.Validation:
+		*fields = append(*fields, eserrors.FieldError{Field: e.Name, Message: e.Error()})
+	default:
+		*fields = append(*fields, eserrors.FieldError{Message: err.Error()})
+	}
+}
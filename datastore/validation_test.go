@@ -0,0 +1,73 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	oaerrors "github.com/go-openapi/errors"
+	"github.com/go-openapi/strfmt"
+	eserrors "github.com/suparena/entitystore/errors"
+	"github.com/suparena/entitystore/registry"
+)
+
+// swaggerModel mimics a go-swagger generated model with required fields
+type swaggerModel struct {
+	ID    *string
+	Email strfmt.Email
+}
+
+func (m *swaggerModel) Validate(formats strfmt.Registry) error {
+	var res []error
+	if m.ID == nil {
+		res = append(res, oaerrors.Required("Id", "body", nil))
+	}
+	if m.Email != "" && !formats.Validates("email", m.Email.String()) {
+		res = append(res, oaerrors.InvalidType("Email", "body", "email", m.Email.String()))
+	}
+	if len(res) > 0 {
+		return oaerrors.CompositeValidationError(res...)
+	}
+	return nil
+}
+
+type unvalidatedModel struct {
+	ID string
+}
+
+func TestRunSchemaValidation(t *testing.T) {
+	ctx := context.Background()
+	invalid := &swaggerModel{Email: "not-an-email"}
+
+	// Disabled by default
+	if err := RunBeforePut(ctx, invalid); err != nil {
+		t.Fatalf("expected no validation without opt-in, got %v", err)
+	}
+
+	registry.EnableSchemaValidation[swaggerModel](nil)
+	defer registry.DisableSchemaValidation[swaggerModel]()
+
+	err := RunBeforePut(ctx, invalid)
+	var verr *eserrors.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(verr.Fields) != 2 || verr.Fields[0].Field != "Id" || verr.Fields[1].Field != "Email" {
+		t.Errorf("unexpected field errors: %+v", verr.Fields)
+	}
+
+	id := "1"
+	if err := RunBeforePut(ctx, &swaggerModel{ID: &id, Email: "a@example.com"}); err != nil {
+		t.Errorf("expected valid model to pass, got %v", err)
+	}
+
+	registry.EnableSchemaValidation[unvalidatedModel](nil)
+	defer registry.DisableSchemaValidation[unvalidatedModel]()
+	if err := RunBeforePut(ctx, &unvalidatedModel{}); err == nil {
+		t.Error("expected error for model without Validate(strfmt.Registry)")
+	}
+}
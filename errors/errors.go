@@ -7,6 +7,7 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // Common sentinel errors
@@ -55,13 +56,30 @@ func (e *AlreadyExistsError) Is(target error) bool {
 	return target == ErrAlreadyExists
 }
 
+// FieldError describes a validation failure of a single field
+type FieldError struct {
+	Field   string
+	Message string
+}
+
 // ValidationError represents an input validation error
 type ValidationError struct {
 	Field   string
 	Message string
+	// Fields lists the individual failures when several fields are invalid
+	Fields []FieldError
+	// Err is the underlying error, e.g. the one returned by an entity's Validate method
+	Err error
 }
 
 func (e *ValidationError) Error() string {
+	if len(e.Fields) > 0 {
+		msgs := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			msgs[i] = f.Message
+		}
+		return fmt.Sprintf("validation failed: %s", strings.Join(msgs, "; "))
+	}
 	if e.Field != "" {
 		return fmt.Sprintf("validation failed for field %q: %s", e.Field, e.Message)
 	}
@@ -72,6 +90,10 @@ func (e *ValidationError) Is(target error) bool {
 	return target == ErrInvalidInput
 }
 
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
 // ConditionFailedError represents a failed conditional operation
 type ConditionFailedError struct {
 	Operation string
@@ -103,6 +125,20 @@ func NewValidationError(field, message string) error {
 	return &ValidationError{Field: field, Message: message}
 }
 
+// NewFieldValidationError creates a ValidationError listing several invalid fields
+func NewFieldValidationError(fields []FieldError) error {
+	return &ValidationError{Fields: fields}
+}
+
+// WrapValidationError converts err into a ValidationError, keeping it as the cause.
+// Errors that already are validation errors are returned unchanged.
+func WrapValidationError(err error) error {
+	if err == nil || IsValidationError(err) {
+		return err
+	}
+	return &ValidationError{Message: err.Error(), Err: err}
+}
+
 // NewConditionFailedError creates a new ConditionFailedError
 func NewConditionFailedError(operation, condition string) error {
 	return &ConditionFailedError{Operation: operation, Condition: condition}
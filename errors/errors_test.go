@@ -141,4 +141,40 @@ func TestSentinelErrors(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+func TestWrapValidationError(t *testing.T) {
+	cause := fmt.Errorf("email must not be empty")
+	err := WrapValidationError(cause)
+
+	if !IsValidationError(err) {
+		t.Error("wrapped error should be a validation error")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("wrapped error should unwrap to its cause")
+	}
+	if err.Error() != "validation failed: email must not be empty" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	existing := NewValidationError("email", "required")
+	if WrapValidationError(existing) != existing {
+		t.Error("validation errors should be returned unchanged")
+	}
+	if WrapValidationError(nil) != nil {
+		t.Error("nil should stay nil")
+	}
+}
+
+func TestValidationErrorFields(t *testing.T) {
+	err := NewFieldValidationError([]FieldError{
+		{Field: "Id", Message: "Id in body is required"},
+		{Field: "Name", Message: "Name in body is required"},
+	})
+	if !IsValidationError(err) {
+		t.Fatal("expected a validation error")
+	}
+	want := "validation failed: Id in body is required; Name in body is required"
+	if err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
@@ -0,0 +1,320 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/suparena/entitystore/datastore/ddb"
+)
+
+// indexKey is the key of one entity in the table or in one GSI
+type indexKey struct {
+	Model string
+	keyIndex
+	pos Position
+}
+
+// indexKeys returns the keys of all entities grouped by index name ("" for the table),
+// each group sorted by model name
+func indexKeys(defs map[string]Definition) (map[string][]indexKey, error) {
+	names := make([]string, 0, len(defs))
+	for name, def := range defs {
+		if _, ok := def.VendorExtensions["x-dynamodb-indexmap"]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	byIndex := make(map[string][]indexKey)
+	for _, name := range names {
+		def := defs[name]
+		ixMap, err := indexMapOf(def)
+		if err != nil {
+			return nil, fmt.Errorf("definition %s: %w", name, err)
+		}
+		for _, ix := range keyIndexes(ixMap) {
+			entry := ix.Name + "PK"
+			if ix.Name == "" {
+				entry = "PK"
+			}
+			byIndex[ix.Name] = append(byIndex[ix.Name], indexKey{
+				Model:    name,
+				keyIndex: ix,
+				pos:      def.ExtensionEntryPos("x-dynamodb-indexmap", entry),
+			})
+		}
+	}
+	return byIndex, nil
+}
+
+// sortedIndexNames returns the GSI names of 'byIndex', without the table
+func sortedIndexNames(byIndex map[string][]indexKey) []string {
+	var names []string
+	for name := range byIndex {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeyOverlaps reports entity types whose keys share a partition in the table or in a
+// GSI while the constant prefix of one sort key is a prefix of the other's, so that a
+// begins_with query for one entity type can also return the other. These are warnings:
+// colliding table keys are errors reported by ValidateIndexMaps.
+func KeyOverlaps(defs map[string]Definition) ([]Diagnostic, error) {
+	byIndex, err := indexKeys(defs)
+	if err != nil {
+		return nil, err
+	}
+
+	var diags []Diagnostic
+	for _, index := range append([]string{""}, sortedIndexNames(byIndex)...) {
+		keys := byIndex[index]
+		label := index
+		if label == "" {
+			label = "table"
+		}
+		for i := 0; i < len(keys); i++ {
+			for j := i + 1; j < len(keys); j++ {
+				a, b := keys[i], keys[j]
+				if !templatesOverlap(a.PK, b.PK) {
+					continue
+				}
+				pa, pb := constantPrefix(a.SK), constantPrefix(b.SK)
+				if !strings.HasPrefix(pa, pb) && !strings.HasPrefix(pb, pa) {
+					continue
+				}
+				diags = append(diags, Diagnostic{
+					Pos:   b.pos,
+					Model: b.Model,
+					Message: fmt.Sprintf("%s: partition %q overlaps %q of %s and sort key prefix %q overlaps %q; queries for one entity type can return the other",
+						label, b.PK, a.PK, a.Model, pb, pa),
+				})
+			}
+		}
+	}
+	return diags, nil
+}
+
+// gsiAttributeNames returns the physical key attributes of GSI 'name': a declaration from
+// x-dynamodb-gsi, a default from ddb.DefaultGSIConfigs, or the logical names otherwise
+func gsiAttributeNames(name string, decls []gsiDecl) (string, string) {
+	for _, d := range decls {
+		if d.Name == name {
+			return d.PartitionKey, d.SortKey
+		}
+	}
+	if cfg, ok := ddb.DefaultGSIConfigs[name]; ok {
+		return cfg.PartitionKeyName, cfg.SortKeyName
+	}
+	return name + "PK", name + "SK"
+}
+
+// GenerateAccessPatterns returns a Markdown document describing the single-table layout
+// of 'defs': a matrix of the key templates per entity type, the access patterns they
+// support, and the overlapping key prefixes reported by KeyOverlaps
+func GenerateAccessPatterns(defs map[string]Definition) ([]byte, error) {
+	byIndex, err := indexKeys(defs)
+	if err != nil {
+		return nil, err
+	}
+	decls, err := gsiDeclarations(defs)
+	if err != nil {
+		return nil, err
+	}
+	overlaps, err := KeyOverlaps(defs)
+	if err != nil {
+		return nil, err
+	}
+	gsis := sortedIndexNames(byIndex)
+
+	var b strings.Builder
+	b.WriteString("<!-- Code generated by postprocess tool; DO NOT EDIT. -->\n\n")
+	b.WriteString("# Access Patterns\n\n")
+
+	// Key matrix
+	b.WriteString("## Key Matrix\n\n| Entity | PK | SK |")
+	for _, gsi := range gsis {
+		pk, sk := gsiAttributeNames(gsi, decls)
+		fmt.Fprintf(&b, " %sPK (%s) | %sSK (%s) |", gsi, pk, gsi, sk)
+	}
+	b.WriteString("\n|---|---|---|")
+	b.WriteString(strings.Repeat("---|---|", len(gsis)))
+	b.WriteString("\n")
+
+	keysOf := make(map[string]map[string]keyIndex)
+	var models []string
+	for index, keys := range byIndex {
+		for _, k := range keys {
+			if keysOf[k.Model] == nil {
+				keysOf[k.Model] = make(map[string]keyIndex)
+				models = append(models, k.Model)
+			}
+			keysOf[k.Model][index] = k.keyIndex
+		}
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		table := keysOf[model][""]
+		fmt.Fprintf(&b, "| %s | %s | %s |", model, markdownCode(table.PK), markdownCode(table.SK))
+		for _, gsi := range gsis {
+			ix := keysOf[model][gsi]
+			fmt.Fprintf(&b, " %s | %s |", markdownCode(ix.PK), markdownCode(ix.SK))
+		}
+		b.WriteString("\n")
+	}
+
+	// Access patterns, as offered by the generated repositories
+	b.WriteString("\n## Access Patterns\n\n| Entity | Method | Index | Key Condition |\n|---|---|---|---|\n")
+	for _, model := range models {
+		repo, err := repositoryModel(model, defs[model])
+		if err != nil {
+			return nil, fmt.Errorf("definition %s: %w", model, err)
+		}
+		for _, m := range repo.Methods {
+			index := "table"
+			pkAttr, skAttr := "PK", "SK"
+			if m.Index != "" {
+				index = m.Index
+				pkAttr, skAttr = gsiAttributeNames(m.Index, decls)
+			}
+			cond := fmt.Sprintf("%s = %s", pkAttr, m.PK)
+			switch {
+			case m.SK != "":
+				cond += fmt.Sprintf(" AND %s = %s", skAttr, m.SK)
+			case m.SKPrefix != "":
+				cond += fmt.Sprintf(" AND begins_with(%s, %q)", skAttr, m.SKPrefix)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", model, markdownCode(m.Name), index, markdownCode(cond))
+		}
+	}
+
+	// Overlaps
+	b.WriteString("\n## Overlapping Key Prefixes\n\n")
+	if len(overlaps) == 0 {
+		b.WriteString("None.\n")
+	}
+	for _, d := range overlaps {
+		fmt.Fprintf(&b, "- %s: %s\n", d.Model, strings.ReplaceAll(d.Message, "|", `\|`))
+	}
+	return []byte(b.String()), nil
+}
+
+// markdownCode formats 's' as inline code for a table cell, or "" when empty
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+}
+
+// TableDefinition is the input of "aws dynamodb create-table --cli-input-json"
+type TableDefinition struct {
+	TableName              string                 `json:"TableName"`
+	AttributeDefinitions   []AttributeDefinition  `json:"AttributeDefinitions"`
+	KeySchema              []KeySchemaElement     `json:"KeySchema"`
+	GlobalSecondaryIndexes []GlobalSecondaryIndex `json:"GlobalSecondaryIndexes,omitempty"`
+	BillingMode            string                 `json:"BillingMode"`
+	StreamSpecification    *StreamSpecification   `json:"StreamSpecification,omitempty"`
+}
+
+// AttributeDefinition declares the type of a key attribute
+type AttributeDefinition struct {
+	AttributeName string `json:"AttributeName"`
+	AttributeType string `json:"AttributeType"`
+}
+
+// KeySchemaElement is a HASH or RANGE key of a table or index
+type KeySchemaElement struct {
+	AttributeName string `json:"AttributeName"`
+	KeyType       string `json:"KeyType"`
+}
+
+// GlobalSecondaryIndex declares a GSI with all attributes projected
+type GlobalSecondaryIndex struct {
+	IndexName  string             `json:"IndexName"`
+	KeySchema  []KeySchemaElement `json:"KeySchema"`
+	Projection Projection         `json:"Projection"`
+}
+
+// Projection selects the attributes copied into an index
+type Projection struct {
+	ProjectionType string `json:"ProjectionType"`
+}
+
+// StreamSpecification enables DynamoDB Streams
+type StreamSpecification struct {
+	StreamEnabled  bool   `json:"StreamEnabled"`
+	StreamViewType string `json:"StreamViewType"`
+}
+
+// TableDefinitionFor derives the table named 'tableName' from the index maps of 'defs'.
+// Keys are strings; every GSI used by an index map is included, with the key attributes
+// of its x-dynamodb-gsi declaration or of ddb.DefaultGSIConfigs. Streams are enabled
+// with new and old images, as needed by the change feed.
+func TableDefinitionFor(defs map[string]Definition, tableName string) (TableDefinition, error) {
+	byIndex, err := indexKeys(defs)
+	if err != nil {
+		return TableDefinition{}, err
+	}
+	decls, err := gsiDeclarations(defs)
+	if err != nil {
+		return TableDefinition{}, err
+	}
+
+	table := TableDefinition{
+		TableName: tableName,
+		KeySchema: []KeySchemaElement{
+			{AttributeName: "PK", KeyType: "HASH"},
+			{AttributeName: "SK", KeyType: "RANGE"},
+		},
+		BillingMode:         "PAY_PER_REQUEST",
+		StreamSpecification: &StreamSpecification{StreamEnabled: true, StreamViewType: "NEW_AND_OLD_IMAGES"},
+	}
+	attributes := map[string]bool{"PK": true, "SK": true}
+
+	for _, gsi := range sortedIndexNames(byIndex) {
+		pk, sk := gsiAttributeNames(gsi, decls)
+		index := GlobalSecondaryIndex{
+			IndexName:  gsi,
+			KeySchema:  []KeySchemaElement{{AttributeName: pk, KeyType: "HASH"}},
+			Projection: Projection{ProjectionType: "ALL"},
+		}
+		attributes[pk] = true
+		for _, k := range byIndex[gsi] {
+			if k.SK != "" {
+				index.KeySchema = append(index.KeySchema, KeySchemaElement{AttributeName: sk, KeyType: "RANGE"})
+				attributes[sk] = true
+				break
+			}
+		}
+		table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, index)
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		table.AttributeDefinitions = append(table.AttributeDefinitions, AttributeDefinition{AttributeName: name, AttributeType: "S"})
+	}
+	return table, nil
+}
+
+// GenerateTableDefinition returns the JSON form of TableDefinitionFor
+func GenerateTableDefinition(defs map[string]Definition, tableName string) ([]byte, error) {
+	table, err := TableDefinitionFor(defs, tableName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(table, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyOverlaps(t *testing.T) {
+	defs, err := LoadSpec("testdata/accesspatterns.yaml")
+	if err != nil {
+		t.Fatalf("LoadSpec failed: %v", err)
+	}
+	if diags := ValidateIndexMaps(defs); len(diags) != 0 {
+		t.Fatalf("overlapping prefixes must not be errors: %v", diags)
+	}
+
+	overlaps, err := KeyOverlaps(defs)
+	if err != nil {
+		t.Fatalf("KeyOverlaps failed: %v", err)
+	}
+	if len(overlaps) != 1 {
+		t.Fatalf("expected one overlap, got %v", overlaps)
+	}
+	d := overlaps[0]
+	if d.Model != "Member" || !strings.Contains(d.Message, "of Invite") || !strings.Contains(d.Message, `"MEMBER#INVITE#"`) {
+		t.Errorf("unexpected overlap: %s", d)
+	}
+	if filepath.Base(d.Pos.File) != "accesspatterns.yaml" || d.Pos.Line != 26 {
+		t.Errorf("overlap reported at %s", d.Pos)
+	}
+}
+
+func TestGenerateAccessPatterns(t *testing.T) {
+	defs, err := LoadSpec("testdata/accesspatterns.yaml")
+	if err != nil {
+		t.Fatalf("LoadSpec failed: %v", err)
+	}
+	src, err := GenerateAccessPatterns(defs)
+	if err != nil {
+		t.Fatalf("GenerateAccessPatterns failed: %v", err)
+	}
+
+	const golden = "testdata/accesspatterns.golden.md"
+	if *updateGolden {
+		if err := os.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("generated access patterns differ from %s (run with -update to accept):\n%s", golden, src)
+	}
+}
+
+func TestGenerateTableDefinition(t *testing.T) {
+	defs, err := LoadSpec("testdata/accesspatterns.yaml")
+	if err != nil {
+		t.Fatalf("LoadSpec failed: %v", err)
+	}
+	src, err := GenerateTableDefinition(defs, "orgs")
+	if err != nil {
+		t.Fatalf("GenerateTableDefinition failed: %v", err)
+	}
+
+	var table TableDefinition
+	if err := json.Unmarshal(src, &table); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if table.TableName != "orgs" || len(table.KeySchema) != 2 {
+		t.Errorf("unexpected table: %+v", table)
+	}
+
+	var attrs []string
+	for _, a := range table.AttributeDefinitions {
+		attrs = append(attrs, a.AttributeName)
+	}
+	if got := strings.Join(attrs, ","); got != "InvitePK,InviteSK,PK,PK1,SK,SK1" {
+		t.Errorf("attribute definitions = %s", got)
+	}
+
+	if len(table.GlobalSecondaryIndexes) != 2 {
+		t.Fatalf("expected GSI1 and GSI3, got %+v", table.GlobalSecondaryIndexes)
+	}
+	gsi3 := table.GlobalSecondaryIndexes[1]
+	if gsi3.IndexName != "GSI3" || gsi3.KeySchema[0].AttributeName != "InvitePK" || gsi3.KeySchema[1].AttributeName != "InviteSK" {
+		t.Errorf("unexpected GSI3: %+v", gsi3)
+	}
+}
@@ -20,24 +20,83 @@ The processor looks for the x-dynamodb-indexmap vendor extension:
 	    email:
 	      type: string
 
+Spec Formats:
+Both Swagger 2 documents (models under "definitions") and OpenAPI 3 documents
+(models under "components.schemas") are supported. Local and relative-file
+$refs such as "./common.yaml#/components/schemas/Auditable" are resolved, and
+allOf compositions are merged, including the vendor extensions of their parts.
+
+Lifecycle Extensions:
+x-dynamodb-timestamps, x-dynamodb-version and x-dynamodb-ttl declare managed
+attributes, and x-dynamodb-validate enables schema validation on write.
+
+Validation:
+Before generating, every index map is checked against its schema. Macros must
+name a property by JSON name, x-go-name or derived Go field name, key fields
+must be scalars, PK and SK are required, and table keys that can collide across
+models are reported. Each problem is printed as "file:line: Model: message"
+and generation fails.
+
 Generated Code:
-The processor generates registration code:
+The processor generates registration code, sorted by model name and formatted
+like goimports:
 
 	func init() {
-	    // Register type
-	    registry.RegisterType("UserProfile", func() interface{} {
-	        return &UserProfile{}
-	    })
-	    
-	    // Register index map
-	    registry.RegisterIndexMap(UserProfile{}, map[string]string{
-	        "PK": "USER#{UserId}",
-	        "SK": "PROFILE",
-	        "GSI1PK": "EMAIL#{Email}",
-	        "GSI1SK": "USER",
-	    })
+		// Register index map for model UserProfile
+		registry.RegisterIndexMap[UserProfile](map[string]string{
+			"GSI1PK": "EMAIL#{Email}",
+			"GSI1SK": "USER",
+			"PK":     "USER#{UserId}",
+			"SK":     "PROFILE",
+		})
+		// Register type registry for model UserProfile.
+		registry.RegisterType("UserProfile", func(item map[string]types.AttributeValue) (interface{}, error) {
+			...
+		})
 	}
 
+GSIs other than the default GSI1 declare their key attributes with
+x-dynamodb-gsi, which is emitted as a registry.RegisterGSI call:
+
+	x-dynamodb-gsi:
+	  GSI2:
+	    partitionKey: PK2
+	    sortKey: SK2
+
+Flags:
+  - -in may be repeated; the definitions of all specs are merged
+  - -package sets the package of the generated code (default "models")
+  - -model-import generates into another package, qualifying model types with
+    the given import path; -model-package sets the name of that package when it
+    is not the last path element, e.g. for ".../models/v2" or "go-models"
+  - -docs writes a Markdown access-pattern document: the key templates per
+    entity type, the queries they support and overlapping key prefixes, which
+    are also printed as warnings
+  - -table writes a JSON table definition for "aws dynamodb create-table
+    --cli-input-json", named with -table-name
+  - -check compares the output with the existing files and fails when they are
+    out of date, for use in CI
+
+Struct Tags:
+Go-defined entities can carry their index map in an entitystore struct tag
+instead, usually on a blank field:
+
+	type UserProfile struct {
+	    _     struct{} `entitystore:"pk=USER#{UserId},sk=PROFILE,gsi1pk=EMAIL#{Email},gsi1sk=USER"`
+	    UserId string
+	    Email  string
+	}
+
+The "indexmap tags" subcommand loads the package in the current directory (or
+the given pattern) and writes the same registration code into it, which makes
+it usable from go:generate. It accepts -out, -package, -model-import,
+-model-package and -check like the OpenAPI mode.
+
+Repositories:
+With -repo <file> the processor also writes a typed repository per model, with
+methods derived from the key templates, such as GetByID(ctx, id) for the table
+key and QueryByEmail(ctx, email) for a GSI1PK of "EMAIL#{Email}".
+
 This automation reduces boilerplate and ensures consistency between
 the API specification and storage configuration.
 */
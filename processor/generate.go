@@ -0,0 +1,187 @@
+package processor
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/imports"
+)
+
+// GenerateOption configures code generation
+type GenerateOption func(*generateConfig)
+
+type generateConfig struct {
+	modelImport  string
+	modelPackage string
+}
+
+func newGenerateConfig(opts []GenerateOption) generateConfig {
+	var cfg generateConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithModelImport makes generated code refer to the models of the package with import
+// path 'importPath', for generating into a package other than the models
+func WithModelImport(importPath string) GenerateOption {
+	return func(c *generateConfig) {
+		c.modelImport = importPath
+	}
+}
+
+// WithModelPackage sets the package name of the models imported with WithModelImport,
+// for packages whose name cannot be derived from their import path
+func WithModelPackage(name string) GenerateOption {
+	return func(c *generateConfig) {
+		c.modelPackage = name
+	}
+}
+
+// packageName returns the name generated code refers to the models package by: the one
+// set with WithModelPackage, or else the name goimports assumes for the import path
+func (c generateConfig) packageName() string {
+	if c.modelPackage != "" {
+		return c.modelPackage
+	}
+	return assumedPackageName(c.modelImport)
+}
+
+// qualifier returns the prefix of model type names
+func (c generateConfig) qualifier() string {
+	if c.modelImport == "" {
+		return ""
+	}
+	return c.packageName() + "."
+}
+
+// importSpec returns the import of the models package, named explicitly unless the
+// package name is the last element of the import path
+func (c generateConfig) importSpec() string {
+	if c.modelImport == "" {
+		return ""
+	}
+	if name := c.packageName(); name != path.Base(c.modelImport) {
+		return name + " " + strconv.Quote(c.modelImport)
+	}
+	return strconv.Quote(c.modelImport)
+}
+
+// assumedPackageName returns the package name conventionally used for 'importPath': its
+// last element without a major version suffix such as "/v2" or a "go-" prefix, up to
+// the first character that is not valid in an identifier
+func assumedPackageName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil && path.Dir(importPath) != "." {
+			base = path.Base(path.Dir(importPath))
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	if base == "" || unicode.IsDigit(rune(base[0])) {
+		return "models"
+	}
+	return base
+}
+
+// formatSource formats generated code like goimports, dropping unused imports
+func formatSource(src []byte) ([]byte, error) {
+	out, err := imports.Process("", src, &imports.Options{Comments: true, TabIndent: true, TabWidth: 8})
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w\n%s", err, src)
+	}
+	return out, nil
+}
+
+// LoadSpecs loads and merges the definitions of several specs. A model defined in more
+// than one of them is an error.
+func LoadSpecs(paths ...string) (map[string]Definition, error) {
+	merged := make(map[string]Definition)
+	for _, p := range paths {
+		defs, err := LoadSpec(p)
+		if err != nil {
+			return nil, err
+		}
+		for name, def := range defs {
+			if existing, ok := merged[name]; ok {
+				return nil, fmt.Errorf("%s: model %s is already defined at %s", def.Pos, name, existing.Pos)
+			}
+			merged[name] = def
+		}
+	}
+	return merged, nil
+}
+
+// extGSI declares the key attributes of global secondary indexes:
+//
+//	x-dynamodb-gsi:
+//	  GSI2:
+//	    partitionKey: PK2
+//	    sortKey: SK2
+//
+// Declarations may be repeated across models but must agree.
+const extGSI = "x-dynamodb-gsi"
+
+// gsiDecl is a GSI declared with x-dynamodb-gsi
+type gsiDecl struct {
+	Name         string
+	PartitionKey string
+	SortKey      string
+	pos          Position
+}
+
+// gsiDeclarations collects the GSIs declared by 'defs', sorted by name
+func gsiDeclarations(defs map[string]Definition) ([]gsiDecl, error) {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	byName := make(map[string]gsiDecl)
+	for _, model := range names {
+		def := defs[model]
+		ext, ok := def.VendorExtensions[extGSI]
+		if !ok {
+			continue
+		}
+		indexes, ok := ext.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: %s: %s must be a mapping", def.ExtensionPos(extGSI), model, extGSI)
+		}
+		for index, v := range indexes {
+			pos := def.ExtensionEntryPos(extGSI, index)
+			keys, _ := v.(map[string]interface{})
+			pk, _ := keys["partitionKey"].(string)
+			sk, _ := keys["sortKey"].(string)
+			if pk == "" || sk == "" {
+				return nil, fmt.Errorf("%s: %s: %s.%s requires partitionKey and sortKey", pos, model, extGSI, index)
+			}
+			decl := gsiDecl{Name: index, PartitionKey: pk, SortKey: sk, pos: pos}
+			if existing, ok := byName[index]; ok {
+				if existing.PartitionKey != pk || existing.SortKey != sk {
+					return nil, fmt.Errorf("%s: %s: %s conflicts with the declaration at %s", pos, model, index, existing.pos)
+				}
+				continue
+			}
+			byName[index] = decl
+		}
+	}
+
+	gsis := make([]gsiDecl, 0, len(byName))
+	for _, decl := range byName {
+		gsis = append(gsis, decl)
+	}
+	sort.Slice(gsis, func(i, j int) bool { return gsis[i].Name < gsis[j].Name })
+	return gsis, nil
+}
@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var generateInputs = []string{"testdata/generate/accounts.yaml", "testdata/generate/sessions.yaml"}
+
+func TestGenerateRegistration(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "registration.go")
+	args := []string{"-outputdata", out, "-package", "store", "-model-import", "example.com/api/models"}
+	for _, in := range generateInputs {
+		args = append(args, "-in", in)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := Run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("Run failed with %d: %s", code, stderr.String())
+	}
+	src, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const golden = "testdata/registration.golden"
+	if *updateGolden {
+		if err := os.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("generated registration differs from %s (run with -update to accept):\n%s", golden, src)
+	}
+
+	// Regenerating must be a no-op, so -check passes
+	stdout.Reset()
+	stderr.Reset()
+	if code := Run(append(args, "-check"), &stdout, &stderr); code != 0 {
+		t.Errorf("-check reported fresh output as stale: %s", stderr.String())
+	}
+
+	if err := os.WriteFile(out, append(src, "// edited\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if code := Run(append(args, "-check"), &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "out of date") {
+		t.Errorf("-check should fail for edited output, got %d: %s", code, stderr.String())
+	}
+}
+
+func TestLoadSpecsDuplicateModel(t *testing.T) {
+	_, err := LoadSpecs("testdata/generate/accounts.yaml", "testdata/generate/accounts.yaml")
+	if err == nil || !strings.Contains(err.Error(), "model Account is already defined") {
+		t.Errorf("expected duplicate model error, got %v", err)
+	}
+}
+
+func TestGSIDeclarationConflict(t *testing.T) {
+	defs, err := LoadSpecs("testdata/generate/accounts.yaml", "testdata/generate/conflict.yaml")
+	if err != nil {
+		t.Fatalf("LoadSpecs failed: %v", err)
+	}
+	_, err = GenerateRegistration(defs, "models")
+	if err == nil || !strings.Contains(err.Error(), "GSI2 conflicts") {
+		t.Errorf("expected GSI conflict, got %v", err)
+	}
+}
+
+func TestGenerateValidateMustBeBoolean(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "spec.yaml")
+	spec := `swagger: "2.0"
+info:
+  title: Notes
+  version: 1.0.0
+paths: {}
+definitions:
+  Note:
+    type: object
+    properties:
+      ID:
+        type: string
+    x-dynamodb-indexmap:
+      PK: "NOTE#{ID}"
+      SK: "NOTE#{ID}"
+    x-dynamodb-validate: "yes"
+`
+	if err := os.WriteFile(in, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"-in", in, "-outputdata", filepath.Join(dir, "registration.go")}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "x-dynamodb-validate must be a boolean") {
+		t.Errorf("expected x-dynamodb-validate to be rejected, got %d: %s", code, stderr.String())
+	}
+}
+
+func TestModelPackageName(t *testing.T) {
+	tests := []struct {
+		opts       []GenerateOption
+		qualifier  string
+		importSpec string
+	}{
+		{[]GenerateOption{WithModelImport("example.com/api/models")}, "models.", `"example.com/api/models"`},
+		{[]GenerateOption{WithModelImport("example.com/api/models/v2")}, "models.", `models "example.com/api/models/v2"`},
+		{[]GenerateOption{WithModelImport("example.com/api/go-models")}, "models.", `models "example.com/api/go-models"`},
+		{[]GenerateOption{WithModelImport("example.com/api/user-models")}, "user.", `user "example.com/api/user-models"`},
+		{[]GenerateOption{WithModelImport("example.com/api/user-models"), WithModelPackage("usermodels")}, "usermodels.", `usermodels "example.com/api/user-models"`},
+	}
+	for _, tt := range tests {
+		cfg := newGenerateConfig(tt.opts)
+		if got := cfg.qualifier(); got != tt.qualifier {
+			t.Errorf("%s: qualifier = %q, want %q", cfg.modelImport, got, tt.qualifier)
+		}
+		if got := cfg.importSpec(); got != tt.importSpec {
+			t.Errorf("%s: importSpec = %q, want %q", cfg.modelImport, got, tt.importSpec)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-in", generateInputs[0], "-outputdata", filepath.Join(t.TempDir(), "registration.go"),
+		"-model-import", "example.com/api/user-models", "-model-package", "user-models"}
+	if code := Run(args, &stdout, &stderr); code != 2 || !strings.Contains(stderr.String(), "not a valid package name") {
+		t.Errorf("expected an invalid -model-package to be rejected, got %d: %s", code, stderr.String())
+	}
+}
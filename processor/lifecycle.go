@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/suparena/entitystore/datastore"
+)
+
+// Vendor extensions declaring automatically maintained attributes:
+//
+//	x-dynamodb-timestamps:
+//	  createdAt: CreatedAt
+//	  updatedAt: UpdatedAt
+//	x-dynamodb-version: Version
+//	x-dynamodb-ttl:
+//	  attribute: ExpiresAt
+//	  after: 720h
+//	  from: EndsAt
+//
+// They are added to the generated index map as "@" directives.
+const (
+	extTimestamps = "x-dynamodb-timestamps"
+	extVersion    = "x-dynamodb-version"
+	extTTL        = "x-dynamodb-ttl"
+)
+
+// lifecycleDirectives converts the lifecycle extensions of a definition into index map directives
+func lifecycleDirectives(def Definition) (map[string]string, error) {
+	directives := make(map[string]string)
+
+	if ext, ok := def.VendorExtensions[extTimestamps]; ok {
+		m, ok := ext.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be a mapping", extTimestamps)
+		}
+		if err := copyDirectives(directives, extTimestamps, m, map[string]string{
+			"createdAt": datastore.DirectiveCreatedAt,
+			"updatedAt": datastore.DirectiveUpdatedAt,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if ext, ok := def.VendorExtensions[extVersion]; ok {
+		field, ok := ext.(string)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("%s must be a field name", extVersion)
+		}
+		directives[datastore.DirectiveVersion] = field
+	}
+
+	if ext, ok := def.VendorExtensions[extTTL]; ok {
+		m, ok := ext.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be a mapping", extTTL)
+		}
+		if err := copyDirectives(directives, extTTL, m, map[string]string{
+			"attribute": datastore.DirectiveTTL,
+			"after":     datastore.DirectiveTTLAfter,
+			"from":      datastore.DirectiveTTLFrom,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate the combination the same way the datastore will at runtime
+	if _, err := datastore.ParseLifecycle(directives); err != nil {
+		return nil, err
+	}
+	return directives, nil
+}
+
+func copyDirectives(dst map[string]string, ext string, src map[string]interface{}, keys map[string]string) error {
+	for k, v := range src {
+		directive, ok := keys[k]
+		if !ok {
+			return fmt.Errorf("%s: unknown key %q", ext, k)
+		}
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return fmt.Errorf("%s.%s must be a non-empty string", ext, k)
+		}
+		dst[directive] = s
+	}
+	return nil
+}
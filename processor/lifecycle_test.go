@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLifecycleDirectives(t *testing.T) {
+	src := `
+type: object
+x-dynamodb-indexmap:
+  PK: "SESSION#{ID}"
+x-dynamodb-timestamps:
+  createdAt: CreatedAt
+  updatedAt: UpdatedAt
+x-dynamodb-version: Version
+x-dynamodb-ttl:
+  attribute: ExpiresAt
+  after: 720h
+`
+	var def Definition
+	if err := yaml.Unmarshal([]byte(src), &def); err != nil {
+		t.Fatalf("failed to parse definition: %v", err)
+	}
+
+	directives, err := lifecycleDirectives(def)
+	if err != nil {
+		t.Fatalf("lifecycleDirectives failed: %v", err)
+	}
+	want := map[string]string{
+		"@CreatedAt": "CreatedAt",
+		"@UpdatedAt": "UpdatedAt",
+		"@Version":   "Version",
+		"@TTL":       "ExpiresAt",
+		"@TTLAfter":  "720h",
+	}
+	if len(directives) != len(want) {
+		t.Fatalf("expected %v, got %v", want, directives)
+	}
+	for k, v := range want {
+		if directives[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, directives[k])
+		}
+	}
+
+	def.VendorExtensions["x-dynamodb-ttl"] = map[string]interface{}{"after": "1h"}
+	if _, err := lifecycleDirectives(def); err == nil {
+		t.Error("expected error for TTL without attribute")
+	}
+}
@@ -1,18 +1,21 @@
 package processor
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"go/token"
+	"io"
 	"os"
+	"sort"
 	"strings"
 	"text/template"
 
 	"gopkg.in/yaml.v3"
 )
 
-// SwaggerSpec is a minimal representation of your OpenAPI spec,
-// assuming definitions are under the "definitions" key.
+// SwaggerSpec is a minimal representation of a Swagger 2 spec with definitions under
+// the "definitions" key. Use LoadSpec to also read OpenAPI 3 documents and resolve $refs.
 type SwaggerSpec struct {
 	Definitions map[string]Definition `yaml:"definitions"`
 }
@@ -22,6 +25,36 @@ type SwaggerSpec struct {
 type Definition struct {
 	Raw              map[string]interface{} `yaml:",inline"`
 	VendorExtensions map[string]interface{}
+	// Pos is where the definition is declared, when loaded with LoadSpec
+	Pos Position `yaml:"-"`
+
+	extSrc map[string]source
+}
+
+// ExtensionPos returns where vendor extension 'name' is declared. For extensions
+// inherited through allOf this is the position in the composed schema.
+func (d Definition) ExtensionPos(name string) Position {
+	if src, ok := d.extSrc[name]; ok {
+		return src.pos
+	}
+	return d.Pos
+}
+
+// ExtensionEntryPos returns where 'key' of the mapping extension 'name' is declared,
+// falling back to the position of the extension
+func (d Definition) ExtensionEntryPos(name, key string) Position {
+	src, ok := d.extSrc[name]
+	if !ok {
+		return d.Pos
+	}
+	if src.value != nil && src.value.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(src.value.Content); i += 2 {
+			if src.value.Content[i].Value == key {
+				return position(src.file, src.value.Content[i])
+			}
+		}
+	}
+	return src.pos
 }
 
 // UnmarshalYAML customizes the unmarshaling to extract vendor extensions.
@@ -42,85 +75,285 @@ func (d *Definition) UnmarshalYAML(value *yaml.Node) error {
 
 const tmplText = `// Code generated by postprocess tool; DO NOT EDIT.
 
-package models
+package {{.Package}}
 
 import (
-	"github.com/suparena/entitystore/registry"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/suparena/entitystore/registry"
+{{- if .ModelImport}}
+
+	{{.ModelImport}}
+{{- end}}
 )
 
 func init() {
-{{- range $modelName, $def := . }}
-    {{- $ixMap := index $def.VendorExtensions "x-dynamodb-indexmap" }}
-    {{- if $ixMap }}
-    // Register index map for model {{$modelName}}
-    registry.RegisterIndexMap[{{$modelName}}](func() map[string]string {
-        // Extract index map details from the vendor extension.
-        return map[string]string{
-            {{- range $key, $value := $ixMap }}
-            "{{$key}}": "{{$value}}",
-            {{- end }}
-        }
-    }())
-    {{- end }}
-    // Register type registry for model {{$modelName}}.
-    // The registry key is the model name (which is also injected as the EntityType when persisting).
-    registry.RegisterType("{{$modelName}}", func(item map[string]types.AttributeValue) (interface{}, error) {
-        obj := &{{$modelName}}{}
-        err := attributevalue.UnmarshalMap(item, obj)
-        return obj, err
-    })
-{{- end }}
+{{- range .GSIs}}
+	// Key attributes of index {{.Name}}
+	registry.RegisterGSI({{printf "%q" .Name}}, {{printf "%q" .PartitionKey}}, {{printf "%q" .SortKey}})
+{{- end}}
+{{- range $i, $m := .Models}}
+{{- if or $i $.GSIs}}
+{{end}}
+	// Register index map for model {{$m.Name}}
+	registry.RegisterIndexMap[{{$m.Type}}](map[string]string{
+	{{- range $m.IndexMap}}
+		{{printf "%q" .Key}}: {{printf "%q" .Value}},
+	{{- end}}
+	})
+	{{- if $m.Validate}}
+	// Validate model {{$m.Name}} against its schema before it is written
+	registry.EnableSchemaValidation[{{$m.Type}}](nil)
+	{{- end}}
+	// Register type registry for model {{$m.Name}}.
+	// The registry key is the model name (which is also injected as the EntityType when persisting).
+	registry.RegisterType({{printf "%q" $m.Name}}, func(item map[string]types.AttributeValue) (interface{}, error) {
+		obj := &{{$m.Type}}{}
+		err := attributevalue.UnmarshalMap(item, obj)
+		return obj, err
+	})
+{{- end}}
 }
 `
 
+var registrationTmpl = template.Must(template.New("registration").Parse(tmplText))
+
+// registrationEntry is an index map entry of the registration template
+type registrationEntry struct {
+	Key   string
+	Value string
+}
+
+// registrationModel is the template data of one registered model
+type registrationModel struct {
+	Name     string // Definition name, used as the EntityType
+	Type     string // Go type, qualified when models are imported
+	IndexMap []registrationEntry
+	Validate bool
+}
+
+// GenerateRegistration returns formatted init code registering the GSIs, index maps and
+// types of 'defs' in package 'pkg'. Models and index map entries are sorted by name.
+func GenerateRegistration(defs map[string]Definition, pkg string, opts ...GenerateOption) ([]byte, error) {
+	cfg := newGenerateConfig(opts)
+
+	gsis, err := gsiDeclarations(defs)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(defs))
+	for name, def := range defs {
+		if _, ok := def.VendorExtensions["x-dynamodb-indexmap"]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	models := make([]registrationModel, 0, len(names))
+	for _, name := range names {
+		def := defs[name]
+		raw, ok := def.VendorExtensions["x-dynamodb-indexmap"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("definition %s: x-dynamodb-indexmap must be a mapping", name)
+		}
+		model := registrationModel{Name: name, Type: cfg.qualifier() + name}
+		for k, v := range raw {
+			model.IndexMap = append(model.IndexMap, registrationEntry{Key: k, Value: fmt.Sprint(v)})
+		}
+		sort.Slice(model.IndexMap, func(i, j int) bool { return model.IndexMap[i].Key < model.IndexMap[j].Key })
+		model.Validate, _ = def.VendorExtensions["x-dynamodb-validate"].(bool)
+		models = append(models, model)
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		Package     string
+		ModelImport string
+		GSIs        []gsiDecl
+		Models      []registrationModel
+	}{Package: pkg, ModelImport: cfg.importSpec(), GSIs: gsis, Models: models}
+	if err := registrationTmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute registration template: %w", err)
+	}
+	return formatSource(buf.Bytes())
+}
+
+// Main runs the generator with the command-line arguments and exits
 func Main() {
-	// Command-line flags: input OpenAPI spec and output file.
-	inputFile := flag.String("in", "openapi.yaml", "Path to the OpenAPI spec YAML file")
-	outputFile := flag.String("outputdata", "indexmap_type_registry_registration.go", "Path for the generated registration code")
-	flag.Parse()
+	os.Exit(Run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run runs the generator with 'args' and returns the exit code
+func Run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("indexmap", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var inputFiles stringList
+	fs.Var(&inputFiles, "in", "Path to an OpenAPI spec YAML file; repeat to merge several specs (default openapi.yaml)")
+	outputFile := fs.String("outputdata", "indexmap_type_registry_registration.go", "Path for the generated registration code")
+	repoFile := fs.String("repo", "", "Path for generated typed repositories (disabled when empty)")
+	pkg := fs.String("package", "models", "Package name of the generated code")
+	modelImport := fs.String("model-import", "", "Import path of the models package, when generating into a different package")
+	modelPackage := fs.String("model-package", "", "Package name of the -model-import package (default derived from the import path)")
+	docsFile := fs.String("docs", "", "Path for a Markdown access-pattern document (disabled when empty)")
+	tableFile := fs.String("table", "", "Path for a create-table JSON definition (disabled when empty)")
+	tableName := fs.String("table-name", "entitystore", "Table name used in the -table definition")
+	check := fs.Bool("check", false, "Fail if the generated files are out of date instead of writing them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(inputFiles) == 0 {
+		inputFiles = stringList{"openapi.yaml"}
+	}
 
-	// Read the OpenAPI spec.
-	data, err := ioutil.ReadFile(*inputFile)
+	// Read the Swagger 2 or OpenAPI 3 specs, resolving $refs and allOf.
+	definitions, err := LoadSpecs(inputFiles...)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input file: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Error reading spec: %v\n", err)
+		return 1
 	}
 
-	// Unmarshal YAML into our SwaggerSpec structure.
-	var spec SwaggerSpec
-	if err := yaml.Unmarshal(data, &spec); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing YAML: %v\n", err)
-		os.Exit(1)
+	// Check the index maps against the schemas before generating anything.
+	if diags := ValidateIndexMaps(definitions); len(diags) > 0 {
+		for _, d := range diags {
+			fmt.Fprintln(stderr, d)
+		}
+		return 1
 	}
 
 	// Filter definitions: keep only those that have the x-dynamodb-indexmap extension.
 	filtered := make(map[string]Definition)
-	for name, def := range spec.Definitions {
-		if _, ok := def.VendorExtensions["x-dynamodb-indexmap"]; ok {
-			filtered[name] = def
+	for name, def := range definitions {
+		ixMap, ok := def.VendorExtensions["x-dynamodb-indexmap"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := def.VendorExtensions["x-dynamodb-validate"]; ok {
+			if _, isBool := v.(bool); !isBool {
+				fmt.Fprintf(stderr, "Error in definition %s: x-dynamodb-validate must be a boolean\n", name)
+				return 1
+			}
+		}
+		directives, err := lifecycleDirectives(def)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error in definition %s: %v\n", name, err)
+			return 1
+		}
+		for k, v := range directives {
+			ixMap[k] = v
 		}
+		filtered[name] = def
 	}
 
-	// Parse and execute the template.
-	t, err := template.New("registration").Parse(tmplText)
+	opts, err := modelOptions(*modelImport, *modelPackage)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing template: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
 	}
 
-	outFile, err := os.Create(*outputFile)
+	src, err := GenerateRegistration(filtered, *pkg, opts...)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Error generating registration code: %v\n", err)
+		return 1
+	}
+	outputs := []generatedFile{{path: *outputFile, src: src}}
+
+	if *repoFile != "" {
+		src, err := GenerateRepositories(filtered, *pkg, opts...)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error generating repositories: %v\n", err)
+			return 1
+		}
+		outputs = append(outputs, generatedFile{path: *repoFile, src: src})
+	}
+
+	if *docsFile != "" {
+		overlaps, err := KeyOverlaps(filtered)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error checking key overlaps: %v\n", err)
+			return 1
+		}
+		for _, d := range overlaps {
+			fmt.Fprintf(stderr, "warning: %s\n", d)
+		}
+		src, err := GenerateAccessPatterns(filtered)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error generating access patterns: %v\n", err)
+			return 1
+		}
+		outputs = append(outputs, generatedFile{path: *docsFile, src: src})
 	}
-	defer outFile.Close()
 
-	if err := t.Execute(outFile, filtered); err != nil {
-		fmt.Fprintf(os.Stderr, "Error executing template: %v\n", err)
-		os.Exit(1)
+	if *tableFile != "" {
+		src, err := GenerateTableDefinition(filtered, *tableName)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error generating table definition: %v\n", err)
+			return 1
+		}
+		outputs = append(outputs, generatedFile{path: *tableFile, src: src})
 	}
 
-	fmt.Printf("Generated %s successfully.\n", *outputFile)
+	return writeOutputs(outputs, *check, stdout, stderr)
+}
+
+// modelOptions returns the GenerateOptions of the -model-import and -model-package flags
+func modelOptions(modelImport, modelPackage string) ([]GenerateOption, error) {
+	var opts []GenerateOption
+	if modelImport != "" {
+		opts = append(opts, WithModelImport(modelImport))
+	}
+	if modelPackage != "" {
+		if !token.IsIdentifier(modelPackage) {
+			return nil, fmt.Errorf("-model-package %q is not a valid package name", modelPackage)
+		}
+		opts = append(opts, WithModelPackage(modelPackage))
+	}
+	return opts, nil
+}
+
+// writeOutputs writes the generated files, or with 'check' reports those that differ
+// from their current contents, and returns the exit code
+func writeOutputs(outputs []generatedFile, check bool, stdout, stderr io.Writer) int {
+	if check {
+		stale := false
+		for _, out := range outputs {
+			current, err := os.ReadFile(out.path)
+			if err != nil || !bytes.Equal(current, out.src) {
+				fmt.Fprintf(stderr, "%s is out of date, rerun the generator\n", out.path)
+				stale = true
+			}
+		}
+		if stale {
+			return 1
+		}
+		fmt.Fprintln(stdout, "Generated files are up to date.")
+		return 0
+	}
+
+	for _, out := range outputs {
+		if err := os.WriteFile(out.path, out.src, 0644); err != nil {
+			fmt.Fprintf(stderr, "Error writing %s: %v\n", out.path, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Generated %s successfully.\n", out.path)
+	}
+	return 0
+}
+
+// generatedFile is an output of the generator
+type generatedFile struct {
+	path string
+	src  []byte
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
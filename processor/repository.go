@@ -0,0 +1,427 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// macroPattern matches the {Field} macros of a key template
+var macroPattern = regexp.MustCompile(`{([^}]+)}`)
+
+// keyIndex groups the partition and sort key templates of the table or of one GSI
+type keyIndex struct {
+	Name string // "" for the table, otherwise the logical GSI name such as "GSI1"
+	PK   string
+	SK   string
+}
+
+// repoParam is a method parameter bound to a key macro
+type repoParam struct {
+	Macro string
+	Name  string
+	Type  string
+}
+
+// repoMethod is a generated repository method
+type repoMethod struct {
+	Name     string
+	Doc      string
+	Params   []repoParam
+	Index    string
+	PK       string
+	SK       string // Template of the exact sort key (Get and exact queries)
+	SKPrefix string // Constant sort key prefix for partition queries
+	Unique   bool   // Get by primary key
+}
+
+// repoModel is the template data of one repository
+type repoModel struct {
+	Model   string
+	Type    string // Go type, qualified when models are imported
+	Methods []repoMethod
+}
+
+// GenerateRepositories returns gofmt'd Go source declaring a typed repository for every
+// definition with an x-dynamodb-indexmap. Methods are derived from the key templates:
+// GetBy<Fields> for a fully parameterized primary key, QueryBy<Fields> for partitions of
+// the table and of each GSI, and List variants for constant partition keys.
+func GenerateRepositories(defs map[string]Definition, pkg string, opts ...GenerateOption) ([]byte, error) {
+	cfg := newGenerateConfig(opts)
+
+	names := make([]string, 0, len(defs))
+	for name, def := range defs {
+		if _, ok := def.VendorExtensions["x-dynamodb-indexmap"]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var models []repoModel
+	usesStrfmt := false
+	for _, name := range names {
+		model, err := repositoryModel(name, defs[name])
+		if err != nil {
+			return nil, fmt.Errorf("definition %s: %w", name, err)
+		}
+		model.Type = cfg.qualifier() + name
+		for _, m := range model.Methods {
+			for _, p := range m.Params {
+				if strings.HasPrefix(p.Type, "strfmt.") {
+					usesStrfmt = true
+				}
+			}
+		}
+		models = append(models, model)
+	}
+
+	var buf bytes.Buffer
+	err := repoTemplate.Execute(&buf, map[string]interface{}{
+		"Package":     pkg,
+		"ModelImport": cfg.importSpec(),
+		"Models":      models,
+		"UsesStrfmt":  usesStrfmt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return formatSource(buf.Bytes())
+}
+
+// repositoryModel derives the repository methods of one definition
+func repositoryModel(name string, def Definition) (repoModel, error) {
+	ixMap, err := indexMapOf(def)
+	if err != nil {
+		return repoModel{}, err
+	}
+
+	model := repoModel{Model: name}
+	used := make(map[string]bool)
+	add := func(m repoMethod) {
+		// Keep names unique when the table and a GSI yield the same method
+		if used[m.Name] && m.Index != "" {
+			m.Name += "In" + m.Index
+		}
+		if used[m.Name] {
+			return
+		}
+		used[m.Name] = true
+		model.Methods = append(model.Methods, m)
+	}
+
+	for _, ix := range keyIndexes(ixMap) {
+		pkParams := macroParams(ix.PK, def)
+		skParams := macroParams(ix.SK, def)
+		allParams := mergeParams(pkParams, skParams)
+
+		target := "the table"
+		if ix.Name != "" {
+			target = ix.Name
+		}
+
+		// Exact lookups: a Get on the table key, and a query on GSI keys whose sort key
+		// adds fields beyond the partition key
+		if ix.SK != "" {
+			if ix.Name == "" {
+				add(repoMethod{
+					Name:   "GetBy" + methodSuffix(allParams),
+					Doc:    fmt.Sprintf("returns the %s with the given key", name),
+					Params: allParams,
+					PK:     ix.PK,
+					SK:     ix.SK,
+					Unique: true,
+				})
+			} else if len(skParams) > 0 && len(allParams) > len(pkParams) {
+				add(repoMethod{
+					Name:   "QueryBy" + methodSuffix(allParams),
+					Doc:    fmt.Sprintf("returns the %s items with the given %s key", name, ix.Name),
+					Params: allParams,
+					Index:  ix.Name,
+					PK:     ix.PK,
+					SK:     ix.SK,
+				})
+			}
+		}
+
+		// Partition queries, restricted to the constant prefix of the sort key
+		if ix.Name == "" && len(allParams) == len(pkParams) {
+			// The primary key is fully determined by the partition key fields
+			continue
+		}
+		methodName := "QueryBy" + methodSuffix(pkParams)
+		if len(pkParams) == 0 {
+			methodName = "List"
+			if ix.Name != "" {
+				methodName += "By" + ix.Name
+			}
+		}
+		add(repoMethod{
+			Name:     methodName,
+			Doc:      fmt.Sprintf("returns the %s items in a partition of %s", name, target),
+			Params:   pkParams,
+			Index:    ix.Name,
+			PK:       ix.PK,
+			SKPrefix: constantPrefix(ix.SK),
+		})
+	}
+	return model, nil
+}
+
+// indexMapOf returns the key templates of a definition, without directives
+func indexMapOf(def Definition) (map[string]string, error) {
+	raw, ok := def.VendorExtensions["x-dynamodb-indexmap"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("x-dynamodb-indexmap must be a mapping")
+	}
+	ixMap := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if strings.HasPrefix(k, "@") {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("x-dynamodb-indexmap.%s must be a string", k)
+		}
+		ixMap[k] = s
+	}
+	return ixMap, nil
+}
+
+var gsiKeyPattern = regexp.MustCompile(`^(GSI\d+)(PK|SK)$`)
+
+// keyIndexes groups index map entries into the table key and GSI keys, sorted by name
+func keyIndexes(ixMap map[string]string) []keyIndex {
+	byName := make(map[string]*keyIndex)
+	get := func(name string) *keyIndex {
+		if ix, ok := byName[name]; ok {
+			return ix
+		}
+		ix := &keyIndex{Name: name}
+		byName[name] = ix
+		return ix
+	}
+
+	for k, v := range ixMap {
+		switch {
+		case k == "PK":
+			get("").PK = v
+		case k == "SK":
+			get("").SK = v
+		default:
+			if m := gsiKeyPattern.FindStringSubmatch(k); m != nil {
+				if m[2] == "PK" {
+					get(m[1]).PK = v
+				} else {
+					get(m[1]).SK = v
+				}
+			}
+		}
+	}
+
+	var indexes []keyIndex
+	for _, ix := range byName {
+		if ix.PK != "" {
+			indexes = append(indexes, *ix)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes
+}
+
+// macroParams returns one parameter per distinct macro of a template, in order of appearance
+func macroParams(tmpl string, def Definition) []repoParam {
+	var params []repoParam
+	seen := make(map[string]bool)
+	for _, m := range macroPattern.FindAllStringSubmatch(tmpl, -1) {
+		if seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		params = append(params, repoParam{Macro: m[1], Name: paramName(m[1]), Type: propertyGoType(def, m[1])})
+	}
+	return params
+}
+
+func mergeParams(a, b []repoParam) []repoParam {
+	merged := append([]repoParam{}, a...)
+	for _, p := range b {
+		dup := false
+		for _, q := range merged {
+			if q.Macro == p.Macro {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+// constantPrefix returns the text of a template before its first macro
+func constantPrefix(tmpl string) string {
+	if loc := macroPattern.FindStringIndex(tmpl); loc != nil {
+		return tmpl[:loc[0]]
+	}
+	return tmpl
+}
+
+func methodSuffix(params []repoParam) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = exportedName(p.Macro)
+	}
+	return strings.Join(parts, "And")
+}
+
+// exportedName turns a field name into an exported Go identifier
+func exportedName(field string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range field {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// paramName turns a field name into a parameter name: "ID" -> "id", "UserID" -> "userID"
+func paramName(field string) string {
+	runes := []rune(exportedName(field))
+	// Lower the leading run of capitals, keeping the last one if it starts a new word
+	i := 0
+	for i < len(runes) && unicode.IsUpper(runes[i]) {
+		i++
+	}
+	if i > 1 && i < len(runes) && unicode.IsLower(runes[i]) {
+		i--
+	}
+	for j := 0; j < i; j++ {
+		runes[j] = unicode.ToLower(runes[j])
+	}
+
+	name := string(runes)
+	if name == "" || token.IsKeyword(name) || name == "ctx" || name == "r" {
+		name += "Value"
+	}
+	return name
+}
+
+// propertyGoType maps the schema property backing a macro to a Go parameter type.
+// Properties are matched by name, falling back to a case-insensitive match since
+// macros use Go field names while schemas often use JSON names.
+func propertyGoType(def Definition, field string) string {
+	props, _ := def.Raw["properties"].(map[string]interface{})
+	prop, ok := props[field].(map[string]interface{})
+	if !ok {
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if strings.EqualFold(k, field) {
+				prop, _ = props[k].(map[string]interface{})
+				break
+			}
+		}
+	}
+
+	typ, _ := prop["type"].(string)
+	formatName, _ := prop["format"].(string)
+	switch typ {
+	case "integer":
+		if formatName == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		if formatName == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "string":
+		switch formatName {
+		case "date-time":
+			return "strfmt.DateTime"
+		case "date":
+			return "strfmt.Date"
+		}
+	}
+	return "string"
+}
+
+var repoTemplate = template.Must(template.New("repositories").Parse(`// Code generated by postprocess tool; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{if .UsesStrfmt}}
+	"github.com/go-openapi/strfmt"
+{{- else}}
+{{end}}
+	"github.com/suparena/entitystore/datastore/ddb"
+{{- if .ModelImport}}
+
+	{{.ModelImport}}
+{{- end}}
+)
+{{range $model := .Models}}
+// {{$model.Model}}Repository provides typed access to {{$model.Model}} items based on its index map
+type {{$model.Model}}Repository struct {
+	Store *ddb.DynamodbDataStore[{{$model.Type}}]
+}
+
+// New{{$model.Model}}Repository creates a {{$model.Model}}Repository on top of 'store'
+func New{{$model.Model}}Repository(store *ddb.DynamodbDataStore[{{$model.Type}}]) *{{$model.Model}}Repository {
+	return &{{$model.Model}}Repository{Store: store}
+}
+{{range $m := $model.Methods}}
+// {{$m.Name}} {{$m.Doc}}
+func (r *{{$model.Model}}Repository) {{$m.Name}}(ctx context.Context{{range $m.Params}}, {{.Name}} {{.Type}}{{end}}) ({{if $m.Unique}}*{{$model.Type}}{{else}}[]{{$model.Type}}{{end}}, error) {
+	values := map[string]any{ {{- range $m.Params}}"{{.Macro}}": {{.Name}}, {{end -}} }
+	pk, err := ddb.ExpandTemplate({{printf "%q" $m.PK}}, values)
+	if err != nil {
+		return nil, err
+	}
+{{- if $m.SK}}
+	sk, err := ddb.ExpandTemplate({{printf "%q" $m.SK}}, values)
+	if err != nil {
+		return nil, err
+	}
+{{- end}}
+{{- if $m.Unique}}
+	return r.Store.GetByKey(ctx, pk, sk)
+{{- else}}
+	return r.Store.QueryKey(ctx, ddb.KeyQuery{
+{{- if $m.Index}}
+		IndexName:    {{printf "%q" $m.Index}},
+{{- end}}
+		PartitionKey: pk,
+{{- if $m.SK}}
+		SortKey:      sk,
+{{- else if $m.SKPrefix}}
+		SortKeyPrefix: {{printf "%q" $m.SKPrefix}},
+{{- end}}
+	})
+{{- end}}
+}
+{{end}}
+{{- end}}
+`))
@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestGenerateRepositories(t *testing.T) {
+	defs, err := LoadSpec("testdata/repository.yaml")
+	if err != nil {
+		t.Fatalf("LoadSpec failed: %v", err)
+	}
+
+	src, err := GenerateRepositories(defs, "models")
+	if err != nil {
+		t.Fatalf("GenerateRepositories failed: %v", err)
+	}
+
+	// Output must not depend on map iteration order
+	for i := 0; i < 5; i++ {
+		again, err := GenerateRepositories(defs, "models")
+		if err != nil {
+			t.Fatalf("GenerateRepositories failed: %v", err)
+		}
+		if !bytes.Equal(src, again) {
+			t.Fatal("generated output is not deterministic")
+		}
+	}
+
+	const golden = "testdata/repository.golden"
+	if *updateGolden {
+		if err := os.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("generated repositories differ from %s (run with -update to accept):\n%s", golden, src)
+	}
+}
+
+func TestParamName(t *testing.T) {
+	cases := map[string]string{
+		"ID":        "id",
+		"OrgID":     "orgID",
+		"URLPath":   "urlPath",
+		"email":     "email",
+		"type":      "typeValue",
+		"user_name": "userName",
+	}
+	for in, want := range cases {
+		if got := paramName(in); got != want {
+			t.Errorf("paramName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position identifies a location in a spec file
+type Position struct {
+	File string
+	Line int
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// LoadSpec reads a Swagger 2 or OpenAPI 3 document and returns its model definitions,
+// taken from "definitions" and "components.schemas" respectively. Local and relative-file
+// $refs are resolved and allOf compositions are merged into a single definition.
+func LoadSpec(path string) (map[string]Definition, error) {
+	l := &specLoader{docs: make(map[string]*yaml.Node)}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := l.load(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemas *yaml.Node
+	if mappingValue(root, "openapi") != nil {
+		schemas = mappingValue(mappingValue(root, "components"), "schemas")
+	} else {
+		schemas = mappingValue(root, "definitions")
+	}
+
+	defs := make(map[string]Definition)
+	if schemas == nil {
+		return defs, nil
+	}
+	if schemas.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: schemas must be a mapping", position(abs, schemas))
+	}
+
+	for i := 0; i+1 < len(schemas.Content); i += 2 {
+		name := schemas.Content[i].Value
+		def, err := l.definition(abs, schemas.Content[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+		def.Pos = position(abs, schemas.Content[i])
+		defs[name] = def
+	}
+	return defs, nil
+}
+
+// specLoader caches the documents referenced while loading a spec
+type specLoader struct {
+	docs map[string]*yaml.Node
+}
+
+// load parses a file and returns its root node
+func (l *specLoader) load(path string) (*yaml.Node, error) {
+	if doc, ok := l.docs[path]; ok {
+		return doc, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	root := &doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	l.docs[path] = root
+	return root, nil
+}
+
+// resolve follows $ref chains starting at 'node' in 'file' and returns the target
+func (l *specLoader) resolve(file string, node *yaml.Node) (string, *yaml.Node, error) {
+	seen := make(map[string]bool)
+	for {
+		ref := mappingValue(node, "$ref")
+		if ref == nil {
+			return file, node, nil
+		}
+
+		target, pointer, _ := strings.Cut(ref.Value, "#")
+		if target != "" {
+			file = filepath.Join(filepath.Dir(file), filepath.FromSlash(target))
+		}
+		id := file + "#" + pointer
+		if seen[id] {
+			return "", nil, fmt.Errorf("%s: circular $ref %q", position(file, ref), ref.Value)
+		}
+		seen[id] = true
+
+		doc, err := l.load(file)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: cannot resolve $ref %q: %w", position(file, ref), ref.Value, err)
+		}
+		node, err = lookupPointer(doc, pointer)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: cannot resolve $ref %q: %w", position(file, ref), ref.Value, err)
+		}
+	}
+}
+
+// definition builds a Definition from a schema node, resolving $refs and merging allOf
+func (l *specLoader) definition(file string, node *yaml.Node) (Definition, error) {
+	raw, nodes, err := l.schema(file, node, 0)
+	if err != nil {
+		return Definition{}, err
+	}
+
+	def := Definition{
+		Raw:              raw,
+		VendorExtensions: make(map[string]interface{}),
+		extSrc:           make(map[string]source),
+	}
+	for k, v := range raw {
+		if strings.HasPrefix(k, "x-") {
+			def.VendorExtensions[k] = v
+			def.extSrc[k] = nodes[k]
+		}
+	}
+	return def, nil
+}
+
+// maxAllOfDepth bounds allOf nesting to guard against reference cycles
+const maxAllOfDepth = 32
+
+// source records where a schema key is declared
+type source struct {
+	pos   Position   // Position of the key
+	file  string     // File containing the value
+	value *yaml.Node // Value node
+}
+
+// schema decodes a schema into a map. Parts of an allOf are merged first, then the
+// schema's own keys are applied on top. The returned sources locate each top-level key.
+// Properties given as $refs are replaced by the referenced schema.
+func (l *specLoader) schema(file string, node *yaml.Node, depth int) (map[string]interface{}, map[string]source, error) {
+	if depth > maxAllOfDepth {
+		return nil, nil, fmt.Errorf("%s: allOf nested too deeply", position(file, node))
+	}
+
+	file, node, err := l.resolve(file, node)
+	if err != nil {
+		return nil, nil, err
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s: schema must be a mapping", position(file, node))
+	}
+
+	raw := make(map[string]interface{})
+	nodes := make(map[string]source)
+
+	if allOf := mappingValue(node, "allOf"); allOf != nil {
+		if allOf.Kind != yaml.SequenceNode {
+			return nil, nil, fmt.Errorf("%s: allOf must be a list", position(file, allOf))
+		}
+		for _, part := range allOf.Content {
+			partRaw, partNodes, err := l.schema(file, part, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			mergeSchema(raw, nodes, partRaw, partNodes)
+		}
+	}
+
+	own := make(map[string]interface{})
+	ownNodes := make(map[string]source)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if key == "allOf" || key == "$ref" {
+			continue
+		}
+		var v interface{}
+		if key == "properties" {
+			v, err = l.properties(file, node.Content[i+1])
+		} else {
+			err = node.Content[i+1].Decode(&v)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", position(file, node.Content[i+1]), err)
+		}
+		own[key] = v
+		ownNodes[key] = source{pos: position(file, node.Content[i]), file: file, value: node.Content[i+1]}
+	}
+	mergeSchema(raw, nodes, own, ownNodes)
+
+	return raw, nodes, nil
+}
+
+// mergeSchema merges 'src' into 'dst': properties and required lists are combined,
+// all other keys in 'src' replace those in 'dst'
+func mergeSchema(dst map[string]interface{}, dstNodes map[string]source, src map[string]interface{}, srcNodes map[string]source) {
+	for k, v := range src {
+		switch k {
+		case "properties":
+			props, _ := dst[k].(map[string]interface{})
+			if props == nil {
+				props = make(map[string]interface{})
+			}
+			if srcProps, ok := v.(map[string]interface{}); ok {
+				for name, prop := range srcProps {
+					props[name] = prop
+				}
+			}
+			dst[k] = props
+		case "required":
+			existing, _ := dst[k].([]interface{})
+			seen := make(map[interface{}]bool, len(existing))
+			for _, r := range existing {
+				seen[r] = true
+			}
+			if srcList, ok := v.([]interface{}); ok {
+				for _, r := range srcList {
+					if !seen[r] {
+						existing = append(existing, r)
+						seen[r] = true
+					}
+				}
+			}
+			dst[k] = existing
+		default:
+			dst[k] = v
+		}
+		dstNodes[k] = srcNodes[k]
+	}
+}
+
+// properties decodes a properties mapping, replacing $ref properties by their target
+func (l *specLoader) properties(file string, node *yaml.Node) (map[string]interface{}, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("properties must be a mapping")
+	}
+	props := make(map[string]interface{}, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		refFile, target, err := l.resolve(file, node.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if err := target.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%s: %w", position(refFile, target), err)
+		}
+		props[node.Content[i].Value] = v
+	}
+	return props, nil
+}
+
+// lookupPointer resolves a JSON pointer such as "/components/schemas/User" in 'root'
+func lookupPointer(root *yaml.Node, pointer string) (*yaml.Node, error) {
+	node := root
+	if pointer == "" || pointer == "/" {
+		return node, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node.Kind {
+		case yaml.MappingNode:
+			next := mappingValue(node, token)
+			if next == nil {
+				return nil, fmt.Errorf("%q not found", token)
+			}
+			node = next
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return nil, fmt.Errorf("invalid index %q", token)
+			}
+			node = node.Content[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into %q", token)
+		}
+	}
+	return node, nil
+}
+
+// mappingValue returns the value of 'key' in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func position(file string, node *yaml.Node) Position {
+	if node == nil {
+		return Position{File: file}
+	}
+	return Position{File: file, Line: node.Line}
+}
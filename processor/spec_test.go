@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadSpecSwagger2(t *testing.T) {
+	defs, err := LoadSpec("testdata/swagger2.yaml")
+	if err != nil {
+		t.Fatalf("LoadSpec failed: %v", err)
+	}
+	def, ok := defs["RatingSystem"]
+	if !ok {
+		t.Fatalf("RatingSystem not found in %v", defs)
+	}
+	ixMap := def.VendorExtensions["x-dynamodb-indexmap"].(map[string]interface{})
+	if ixMap["PK"] != "{ID}" {
+		t.Errorf("unexpected index map: %v", ixMap)
+	}
+	if def.Pos.Line != 7 || filepath.Base(def.Pos.File) != "swagger2.yaml" {
+		t.Errorf("unexpected position: %v", def.Pos)
+	}
+}
+
+func TestLoadSpecOpenAPI3(t *testing.T) {
+	defs, err := LoadSpec("testdata/openapi3/api.yaml")
+	if err != nil {
+		t.Fatalf("LoadSpec failed: %v", err)
+	}
+
+	tournament := defs["Tournament"]
+
+	props := tournament.Raw["properties"].(map[string]interface{})
+	var names []string
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"CreatedAt", "ID", "Name", "UpdatedAt", "Venue"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected merged properties %v, got %v", want, names)
+	}
+	if want := []interface{}{"CreatedAt", "ID", "Name"}; !reflect.DeepEqual(tournament.Raw["required"], want) {
+		t.Errorf("expected merged required %v, got %v", want, tournament.Raw["required"])
+	}
+
+	// Extensions are inherited from allOf parts, with their origin preserved
+	if _, ok := tournament.VendorExtensions["x-dynamodb-timestamps"]; !ok {
+		t.Error("expected x-dynamodb-timestamps to be inherited from Auditable")
+	}
+	if pos := tournament.ExtensionPos("x-dynamodb-timestamps"); filepath.Base(pos.File) != "base.yaml" || pos.Line != 13 {
+		t.Errorf("unexpected extension position: %v", pos)
+	}
+	if pos := tournament.ExtensionPos("x-dynamodb-indexmap"); filepath.Base(pos.File) != "api.yaml" || pos.Line != 20 {
+		t.Errorf("unexpected extension position: %v", pos)
+	}
+
+	// A schema that is only a $ref to another file
+	player := defs["Player"]
+	if ixMap, ok := player.VendorExtensions["x-dynamodb-indexmap"].(map[string]interface{}); !ok || ixMap["PK"] != "PLAYER#{ID}" {
+		t.Errorf("expected Player index map from referenced file, got %v", player.VendorExtensions)
+	}
+}
+
+func TestLoadSpecCircularRef(t *testing.T) {
+	_, err := LoadSpec("testdata/circular.yaml")
+	if err == nil || !strings.Contains(err.Error(), "circular $ref") {
+		t.Fatalf("expected circular $ref error, got %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+package processor
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// TagName is the struct tag read by the tags generator. It is placed on any field of a
+// struct type, usually a blank one:
+//
+//	type UserProfile struct {
+//	    _      struct{} `entitystore:"pk=USER#{ID},sk=PROFILE,gsi1pk=EMAIL#{Email},gsi1sk=USER"`
+//	    ID     string
+//	    Email  string
+//	}
+//
+// Keys are pk, sk, gsi<N>pk and gsi<N>sk, the lifecycle options createdAt, updatedAt,
+// version, ttl, ttlAfter and ttlFrom, and the flag validate.
+const TagName = "entitystore"
+
+var gsiTagPattern = regexp.MustCompile(`^gsi(\d+)(pk|sk)$`)
+
+// tagDirectives maps lifecycle tag options to index map directives
+var tagDirectives = map[string]string{
+	"createdAt": "@CreatedAt",
+	"updatedAt": "@UpdatedAt",
+	"version":   "@Version",
+	"ttl":       "@TTL",
+	"ttlAfter":  "@TTLAfter",
+	"ttlFrom":   "@TTLFrom",
+}
+
+// LoadTaggedTypes parses the Go package matching 'patterns', relative to 'dir', and
+// returns its name and a definition for every struct type carrying an entitystore tag.
+// Definition properties are the attribute names of the struct fields, so the result
+// can be checked with ValidateIndexMaps. Packages are parsed but not type checked.
+func LoadTaggedTypes(dir string, patterns ...string) (string, map[string]Definition, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax,
+		Dir:  dir,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	if len(pkgs) != 1 {
+		return "", nil, fmt.Errorf("patterns %v must match exactly one package, matched %d", patterns, len(pkgs))
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		return "", nil, fmt.Errorf("failed to load package %s: %v", pkg.PkgPath, pkg.Errors[0])
+	}
+
+	structs := make(map[string]*ast.StructType)
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok && ts.TypeParams == nil {
+					structs[ts.Name.Name] = st
+				}
+			}
+		}
+	}
+
+	defs := make(map[string]Definition)
+	for name, st := range structs {
+		tag, pos, ok := entityTag(st)
+		if !ok {
+			continue
+		}
+		position := pkg.Fset.Position(pos)
+		ixMap, validate, err := parseEntityTag(tag)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s:%d: %s: %w", position.Filename, position.Line, name, err)
+		}
+
+		extensions := map[string]interface{}{"x-dynamodb-indexmap": ixMap}
+		if validate {
+			extensions["x-dynamodb-validate"] = true
+		}
+		raw := map[string]interface{}{
+			"type":       "object",
+			"properties": structProperties(st, structs, map[string]bool{name: true}),
+		}
+		for k, v := range extensions {
+			raw[k] = v
+		}
+		defs[name] = Definition{
+			Raw:              raw,
+			VendorExtensions: extensions,
+			Pos:              Position{File: position.Filename, Line: position.Line},
+		}
+	}
+	return pkg.Name, defs, nil
+}
+
+// entityTag returns the first entitystore tag among the fields of 'st'
+func entityTag(st *ast.StructType) (string, token.Pos, bool) {
+	for _, field := range st.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			continue
+		}
+		if v, ok := reflect.StructTag(tag).Lookup(TagName); ok {
+			return v, field.Tag.Pos(), true
+		}
+	}
+	return "", token.NoPos, false
+}
+
+// parseEntityTag converts an entitystore tag into an index map
+func parseEntityTag(tag string) (map[string]interface{}, bool, error) {
+	ixMap := make(map[string]interface{})
+	validate := false
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(part, "=")
+		if key == "validate" && !hasValue {
+			validate = true
+			continue
+		}
+		if !hasValue || value == "" {
+			return nil, false, fmt.Errorf("%s option %q requires a value", TagName, key)
+		}
+
+		var entry string
+		switch {
+		case key == "pk" || key == "sk":
+			entry = strings.ToUpper(key)
+		case gsiTagPattern.MatchString(key):
+			m := gsiTagPattern.FindStringSubmatch(key)
+			entry = "GSI" + m[1] + strings.ToUpper(m[2])
+		case tagDirectives[key] != "":
+			entry = tagDirectives[key]
+		default:
+			return nil, false, fmt.Errorf("unknown %s option %q", TagName, key)
+		}
+		if _, dup := ixMap[entry]; dup {
+			return nil, false, fmt.Errorf("duplicate %s option %q", TagName, key)
+		}
+		ixMap[entry] = value
+	}
+	return ixMap, validate, nil
+}
+
+// structProperties describes the fields of 'st' as schema properties keyed by attribute
+// name. Fields of embedded structs declared in the same package are promoted.
+func structProperties(st *ast.StructType, structs map[string]*ast.StructType, visiting map[string]bool) map[string]interface{} {
+	props := make(map[string]interface{})
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			if s, err := strconv.Unquote(field.Tag.Value); err == nil {
+				tag = reflect.StructTag(s)
+			}
+		}
+		attr := strings.Split(tag.Get("dynamodbav"), ",")[0]
+		if attr == "-" {
+			continue
+		}
+
+		if len(field.Names) == 0 {
+			// Embedded field
+			name := typeName(field.Type)
+			if embedded, ok := structs[name]; ok && attr == "" && !visiting[name] {
+				visiting[name] = true
+				for k, v := range structProperties(embedded, structs, visiting) {
+					props[k] = v
+				}
+				delete(visiting, name)
+				continue
+			}
+			if name == "" {
+				continue
+			}
+			props[name] = fieldSchema(field.Type, name)
+			continue
+		}
+
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			name := attr
+			if name == "" {
+				name = ident.Name
+			}
+			props[name] = fieldSchema(field.Type, name)
+		}
+	}
+	return props
+}
+
+// fieldSchema returns the schema of a Go field type, as far as key validation needs it
+func fieldSchema(expr ast.Expr, attr string) map[string]interface{} {
+	schema := map[string]interface{}{"x-go-name": attr}
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.ArrayType:
+		if ident, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && (ident.Name == "byte" || ident.Name == "uint8") {
+			schema["type"], schema["format"] = "string", "byte"
+		} else {
+			schema["type"] = "array"
+		}
+	case *ast.MapType, *ast.StructType, *ast.InterfaceType:
+		schema["type"] = "object"
+	case *ast.Ident:
+		switch {
+		case t.Name == "bool":
+			schema["type"] = "boolean"
+		case strings.HasPrefix(t.Name, "int") || strings.HasPrefix(t.Name, "uint"):
+			schema["type"] = "integer"
+		case strings.HasPrefix(t.Name, "float"):
+			schema["type"] = "number"
+		case t.Name == "any":
+			schema["type"] = "object"
+		default:
+			schema["type"] = "string"
+		}
+	default:
+		// Named types from other packages, e.g. time.Time or strfmt.DateTime
+		schema["type"] = "string"
+	}
+	return schema
+}
+
+// typeName returns the name of an embedded field type
+func typeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return typeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+// TagsMain runs the tags generator with the arguments following the "tags" subcommand
+// and exits. It is meant for go:generate:
+//
+//	//go:generate go run github.com/suparena/entitystore/cmd/indexmap tags -out entitystore_gen.go
+func TagsMain(args []string) {
+	os.Exit(RunTags(args, os.Stdout, os.Stderr))
+}
+
+// RunTags runs the tags generator with 'args' and returns the exit code
+func RunTags(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("tags", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	outputFile := fs.String("out", "entitystore_registration.go", "Path for the generated registration code")
+	pkg := fs.String("package", "", "Package name of the generated code (default the name of the parsed package)")
+	modelImport := fs.String("model-import", "", "Import path of the parsed package, when generating into a different package")
+	modelPackage := fs.String("model-package", "", "Package name of the -model-import package (default derived from the import path)")
+	check := fs.Bool("check", false, "Fail if the generated file is out of date instead of writing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: indexmap tags [flags] [package pattern]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	opts, err := modelOptions(*modelImport, *modelPackage)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	pkgName, defs, err := LoadTaggedTypes("", patterns...)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading Go package: %v\n", err)
+		return 1
+	}
+	if len(defs) == 0 {
+		fmt.Fprintf(stderr, "No struct types with %s tags found in %v\n", TagName, patterns)
+		return 1
+	}
+
+	if diags := ValidateIndexMaps(defs); len(diags) > 0 {
+		for _, d := range diags {
+			fmt.Fprintln(stderr, d)
+		}
+		return 1
+	}
+
+	if *pkg != "" {
+		pkgName = *pkg
+	}
+	src, err := GenerateRegistration(defs, pkgName, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error generating registration code: %v\n", err)
+		return 1
+	}
+	return writeOutputs([]generatedFile{{path: *outputFile, src: src}}, *check, stdout, stderr)
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadTaggedTypes(t *testing.T) {
+	pkg, defs, err := LoadTaggedTypes("testdata/tags", ".")
+	if err != nil {
+		t.Fatalf("LoadTaggedTypes failed: %v", err)
+	}
+	if pkg != "tagged" {
+		t.Errorf("package = %q, want tagged", pkg)
+	}
+	if len(defs) != 2 {
+		t.Fatalf("expected 2 tagged types, got %d", len(defs))
+	}
+
+	profile := defs["UserProfile"]
+	wantIxMap := map[string]interface{}{
+		"PK":         "USER#{ID}",
+		"SK":         "PROFILE",
+		"GSI1PK":     "EMAIL#{Email}",
+		"GSI1SK":     "USER",
+		"@CreatedAt": "CreatedAt",
+		"@UpdatedAt": "UpdatedAt",
+	}
+	if got := profile.VendorExtensions["x-dynamodb-indexmap"]; !reflect.DeepEqual(got, wantIxMap) {
+		t.Errorf("UserProfile index map = %v, want %v", got, wantIxMap)
+	}
+	if profile.VendorExtensions["x-dynamodb-validate"] != true {
+		t.Error("UserProfile should enable schema validation")
+	}
+	if !strings.HasSuffix(profile.Pos.File, "models.go") || profile.Pos.Line != 14 {
+		t.Errorf("UserProfile position = %s", profile.Pos)
+	}
+
+	props := profile.Raw["properties"].(map[string]interface{})
+	for _, name := range []string{"ID", "Email", "Labels", "CreatedAt", "UpdatedAt"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("UserProfile is missing property %s", name)
+		}
+	}
+
+	if diags := ValidateIndexMaps(defs); len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diags)
+	}
+}
+
+func TestGenerateRegistrationFromTags(t *testing.T) {
+	pkg, defs, err := LoadTaggedTypes("testdata/tags", ".")
+	if err != nil {
+		t.Fatalf("LoadTaggedTypes failed: %v", err)
+	}
+	src, err := GenerateRegistration(defs, pkg)
+	if err != nil {
+		t.Fatalf("GenerateRegistration failed: %v", err)
+	}
+
+	out := string(src)
+	for _, want := range []string{
+		"package tagged",
+		"registry.RegisterIndexMap[Session]",
+		`"SESSION#{token}",`,
+		`"24h",`,
+		"registry.EnableSchemaValidation[UserProfile](nil)",
+		`registry.RegisterType("UserProfile"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated code is missing %q", want)
+		}
+	}
+	if strings.Contains(out, "Untagged") {
+		t.Error("untagged types should not be registered")
+	}
+}
+
+func TestRunTags(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "entitystore_gen.go")
+	args := []string{"-out", out, "./testdata/tags"}
+
+	var stdout, stderr bytes.Buffer
+	if code := RunTags(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("RunTags failed with %d: %s", code, stderr.String())
+	}
+	src, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(src), "// Code generated") || !strings.Contains(string(src), "package tagged") {
+		t.Errorf("generated code is not a tagged package registration:\n%s", src)
+	}
+
+	// Regenerating must be a no-op, so -check passes
+	stderr.Reset()
+	if code := RunTags(append([]string{"-check"}, args...), &stdout, &stderr); code != 0 {
+		t.Errorf("-check reported fresh output as stale: %s", stderr.String())
+	}
+	if err := os.WriteFile(out, append(src, "// edited\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if code := RunTags(append([]string{"-check"}, args...), &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "out of date") {
+		t.Errorf("-check should fail for edited output, got %d: %s", code, stderr.String())
+	}
+
+	// Generating into another package imports the models
+	stderr.Reset()
+	code := RunTags([]string{"-out", out, "-package", "store", "-model-import", "example.com/tagged", "./testdata/tags"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("RunTags failed with %d: %s", code, stderr.String())
+	}
+	src, err = os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package store", `"example.com/tagged"`, "registry.RegisterIndexMap[tagged.Session]"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code is missing %q:\n%s", want, src)
+		}
+	}
+
+	for _, args := range [][]string{{"-unknown"}, {"-model-package", "not-a-name", "./testdata/tags"}} {
+		stderr.Reset()
+		if code := RunTags(args, &stdout, &stderr); code != 2 {
+			t.Errorf("RunTags(%q) = %d, want 2: %s", args, code, stderr.String())
+		}
+	}
+}
+
+func TestParseEntityTag(t *testing.T) {
+	ixMap, validate, err := parseEntityTag("pk=ORG#{OrgID}, sk=USER#{ID},gsi2pk=ROLE#{Role},gsi2sk=USER,version=Version")
+	if err != nil {
+		t.Fatalf("parseEntityTag failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"PK":       "ORG#{OrgID}",
+		"SK":       "USER#{ID}",
+		"GSI2PK":   "ROLE#{Role}",
+		"GSI2SK":   "USER",
+		"@Version": "Version",
+	}
+	if !reflect.DeepEqual(ixMap, want) || validate {
+		t.Errorf("parseEntityTag = %v, %v", ixMap, validate)
+	}
+
+	for _, tag := range []string{"pk", "pk=A,pk=B", "partition=A", "sk="} {
+		if _, _, err := parseEntityTag(tag); err == nil {
+			t.Errorf("parseEntityTag(%q) should fail", tag)
+		}
+	}
+}
+
+func TestValidateTaggedTypes(t *testing.T) {
+	defs := map[string]Definition{}
+	ixMap, _, _ := parseEntityTag("pk=USER#{Id},sk=USER")
+	defs["User"] = Definition{
+		Raw: map[string]interface{}{"properties": map[string]interface{}{
+			"ID": map[string]interface{}{"type": "string", "x-go-name": "ID"},
+		}},
+		VendorExtensions: map[string]interface{}{"x-dynamodb-indexmap": ixMap},
+	}
+	diags := ValidateIndexMaps(defs)
+	if len(diags) != 1 || !strings.Contains(diags[0].Message, `did you mean "ID"`) {
+		t.Errorf("unexpected diagnostics: %v", diags)
+	}
+}
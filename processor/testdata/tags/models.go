@@ -0,0 +1,31 @@
+package tagged
+
+import "time"
+
+//go:generate go run github.com/suparena/entitystore/cmd/indexmap tags -out entitystore_gen.go
+
+// Auditable is embedded into tagged types
+type Auditable struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type UserProfile struct {
+	_ struct{} `entitystore:"pk=USER#{ID},sk=PROFILE,gsi1pk=EMAIL#{Email},gsi1sk=USER,createdAt=CreatedAt,updatedAt=UpdatedAt,validate"`
+	Auditable
+	ID     string
+	Email  string `dynamodbav:"Email"`
+	Labels []string
+}
+
+type Session struct {
+	_         struct{} `entitystore:"pk=USER#{UserID},sk=SESSION#{token},ttl=ExpiresAt,ttlAfter=24h"`
+	UserID    string
+	Token     string `dynamodbav:"token"`
+	ExpiresAt int64
+}
+
+// Untagged is ignored
+type Untagged struct {
+	ID string
+}
@@ -0,0 +1,309 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Diagnostic is a problem found in a spec, reported with its source position
+type Diagnostic struct {
+	Pos     Position
+	Model   string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Model, d.Message)
+}
+
+// keySeparator separates key segments. Macro values are assumed not to contain it,
+// which is what keeps differently prefixed templates apart.
+const keySeparator = '#'
+
+// ValidateIndexMaps checks the x-dynamodb-indexmap of every definition:
+//   - every macro names a schema property, by JSON name or Go field name
+//   - key fields have scalar types that expand to non-empty strings
+//   - the table key (PK and SK) is declared
+//   - no two models have table keys that can produce the same item key
+//
+// Diagnostics are sorted by position.
+func ValidateIndexMaps(defs map[string]Definition) []Diagnostic {
+	var diags []Diagnostic
+
+	names := make([]string, 0, len(defs))
+	for name, def := range defs {
+		if _, ok := def.VendorExtensions["x-dynamodb-indexmap"]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	type tableKey struct {
+		model  string
+		pk, sk string
+		pos    Position
+	}
+	var keys []tableKey
+
+	for _, name := range names {
+		def := defs[name]
+		ixMap, err := indexMapOf(def)
+		if err != nil {
+			diags = append(diags, Diagnostic{Pos: def.ExtensionPos("x-dynamodb-indexmap"), Model: name, Message: err.Error()})
+			continue
+		}
+
+		fields := schemaFields(def)
+		entries := make([]string, 0, len(ixMap))
+		for k := range ixMap {
+			entries = append(entries, k)
+		}
+		sort.Strings(entries)
+
+		for _, entry := range entries {
+			pos := def.ExtensionEntryPos("x-dynamodb-indexmap", entry)
+			for _, m := range macroPattern.FindAllStringSubmatch(ixMap[entry], -1) {
+				if msg := checkKeyField(fields, m[1]); msg != "" {
+					diags = append(diags, Diagnostic{
+						Pos:     pos,
+						Model:   name,
+						Message: fmt.Sprintf("%s template %q: %s", entry, ixMap[entry], msg),
+					})
+				}
+			}
+		}
+
+		pk, hasPK := ixMap["PK"]
+		sk, hasSK := ixMap["SK"]
+		if !hasPK || !hasSK {
+			diags = append(diags, Diagnostic{
+				Pos:     def.ExtensionPos("x-dynamodb-indexmap"),
+				Model:   name,
+				Message: "index map must define both PK and SK",
+			})
+			continue
+		}
+		keys = append(keys, tableKey{model: name, pk: pk, sk: sk, pos: def.ExtensionEntryPos("x-dynamodb-indexmap", "PK")})
+	}
+
+	for i := 0; i < len(keys); i++ {
+		for j := i + 1; j < len(keys); j++ {
+			a, b := keys[i], keys[j]
+			if templatesOverlap(a.pk, b.pk) && templatesOverlap(a.sk, b.sk) {
+				diags = append(diags, Diagnostic{
+					Pos:   b.pos,
+					Model: b.model,
+					Message: fmt.Sprintf("key PK=%q SK=%q can collide with %s (PK=%q SK=%q at %s)",
+						b.pk, b.sk, a.model, a.pk, a.sk, a.pos),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Pos.File != diags[j].Pos.File {
+			return diags[i].Pos.File < diags[j].Pos.File
+		}
+		return diags[i].Pos.Line < diags[j].Pos.Line
+	})
+	return diags
+}
+
+// schemaField is a property a macro can refer to
+type schemaField struct {
+	property string
+	schema   map[string]interface{}
+}
+
+// schemaFields indexes the properties of a definition by JSON name and Go field name
+func schemaFields(def Definition) map[string]schemaField {
+	props, _ := def.Raw["properties"].(map[string]interface{})
+	fields := make(map[string]schemaField, 2*len(props))
+	for name, p := range props {
+		schema, _ := p.(map[string]interface{})
+		f := schemaField{property: name, schema: schema}
+		fields[name] = f
+		if goName, ok := schema["x-go-name"].(string); ok && goName != "" {
+			fields[goName] = f
+		} else {
+			fields[goFieldName(name)] = f
+		}
+	}
+	return fields
+}
+
+// checkKeyField returns a description of what is wrong with a macro, or ""
+func checkKeyField(fields map[string]schemaField, macro string) string {
+	f, ok := fields[macro]
+	if !ok {
+		msg := fmt.Sprintf("unknown field %q", macro)
+		if s := suggestField(fields, macro); s != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", s)
+		}
+		return msg
+	}
+
+	typ, _ := f.schema["type"].(string)
+	format, _ := f.schema["format"].(string)
+	switch {
+	case typ == "object" || typ == "array":
+		return fmt.Sprintf("field %q has unsupported key type %s", macro, typ)
+	case typ == "string" && (format == "binary" || format == "byte"):
+		return fmt.Sprintf("field %q has unsupported key format %s", macro, format)
+	case typ == "":
+		if _, hasProps := f.schema["properties"]; hasProps {
+			return fmt.Sprintf("field %q has unsupported key type object", macro)
+		}
+	}
+	return ""
+}
+
+// suggestField returns the field name closest to 'macro', if any is close enough
+func suggestField(fields map[string]schemaField, macro string) string {
+	best, bestDist := "", 3
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.EqualFold(name, macro) {
+			return name
+		}
+		if d := editDistance(name, macro); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// templatesOverlap reports whether two key templates can expand to the same value,
+// treating each macro as any string without the key separator
+func templatesOverlap(a, b string) bool {
+	ta, tb := templateTokens(a), templateTokens(b)
+
+	// reachable[i][j]: prefixes ta[:i] and tb[:j] can produce the same string
+	reachable := make([][]bool, len(ta)+1)
+	for i := range reachable {
+		reachable[i] = make([]bool, len(tb)+1)
+	}
+	reachable[0][0] = true
+	for i := 0; i <= len(ta); i++ {
+		for j := 0; j <= len(tb); j++ {
+			if !reachable[i][j] {
+				continue
+			}
+			// A macro may match the empty string
+			if i < len(ta) && ta[i] == wildcard {
+				reachable[i+1][j] = true
+			}
+			if j < len(tb) && tb[j] == wildcard {
+				reachable[i][j+1] = true
+			}
+			if i < len(ta) && j < len(tb) {
+				switch {
+				case ta[i] == wildcard && tb[j] == wildcard:
+					reachable[i+1][j+1] = true
+				case ta[i] == wildcard && tb[j] != keySeparator:
+					// The macro of a absorbs a character of b
+					reachable[i][j+1] = true
+				case tb[j] == wildcard && ta[i] != keySeparator:
+					reachable[i+1][j] = true
+				case ta[i] == tb[j]:
+					reachable[i+1][j+1] = true
+				}
+			}
+		}
+	}
+	return reachable[len(ta)][len(tb)]
+}
+
+// wildcard stands for a macro in a tokenized template
+const wildcard = -1
+
+// templateTokens splits a template into literal runes and wildcards
+func templateTokens(tmpl string) []rune {
+	var tokens []rune
+	last := 0
+	for _, loc := range macroPattern.FindAllStringIndex(tmpl, -1) {
+		tokens = append(tokens, []rune(tmpl[last:loc[0]])...)
+		tokens = append(tokens, wildcard)
+		last = loc[1]
+	}
+	return append(tokens, []rune(tmpl[last:])...)
+}
+
+// commonInitialisms are the initialisms go-swagger upper-cases in Go field names
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true,
+	"EOF": true, "GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"IP": true, "JSON": true, "LHS": true, "QPS": true, "RAM": true, "RHS": true,
+	"RPC": true, "SLA": true, "SMTP": true, "SQL": true, "SSH": true, "TCP": true,
+	"TLS": true, "TTL": true, "UDP": true, "UI": true, "UID": true, "UUID": true,
+	"URI": true, "URL": true, "UTF8": true, "VM": true, "XML": true, "XMPP": true,
+	"XSRF": true, "XSS": true,
+}
+
+// goFieldName approximates the Go field name go-swagger derives from a property name,
+// e.g. "Id" -> "ID" and "siteUrl" -> "SiteURL"
+func goFieldName(property string) string {
+	var words []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, string(cur))
+			cur = nil
+		}
+	}
+	runes := []rune(property)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && len(cur) > 0:
+			prevLower := unicode.IsLower(cur[len(cur)-1]) || unicode.IsDigit(cur[len(cur)-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (nextLower && unicode.IsUpper(cur[len(cur)-1])) {
+				flush()
+			}
+		}
+		cur = append(cur, r)
+	}
+	flush()
+
+	var b strings.Builder
+	for _, w := range words {
+		upper := strings.ToUpper(w)
+		if commonInitialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		r := []rune(strings.ToLower(w))
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
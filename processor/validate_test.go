@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateIndexMaps(t *testing.T) {
+	defs, err := LoadSpec("testdata/invalid_indexmap.yaml")
+	if err != nil {
+		t.Fatalf("LoadSpec failed: %v", err)
+	}
+
+	var got []string
+	for _, d := range ValidateIndexMaps(defs) {
+		d.Pos.File = filepath.Base(d.Pos.File)
+		got = append(got, d.String())
+	}
+
+	want := []string{
+		`invalid_indexmap.yaml:22: Player: PK template "PLAYER#{Id}": unknown field "Id" (did you mean "ID"?)`,
+		`invalid_indexmap.yaml:23: Player: SK template "TEAM#{TeamIdd}": unknown field "TeamIdd" (did you mean "TeamID"?)`,
+		`invalid_indexmap.yaml:24: Player: GSI1PK template "TAG#{Tags}": field "Tags" has unsupported key type array`,
+		`invalid_indexmap.yaml:25: Player: GSI1SK template "AVATAR#{Avatar}": field "Avatar" has unsupported key format byte`,
+		`invalid_indexmap.yaml:39: Venue: index map must define both PK and SK`,
+	}
+	for _, w := range want {
+		if !contains(got, w) {
+			t.Errorf("missing diagnostic %s\ngot:\n%s", w, strings.Join(got, "\n"))
+		}
+	}
+
+	var collisions []string
+	for _, g := range got {
+		if strings.Contains(g, "can collide") {
+			collisions = append(collisions, g)
+		}
+	}
+	// Coach and Player share PK and SK prefixes; Team differs in PK
+	if len(collisions) != 1 || !strings.Contains(collisions[0], "Player: ") || !strings.Contains(collisions[0], "with Coach") {
+		t.Errorf("unexpected collisions:\n%s", strings.Join(collisions, "\n"))
+	}
+}
+
+func TestValidateIndexMapsValidSpecs(t *testing.T) {
+	for _, file := range []string{"testdata/repository.yaml", "testdata/openapi3/api.yaml", "testdata/swagger2.yaml"} {
+		defs, err := LoadSpec(file)
+		if err != nil {
+			t.Fatalf("LoadSpec(%s) failed: %v", file, err)
+		}
+		for _, d := range ValidateIndexMaps(defs) {
+			t.Errorf("%s: unexpected diagnostic %s", file, d)
+		}
+	}
+}
+
+func TestTemplatesOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"USER#{ID}", "USER#{ID}", true},
+		{"USER#{ID}", "USER#42", true},
+		{"USER#{ID}", "ORG#{ID}", false},
+		{"USER#{ID}", "USER#{OrgID}#{ID}", false},
+		{"USER#{ID}", "USERS", false},
+		{"{Kind}#{ID}", "USER#{ID}", true},
+		{"PROFILE", "PROFILE", true},
+		{"PROFILE", "SETTINGS", false},
+		{"A{X}", "{Y}B", true},
+	}
+	for _, tt := range tests {
+		if got := templatesOverlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("templatesOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := templatesOverlap(tt.b, tt.a); got != tt.want {
+			t.Errorf("templatesOverlap(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestGoFieldName(t *testing.T) {
+	tests := map[string]string{
+		"id":         "ID",
+		"Id":         "ID",
+		"userId":     "UserID",
+		"siteUrl":    "SiteURL",
+		"created_at": "CreatedAt",
+		"HTTPServer": "HTTPServer",
+		"OrgID":      "OrgID",
+	}
+	for in, want := range tests {
+		if got := goFieldName(in); got != want {
+			t.Errorf("goFieldName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -26,5 +26,33 @@ Associates Go types with DynamoDB key patterns:
 
 The registry is thread-safe and should be populated during initialization,
 typically in init() functions or through generated code.
+
+Entity Type Names:
+Items are stored with the Go type name as EntityType unless another name is
+registered. Aliases keep items written under earlier names readable:
+
+	registry.RegisterEntityName[billing.User]("BillingUser", "User")
+
+Schema Versions:
+Upcasters upgrade raw items written by older versions of a model before they
+are unmarshaled. Items carry their version in the SchemaVersion attribute,
+version 1 when absent:
+
+	registry.RegisterUpcaster("User", 1, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	    item["FullName"] = item["Name"]
+	    delete(item, "Name")
+	    return item, nil
+	})
+
+Registry Instances:
+The package-level functions operate on Default(). A separate Registry keeps
+registrations apart, e.g. per test, table or plugin:
+
+	reg := registry.Default().Clone()
+	reg.RegisterIndexMap(reflect.TypeOf(User{}), indexMap)
+	store := ddb.NewDynamodbDataStoreWithClient[User](client, "users", ddb.WithRegistry(reg))
+
+Registrations can be listed with TypeNames and GoTypes and removed with
+Unregister and UnregisterGoType.
 */
 package registry
\ No newline at end of file
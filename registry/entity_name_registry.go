@@ -0,0 +1,150 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RegisterEntityName sets the EntityType name stored for Go type 't' to 'name', instead
+// of the Go type name. Items stored under one of 'aliases', e.g. the name before a
+// rename, are read as 'name'. Registering 't' again replaces its name and aliases.
+func (r *Registry) RegisterEntityName(t reflect.Type, name string, aliases ...string) error {
+	t = derefType(t)
+	if name == "" {
+		return fmt.Errorf("entity name registry: empty name for %s", t)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for other, otherName := range r.entityNames {
+		if other != t && otherName == name {
+			return fmt.Errorf("entity name registry: name %q already registered for %s", name, other)
+		}
+	}
+	if canonical, ok := r.aliases[name]; ok && canonical != r.entityNames[t] {
+		return fmt.Errorf("entity name registry: name %q already registered as an alias of %q", name, canonical)
+	}
+	for _, alias := range aliases {
+		if alias == name {
+			continue
+		}
+		if canonical, ok := r.aliases[alias]; ok && canonical != r.entityNames[t] {
+			return fmt.Errorf("entity name registry: alias %q already registered for %q", alias, canonical)
+		}
+		for other, otherName := range r.entityNames {
+			if other != t && otherName == alias {
+				return fmt.Errorf("entity name registry: alias %q is the name of %s", alias, other)
+			}
+		}
+	}
+
+	r.removeEntityName(t)
+	r.entityNames[t] = name
+	for _, alias := range aliases {
+		if alias != name {
+			r.aliases[alias] = name
+		}
+	}
+	return nil
+}
+
+// EntityTypeName returns the EntityType name of Go type 't': the registered name, or
+// the Go type name. Pointer types have the name of their element type.
+func (r *Registry) EntityTypeName(t reflect.Type) string {
+	t = derefType(t)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name, ok := r.entityNames[t]; ok {
+		return name
+	}
+	return t.Name()
+}
+
+// ResolveEntityType maps an EntityType read from an item of unknown type to its current
+// name: the name an alias was registered for, or 'name' itself. A name registered with
+// RegisterType is kept even when it is also an alias. Reads by a store of a known Go type
+// should use ResolveEntityTypeFor, since that type may store its items under an alias.
+func (r *Registry) ResolveEntityType(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolveEntityType(name)
+}
+
+// ResolveEntityTypeFor maps an EntityType read by a store of Go type 't' to its current
+// name like ResolveEntityType, except that the entity type name of 't' is kept, so that
+// an alias never claims the items of 't' stored under the same name. Typed and
+// polymorphic reads of a store resolve names alike with it.
+func (r *Registry) ResolveEntityTypeFor(t reflect.Type, name string) string {
+	t = derefType(t)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	own, ok := r.entityNames[t]
+	if !ok {
+		own = t.Name()
+	}
+	if name == own {
+		return name
+	}
+	return r.resolveEntityType(name)
+}
+
+// resolveEntityType implements ResolveEntityType; the caller holds the lock
+func (r *Registry) resolveEntityType(name string) string {
+	if _, ok := r.types[name]; ok {
+		return name
+	}
+	if canonical, ok := r.aliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// removeEntityName drops the name and aliases of 't'; the caller holds the lock
+func (r *Registry) removeEntityName(t reflect.Type) bool {
+	name, ok := r.entityNames[t]
+	if !ok {
+		return false
+	}
+	delete(r.entityNames, t)
+	for alias, canonical := range r.aliases {
+		if canonical == name {
+			delete(r.aliases, alias)
+		}
+	}
+	return true
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// RegisterEntityName sets the EntityType name of T in the default registry, with legacy
+// aliases accepted on read. It panics if the name or an alias belongs to another type.
+func RegisterEntityName[T any](name string, aliases ...string) {
+	if err := defaultRegistry.RegisterEntityName(typeOf[T](), name, aliases...); err != nil {
+		panic(err.Error())
+	}
+}
+
+// EntityTypeName returns the EntityType name of T in the default registry
+func EntityTypeName[T any]() string {
+	return defaultRegistry.EntityTypeName(typeOf[T]())
+}
+
+// ResolveEntityType maps an EntityType alias to its current name in the default registry
+func ResolveEntityType(name string) string {
+	return defaultRegistry.ResolveEntityType(name)
+}
+
+// ResolveEntityTypeFor maps an EntityType read by a store of T to its current name in
+// the default registry
+func ResolveEntityTypeFor[T any](name string) string {
+	return defaultRegistry.ResolveEntityTypeFor(typeOf[T](), name)
+}
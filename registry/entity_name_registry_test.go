@@ -0,0 +1,111 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type registryTestMember struct {
+	ID string
+}
+
+func TestEntityNames(t *testing.T) {
+	r := New()
+	userType := reflect.TypeOf(registryTestUser{})
+	memberType := reflect.TypeOf(registryTestMember{})
+
+	if got := r.EntityTypeName(userType); got != "registryTestUser" {
+		t.Errorf("EntityTypeName without registration = %q, want the Go type name", got)
+	}
+	if err := r.RegisterEntityName(userType, "User", "Account", "LegacyUser"); err != nil {
+		t.Fatalf("RegisterEntityName failed: %v", err)
+	}
+	if got := r.EntityTypeName(reflect.PointerTo(userType)); got != "User" {
+		t.Errorf("EntityTypeName(*T) = %q, want User", got)
+	}
+	for _, name := range []string{"User", "Account", "LegacyUser"} {
+		if got := r.ResolveEntityType(name); got != "User" {
+			t.Errorf("ResolveEntityType(%q) = %q, want User", name, got)
+		}
+	}
+	if got := r.ResolveEntityType("Other"); got != "Other" {
+		t.Errorf("ResolveEntityType(Other) = %q", got)
+	}
+
+	// Names and aliases belong to one Go type
+	if err := r.RegisterEntityName(memberType, "User"); err == nil {
+		t.Error("expected an error reusing the name of another type")
+	}
+	if err := r.RegisterEntityName(memberType, "Account"); err == nil {
+		t.Error("expected an error using an alias of another type as name")
+	}
+	if err := r.RegisterEntityName(memberType, "Member", "LegacyUser"); err == nil {
+		t.Error("expected an error reusing an alias of another type")
+	}
+	if err := r.RegisterEntityName(memberType, "Member", "User"); err == nil {
+		t.Error("expected an error using the name of another type as alias")
+	}
+
+	// Registering again replaces the name and aliases
+	if err := r.RegisterEntityName(userType, "Customer", "User"); err != nil {
+		t.Fatalf("RegisterEntityName failed: %v", err)
+	}
+	if got := r.ResolveEntityType("Account"); got != "Account" {
+		t.Errorf("replaced alias still resolves to %q", got)
+	}
+	if got := r.ResolveEntityType("User"); got != "Customer" {
+		t.Errorf("ResolveEntityType(User) = %q, want Customer", got)
+	}
+
+	c := r.Clone()
+	if !r.UnregisterGoType(userType) {
+		t.Error("UnregisterGoType reported no registration")
+	}
+	if got := r.EntityTypeName(userType); got != "registryTestUser" {
+		t.Errorf("EntityTypeName after UnregisterGoType = %q", got)
+	}
+	if got := c.EntityTypeName(userType); got != "Customer" {
+		t.Errorf("clone EntityTypeName = %q, want Customer", got)
+	}
+}
+
+func TestResolveEntityTypeFor(t *testing.T) {
+	r := New()
+	userType := reflect.TypeOf(registryTestUser{})
+	memberType := reflect.TypeOf(registryTestMember{})
+
+	if err := r.RegisterEntityName(userType, "BillingUser", "User"); err != nil {
+		t.Fatalf("RegisterEntityName failed: %v", err)
+	}
+	if got := r.ResolveEntityTypeFor(userType, "User"); got != "BillingUser" {
+		t.Errorf("ResolveEntityTypeFor(owner, User) = %q, want BillingUser", got)
+	}
+	if got := r.ResolveEntityTypeFor(reflect.PointerTo(userType), "User"); got != "BillingUser" {
+		t.Errorf("ResolveEntityTypeFor(*owner, User) = %q, want BillingUser", got)
+	}
+	// Other types resolve aliases like ResolveEntityType, except for their own name
+	if got := r.ResolveEntityTypeFor(memberType, "User"); got != "BillingUser" {
+		t.Errorf("ResolveEntityTypeFor(other, User) = %q, want BillingUser", got)
+	}
+	type User struct{}
+	if got := r.ResolveEntityTypeFor(reflect.TypeOf(User{}), "User"); got != "User" {
+		t.Errorf("ResolveEntityTypeFor(type named User, User) = %q, want User", got)
+	}
+
+	// Without a type, a name registered with RegisterType is not taken for an alias
+	if got := r.ResolveEntityType("User"); got != "BillingUser" {
+		t.Errorf("ResolveEntityType(User) = %q, want BillingUser", got)
+	}
+	r.RegisterType("User", func(item map[string]types.AttributeValue) (interface{}, error) {
+		return item, nil
+	})
+	if got := r.ResolveEntityType("User"); got != "User" {
+		t.Errorf("ResolveEntityType(User) = %q, want the registered type", got)
+	}
+}
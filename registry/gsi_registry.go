@@ -0,0 +1,37 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+// GSIKeys names the key attributes of a global secondary index
+type GSIKeys struct {
+	PartitionKey string // Partition key attribute, e.g. "PK2"
+	SortKey      string // Sort key attribute, e.g. "SK2"
+}
+
+// RegisterGSI declares the key attributes of the global secondary index 'indexName'
+func (r *Registry) RegisterGSI(indexName, partitionKey, sortKey string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gsis[indexName] = GSIKeys{PartitionKey: partitionKey, SortKey: sortKey}
+}
+
+// GetGSI returns the key attributes registered for 'indexName'
+func (r *Registry) GetGSI(indexName string) (GSIKeys, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys, ok := r.gsis[indexName]
+	return keys, ok
+}
+
+// RegisterGSI declares the key attributes of the global secondary index 'indexName'.
+// The logical keys GSI<N>PK and GSI<N>SK of an index map are written to these attributes.
+func RegisterGSI(indexName, partitionKey, sortKey string) {
+	defaultRegistry.RegisterGSI(indexName, partitionKey, sortKey)
+}
+
+// GetGSI returns the key attributes registered for 'indexName'
+func GetGSI(indexName string) (GSIKeys, bool) {
+	return defaultRegistry.GetGSI(indexName)
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+import (
+	"context"
+	"reflect"
+)
+
+// Hooks holds lifecycle callbacks for entity type T. It is the registry-based
+// alternative to implementing the hook interfaces of the datastore package, for
+// types (such as generated models) that cannot be given extra methods.
+// Any field may be nil.
+type Hooks[T any] struct {
+	// BeforePut runs before the entity is written and may modify it
+	BeforePut func(ctx context.Context, entity *T) error
+	// AfterLoad runs after the entity has been read and unmarshaled
+	AfterLoad func(ctx context.Context, entity *T) error
+	// BeforeDelete runs before the entity with the given key is deleted. 'entity' is
+	// the stored entity, or nil if it does not exist.
+	BeforeDelete func(ctx context.Context, key string, entity *T) error
+	// Validate runs after BeforePut; its errors are reported as validation errors
+	Validate func(entity *T) error
+}
+
+// EntityHooks is the type-erased form of Hooks used by datastore implementations.
+// The entity arguments are pointers to the registered type.
+type EntityHooks struct {
+	BeforePut    func(ctx context.Context, entity any) error
+	AfterLoad    func(ctx context.Context, entity any) error
+	BeforeDelete func(ctx context.Context, key string, entity any) error
+	Validate     func(entity any) error
+}
+
+// NewEntityHooks converts typed hooks into their type-erased form, for registering
+// them with Registry.RegisterHooks
+func NewEntityHooks[T any](hooks Hooks[T]) EntityHooks {
+	var erased EntityHooks
+	if hooks.BeforePut != nil {
+		erased.BeforePut = func(ctx context.Context, entity any) error {
+			return hooks.BeforePut(ctx, entity.(*T))
+		}
+	}
+	if hooks.AfterLoad != nil {
+		erased.AfterLoad = func(ctx context.Context, entity any) error {
+			return hooks.AfterLoad(ctx, entity.(*T))
+		}
+	}
+	if hooks.BeforeDelete != nil {
+		erased.BeforeDelete = func(ctx context.Context, key string, entity any) error {
+			return hooks.BeforeDelete(ctx, key, entity.(*T))
+		}
+	}
+	if hooks.Validate != nil {
+		erased.Validate = func(entity any) error {
+			return hooks.Validate(entity.(*T))
+		}
+	}
+	return erased
+}
+
+// RegisterHooks associates lifecycle hooks with Go type 't', replacing any previous registration
+func (r *Registry) RegisterHooks(t reflect.Type, hooks EntityHooks) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks[t] = hooks
+}
+
+// GetHooksForType returns the hooks registered for the given (non-pointer) type, if any.
+func (r *Registry) GetHooksForType(t reflect.Type) (EntityHooks, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.hooks[t]
+	return h, ok
+}
+
+// RegisterHooks associates lifecycle hooks with type T, replacing any previous registration.
+func RegisterHooks[T any](hooks Hooks[T]) {
+	defaultRegistry.RegisterHooks(typeOf[T](), NewEntityHooks(hooks))
+}
+
+// GetHooks returns the hooks registered for type T, if any.
+func GetHooks[T any]() (EntityHooks, bool) {
+	return defaultRegistry.GetHooksForType(typeOf[T]())
+}
+
+// GetHooksForType returns the hooks registered for the given (non-pointer) type, if any.
+func GetHooksForType(t reflect.Type) (EntityHooks, bool) {
+	return defaultRegistry.GetHooksForType(t)
+}
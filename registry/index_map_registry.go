@@ -5,34 +5,32 @@
 package registry
 
 import (
+	"maps"
 	"reflect"
-	"sync"
 )
 
-// IndexMapRegistry is a registry for Go types and their DynamoDB index maps.
+// RegisterIndexMap associates Go type 't' with a copy of a DynamoDB index map (PK, SK,
+// etc.), replacing any previous one
+func (r *Registry) RegisterIndexMap(t reflect.Type, idxMap map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.indexMaps[t] = maps.Clone(idxMap)
+}
 
-var (
-	indexMapRegistry = make(map[reflect.Type]map[string]string)
-	mu               sync.RWMutex
-)
+// GetIndexMap retrieves a copy of the index map of Go type 't', if any
+func (r *Registry) GetIndexMap(t reflect.Type) (map[string]string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.indexMaps[t]
+	return maps.Clone(m), ok
+}
 
 // RegisterIndexMap associates a Go type T with a given DynamoDB index map (PK, SK, etc.).
 func RegisterIndexMap[T any](idxMap map[string]string) {
-	var zero T
-	t := reflect.TypeOf(zero)
-
-	mu.Lock()
-	defer mu.Unlock()
-	indexMapRegistry[t] = idxMap
+	defaultRegistry.RegisterIndexMap(typeOf[T](), idxMap)
 }
 
 // GetIndexMap retrieves the indexMap for type T, if any.
 func GetIndexMap[T any]() (map[string]string, bool) {
-	var zero T
-	t := reflect.TypeOf(zero)
-
-	mu.RLock()
-	defer mu.RUnlock()
-	m, ok := indexMapRegistry[t]
-	return m, ok
+	return defaultRegistry.GetIndexMap(typeOf[T]())
 }
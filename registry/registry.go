@@ -0,0 +1,176 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+import (
+	"maps"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/go-openapi/strfmt"
+)
+
+// Registry holds the registrations datastores rely on: unmarshal functions and upcasters
+// by entity type name, and index maps, hooks and schema validation by Go type, plus GSI key
+// attributes. It is safe for concurrent use.
+//
+// The package-level functions operate on Default(). Separate instances allow tests,
+// tables or plugins to keep their registrations apart.
+type Registry struct {
+	mu         sync.RWMutex
+	types      map[string]UnmarshalFunc
+	indexMaps  map[reflect.Type]map[string]string
+	hooks      map[reflect.Type]EntityHooks
+	validation map[reflect.Type]strfmt.Registry
+	gsis       map[string]GSIKeys
+	upcasters  map[string]map[int]Upcaster
+	// entityNames are EntityType names registered for Go types, aliases map legacy
+	// names to them
+	entityNames map[reflect.Type]string
+	aliases     map[string]string
+}
+
+// New creates an empty Registry
+func New() *Registry {
+	return &Registry{
+		types:       make(map[string]UnmarshalFunc),
+		indexMaps:   make(map[reflect.Type]map[string]string),
+		hooks:       make(map[reflect.Type]EntityHooks),
+		validation:  make(map[reflect.Type]strfmt.Registry),
+		gsis:        make(map[string]GSIKeys),
+		upcasters:   make(map[string]map[int]Upcaster),
+		entityNames: make(map[reflect.Type]string),
+		aliases:     make(map[string]string),
+	}
+}
+
+var defaultRegistry = New()
+
+// Default returns the registry used by the package-level functions and by datastores
+// constructed without a registry
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// OrDefault returns 'r', or Default() when 'r' is nil
+func OrDefault(r *Registry) *Registry {
+	if r == nil {
+		return defaultRegistry
+	}
+	return r
+}
+
+// Clone returns an independent copy of the registry, e.g. for a test to extend
+// the default registrations without affecting other tests
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := New()
+	for k, v := range r.types {
+		c.types[k] = v
+	}
+	for k, v := range r.indexMaps {
+		c.indexMaps[k] = maps.Clone(v)
+	}
+	for k, v := range r.hooks {
+		c.hooks[k] = v
+	}
+	for k, v := range r.validation {
+		c.validation[k] = v
+	}
+	for k, v := range r.gsis {
+		c.gsis[k] = v
+	}
+	for k, v := range r.entityNames {
+		c.entityNames[k] = v
+	}
+	for k, v := range r.aliases {
+		c.aliases[k] = v
+	}
+	for k, chain := range r.upcasters {
+		c.upcasters[k] = make(map[int]Upcaster, len(chain))
+		for v, fn := range chain {
+			c.upcasters[k][v] = fn
+		}
+	}
+	return c
+}
+
+// Unregister removes the entity type registered under 'name' and its upcasters.
+// It reports whether the name was registered.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.types[name]
+	_, hasUpcasters := r.upcasters[name]
+	delete(r.types, name)
+	delete(r.upcasters, name)
+	return ok || hasUpcasters
+}
+
+// UnregisterGoType removes the index map, hooks, schema validation and entity name of
+// Go type 't'. It reports whether any of them was registered.
+func (r *Registry) UnregisterGoType(t reflect.Type) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, hasIndexMap := r.indexMaps[t]
+	_, hasHooks := r.hooks[t]
+	_, hasValidation := r.validation[t]
+	delete(r.indexMaps, t)
+	delete(r.hooks, t)
+	delete(r.validation, t)
+	hasName := r.removeEntityName(t)
+	return hasIndexMap || hasHooks || hasValidation || hasName
+}
+
+// TypeNames returns the registered entity type names, sorted
+func (r *Registry) TypeNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GoTypes returns the Go types with an index map, hooks, schema validation or an
+// entity name, sorted by name
+func (r *Registry) GoTypes() []reflect.Type {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[reflect.Type]bool)
+	for t := range r.indexMaps {
+		seen[t] = true
+	}
+	for t := range r.hooks {
+		seen[t] = true
+	}
+	for t := range r.validation {
+		seen[t] = true
+	}
+	for t := range r.entityNames {
+		seen[t] = true
+	}
+	types := make([]reflect.Type, 0, len(seen))
+	for t := range seen {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].String() < types[j].String() })
+	return types
+}
+
+// Unregister removes the entity type registered under 'name' from the default registry
+func Unregister(name string) bool {
+	return defaultRegistry.Unregister(name)
+}
+
+// typeOf returns the reflect.Type of T, also for interface types
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type registryTestUser struct {
+	ID string
+}
+
+type registryTestOrder struct {
+	ID string
+}
+
+func unmarshalNothing(item map[string]types.AttributeValue) (interface{}, error) {
+	return nil, nil
+}
+
+func TestRegistryRegisterType(t *testing.T) {
+	r := New()
+	if err := r.RegisterType("User", unmarshalNothing); err != nil {
+		t.Fatalf("RegisterType failed: %v", err)
+	}
+	if err := r.RegisterType("User", unmarshalNothing); err == nil {
+		t.Error("expected an error registering a duplicate type")
+	}
+	if _, err := r.GetUnmarshalFunc("User"); err != nil {
+		t.Errorf("GetUnmarshalFunc failed: %v", err)
+	}
+
+	if !r.Unregister("User") {
+		t.Error("Unregister reported the type as not registered")
+	}
+	if r.Unregister("User") {
+		t.Error("Unregister reported a removed type as registered")
+	}
+	if _, err := r.GetUnmarshalFunc("User"); err == nil {
+		t.Error("expected an error for an unregistered type")
+	}
+	if err := r.RegisterType("User", unmarshalNothing); err != nil {
+		t.Errorf("RegisterType after Unregister failed: %v", err)
+	}
+}
+
+func TestRegistryIntrospection(t *testing.T) {
+	r := New()
+	r.RegisterType("Order", unmarshalNothing)
+	r.RegisterType("User", unmarshalNothing)
+	r.RegisterIndexMap(reflect.TypeOf(registryTestUser{}), map[string]string{"PK": "USER#{ID}", "SK": "USER"})
+	r.RegisterHooks(reflect.TypeOf(registryTestOrder{}), NewEntityHooks(Hooks[registryTestOrder]{}))
+
+	if got, want := r.TypeNames(), []string{"Order", "User"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TypeNames() = %v, want %v", got, want)
+	}
+	want := []reflect.Type{reflect.TypeOf(registryTestOrder{}), reflect.TypeOf(registryTestUser{})}
+	if got := r.GoTypes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GoTypes() = %v, want %v", got, want)
+	}
+
+	if !r.UnregisterGoType(reflect.TypeOf(registryTestUser{})) {
+		t.Error("UnregisterGoType reported the type as not registered")
+	}
+	if _, ok := r.GetIndexMap(reflect.TypeOf(registryTestUser{})); ok {
+		t.Error("index map still registered after UnregisterGoType")
+	}
+}
+
+func TestRegistryClone(t *testing.T) {
+	r := New()
+	userType := reflect.TypeOf(registryTestUser{})
+	r.RegisterType("User", unmarshalNothing)
+	r.RegisterIndexMap(userType, map[string]string{"PK": "USER#{ID}", "SK": "USER"})
+	r.RegisterGSI("GSI4", "PK4", "SK4")
+
+	c := r.Clone()
+	c.RegisterType("Order", unmarshalNothing)
+	c.Unregister("User")
+	m, _ := c.GetIndexMap(userType)
+	m["SK"] = "CHANGED"
+
+	if got := r.TypeNames(); !reflect.DeepEqual(got, []string{"User"}) {
+		t.Errorf("original TypeNames() = %v after changing the clone", got)
+	}
+	if m, _ := r.GetIndexMap(userType); m["SK"] != "USER" {
+		t.Errorf("original index map changed through the clone: %v", m)
+	}
+	if keys, ok := c.GetGSI("GSI4"); !ok || keys.PartitionKey != "PK4" {
+		t.Errorf("clone GSI4 = %+v, %v", keys, ok)
+	}
+}
+
+func TestRegistryIndexMapCopies(t *testing.T) {
+	r := New()
+	userType := reflect.TypeOf(registryTestUser{})
+	idxMap := map[string]string{"PK": "USER#{ID}", "SK": "USER"}
+	r.RegisterIndexMap(userType, idxMap)
+
+	idxMap["SK"] = "CHANGED"
+	m, _ := r.GetIndexMap(userType)
+	m["createdAt"] = "CreatedAt"
+
+	want := map[string]string{"PK": "USER#{ID}", "SK": "USER"}
+	if got, _ := r.GetIndexMap(userType); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetIndexMap() = %v after changing the registered and returned maps, want %v", got, want)
+	}
+}
+
+func TestRegistryConcurrentUse(t *testing.T) {
+	r := New()
+	userType := reflect.TypeOf(registryTestUser{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("Type%d", i)
+			for j := 0; j < 100; j++ {
+				r.RegisterType(name, unmarshalNothing)
+				r.GetUnmarshalFunc(name)
+				r.RegisterIndexMap(userType, map[string]string{"PK": name, "SK": name})
+				r.GetIndexMap(userType)
+				r.RegisterGSI(name, "PK", "SK")
+				r.TypeNames()
+				r.GoTypes()
+				r.Clone()
+				r.Unregister(name)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if names := r.TypeNames(); len(names) != 0 {
+		t.Errorf("expected all types to be unregistered, got %v", names)
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	if OrDefault(nil) != Default() {
+		t.Error("OrDefault(nil) must return the default registry")
+	}
+	r := New()
+	if OrDefault(r) != r {
+		t.Error("OrDefault(r) must return r")
+	}
+
+	RegisterType("registryTestDefault", unmarshalNothing)
+	defer Unregister("registryTestDefault")
+	if _, err := Default().GetUnmarshalFunc("registryTestDefault"); err != nil {
+		t.Errorf("package RegisterType did not register in the default registry: %v", err)
+	}
+}
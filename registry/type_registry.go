@@ -9,24 +9,39 @@ import (
 // UnmarshalFunc defines a function that takes a raw DynamoDB item and returns the unmarshaled object.
 type UnmarshalFunc func(item map[string]types.AttributeValue) (interface{}, error)
 
-// typeRegistry holds the mapping from a type prefix (like "PL", "DR", etc.) to its unmarshal function.
-var typeRegistry = make(map[string]UnmarshalFunc)
+// RegisterType registers an unmarshal function for the entity type 'name'.
+// It fails if the name is already registered; use Unregister first to replace it.
+func (r *Registry) RegisterType(name string, fn UnmarshalFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.types[name]; exists {
+		return fmt.Errorf("type registry: type with prefix %q already registered", name)
+	}
+	r.types[name] = fn
+	return nil
+}
+
+// GetUnmarshalFunc returns the unmarshal function registered for the entity type 'name'
+func (r *Registry) GetUnmarshalFunc(name string) (UnmarshalFunc, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, ok := r.types[name]
+	if !ok {
+		return nil, fmt.Errorf("type registry: no type registered for prefix %q", name)
+	}
+	return fn, nil
+}
 
-// RegisterType registers an unmarshal function for a given type prefix.
+// RegisterType registers an unmarshal function for a given type prefix in the default registry.
 // If a type is already registered for the given prefix, it panics to prevent accidental overrides.
 func RegisterType(prefix string, fn UnmarshalFunc) {
-	if _, exists := typeRegistry[prefix]; exists {
-		panic(fmt.Sprintf("type registry: type with prefix %q already registered", prefix))
+	if err := defaultRegistry.RegisterType(prefix, fn); err != nil {
+		panic(err.Error())
 	}
-	typeRegistry[prefix] = fn
 }
 
 // GetUnmarshalFunc returns the registered unmarshal function for the given type prefix.
 // If no function is registered, it returns an error.
 func GetUnmarshalFunc(prefix string) (UnmarshalFunc, error) {
-	fn, ok := typeRegistry[prefix]
-	if !ok {
-		return nil, fmt.Errorf("type registry: no type registered for prefix %q", prefix)
-	}
-	return fn, nil
+	return defaultRegistry.GetUnmarshalFunc(prefix)
 }
@@ -0,0 +1,178 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SchemaVersionAttribute is the item attribute holding the schema version an item was
+// written with. Items without it are at version 1.
+const SchemaVersionAttribute = "SchemaVersion"
+
+// Upcaster transforms a raw item from one schema version to the next, e.g. by renaming
+// or splitting attributes. It may modify and return 'item'.
+type Upcaster func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+
+// RegisterUpcaster registers 'fn' to upgrade items of 'entityType' from 'fromVersion' to
+// fromVersion+1. The current schema version of the entity type becomes one more than the
+// highest registered 'fromVersion'.
+func (r *Registry) RegisterUpcaster(entityType string, fromVersion int, fn Upcaster) error {
+	if fromVersion < 1 {
+		return fmt.Errorf("upcaster registry: invalid version %d for %q, versions start at 1", fromVersion, entityType)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.upcasters[entityType][fromVersion]; exists {
+		return fmt.Errorf("upcaster registry: upcaster from version %d of %q already registered", fromVersion, entityType)
+	}
+	if r.upcasters[entityType] == nil {
+		r.upcasters[entityType] = make(map[int]Upcaster)
+	}
+	r.upcasters[entityType][fromVersion] = fn
+	return nil
+}
+
+// SchemaVersion returns the current schema version of 'entityType'. It reports false
+// when no upcasters are registered for it.
+func (r *Registry) SchemaVersion(entityType string) (int, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return currentVersion(r.upcasters[entityType])
+}
+
+// Upcast upgrades a raw item of 'entityType' to the current schema version and sets its
+// SchemaVersion attribute. 'item' itself is not modified. It reports whether the item was
+// upgraded; items already at the current version, or at a newer one, are returned as is.
+func (r *Registry) Upcast(entityType string, item map[string]types.AttributeValue) (map[string]types.AttributeValue, bool, error) {
+	r.mu.RLock()
+	chain := r.upcasters[entityType]
+	current, ok := currentVersion(chain)
+	upcasters := make(map[int]Upcaster, len(chain))
+	for v, fn := range chain {
+		upcasters[v] = fn
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return item, false, nil
+	}
+
+	version, err := ItemSchemaVersion(item)
+	if err != nil {
+		return nil, false, err
+	}
+	if version >= current {
+		return item, false, nil
+	}
+
+	upgraded := make(map[string]types.AttributeValue, len(item)+1)
+	for k, v := range item {
+		upgraded[k] = copyAttributeValue(v)
+	}
+	for v := version; v < current; v++ {
+		fn, ok := upcasters[v]
+		if !ok {
+			return nil, false, fmt.Errorf("upcaster registry: no upcaster from version %d of %q", v, entityType)
+		}
+		if upgraded, err = fn(upgraded); err != nil {
+			return nil, false, fmt.Errorf("upcaster registry: failed to upgrade %q from version %d: %w", entityType, v, err)
+		}
+		if upgraded == nil {
+			return nil, false, fmt.Errorf("upcaster registry: upcaster from version %d of %q returned no item", v, entityType)
+		}
+	}
+	upgraded[SchemaVersionAttribute] = &types.AttributeValueMemberN{Value: strconv.Itoa(current)}
+	return upgraded, true, nil
+}
+
+// ItemSchemaVersion returns the SchemaVersion attribute of a raw item, or 1 without it
+func ItemSchemaVersion(item map[string]types.AttributeValue) (int, error) {
+	attr, ok := item[SchemaVersionAttribute]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := attr.(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, fmt.Errorf("upcaster registry: %s attribute must be a number", SchemaVersionAttribute)
+	}
+	version, err := strconv.Atoi(n.Value)
+	if err != nil {
+		return 0, fmt.Errorf("upcaster registry: invalid %s %q: %w", SchemaVersionAttribute, n.Value, err)
+	}
+	return version, nil
+}
+
+// currentVersion returns one more than the highest version 'chain' upgrades from
+func currentVersion(chain map[int]Upcaster) (int, bool) {
+	if len(chain) == 0 {
+		return 0, false
+	}
+	highest := 0
+	for v := range chain {
+		highest = max(highest, v)
+	}
+	return highest + 1, true
+}
+
+// RegisterUpcaster registers 'fn' in the default registry to upgrade items of 'entityType'
+// from 'fromVersion' to fromVersion+1. It panics on invalid or duplicate registrations.
+func RegisterUpcaster(entityType string, fromVersion int, fn Upcaster) {
+	if err := defaultRegistry.RegisterUpcaster(entityType, fromVersion, fn); err != nil {
+		panic(err.Error())
+	}
+}
+
+// SchemaVersion returns the current schema version of 'entityType' in the default registry
+func SchemaVersion(entityType string) (int, bool) {
+	return defaultRegistry.SchemaVersion(entityType)
+}
+
+// Upcast upgrades a raw item of 'entityType' with the upcasters of the default registry
+func Upcast(entityType string, item map[string]types.AttributeValue) (map[string]types.AttributeValue, bool, error) {
+	return defaultRegistry.Upcast(entityType, item)
+}
+
+// copyAttributeValue returns a deep copy of 'av', so that upcasters can modify nested
+// maps, lists and sets without changing the item they were given
+func copyAttributeValue(av types.AttributeValue) types.AttributeValue {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberM:
+		m := make(map[string]types.AttributeValue, len(v.Value))
+		for k, e := range v.Value {
+			m[k] = copyAttributeValue(e)
+		}
+		return &types.AttributeValueMemberM{Value: m}
+	case *types.AttributeValueMemberL:
+		l := make([]types.AttributeValue, len(v.Value))
+		for i, e := range v.Value {
+			l[i] = copyAttributeValue(e)
+		}
+		return &types.AttributeValueMemberL{Value: l}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string(nil), v.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string(nil), v.Value...)}
+	case *types.AttributeValueMemberBS:
+		bs := make([][]byte, len(v.Value))
+		for i, b := range v.Value {
+			bs[i] = append([]byte(nil), b...)
+		}
+		return &types.AttributeValueMemberBS{Value: bs}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte(nil), v.Value...)}
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: v.Value}
+	}
+	return av
+}
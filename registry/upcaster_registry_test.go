@@ -0,0 +1,137 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func renameAttribute(from, to string) Upcaster {
+	return func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		if v, ok := item[from]; ok {
+			item[to] = v
+			delete(item, from)
+		}
+		return item, nil
+	}
+}
+
+func TestUpcast(t *testing.T) {
+	r := New()
+	if _, ok := r.SchemaVersion("Customer"); ok {
+		t.Error("expected no schema version without upcasters")
+	}
+	if err := r.RegisterUpcaster("Customer", 1, renameAttribute("Name", "FullName")); err != nil {
+		t.Fatalf("RegisterUpcaster failed: %v", err)
+	}
+	if err := r.RegisterUpcaster("Customer", 2, renameAttribute("Mail", "Email")); err != nil {
+		t.Fatalf("RegisterUpcaster failed: %v", err)
+	}
+	if err := r.RegisterUpcaster("Customer", 2, renameAttribute("Mail", "Email")); err == nil {
+		t.Error("expected an error registering a duplicate upcaster")
+	}
+	if err := r.RegisterUpcaster("Customer", 0, renameAttribute("A", "B")); err == nil {
+		t.Error("expected an error registering version 0")
+	}
+	if v, ok := r.SchemaVersion("Customer"); !ok || v != 3 {
+		t.Fatalf("SchemaVersion = %d, %v, want 3", v, ok)
+	}
+
+	item := map[string]types.AttributeValue{
+		"Name": &types.AttributeValueMemberS{Value: "Ada"},
+		"Mail": &types.AttributeValueMemberS{Value: "ada@example.com"},
+	}
+	upgraded, ok, err := r.Upcast("Customer", item)
+	if err != nil || !ok {
+		t.Fatalf("Upcast = %v, %v", ok, err)
+	}
+	if _, stillThere := item["Name"]; !stillThere {
+		t.Error("Upcast modified its input")
+	}
+	if s, _ := upgraded["FullName"].(*types.AttributeValueMemberS); s == nil || s.Value != "Ada" {
+		t.Errorf("FullName = %v", upgraded["FullName"])
+	}
+	if s, _ := upgraded["Email"].(*types.AttributeValueMemberS); s == nil || s.Value != "ada@example.com" {
+		t.Errorf("Email = %v", upgraded["Email"])
+	}
+	if v, err := ItemSchemaVersion(upgraded); err != nil || v != 3 {
+		t.Errorf("ItemSchemaVersion = %d, %v, want 3", v, err)
+	}
+
+	// Items at version 2 only run the second upcaster
+	item = map[string]types.AttributeValue{
+		"Name":                 &types.AttributeValueMemberS{Value: "kept"},
+		"Mail":                 &types.AttributeValueMemberS{Value: "b@example.com"},
+		SchemaVersionAttribute: &types.AttributeValueMemberN{Value: "2"},
+	}
+	upgraded, _, _ = r.Upcast("Customer", item)
+	if _, ok := upgraded["Name"]; !ok {
+		t.Error("upcaster from version 1 ran on a version 2 item")
+	}
+
+	// Current items are returned as is
+	if _, ok, err := r.Upcast("Customer", upgraded); ok || err != nil {
+		t.Errorf("Upcast of a current item = %v, %v", ok, err)
+	}
+	if _, ok, err := r.Upcast("Other", item); ok || err != nil {
+		t.Errorf("Upcast without upcasters = %v, %v", ok, err)
+	}
+}
+
+func TestUpcastErrors(t *testing.T) {
+	r := New()
+	r.RegisterUpcaster("Gap", 2, renameAttribute("A", "B"))
+	if _, _, err := r.Upcast("Gap", map[string]types.AttributeValue{}); err == nil {
+		t.Error("expected an error for a missing upcaster from version 1")
+	}
+
+	failure := errors.New("boom")
+	r.RegisterUpcaster("Failing", 1, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		return nil, failure
+	})
+	if _, _, err := r.Upcast("Failing", map[string]types.AttributeValue{}); !errors.Is(err, failure) {
+		t.Errorf("expected the upcaster error, got %v", err)
+	}
+
+	bad := map[string]types.AttributeValue{SchemaVersionAttribute: &types.AttributeValueMemberS{Value: "1"}}
+	if _, _, err := r.Upcast("Failing", bad); err == nil {
+		t.Error("expected an error for a non-numeric schema version")
+	}
+}
+
+func TestUpcastCopiesNestedAttributes(t *testing.T) {
+	r := New()
+	err := r.RegisterUpcaster("Order", 1, func(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+		address := item["Address"].(*types.AttributeValueMemberM)
+		address.Value["Country"] = &types.AttributeValueMemberS{Value: "US"}
+		lines := item["Lines"].(*types.AttributeValueMemberL)
+		lines.Value[0] = &types.AttributeValueMemberS{Value: "changed"}
+		return item, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterUpcaster failed: %v", err)
+	}
+
+	item := map[string]types.AttributeValue{
+		"Address": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"City": &types.AttributeValueMemberS{Value: "Springfield"},
+		}},
+		"Lines": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "original"},
+		}},
+	}
+	if _, ok, err := r.Upcast("Order", item); err != nil || !ok {
+		t.Fatalf("Upcast = %v, %v", ok, err)
+	}
+	if _, ok := item["Address"].(*types.AttributeValueMemberM).Value["Country"]; ok {
+		t.Error("upcaster modified a nested map of the original item")
+	}
+	if s := item["Lines"].(*types.AttributeValueMemberL).Value[0].(*types.AttributeValueMemberS).Value; s != "original" {
+		t.Errorf("upcaster modified a nested list of the original item: %q", s)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright © 2025 Suparena Software Inc., All rights reserved.
+ */
+
+package registry
+
+import (
+	"reflect"
+
+	"github.com/go-openapi/strfmt"
+)
+
+// EnableSchemaValidation makes datastores call Validate(formats) on entities of Go type
+// 't' before writing them. A nil registry means strfmt.Default.
+func (r *Registry) EnableSchemaValidation(t reflect.Type, formats strfmt.Registry) {
+	if formats == nil {
+		formats = strfmt.Default
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.validation[t] = formats
+}
+
+// DisableSchemaValidation turns schema validation for Go type 't' off again
+func (r *Registry) DisableSchemaValidation(t reflect.Type) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.validation, t)
+}
+
+// GetSchemaValidation returns the format registry to validate the given type with,
+// or false if schema validation is not enabled for it.
+func (r *Registry) GetSchemaValidation(t reflect.Type) (strfmt.Registry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	formats, ok := r.validation[t]
+	return formats, ok
+}
+
+// EnableSchemaValidation makes datastores call Validate(formats) on entities of type T
+// before writing them, as generated by go-swagger. A nil registry means strfmt.Default.
+func EnableSchemaValidation[T any](formats strfmt.Registry) {
+	defaultRegistry.EnableSchemaValidation(typeOf[T](), formats)
+}
+
+// DisableSchemaValidation turns schema validation for type T off again
+func DisableSchemaValidation[T any]() {
+	defaultRegistry.DisableSchemaValidation(typeOf[T]())
+}
+
+// GetSchemaValidation returns the format registry to validate the given type with,
+// or false if schema validation is not enabled for it.
+func GetSchemaValidation(t reflect.Type) (strfmt.Registry, bool) {
+	return defaultRegistry.GetSchemaValidation(t)
+}